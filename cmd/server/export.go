@@ -0,0 +1,92 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/service"
+)
+
+const exportUsage = `usage:
+  shrink export links [-format csv|ndjson] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-o FILE]
+  shrink export clicks [-format csv|ndjson] [-from YYYY-MM-DD] [-to YYYY-MM-DD] [-o FILE]`
+
+// operatorKey is the identity exports run under from the command line. Whoever
+// can run the binary can read the database, so it sees every owner's links.
+var operatorKey = &domain.APIKey{Name: "cli", Admin: true}
+
+// runExport implements the "export" subcommand for dumping analytics.
+func runExport(svc *service.URLService, args []string) error {
+	if len(args) == 0 {
+		return errors.New(exportUsage)
+	}
+
+	var run func(context.Context, *domain.APIKey, domain.ExportRequest, io.Writer) error
+	switch args[0] {
+	case "links":
+		run = svc.ExportLinks
+	case "clicks":
+		run = svc.ExportClicks
+	default:
+		return errors.New(exportUsage)
+	}
+
+	fs := flag.NewFlagSet("export "+args[0], flag.ContinueOnError)
+	format := fs.String("format", domain.FormatCSV, "output format: csv or ndjson")
+	from := fs.String("from", "", "first UTC day to include (YYYY-MM-DD)")
+	to := fs.String("to", "", "last UTC day to include (YYYY-MM-DD)")
+	output := fs.String("o", "", "write to FILE instead of standard output")
+	if err := fs.Parse(args[1:]); err != nil {
+		return err
+	}
+	if fs.NArg() != 0 {
+		return errors.New(exportUsage)
+	}
+
+	req := domain.ExportRequest{Format: *format}
+	var err error
+	if req.From, err = parseDay(*from); err != nil {
+		return fmt.Errorf("invalid -from: %w", err)
+	}
+	if req.To, err = parseDay(*to); err != nil {
+		return fmt.Errorf("invalid -to: %w", err)
+	}
+
+	out := os.Stdout
+	if *output != "" {
+		if out, err = os.Create(*output); err != nil {
+			return err
+		}
+	}
+
+	w := bufio.NewWriter(out)
+	err = run(context.Background(), operatorKey, req, w)
+	if ferr := w.Flush(); err == nil {
+		err = ferr
+	}
+	if *output != "" {
+		if cerr := out.Close(); err == nil {
+			err = cerr
+		}
+	}
+	return err
+}
+
+// parseDay parses an optional YYYY-MM-DD flag value as a UTC day.
+func parseDay(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
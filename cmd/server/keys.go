@@ -0,0 +1,79 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"strconv"
+	"text/tabwriter"
+
+	"github.com/devaloi/shrink/internal/service"
+)
+
+const keysUsage = `usage:
+  shrink keys create [-admin] NAME
+  shrink keys list
+  shrink keys revoke ID`
+
+// runKeys implements the "keys" subcommand for managing API keys.
+func runKeys(svc *service.KeyService, args []string) error {
+	if len(args) == 0 {
+		return errors.New(keysUsage)
+	}
+
+	switch args[0] {
+	case "create":
+		fs := flag.NewFlagSet("keys create", flag.ContinueOnError)
+		admin := fs.Bool("admin", false, "allow the key to manage every link")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 1 {
+			return errors.New(keysUsage)
+		}
+
+		secret, key, err := svc.Create(context.Background(), fs.Arg(0), *admin)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Created key %d (%s). Store it now; it will not be shown again:\n%s\n", key.ID, key.Name, secret)
+		return nil
+
+	case "list":
+		keys, err := svc.List(context.Background())
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "ID\tNAME\tPREFIX\tADMIN\tCREATED\tREVOKED")
+		for _, key := range keys {
+			revoked := "-"
+			if key.RevokedAt != nil {
+				revoked = key.RevokedAt.Format("2006-01-02")
+			}
+			fmt.Fprintf(tw, "%d\t%s\t%s\t%t\t%s\t%s\n",
+				key.ID, key.Name, key.Prefix, key.Admin, key.CreatedAt.Format("2006-01-02"), revoked)
+		}
+		return tw.Flush()
+
+	case "revoke":
+		if len(args) != 2 {
+			return errors.New(keysUsage)
+		}
+		id, err := strconv.ParseInt(args[1], 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid key id %q", args[1])
+		}
+		if err := svc.Revoke(context.Background(), id); err != nil {
+			return err
+		}
+		fmt.Printf("Revoked key %d\n", id)
+		return nil
+
+	default:
+		return errors.New(keysUsage)
+	}
+}
@@ -3,20 +3,30 @@ package main
 import (
 	"context"
 	"database/sql"
+	"fmt"
 	"log"
+	"net"
 	"net/http"
 	"os"
 	"os/signal"
 	"syscall"
 	"time"
+	_ "time/tzdata" // time series accept any IANA zone, even without system tzdata
 
 	_ "github.com/mattn/go-sqlite3"
 
+	"github.com/devaloi/shrink/internal/codegen"
 	"github.com/devaloi/shrink/internal/config"
+	"github.com/devaloi/shrink/internal/encoding"
 	"github.com/devaloi/shrink/internal/handler"
 	"github.com/devaloi/shrink/internal/middleware"
+	"github.com/devaloi/shrink/internal/recorder"
 	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/retention"
 	"github.com/devaloi/shrink/internal/service"
+	"github.com/devaloi/shrink/internal/statscache"
+	"github.com/devaloi/shrink/internal/stream"
+	"github.com/devaloi/shrink/internal/webhook"
 )
 
 // Server timeout constants.
@@ -25,6 +35,10 @@ const (
 	WriteTimeout    = 15 * time.Second
 	IdleTimeout     = 60 * time.Second
 	ShutdownTimeout = 10 * time.Second
+
+	// StopTimeout bounds flushing queued clicks and stopping the
+	// background workers once the server has shut down.
+	StopTimeout = 10 * time.Second
 )
 
 func main() {
@@ -39,13 +53,7 @@ func run() error {
 		return err
 	}
 
-	log.Printf("Starting shrink server...")
-	log.Printf("Port: %d", cfg.Port)
-	log.Printf("Database: %s", cfg.DatabaseURL)
-	log.Printf("Base URL: %s", cfg.BaseURL)
-	log.Printf("Rate limit: %.0f req/s, burst: %d", cfg.RateLimit, cfg.RateBurst)
-
-	db, err := sql.Open("sqlite3", cfg.DatabaseURL)
+	db, repo, err := openDB(cfg)
 	if err != nil {
 		return err
 	}
@@ -55,17 +63,123 @@ func run() error {
 		}
 	}()
 
+	// The migrate command inspects and moves the schema itself, so it runs
+	// before the database is brought up to date.
+	if len(os.Args) > 1 && os.Args[1] == "migrate" {
+		return runMigrate(db, os.Args[2:])
+	}
+	if err := repo.Migrate(); err != nil {
+		return err
+	}
+
+	keySvc := service.NewKeyService(repo)
+
+	if len(os.Args) > 1 {
+		switch os.Args[1] {
+		case "keys":
+			return runKeys(keySvc, os.Args[2:])
+		case "export":
+			return runExport(service.NewURLService(repo, cfg.BaseURL), os.Args[2:])
+		default:
+			return fmt.Errorf("unknown command %q", os.Args[1])
+		}
+	}
+
+	return serve(cfg, db, repo, keySvc)
+}
+
+// openDB opens the configured database.
+func openDB(cfg *config.Config) (*sql.DB, *repository.SQLite, error) {
+	db, err := sql.Open("sqlite3", cfg.DatabaseURL)
+	if err != nil {
+		return nil, nil, err
+	}
+
 	if _, err := db.Exec("PRAGMA journal_mode=WAL"); err != nil {
 		log.Printf("Warning: could not enable WAL mode: %v", err)
 	}
 
-	repo := repository.NewSQLite(db)
-	if err := repo.Migrate(); err != nil {
-		return err
+	codes, err := codegen.New(cfg.CodeStrategy, codeCodec(cfg), cfg.CodeLength, cfg.CodeSecret)
+	if err != nil {
+		_ = db.Close()
+		return nil, nil, err
+	}
+
+	repo := repository.NewSQLite(db,
+		repository.WithQueryTimeout(cfg.QueryTimeout),
+		repository.WithCodeGenerator(codes),
+	)
+	return db, repo, nil
+}
+
+// codeCodec returns the codec short codes are written with.
+func codeCodec(cfg *config.Config) *encoding.Codec {
+	codec, _ := encoding.Named(cfg.CodeAlphabet)
+	if cfg.CodeCheckChar {
+		codec = codec.WithCheckChar()
+	}
+	return codec
+}
+
+func serve(cfg *config.Config, db *sql.DB, repo *repository.SQLite, keySvc *service.KeyService) error {
+	log.Printf("Starting shrink server...")
+	log.Printf("Port: %d", cfg.Port)
+	log.Printf("Database: %s", cfg.DatabaseURL)
+	log.Printf("Base URL: %s", cfg.BaseURL)
+	log.Printf("Rate limit: %.0f req/s, burst: %d", cfg.RateLimit, cfg.RateBurst)
+	log.Printf("Default redirect status: %d", cfg.RedirectStatus)
+	log.Printf("Code strategy: %s (%s)", cfg.CodeStrategy, cfg.CodeAlphabet)
+
+	webhookSvc := service.NewWebhookService(repo, repo, cfg.BaseURL)
+	deliveries := webhook.New(repo,
+		webhook.WithPollInterval(cfg.WebhookPollInterval),
+		webhook.WithMaxAttempts(cfg.WebhookMaxAttempts),
+	)
+
+	clicks := recorder.New(repo,
+		recorder.WithQueueSize(cfg.ClickQueueSize),
+		recorder.WithBatchSize(cfg.ClickBatchSize),
+		recorder.WithFlushInterval(cfg.ClickFlushInterval),
+		recorder.WithFlushHook(webhookSvc.ClicksRecorded),
+	)
+
+	live := stream.NewBroker()
+
+	var stats *statscache.Cache
+	if cfg.StatsRefreshInterval > 0 {
+		stats = statscache.New(statscache.WithInterval(cfg.StatsRefreshInterval))
+	}
+
+	opts := []service.Option{
+		service.WithMaxBatchSize(cfg.BatchMax),
+		service.WithDefaultRedirect(cfg.RedirectStatus),
+		service.WithClickRecorder(clicks),
+		service.WithNotifier(webhookSvc),
+		service.WithClickStream(live),
+		service.WithStatsLocation(cfg.StatsLocation),
+		service.WithCodec(codeCodec(cfg)),
+	}
+	if stats != nil {
+		opts = append(opts, service.WithStatsCache(stats))
 	}
+	if cfg.IPHashSalt != "" {
+		opts = append(opts, service.WithIPSalt(cfg.IPHashSalt))
+	} else {
+		log.Printf("Warning: IP_HASH_SALT is not set; click IP hashes will change on restart")
+	}
+	svc := service.NewURLService(repo, cfg.BaseURL, opts...)
 
-	svc := service.NewURLService(repo, cfg.BaseURL)
+	// The retention job also announces links that expire unvisited, so it
+	// runs even when raw clicks are kept forever.
+	rollups := retention.New(repo, cfg.ClickRetentionDays,
+		retention.WithInterval(cfg.RollupInterval),
+		retention.WithExpirySweep(svc.SweepExpired),
+	)
+	if cfg.ClickRetentionDays > 0 {
+		log.Printf("Click retention: %d days", cfg.ClickRetentionDays)
+	}
 	h := handler.New(svc, db)
+	wh := handler.NewWebhookHandler(webhookSvc)
 
 	rateLimiter := middleware.NewRateLimiter(cfg.RateLimit, cfg.RateBurst)
 
@@ -75,23 +189,52 @@ func run() error {
 		middleware.Recovery,
 		middleware.CORS(middleware.DefaultCORSConfig()),
 		rateLimiter.Middleware,
+		middleware.APIKeyAuth(keySvc),
 	)
 
 	mux := http.NewServeMux()
 
 	mux.HandleFunc("POST /api/shorten", h.CreateShortURL)
+	mux.HandleFunc("POST /api/shorten/batch", h.CreateShortURLBatch)
 	mux.HandleFunc("GET /api/health", h.HealthCheck)
 	mux.HandleFunc("GET /api/stats", h.GlobalStats)
+	mux.HandleFunc("GET /api/urls", h.ListURLs)
 	mux.HandleFunc("GET /api/urls/{code}", h.GetStats)
+	mux.HandleFunc("PATCH /api/urls/{code}", h.UpdateURL)
+	mux.HandleFunc("DELETE /api/urls/{code}", h.DeleteURL)
+	mux.HandleFunc("GET /api/urls/{code}/timeseries", h.GetTimeSeries)
+	mux.HandleFunc("GET /api/urls/{code}/breakdown", h.GetBreakdown)
+	mux.HandleFunc("GET /api/urls/{code}/visitors", h.GetVisitors)
+	mux.HandleFunc("GET /api/urls/{code}/revisions", h.ListRevisions)
+	mux.HandleFunc("POST /api/urls/{code}/revisions/{id}/rollback", h.RollbackRevision)
+	mux.HandleFunc("POST /api/urls/{code}/disable", h.DisableURL)
+	mux.HandleFunc("POST /api/urls/{code}/enable", h.EnableURL)
+	mux.HandleFunc("GET /api/urls/{code}/events", streaming(h.StreamClicks))
+	mux.HandleFunc("GET /api/events", streaming(h.StreamAllClicks))
+	mux.HandleFunc("GET /api/export/links", streaming(h.ExportLinks))
+	mux.HandleFunc("GET /api/export/clicks", streaming(h.ExportClicks))
+	mux.HandleFunc("POST /api/webhooks", wh.CreateWebhook)
+	mux.HandleFunc("GET /api/webhooks", wh.ListWebhooks)
+	mux.HandleFunc("DELETE /api/webhooks/{id}", wh.DeleteWebhook)
+	mux.HandleFunc("GET /api/webhooks/{id}/dead-letters", wh.ListDeadLetters)
 	mux.HandleFunc("GET /{code}", h.Redirect)
 
+	// Request contexts derive from base, which is canceled once shutdown
+	// gives up waiting, so queries still running are abandoned with it.
+	base, cancelBase := context.WithCancel(context.Background())
+	defer cancelBase()
+
 	srv := &http.Server{
 		Addr:         cfg.Addr(),
 		Handler:      chain(mux),
 		ReadTimeout:  ReadTimeout,
 		WriteTimeout: WriteTimeout,
 		IdleTimeout:  IdleTimeout,
+		BaseContext:  func(net.Listener) context.Context { return base },
 	}
+	// Shutdown does not wait for open event streams on its own; closing the
+	// broker ends them.
+	srv.RegisterOnShutdown(live.Close)
 
 	go func() {
 		log.Printf("Server listening on %s", cfg.Addr())
@@ -109,10 +252,48 @@ func run() error {
 	ctx, cancel := context.WithTimeout(context.Background(), ShutdownTimeout)
 	defer cancel()
 
-	if err := srv.Shutdown(ctx); err != nil {
-		return err
+	shutdownErr := srv.Shutdown(ctx)
+	cancelBase()
+
+	// Every handler has returned (or the deadline passed), so no more
+	// clicks are coming; write out the ones still queued. Stopping the
+	// workers gets a deadline of its own, since Shutdown may have used up
+	// ctx. The recorder has stopped writing once Close returns, before the
+	// database is closed.
+	stopCtx, cancelStop := context.WithTimeout(context.Background(), StopTimeout)
+	defer cancelStop()
+	if err := clicks.Close(stopCtx); err != nil {
+		log.Printf("Error flushing click queue: %v", err)
+	}
+	// Undelivered webhook events stay in the outbox for the next start.
+	if err := deliveries.Close(stopCtx); err != nil {
+		log.Printf("Error stopping webhook worker: %v", err)
+	}
+	if err := rollups.Close(stopCtx); err != nil {
+		log.Printf("Error stopping click rollups: %v", err)
+	}
+	if stats != nil {
+		if err := stats.Close(stopCtx); err != nil {
+			log.Printf("Error stopping stats refresh: %v", err)
+		}
+	}
+
+	if shutdownErr != nil {
+		return shutdownErr
 	}
 
 	log.Println("Server stopped")
 	return nil
 }
+
+// streaming lifts the server's WriteTimeout for a long-lived response such as
+// an event stream or a large export, which would otherwise be cut off after
+// WriteTimeout.
+func streaming(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if err := http.NewResponseController(w).SetWriteDeadline(time.Time{}); err != nil {
+			log.Printf("Error clearing write deadline: %v", err)
+		}
+		next(w, r)
+	}
+}
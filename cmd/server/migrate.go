@@ -0,0 +1,95 @@
+package main
+
+import (
+	"database/sql"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"text/tabwriter"
+
+	"github.com/devaloi/shrink/internal/migrate"
+	"github.com/devaloi/shrink/migrations"
+)
+
+const migrateUsage = `usage:
+  shrink migrate status
+  shrink migrate up
+  shrink migrate down [-n STEPS]`
+
+// runMigrate implements the "migrate" subcommand for inspecting and moving
+// the database schema between versions.
+func runMigrate(db *sql.DB, args []string) error {
+	if len(args) == 0 {
+		return errors.New(migrateUsage)
+	}
+
+	all, err := migrate.Load(migrations.FS)
+	if err != nil {
+		return err
+	}
+	runner := migrate.New(db, all)
+
+	switch args[0] {
+	case "status":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		status, err := runner.Status()
+		if err != nil {
+			return err
+		}
+
+		tw := tabwriter.NewWriter(os.Stdout, 0, 4, 2, ' ', 0)
+		fmt.Fprintln(tw, "VERSION\tNAME\tAPPLIED")
+		for _, s := range status {
+			applied := "pending"
+			if s.AppliedAt != nil {
+				applied = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Fprintf(tw, "%03d\t%s\t%s\n", s.Version, s.Name, applied)
+		}
+		return tw.Flush()
+
+	case "up":
+		if len(args) != 1 {
+			return errors.New(migrateUsage)
+		}
+		applied, err := runner.Up()
+		for _, m := range applied {
+			fmt.Printf("Applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(applied) == 0 {
+			fmt.Println("Database is up to date")
+		}
+		return nil
+
+	case "down":
+		fs := flag.NewFlagSet("migrate down", flag.ContinueOnError)
+		steps := fs.Int("n", 1, "number of migrations to revert")
+		if err := fs.Parse(args[1:]); err != nil {
+			return err
+		}
+		if fs.NArg() != 0 || *steps < 1 {
+			return errors.New(migrateUsage)
+		}
+
+		reverted, err := runner.Down(*steps)
+		for _, m := range reverted {
+			fmt.Printf("Reverted %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			return err
+		}
+		if len(reverted) == 0 {
+			fmt.Println("No migrations to revert")
+		}
+		return nil
+
+	default:
+		return errors.New(migrateUsage)
+	}
+}
@@ -2,4 +2,4 @@ module github.com/devaloi/shrink
 
 go 1.25.0
 
-require github.com/mattn/go-sqlite3 v1.14.34 // indirect
+require github.com/mattn/go-sqlite3 v1.14.34
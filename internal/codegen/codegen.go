@@ -0,0 +1,233 @@
+// Package codegen assigns short codes to new links. Sequential codes are the
+// row ID written with a codec; random and permuted codes cannot be walked to
+// discover every link.
+package codegen
+
+import (
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"math/big"
+	"math/bits"
+
+	"github.com/devaloi/shrink/internal/encoding"
+)
+
+// Strategy names, as accepted by the CODE_STRATEGY setting.
+const (
+	StrategySequential = "sequential"
+	StrategyRandom     = "random"
+	StrategyPermuted   = "permuted"
+)
+
+// Code length bounds for random and permuted codes, not counting a check
+// character. 62^10 is the largest power of 62 that fits in an int64, so
+// their codecs may have at most maxBase characters.
+const (
+	MinLength = 4
+	MaxLength = 10
+
+	maxBase = 62
+)
+
+// feistelRounds is the number of rounds of the permutation's Feistel network.
+const feistelRounds = 4
+
+// ErrOutOfRange is returned for IDs or codes a generator cannot map.
+var ErrOutOfRange = errors.New("out of range for code generator")
+
+// Generator derives the code for a new link. When a code is already taken,
+// the link is retried under the next row ID, so Code must not return the
+// same code for different IDs except by chance.
+type Generator interface {
+	Code(id int64) (string, error)
+}
+
+// New returns the generator for a strategy, writing codes with codec.
+// length is the length of random codes and the minimum length of permuted
+// ones; secret keys the permutation.
+func New(strategy string, codec *encoding.Codec, length int, secret string) (Generator, error) {
+	switch strategy {
+	case StrategySequential:
+		return NewSequential(codec), nil
+	case StrategyRandom:
+		return NewRandom(codec, length)
+	case StrategyPermuted:
+		return NewPermuted(codec, secret, length)
+	default:
+		return nil, fmt.Errorf("unknown code strategy %q", strategy)
+	}
+}
+
+// Sequential writes the row ID with its codec, so codes grow one by one.
+type Sequential struct {
+	codec *encoding.Codec
+}
+
+// NewSequential creates a Sequential generator writing codes with codec.
+func NewSequential(codec *encoding.Codec) *Sequential {
+	return &Sequential{codec: codec}
+}
+
+// Code returns id written with the codec.
+func (s *Sequential) Code(id int64) (string, error) {
+	if id < 0 {
+		return "", ErrOutOfRange
+	}
+	return s.codec.Encode(id), nil
+}
+
+// Random draws codes of a fixed length from a cryptographic source and
+// ignores the row ID. Collisions are resolved by the caller's retry.
+type Random struct {
+	codec *encoding.Codec
+	space *big.Int
+	width int
+}
+
+// NewRandom creates a Random generator of codes with length characters,
+// written with codec.
+func NewRandom(codec *encoding.Codec, length int) (*Random, error) {
+	if err := check(codec, length); err != nil {
+		return nil, err
+	}
+	return &Random{codec: codec, space: big.NewInt(pow(codec.Base(), length)), width: length}, nil
+}
+
+// Code returns a new random code.
+func (r *Random) Code(int64) (string, error) {
+	n, err := rand.Int(rand.Reader, r.space)
+	if err != nil {
+		return "", fmt.Errorf("generate random code: %w", err)
+	}
+	return r.codec.EncodePadded(n.Int64(), r.width), nil
+}
+
+// Permuted maps row IDs to codes with a keyed permutation, so codes look
+// random to anyone without the secret but never collide with each other,
+// and ID recovers the row ID from a code.
+//
+// IDs are split into tiers by code length: with a codec of base N, the
+// first N^minLength IDs get codes of minLength characters, the next
+// N^(minLength+1) get one character more, and so on. Within a tier, a
+// Feistel network keyed with the secret permutes the ID across every code
+// of that length.
+type Permuted struct {
+	codec     *encoding.Codec
+	key       []byte
+	minLength int
+}
+
+// NewPermuted creates a Permuted generator keyed with secret whose codes are
+// written with codec and at least minLength characters long.
+func NewPermuted(codec *encoding.Codec, secret string, minLength int) (*Permuted, error) {
+	if secret == "" {
+		return nil, errors.New("permuted codes need a secret")
+	}
+	if err := check(codec, minLength); err != nil {
+		return nil, err
+	}
+	return &Permuted{codec: codec, key: []byte(secret), minLength: minLength}, nil
+}
+
+// Code returns the code for id.
+func (p *Permuted) Code(id int64) (string, error) {
+	if id < 0 {
+		return "", ErrOutOfRange
+	}
+
+	n := id
+	for length := p.minLength; length <= MaxLength; length++ {
+		size := pow(p.codec.Base(), length)
+		if n < size {
+			return p.codec.EncodePadded(p.permute(n, size, length, false), length), nil
+		}
+		n -= size
+	}
+	return "", ErrOutOfRange
+}
+
+// ID returns the row ID whose code is code.
+func (p *Permuted) ID(code string) (int64, error) {
+	length := len(code)
+	if p.codec.HasCheckChar() {
+		length--
+	}
+	if length < p.minLength || length > MaxLength {
+		return 0, ErrOutOfRange
+	}
+	v, err := p.codec.Decode(code)
+	if err != nil {
+		return 0, err
+	}
+
+	var offset int64
+	for l := p.minLength; l < length; l++ {
+		offset += pow(p.codec.Base(), l)
+	}
+	return offset + p.permute(v, pow(p.codec.Base(), length), length, true), nil
+}
+
+// permute applies the tier's Feistel network, or its inverse, to x in
+// [0, size). The network permutes a power-of-two range covering size;
+// results outside size are fed through again until they land inside it,
+// which keeps the mapping a permutation of [0, size).
+func (p *Permuted) permute(x, size int64, tier int, inverse bool) int64 {
+	width := bits.Len64(uint64(size - 1))
+	width += width % 2
+	half := uint(width / 2)
+	mask := uint64(1)<<half - 1
+
+	v := uint64(x)
+	for {
+		l, r := v>>half, v&mask
+		if inverse {
+			for round := feistelRounds - 1; round >= 0; round-- {
+				l, r = r^(p.round(round, tier, l)&mask), l
+			}
+		} else {
+			for round := 0; round < feistelRounds; round++ {
+				l, r = r, l^(p.round(round, tier, r)&mask)
+			}
+		}
+		v = l<<half | r
+		if v < uint64(size) {
+			return int64(v)
+		}
+	}
+}
+
+// round is the Feistel round function: an HMAC of the half block, keyed
+// with the secret and bound to the round and tier.
+func (p *Permuted) round(round, tier int, half uint64) uint64 {
+	var msg [10]byte
+	msg[0] = byte(round)
+	msg[1] = byte(tier)
+	binary.BigEndian.PutUint64(msg[2:], half)
+
+	mac := hmac.New(sha256.New, p.key)
+	mac.Write(msg[:])
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+func check(codec *encoding.Codec, length int) error {
+	if codec.Base() > maxBase {
+		return fmt.Errorf("code alphabet must have at most %d characters", maxBase)
+	}
+	if length < MinLength || length > MaxLength {
+		return fmt.Errorf("code length must be between %d and %d", MinLength, MaxLength)
+	}
+	return nil
+}
+
+// pow returns base^n.
+func pow(base, n int) int64 {
+	v := int64(1)
+	for i := 0; i < n; i++ {
+		v *= int64(base)
+	}
+	return v
+}
@@ -0,0 +1,151 @@
+package codegen
+
+import (
+	"testing"
+
+	"github.com/devaloi/shrink/internal/encoding"
+)
+
+func TestSequential(t *testing.T) {
+	code, err := NewSequential(encoding.Base62).Code(62)
+	if err != nil {
+		t.Fatalf("code: %v", err)
+	}
+	if code != "ba" {
+		t.Errorf("expected ba, got %q", code)
+	}
+}
+
+func TestRandom(t *testing.T) {
+	gen, err := NewRandom(encoding.Base62, 7)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	seen := make(map[string]bool)
+	for i := 0; i < 100; i++ {
+		code, err := gen.Code(1)
+		if err != nil {
+			t.Fatalf("code: %v", err)
+		}
+		if len(code) != 7 {
+			t.Errorf("expected 7 characters, got %q", code)
+		}
+		seen[code] = true
+	}
+	if len(seen) < 99 {
+		t.Errorf("expected distinct codes, got %d of 100", len(seen))
+	}
+}
+
+func TestPermuted(t *testing.T) {
+	gen, err := NewPermuted(encoding.Base62, "secret", 4)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	seen := make(map[string]int64)
+	for id := int64(0); id < 2000; id++ {
+		code, err := gen.Code(id)
+		if err != nil {
+			t.Fatalf("code %d: %v", id, err)
+		}
+		if len(code) != 4 {
+			t.Errorf("expected 4 characters for ID %d, got %q", id, code)
+		}
+		if other, ok := seen[code]; ok {
+			t.Fatalf("IDs %d and %d share code %q", other, id, code)
+		}
+		seen[code] = id
+
+		back, err := gen.ID(code)
+		if err != nil || back != id {
+			t.Errorf("ID(%q) = %d, %v, want %d", code, back, err, id)
+		}
+	}
+
+	first, _ := gen.Code(1)
+	second, _ := gen.Code(2)
+	if first == "aaab" || second == "aaac" {
+		t.Errorf("expected codes not to follow the IDs, got %q and %q", first, second)
+	}
+
+	other, err := NewPermuted(encoding.Base62, "another secret", 4)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+	if code, _ := other.Code(1); code == first {
+		t.Errorf("expected the secret to change the codes, got %q for both", code)
+	}
+}
+
+func TestPermuted_Tiers(t *testing.T) {
+	gen, err := NewPermuted(encoding.Base62, "secret", 4)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	for _, id := range []int64{pow(62, 4) - 1, pow(62, 4), pow(62, 4) + pow(62, 5), pow(62, MaxLength)} {
+		code, err := gen.Code(id)
+		if err != nil {
+			t.Fatalf("code %d: %v", id, err)
+		}
+		back, err := gen.ID(code)
+		if err != nil || back != id {
+			t.Errorf("ID(%q) = %d, %v, want %d", code, back, err, id)
+		}
+	}
+
+	if code, _ := gen.Code(pow(62, 4)); len(code) != 5 {
+		t.Errorf("expected the second tier to have 5 characters, got %q", code)
+	}
+	if _, err := gen.Code(1 << 62); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange past the longest codes, got %v", err)
+	}
+	if _, err := gen.ID("abc"); err != ErrOutOfRange {
+		t.Errorf("expected ErrOutOfRange for a code shorter than the minimum, got %v", err)
+	}
+}
+
+func TestNew(t *testing.T) {
+	for _, strategy := range []string{StrategySequential, StrategyRandom, StrategyPermuted} {
+		if _, err := New(strategy, encoding.Base62, 6, "secret"); err != nil {
+			t.Errorf("%s: %v", strategy, err)
+		}
+	}
+
+	if _, err := New("hash", encoding.Base62, 6, "secret"); err == nil {
+		t.Error("expected an unknown strategy to fail")
+	}
+	if _, err := New(StrategyPermuted, encoding.Base62, 6, ""); err == nil {
+		t.Error("expected permuted codes without a secret to fail")
+	}
+	if _, err := New(StrategyRandom, encoding.Base62, MaxLength+1, ""); err == nil {
+		t.Error("expected an out of range length to fail")
+	}
+}
+
+func TestPermuted_Codec(t *testing.T) {
+	codec := encoding.Crockford.WithCheckChar()
+	gen, err := NewPermuted(codec, "secret", 5)
+	if err != nil {
+		t.Fatalf("new: %v", err)
+	}
+
+	for _, id := range []int64{0, 1, 1000, pow(32, 5)} {
+		code, err := gen.Code(id)
+		if err != nil {
+			t.Fatalf("code %d: %v", id, err)
+		}
+		if _, err := codec.Decode(code); err != nil {
+			t.Errorf("expected %q to be a valid Crockford code: %v", code, err)
+		}
+		back, err := gen.ID(code)
+		if err != nil || back != id {
+			t.Errorf("ID(%q) = %d, %v, want %d", code, back, err, id)
+		}
+	}
+	if code, _ := gen.Code(1); len(code) != 6 {
+		t.Errorf("expected 5 characters and a check character, got %q", code)
+	}
+}
@@ -5,6 +5,10 @@ import (
 	"fmt"
 	"os"
 	"strconv"
+	"time"
+
+	"github.com/devaloi/shrink/internal/codegen"
+	"github.com/devaloi/shrink/internal/encoding"
 )
 
 // Config holds all application configuration values.
@@ -14,6 +18,61 @@ type Config struct {
 	BaseURL     string
 	RateLimit   float64
 	RateBurst   int
+	BatchMax    int
+
+	// RedirectStatus is the default HTTP status for redirects when a link
+	// does not set its own redirect type.
+	RedirectStatus int
+
+	// IPHashSalt is the secret used to hash client IPs in click events.
+	// When empty, a random salt is generated at startup.
+	IPHashSalt string
+
+	// Click events are queued in memory and written in batches of up to
+	// ClickBatchSize, at least every ClickFlushInterval. Clicks arriving
+	// while ClickQueueSize clicks are waiting are dropped.
+	ClickQueueSize     int
+	ClickBatchSize     int
+	ClickFlushInterval time.Duration
+
+	// WebhookPollInterval is how often the webhook worker looks for due
+	// deliveries. A delivery is dead-lettered after WebhookMaxAttempts
+	// failed attempts.
+	WebhookPollInterval time.Duration
+	WebhookMaxAttempts  int
+
+	// Raw click events older than ClickRetentionDays full days are rolled
+	// into daily aggregates and deleted, checked every RollupInterval. Zero
+	// keeps raw clicks forever. Expired links are swept every RollupInterval
+	// either way.
+	ClickRetentionDays int
+	RollupInterval     time.Duration
+
+	// StatsLocation is the time zone whose calendar days global stats use
+	// for "today" and per-day counts, unless a request names its own.
+	StatsLocation *time.Location
+
+	// StatsRefreshInterval is how often cached global stats are recomputed.
+	// Zero computes them on every request.
+	StatsRefreshInterval time.Duration
+
+	// QueryTimeout bounds every database query. Zero leaves queries bounded
+	// only by their request.
+	QueryTimeout time.Duration
+
+	// CodeStrategy selects how codes of new links are generated: one of the
+	// codegen strategy names. CodeLength is the length of random codes and
+	// the minimum length of permuted ones, and CodeSecret keys the
+	// permutation.
+	CodeStrategy string
+	CodeLength   int
+	CodeSecret   string
+
+	// CodeAlphabet names the encoding codec codes are written with, and
+	// CodeCheckChar appends a check character to them so mistyped codes are
+	// rejected without a database lookup.
+	CodeAlphabet  string
+	CodeCheckChar bool
 }
 
 // Load reads configuration from environment variables with sensible defaults.
@@ -24,6 +83,27 @@ func Load() (*Config, error) {
 		BaseURL:     "http://localhost:8080",
 		RateLimit:   10,
 		RateBurst:   20,
+		BatchMax:    1000,
+
+		RedirectStatus: 301,
+
+		ClickQueueSize:     10000,
+		ClickBatchSize:     500,
+		ClickFlushInterval: time.Second,
+
+		WebhookPollInterval: 5 * time.Second,
+		WebhookMaxAttempts:  8,
+
+		ClickRetentionDays: 90,
+		RollupInterval:     time.Hour,
+
+		StatsLocation:        time.UTC,
+		StatsRefreshInterval: time.Minute,
+		QueryTimeout:         5 * time.Second,
+
+		CodeStrategy: codegen.StrategySequential,
+		CodeLength:   7,
+		CodeAlphabet: "base62",
 	}
 
 	if port := os.Getenv("PORT"); port != "" {
@@ -67,6 +147,179 @@ func Load() (*Config, error) {
 		cfg.RateBurst = b
 	}
 
+	if batchMax := os.Getenv("BATCH_MAX_SIZE"); batchMax != "" {
+		n, err := strconv.Atoi(batchMax)
+		if err != nil {
+			return nil, fmt.Errorf("invalid BATCH_MAX_SIZE: %w", err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("BATCH_MAX_SIZE must be at least 1")
+		}
+		cfg.BatchMax = n
+	}
+
+	if status := os.Getenv("REDIRECT_STATUS"); status != "" {
+		n, err := strconv.Atoi(status)
+		if err != nil {
+			return nil, fmt.Errorf("invalid REDIRECT_STATUS: %w", err)
+		}
+		switch n {
+		case 301, 302, 307, 308:
+		default:
+			return nil, fmt.Errorf("REDIRECT_STATUS must be one of 301, 302, 307 or 308")
+		}
+		cfg.RedirectStatus = n
+	}
+
+	cfg.IPHashSalt = os.Getenv("IP_HASH_SALT")
+
+	if size := os.Getenv("CLICK_QUEUE_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLICK_QUEUE_SIZE: %w", err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("CLICK_QUEUE_SIZE must be at least 1")
+		}
+		cfg.ClickQueueSize = n
+	}
+
+	if size := os.Getenv("CLICK_BATCH_SIZE"); size != "" {
+		n, err := strconv.Atoi(size)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLICK_BATCH_SIZE: %w", err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("CLICK_BATCH_SIZE must be at least 1")
+		}
+		cfg.ClickBatchSize = n
+	}
+
+	if interval := os.Getenv("CLICK_FLUSH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLICK_FLUSH_INTERVAL: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("CLICK_FLUSH_INTERVAL must be positive")
+		}
+		cfg.ClickFlushInterval = d
+	}
+
+	if interval := os.Getenv("WEBHOOK_POLL_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_POLL_INTERVAL: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("WEBHOOK_POLL_INTERVAL must be positive")
+		}
+		cfg.WebhookPollInterval = d
+	}
+
+	if attempts := os.Getenv("WEBHOOK_MAX_ATTEMPTS"); attempts != "" {
+		n, err := strconv.Atoi(attempts)
+		if err != nil {
+			return nil, fmt.Errorf("invalid WEBHOOK_MAX_ATTEMPTS: %w", err)
+		}
+		if n < 1 {
+			return nil, fmt.Errorf("WEBHOOK_MAX_ATTEMPTS must be at least 1")
+		}
+		cfg.WebhookMaxAttempts = n
+	}
+
+	if days := os.Getenv("CLICK_RETENTION_DAYS"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLICK_RETENTION_DAYS: %w", err)
+		}
+		if n < 0 {
+			return nil, fmt.Errorf("CLICK_RETENTION_DAYS must not be negative")
+		}
+		cfg.ClickRetentionDays = n
+	}
+
+	if interval := os.Getenv("CLICK_ROLLUP_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CLICK_ROLLUP_INTERVAL: %w", err)
+		}
+		if d <= 0 {
+			return nil, fmt.Errorf("CLICK_ROLLUP_INTERVAL must be positive")
+		}
+		cfg.RollupInterval = d
+	}
+
+	if tz := os.Getenv("STATS_TIMEZONE"); tz != "" {
+		loc, err := time.LoadLocation(tz)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATS_TIMEZONE: %w", err)
+		}
+		cfg.StatsLocation = loc
+	}
+
+	if interval := os.Getenv("STATS_REFRESH_INTERVAL"); interval != "" {
+		d, err := time.ParseDuration(interval)
+		if err != nil {
+			return nil, fmt.Errorf("invalid STATS_REFRESH_INTERVAL: %w", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("STATS_REFRESH_INTERVAL must not be negative")
+		}
+		cfg.StatsRefreshInterval = d
+	}
+
+	if timeout := os.Getenv("QUERY_TIMEOUT"); timeout != "" {
+		d, err := time.ParseDuration(timeout)
+		if err != nil {
+			return nil, fmt.Errorf("invalid QUERY_TIMEOUT: %w", err)
+		}
+		if d < 0 {
+			return nil, fmt.Errorf("QUERY_TIMEOUT must not be negative")
+		}
+		cfg.QueryTimeout = d
+	}
+
+	if strategy := os.Getenv("CODE_STRATEGY"); strategy != "" {
+		switch strategy {
+		case codegen.StrategySequential, codegen.StrategyRandom, codegen.StrategyPermuted:
+		default:
+			return nil, fmt.Errorf("CODE_STRATEGY must be one of sequential, random or permuted")
+		}
+		cfg.CodeStrategy = strategy
+	}
+
+	if length := os.Getenv("CODE_LENGTH"); length != "" {
+		n, err := strconv.Atoi(length)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CODE_LENGTH: %w", err)
+		}
+		if n < codegen.MinLength || n > codegen.MaxLength {
+			return nil, fmt.Errorf("CODE_LENGTH must be between %d and %d", codegen.MinLength, codegen.MaxLength)
+		}
+		cfg.CodeLength = n
+	}
+
+	if alphabet := os.Getenv("CODE_ALPHABET"); alphabet != "" {
+		if _, ok := encoding.Named(alphabet); !ok {
+			return nil, fmt.Errorf("CODE_ALPHABET must be one of base62, crockford or unambiguous")
+		}
+		cfg.CodeAlphabet = alphabet
+	}
+
+	if check := os.Getenv("CODE_CHECK_CHAR"); check != "" {
+		b, err := strconv.ParseBool(check)
+		if err != nil {
+			return nil, fmt.Errorf("invalid CODE_CHECK_CHAR: %w", err)
+		}
+		cfg.CodeCheckChar = b
+	}
+
+	cfg.CodeSecret = os.Getenv("CODE_SECRET")
+	if cfg.CodeStrategy == codegen.StrategyPermuted && cfg.CodeSecret == "" {
+		return nil, fmt.Errorf("CODE_SECRET is required when CODE_STRATEGY is permuted")
+	}
+
 	return cfg, nil
 }
 
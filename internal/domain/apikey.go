@@ -0,0 +1,26 @@
+package domain
+
+import (
+	"errors"
+	"time"
+)
+
+// ErrInvalidAPIKey is returned when a presented API key is unknown or revoked.
+var ErrInvalidAPIKey = errors.New("invalid api key")
+
+// APIKey identifies a client that owns and manages short URLs. The secret
+// key itself is never stored; only its hash is persisted.
+type APIKey struct {
+	ID        int64      `json:"id"`
+	Name      string     `json:"name"`
+	Prefix    string     `json:"prefix"`
+	Admin     bool       `json:"admin"`
+	CreatedAt time.Time  `json:"created_at"`
+	RevokedAt *time.Time `json:"revoked_at,omitempty"`
+}
+
+// CanManage reports whether the key may manage a URL owned by ownerID.
+// Admin keys may manage every URL, including anonymous ones.
+func (k *APIKey) CanManage(ownerID int64) bool {
+	return k.Admin || (ownerID != 0 && k.ID == ownerID)
+}
@@ -0,0 +1,147 @@
+package domain
+
+import "time"
+
+// Visit describes the request that followed a short link, as seen by the
+// handler. It is reduced to a Click before anything is stored.
+type Visit struct {
+	Method    string
+	Referrer  string
+	UserAgent string
+	IP        string
+	RequestID string
+
+	// Purpose is the value of the Sec-Purpose, Purpose, X-Purpose or X-Moz
+	// header that browsers and link previewers send with speculative
+	// requests, if any.
+	Purpose string
+}
+
+// Click is a single recorded redirect. The client IP is only kept as a
+// salted hash. VisitorHash identifies the visitor for unique counts and is
+// not stored with the click. Bot clicks come from crawlers, link previews
+// and prefetches; they are stored but kept out of human click counts.
+type Click struct {
+	ID           int64     `json:"id"`
+	ClickedAt    time.Time `json:"clicked_at"`
+	ReferrerHost string    `json:"referrer_host,omitempty"`
+	AgentClass   string    `json:"agent_class"`
+	OS           string    `json:"os"`
+	Browser      string    `json:"browser"`
+	IPHash       string    `json:"ip_hash,omitempty"`
+	RequestID    string    `json:"request_id,omitempty"`
+	Bot          bool      `json:"bot"`
+	VisitorHash  uint64    `json:"-"`
+
+	// Counted reports that the click was added to its URL's click count
+	// when the redirect was served, as is done for links with a click
+	// budget, so storing it must not count it again.
+	Counted bool `json:"-"`
+}
+
+// LiveClick is a click as streamed to dashboards. It is sent when the
+// redirect is served, before the click is stored.
+type LiveClick struct {
+	Code         string    `json:"code"`
+	ClickedAt    time.Time `json:"clicked_at"`
+	ReferrerHost string    `json:"referrer_host,omitempty"`
+	AgentClass   string    `json:"agent_class"`
+	OS           string    `json:"os"`
+	Browser      string    `json:"browser"`
+	Bot          bool      `json:"bot"`
+
+	// OwnerID is the API key that owns the link, used to route the click
+	// to the owner's streams.
+	OwnerID int64 `json:"-"`
+}
+
+// Time series intervals.
+const (
+	IntervalHour = "hour"
+	IntervalDay  = "day"
+)
+
+// ClickBucket is the number of clicks in the bucket beginning at Start.
+type ClickBucket struct {
+	Start  time.Time `json:"start"`
+	Clicks int64     `json:"clicks"`
+}
+
+// TimeSeriesQuery selects the buckets of a click time series. From and To
+// default to a recent window, TZ to UTC and Interval to IntervalDay.
+type TimeSeriesQuery struct {
+	Interval string
+	From     *time.Time
+	To       *time.Time
+	TZ       string
+}
+
+// TimeSeries holds click counts for consecutive buckets in [From, To).
+// Buckets are aligned to TZ and include those without clicks.
+type TimeSeries struct {
+	Code     string        `json:"code"`
+	Interval string        `json:"interval"`
+	TZ       string        `json:"tz"`
+	From     time.Time     `json:"from"`
+	To       time.Time     `json:"to"`
+	Total    int64         `json:"total"`
+	Buckets  []ClickBucket `json:"buckets"`
+}
+
+// BreakdownQuery selects the clicks summarized by a Breakdown. Nil bounds
+// leave the range open; Limit caps the entries per dimension.
+type BreakdownQuery struct {
+	From  *time.Time
+	To    *time.Time
+	Limit int
+}
+
+// BreakdownEntry counts the clicks sharing one value of a dimension.
+type BreakdownEntry struct {
+	Value  string `json:"value"`
+	Clicks int64  `json:"clicks"`
+}
+
+// Breakdown summarizes where a link's clicks came from: the top referrer
+// hosts, device classes, operating systems and browsers, most clicks first.
+type Breakdown struct {
+	Code      string           `json:"code"`
+	Total     int64            `json:"total"`
+	Referrers []BreakdownEntry `json:"referrers"`
+	Devices   []BreakdownEntry `json:"devices"`
+	OS        []BreakdownEntry `json:"os"`
+	Browsers  []BreakdownEntry `json:"browsers"`
+}
+
+// VisitorsQuery selects the UTC days, inclusive, of a Visitors report.
+type VisitorsQuery struct {
+	From *time.Time
+	To   *time.Time
+}
+
+// DailyVisitors is the estimated number of unique visitors on one UTC day.
+type DailyVisitors struct {
+	Day      string `json:"day"`
+	Visitors uint64 `json:"unique_visitors"`
+}
+
+// MonthlyVisitors is the estimated number of unique visitors in one UTC
+// month (YYYY-MM) whose days were merged by the retention job.
+type MonthlyVisitors struct {
+	Month    string `json:"month"`
+	Visitors uint64 `json:"unique_visitors"`
+}
+
+// Visitors reports estimated unique visitors of a link per day and across
+// the whole range. The range total is not the sum of the days, since a
+// visitor may return on several days. Days past the retention period are
+// only known per month: they are reported in Months and count whole months
+// toward the range total.
+type Visitors struct {
+	Code     string            `json:"code"`
+	From     string            `json:"from"`
+	To       string            `json:"to"`
+	Visitors uint64            `json:"unique_visitors"`
+	Days     []DailyVisitors   `json:"days"`
+	Months   []MonthlyVisitors `json:"months,omitempty"`
+}
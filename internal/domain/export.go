@@ -0,0 +1,32 @@
+package domain
+
+import "time"
+
+// Export formats.
+const (
+	FormatCSV    = "csv"
+	FormatNDJSON = "ndjson"
+)
+
+// ExportRequest selects what an export covers. From and To are UTC days and
+// both are inclusive; either may be nil to leave that end open.
+type ExportRequest struct {
+	Format string
+	From   *time.Time
+	To     *time.Time
+}
+
+// ExportQuery selects the rows of an export. Links are selected by creation
+// time and clicks by click time, both in [From, To). OwnerID limits the
+// export to one owner's links; zero exports every owner's.
+type ExportQuery struct {
+	OwnerID int64
+	From    *time.Time
+	To      *time.Time
+}
+
+// ExportedClick is a stored click together with the code of its link.
+type ExportedClick struct {
+	Code string `json:"code"`
+	Click
+}
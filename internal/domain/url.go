@@ -9,14 +9,133 @@ type URL struct {
 	Code      string    `json:"code"`
 	Original  string    `json:"original_url"`
 	Clicks    int64     `json:"clicks"`
+	BotClicks int64     `json:"bot_clicks"`
 	CreatedAt time.Time `json:"created_at"`
+	Disabled  bool      `json:"disabled"`
+	LinkOptions
+
+	// ExpiryNotified reports that the link's expiry has been noticed and
+	// announced to its webhooks.
+	ExpiryNotified bool `json:"-"`
+}
+
+// Expired reports whether the URL has passed its expiry date or used up its
+// click budget at the given time.
+func (u *URL) Expired(now time.Time) bool {
+	if u.ExpiresAt != nil && !now.Before(*u.ExpiresAt) {
+		return true
+	}
+	return u.MaxClicks != nil && u.Clicks >= *u.MaxClicks
+}
+
+// LinkOptions holds optional per-link settings supplied at creation time.
+type LinkOptions struct {
+	ExpiresAt   *time.Time `json:"expires_at,omitempty"`
+	MaxClicks   *int64     `json:"max_clicks,omitempty"`
+	FallbackURL string     `json:"fallback_url,omitempty"`
+
+	// RedirectType is the HTTP status used when redirecting (301, 302, 307
+	// or 308). Zero means the server default.
+	RedirectType int `json:"redirect_type,omitempty"`
+
+	// OwnerID is the API key that owns the link, or zero for anonymous
+	// links. It is set by the server from the authenticated key.
+	OwnerID int64 `json:"-"`
+}
+
+// IsZero reports whether no client-chosen options are set. OwnerID is not
+// considered, since it scopes deduplication rather than preventing it.
+func (o LinkOptions) IsZero() bool {
+	return o.ExpiresAt == nil && o.MaxClicks == nil && o.FallbackURL == "" && o.RedirectType == 0
 }
 
 // CreateRequest is the payload for creating a new short URL.
 type CreateRequest struct {
+	URL   string `json:"url"`
+	Alias string `json:"alias,omitempty"`
+	LinkOptions
+}
+
+// BatchRequest is the payload for shortening several URLs at once.
+type BatchRequest struct {
+	URLs []CreateRequest `json:"urls"`
+}
+
+// BatchResult is the outcome for one item of a batch. Exactly one of Code or
+// Error is set.
+type BatchResult struct {
+	Index    int    `json:"index"`
+	ShortURL string `json:"short_url,omitempty"`
+	Code     string `json:"code,omitempty"`
+	Error    string `json:"error,omitempty"`
+}
+
+// BatchResponse reports per-item results in request order.
+type BatchResponse struct {
+	Succeeded int           `json:"succeeded"`
+	Failed    int           `json:"failed"`
+	Results   []BatchResult `json:"results"`
+}
+
+// UpdateRequest is the payload for changing a short URL's destination.
+type UpdateRequest struct {
 	URL string `json:"url"`
 }
 
+// Revision records a previous destination of a short URL.
+type Revision struct {
+	ID        int64     `json:"id"`
+	Original  string    `json:"original_url"`
+	ChangedBy string    `json:"changed_by"`
+	ChangedAt time.Time `json:"changed_at"`
+}
+
+// RevisionList is the change history of a short URL, newest first.
+type RevisionList struct {
+	Code      string     `json:"code"`
+	Revisions []Revision `json:"revisions"`
+}
+
+// Sort fields accepted when listing URLs.
+const (
+	SortCreatedAt = "created_at"
+	SortClicks    = "clicks"
+)
+
+// ListFilter selects, orders and pages URLs for listing. A zero OwnerID
+// matches URLs of every owner.
+type ListFilter struct {
+	OwnerID       int64
+	Host          string
+	Query         string
+	CreatedAfter  *time.Time
+	CreatedBefore *time.Time
+	SortBy        string
+	Ascending     bool
+	Limit         int
+	After         *ListCursor
+}
+
+// ListCursor is the position of the last URL on a page. Listing resumes
+// strictly after it in the filter's sort order.
+type ListCursor struct {
+	ID        int64
+	Clicks    int64
+	CreatedAt time.Time
+}
+
+// URLPage is one page of listed URLs.
+type URLPage struct {
+	URLs       []URL  `json:"urls"`
+	NextCursor string `json:"next_cursor,omitempty"`
+}
+
+// Redirect describes where a short code sends the client.
+type Redirect struct {
+	Location string
+	Status   int
+}
+
 // CreateResponse is returned after successfully creating a short URL.
 type CreateResponse struct {
 	ShortURL string `json:"short_url"`
@@ -28,14 +147,88 @@ type StatsResponse struct {
 	Code      string    `json:"code"`
 	Original  string    `json:"original_url"`
 	Clicks    int64     `json:"clicks"`
+	BotClicks int64     `json:"bot_clicks"`
 	CreatedAt time.Time `json:"created_at"`
+	Disabled  bool      `json:"disabled"`
+	LinkOptions
 }
 
-// GlobalStats contains aggregate statistics for all URLs.
+// GlobalStats contains aggregate statistics for all URLs, or for the URLs of
+// one owner. Days are calendar days in TZ. The leaderboards count the human
+// clicks of the last WindowDays days, today included, and are only filled in
+// for authenticated requests.
 type GlobalStats struct {
-	TotalURLs   int64 `json:"total_urls"`
-	TotalClicks int64 `json:"total_clicks"`
-	URLsToday   int64 `json:"urls_today"`
+	TotalURLs     int64          `json:"total_urls"`
+	TotalClicks   int64          `json:"total_clicks"`
+	URLsToday     int64          `json:"urls_today"`
+	ClicksToday   int64          `json:"clicks_today"`
+	TZ            string         `json:"tz"`
+	WindowDays    int            `json:"window_days"`
+	CreatedPerDay []DailyCount   `json:"created_per_day"`
+	TopLinks      []LinkClicks   `json:"top_links,omitempty"`
+	TopDomains    []DomainClicks `json:"top_domains,omitempty"`
+
+	// GeneratedAt is when the stats were computed. Cached stats may lag
+	// behind the database by up to the cache's refresh interval.
+	GeneratedAt time.Time `json:"generated_at"`
+}
+
+// DailyCount is a number of events on one local day (YYYY-MM-DD).
+type DailyCount struct {
+	Day   string `json:"day"`
+	Count int64  `json:"count"`
+}
+
+// LinkClicks is a leaderboard entry for one short URL.
+type LinkClicks struct {
+	Code     string `json:"code"`
+	Original string `json:"original_url"`
+	Clicks   int64  `json:"clicks"`
+}
+
+// DomainClicks is a leaderboard entry for one destination host.
+type DomainClicks struct {
+	Domain string `json:"domain"`
+	Links  int64  `json:"links"`
+	Clicks int64  `json:"clicks"`
+}
+
+// StatsRequest is the query for GlobalStats. Zero values select the
+// defaults; an empty TZ uses the server's configured time zone.
+type StatsRequest struct {
+	Days  int
+	Limit int
+	TZ    string
+}
+
+// StatsQuery selects the leaderboards the repository computes for
+// GlobalStats: the top Limit links and hosts by human clicks since From.
+// OwnerID limits them to one owner's links.
+type StatsQuery struct {
+	OwnerID int64
+	From    time.Time
+	Limit   int
+}
+
+// StatsSnapshot is an aggregate GlobalStats are computed from, kept by the
+// stats cache between refreshes. A snapshot of an owner's URLs holds their
+// totals and the URLs created and human clicks recorded per bucket, so any
+// day in any time zone can be counted from it; a snapshot of a leaderboard
+// window holds only TopLinks and TopDomains.
+type StatsSnapshot struct {
+	TotalURLs   int64
+	TotalClicks int64
+	Created     []CountBucket
+	Clicks      []CountBucket
+	TopLinks    []LinkClicks
+	TopDomains  []DomainClicks
+	GeneratedAt time.Time
+}
+
+// CountBucket is the number of events in the bucket beginning at Start.
+type CountBucket struct {
+	Start time.Time
+	Count int64
 }
 
 // HealthResponse contains the health check response.
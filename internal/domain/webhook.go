@@ -0,0 +1,115 @@
+package domain
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Link events delivered to webhooks.
+const (
+	EventLinkCreated = "link.created"
+	EventLinkClicked = "link.clicked"
+	EventLinkExpired = "link.expired"
+	EventLinkDeleted = "link.deleted"
+)
+
+// LinkEvents lists every event type a webhook can subscribe to.
+var LinkEvents = []string{EventLinkCreated, EventLinkClicked, EventLinkExpired, EventLinkDeleted}
+
+// Webhook is an endpoint that receives signed link events for the links its
+// owner can manage. Webhooks owned by admin keys receive events for every
+// link.
+type Webhook struct {
+	ID      int64  `json:"id"`
+	OwnerID int64  `json:"owner_id"`
+	URL     string `json:"url"`
+
+	// Events lists the subscribed event types. Empty means all of them.
+	Events []string `json:"events"`
+
+	// Secret signs deliveries. It is only returned when the webhook is
+	// created.
+	Secret string `json:"secret,omitempty"`
+
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// Subscribed reports whether the webhook receives events of type event.
+func (w *Webhook) Subscribed(event string) bool {
+	if len(w.Events) == 0 {
+		return true
+	}
+	for _, e := range w.Events {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// WebhookList is the response body for listing webhooks.
+type WebhookList struct {
+	Webhooks []Webhook `json:"webhooks"`
+}
+
+// WebhookRequest is the request body for registering a webhook.
+type WebhookRequest struct {
+	URL    string   `json:"url"`
+	Events []string `json:"events,omitempty"`
+}
+
+// WebhookEvent is the JSON body of a webhook delivery.
+type WebhookEvent struct {
+	ID        string        `json:"id"`
+	Type      string        `json:"type"`
+	CreatedAt time.Time     `json:"created_at"`
+	Data      LinkEventData `json:"data"`
+}
+
+// LinkEventData describes the link an event is about.
+type LinkEventData struct {
+	Code        string `json:"code"`
+	ShortURL    string `json:"short_url"`
+	OriginalURL string `json:"original_url"`
+
+	// Clicks and BotClicks count the clicks recorded since the previous
+	// link.clicked event, between FirstClickAt and LastClickAt.
+	Clicks       int64      `json:"clicks,omitempty"`
+	BotClicks    int64      `json:"bot_clicks,omitempty"`
+	FirstClickAt *time.Time `json:"first_click_at,omitempty"`
+	LastClickAt  *time.Time `json:"last_click_at,omitempty"`
+
+	// Reason says why a link expired: "expires_at" or "max_clicks".
+	Reason string `json:"reason,omitempty"`
+}
+
+// WebhookDelivery is a pending attempt to send one event to one webhook.
+type WebhookDelivery struct {
+	ID        int64
+	WebhookID int64
+	URL       string
+	Secret    string
+	EventID   string
+	EventType string
+	Payload   []byte
+	Attempts  int
+}
+
+// DeadLetter is a delivery that was abandoned after too many failed
+// attempts.
+type DeadLetter struct {
+	ID        int64           `json:"id"`
+	WebhookID int64           `json:"webhook_id"`
+	EventID   string          `json:"event_id"`
+	EventType string          `json:"event_type"`
+	Payload   json.RawMessage `json:"payload"`
+	Attempts  int             `json:"attempts"`
+	LastError string          `json:"last_error"`
+	FailedAt  time.Time       `json:"failed_at"`
+}
+
+// DeadLetterList is the response body for listing a webhook's dead letters.
+type DeadLetterList struct {
+	WebhookID   int64        `json:"webhook_id"`
+	DeadLetters []DeadLetter `json:"dead_letters"`
+}
@@ -41,6 +41,33 @@ func TestEncode_Negative(t *testing.T) {
 	}
 }
 
+func TestEncodePadded(t *testing.T) {
+	tests := []struct {
+		input    int64
+		width    int
+		expected string
+	}{
+		{0, 4, "aaaa"},
+		{63, 4, "aabb"},
+		{3844, 3, "baa"},
+		{3844, 1, "baa"},
+		{-1, 4, ""},
+	}
+
+	for _, tt := range tests {
+		result := EncodePadded(tt.input, tt.width)
+		if result != tt.expected {
+			t.Errorf("EncodePadded(%d, %d) = %q, want %q", tt.input, tt.width, result, tt.expected)
+		}
+		if result == "" {
+			continue
+		}
+		if decoded, err := Decode(result); err != nil || decoded != tt.input {
+			t.Errorf("Decode(%q) = %d, %v, want %d", result, decoded, err, tt.input)
+		}
+	}
+}
+
 func TestDecode(t *testing.T) {
 	tests := []struct {
 		name     string
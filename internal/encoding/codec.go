@@ -0,0 +1,314 @@
+package encoding
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Alphabets of the predefined codecs.
+const (
+	base62Alphabet      = "abcdefghijklmnopqrstuvwxyzABCDEFGHIJKLMNOPQRSTUVWXYZ0123456789"
+	crockfordAlphabet   = "0123456789ABCDEFGHJKMNPQRSTVWXYZ"
+	unambiguousAlphabet = "23456789abcdefghijkmnpqrstuvwxyzABCDEFGHJKLMNPQRSTUVWXYZ"
+)
+
+// Predefined codecs.
+var (
+	// Base62 uses a-z, A-Z and 0-9. It is case-sensitive.
+	Base62 = mustCodec(base62Alphabet)
+
+	// Crockford is Douglas Crockford's base32. It is case-insensitive and
+	// reads O as 0 and I and L as 1, so codes survive being read aloud or
+	// copied by hand. Codes are written in upper case.
+	Crockford = mustCodec(crockfordAlphabet, CaseInsensitive(), withLookalikes("O0I1L1"))
+
+	// Unambiguous is base62 without the characters most often confused
+	// with each other: 0, O, o, 1, l and I. It is case-sensitive.
+	Unambiguous = mustCodec(unambiguousAlphabet)
+)
+
+// Named returns the predefined codec with the given name, as accepted by
+// the CODE_ALPHABET setting: base62, crockford or unambiguous.
+func Named(name string) (*Codec, bool) {
+	switch name {
+	case "base62":
+		return Base62, true
+	case "crockford":
+		return Crockford, true
+	case "unambiguous":
+		return Unambiguous, true
+	default:
+		return nil, false
+	}
+}
+
+// Errors returned when decoding.
+var (
+	// ErrInvalidInput is returned when the input cannot be decoded.
+	ErrInvalidInput = errors.New("invalid encoded input")
+
+	// ErrOverflow is returned when a code encodes a number that does not fit
+	// in an int64.
+	ErrOverflow = errors.New("code overflows int64")
+
+	// ErrCheckChar is returned when a code's check character does not match
+	// the rest of the code, as after a typo.
+	ErrCheckChar = errors.New("code check character mismatch")
+)
+
+// CodecOption configures a Codec.
+type CodecOption func(*Codec)
+
+// CaseInsensitive makes a codec accept letters in either case. Its alphabet
+// must not contain the same letter in both cases.
+func CaseInsensitive() CodecOption {
+	return func(c *Codec) {
+		c.caseInsensitive = true
+	}
+}
+
+// withLookalikes makes each odd character of pairs decode as the even
+// character after it.
+func withLookalikes(pairs string) CodecOption {
+	return func(c *Codec) {
+		c.lookalikes = pairs
+	}
+}
+
+// Codec converts non-negative integers to codes over an alphabet, most
+// significant digit first, and back.
+type Codec struct {
+	alphabet        string
+	caseInsensitive bool
+	checkChar       bool
+	lookalikes      string
+
+	// digits maps each accepted byte to its digit value, or -1.
+	digits [256]int
+}
+
+// NewCodec creates a Codec for alphabet, which must hold at least two
+// distinct ASCII characters.
+func NewCodec(alphabet string, opts ...CodecOption) (*Codec, error) {
+	c := &Codec{alphabet: alphabet}
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	if len(alphabet) < 2 {
+		return nil, errors.New("alphabet must have at least two characters")
+	}
+	for i := range c.digits {
+		c.digits[i] = -1
+	}
+	for i := 0; i < len(alphabet); i++ {
+		for _, b := range c.forms(alphabet[i]) {
+			if b >= 0x80 {
+				return nil, fmt.Errorf("alphabet character %q is not ASCII", b)
+			}
+			if c.digits[b] != -1 {
+				return nil, fmt.Errorf("alphabet character %q is repeated", b)
+			}
+			c.digits[b] = i
+		}
+	}
+	for i := 0; i+1 < len(c.lookalikes); i += 2 {
+		d := c.digits[c.lookalikes[i+1]]
+		for _, b := range c.forms(c.lookalikes[i]) {
+			c.digits[b] = d
+		}
+	}
+	return c, nil
+}
+
+// mustCodec is NewCodec for the predefined codecs.
+func mustCodec(alphabet string, opts ...CodecOption) *Codec {
+	c, err := NewCodec(alphabet, opts...)
+	if err != nil {
+		panic(err)
+	}
+	return c
+}
+
+// forms returns the bytes that read as b: b itself and, for a
+// case-insensitive codec, b in the other case.
+func (c *Codec) forms(b byte) []byte {
+	if !c.caseInsensitive {
+		return []byte{b}
+	}
+	lower, upper := strings.ToLower(string(b))[0], strings.ToUpper(string(b))[0]
+	if lower == upper {
+		return []byte{b}
+	}
+	return []byte{lower, upper}
+}
+
+// WithCheckChar returns a copy of c that appends a check character to every
+// code, computed with the Luhn mod N algorithm over the alphabet. It catches
+// every single mistyped character and most swaps of adjacent characters.
+func (c *Codec) WithCheckChar() *Codec {
+	copied := *c
+	copied.checkChar = true
+	return &copied
+}
+
+// Base returns the number of characters in the codec's alphabet.
+func (c *Codec) Base() int {
+	return len(c.alphabet)
+}
+
+// HasCheckChar reports whether codes end with a check character.
+func (c *Codec) HasCheckChar() bool {
+	return c.checkChar
+}
+
+// Encode converts a non-negative integer to a code, followed by its check
+// character if the codec has them. Returns "" for negative numbers.
+func (c *Codec) Encode(n int64) string {
+	return c.EncodePadded(n, 1)
+}
+
+// EncodePadded is Encode with at least width digits, padded with leading
+// zero digits. The check character is not counted in width.
+func (c *Codec) EncodePadded(n int64, width int) string {
+	if n < 0 {
+		return ""
+	}
+
+	base := int64(len(c.alphabet))
+	var digits []byte
+	for n > 0 || len(digits) == 0 {
+		digits = append(digits, c.alphabet[n%base])
+		n /= base
+	}
+	for len(digits) < width {
+		digits = append(digits, c.alphabet[0])
+	}
+	for i, j := 0, len(digits)-1; i < j; i, j = i+1, j-1 {
+		digits[i], digits[j] = digits[j], digits[i]
+	}
+
+	if c.checkChar {
+		digits = append(digits, c.alphabet[c.checkDigit(c.values(digits))])
+	}
+	return string(digits)
+}
+
+// Decode converts a code back to an integer. It returns ErrInvalidInput if
+// the code has characters outside the alphabet, ErrCheckChar if its check
+// character is wrong and ErrOverflow if the number does not fit in an
+// int64.
+func (c *Codec) Decode(code string) (int64, error) {
+	values, err := c.verify(code)
+	if err != nil {
+		return 0, err
+	}
+
+	base := int64(len(c.alphabet))
+	var result int64
+	for _, d := range values {
+		if result > (math.MaxInt64-int64(d))/base {
+			return 0, ErrOverflow
+		}
+		result = result*base + int64(d)
+	}
+	return result, nil
+}
+
+// Canonical returns code as the codec writes it: a case-insensitive codec
+// maps letters to the alphabet's case and look-alikes to the characters
+// they stand for. It returns the same errors as Decode, except ErrOverflow.
+func (c *Codec) Canonical(code string) (string, error) {
+	if _, err := c.verify(code); err != nil {
+		return "", err
+	}
+
+	canonical := make([]byte, len(code))
+	for i := 0; i < len(code); i++ {
+		canonical[i] = c.alphabet[c.digits[code[i]]]
+	}
+	return string(canonical), nil
+}
+
+// AppendCheckChar returns code followed by its check character, in
+// canonical form. It returns ErrInvalidInput if code has characters outside
+// the alphabet.
+func (c *Codec) AppendCheckChar(code string) (string, error) {
+	if code == "" {
+		return "", ErrInvalidInput
+	}
+	values, err := c.valuesOf(code)
+	if err != nil {
+		return "", err
+	}
+
+	canonical := make([]byte, len(values), len(values)+1)
+	for i, d := range values {
+		canonical[i] = c.alphabet[d]
+	}
+	return string(append(canonical, c.alphabet[c.checkDigit(values)])), nil
+}
+
+// verify returns the digit values of code without its check character,
+// after checking that the check character matches.
+func (c *Codec) verify(code string) ([]int, error) {
+	if code == "" || (c.checkChar && len(code) < 2) {
+		return nil, ErrInvalidInput
+	}
+	values, err := c.valuesOf(code)
+	if err != nil {
+		return nil, err
+	}
+	if !c.checkChar {
+		return values, nil
+	}
+
+	body, check := values[:len(values)-1], values[len(values)-1]
+	if c.checkDigit(body) != check {
+		return nil, ErrCheckChar
+	}
+	return body, nil
+}
+
+// valuesOf returns the digit value of each character of code.
+func (c *Codec) valuesOf(code string) ([]int, error) {
+	values := make([]int, len(code))
+	for i := 0; i < len(code); i++ {
+		d := c.digits[code[i]]
+		if d < 0 {
+			return nil, ErrInvalidInput
+		}
+		values[i] = d
+	}
+	return values, nil
+}
+
+// values returns the digit values of characters taken from the alphabet.
+func (c *Codec) values(digits []byte) []int {
+	values := make([]int, len(digits))
+	for i, b := range digits {
+		values[i] = c.digits[b]
+	}
+	return values
+}
+
+// checkDigit computes the Luhn mod N check digit of values: working from
+// the right, every second digit is doubled and its base-N digits summed,
+// and the check digit brings the total to a multiple of N.
+func (c *Codec) checkDigit(values []int) int {
+	n := len(c.alphabet)
+	sum := 0
+	double := true
+	for i := len(values) - 1; i >= 0; i-- {
+		v := values[i]
+		if double {
+			v *= 2
+			v = v/n + v%n
+		}
+		sum += v
+		double = !double
+	}
+	return (n - sum%n) % n
+}
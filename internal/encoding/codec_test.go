@@ -0,0 +1,135 @@
+package encoding
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestCodec_RoundTrip(t *testing.T) {
+	codecs := map[string]*Codec{
+		"base62":      Base62,
+		"crockford":   Crockford,
+		"unambiguous": Unambiguous,
+		"checked":     Crockford.WithCheckChar(),
+	}
+	values := []int64{0, 1, 31, 32, 1000, 123456789, 1<<63 - 1}
+
+	for name, c := range codecs {
+		for _, v := range values {
+			code := c.Encode(v)
+			decoded, err := c.Decode(code)
+			if err != nil {
+				t.Errorf("%s: Decode(%q): %v", name, code, err)
+				continue
+			}
+			if decoded != v {
+				t.Errorf("%s: %d encoded to %q, decoded to %d", name, v, code, decoded)
+			}
+		}
+	}
+}
+
+func TestCodec_Crockford(t *testing.T) {
+	if code := Crockford.Encode(1234); code != "16J" {
+		t.Errorf("Encode(1234) = %q, want 16J", code)
+	}
+
+	for _, code := range []string{"16J", "16j", "i6j", "L6J"} {
+		if n, err := Crockford.Decode(code); err != nil || n != 1234 {
+			t.Errorf("Decode(%q) = %d, %v, want 1234", code, n, err)
+		}
+	}
+	if n, err := Crockford.Decode("o"); err != nil || n != 0 {
+		t.Errorf("Decode(%q) = %d, %v, want 0", "o", n, err)
+	}
+
+	canonical, err := Crockford.Canonical("hel1o")
+	if err != nil {
+		t.Fatalf("canonical: %v", err)
+	}
+	if canonical != "HE110" {
+		t.Errorf("Canonical(hel1o) = %q, want HE110", canonical)
+	}
+
+	if _, err := Crockford.Decode("U"); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected U to be rejected, got %v", err)
+	}
+}
+
+func TestCodec_Unambiguous(t *testing.T) {
+	for _, code := range []string{"0", "O", "o", "1", "l", "I"} {
+		if _, err := Unambiguous.Decode(code); !errors.Is(err, ErrInvalidInput) {
+			t.Errorf("expected %q to be rejected, got %v", code, err)
+		}
+	}
+	if Unambiguous.Base() != 56 {
+		t.Errorf("expected 56 characters, got %d", Unambiguous.Base())
+	}
+}
+
+func TestCodec_CheckChar(t *testing.T) {
+	c := Base62.WithCheckChar()
+	code := c.EncodePadded(123456789, 6)
+	if len(code) != 7 {
+		t.Fatalf("expected 6 digits and a check character, got %q", code)
+	}
+	if Base62.HasCheckChar() || !c.HasCheckChar() {
+		t.Error("expected WithCheckChar to leave the original codec unchanged")
+	}
+
+	// Every single-character typo must be caught.
+	for i := 0; i < len(code); i++ {
+		for j := 0; j < len(base62Alphabet); j++ {
+			if base62Alphabet[j] == code[i] {
+				continue
+			}
+			typo := code[:i] + string(base62Alphabet[j]) + code[i+1:]
+			if _, err := c.Decode(typo); !errors.Is(err, ErrCheckChar) {
+				t.Fatalf("expected typo %q of %q to be caught, got %v", typo, code, err)
+			}
+		}
+	}
+
+	// Swapping adjacent characters is caught too.
+	swapped := code[:2] + string(code[3]) + string(code[2]) + code[4:]
+	if swapped != code {
+		if _, err := c.Decode(swapped); !errors.Is(err, ErrCheckChar) {
+			t.Errorf("expected swap %q of %q to be caught, got %v", swapped, code, err)
+		}
+	}
+
+	signed, err := c.AppendCheckChar(code[:len(code)-1])
+	if err != nil || signed != code {
+		t.Errorf("AppendCheckChar = %q, %v, want %q", signed, err, code)
+	}
+	if _, err := c.Decode(code[:1]); !errors.Is(err, ErrInvalidInput) {
+		t.Errorf("expected a lone character to be rejected, got %v", err)
+	}
+}
+
+func TestCodec_Overflow(t *testing.T) {
+	max := Base62.Encode(1<<63 - 1)
+	if _, err := Base62.Decode(max); err != nil {
+		t.Fatalf("decode max: %v", err)
+	}
+	for _, code := range []string{max + "a", "baaaaaaaaaaaaaaaaaaaaa", "99999999999"} {
+		if _, err := Base62.Decode(code); !errors.Is(err, ErrOverflow) {
+			t.Errorf("Decode(%q): expected ErrOverflow, got %v", code, err)
+		}
+	}
+}
+
+func TestNewCodec(t *testing.T) {
+	for name, alphabet := range map[string]string{
+		"too short": "a",
+		"repeated":  "abca",
+		"non-ASCII": "abcé",
+	} {
+		if _, err := NewCodec(alphabet); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+	if _, err := NewCodec("abA", CaseInsensitive()); err == nil {
+		t.Error("expected a case-insensitive alphabet with both cases to fail")
+	}
+}
@@ -0,0 +1,128 @@
+// Package export encodes links and clicks as CSV or newline-delimited JSON,
+// one record at a time, for bulk analytics exports.
+package export
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// ErrUnknownFormat is returned for a format other than CSV or NDJSON.
+var ErrUnknownFormat = errors.New("unknown export format")
+
+// Column headers of the CSV formats. NDJSON records use the same names.
+var (
+	LinkColumns = []string{
+		"id", "code", "original_url", "clicks", "bot_clicks", "created_at", "disabled",
+		"expires_at", "max_clicks", "fallback_url", "redirect_type",
+	}
+	ClickColumns = []string{
+		"id", "code", "clicked_at", "referrer_host", "agent_class", "os", "browser", "request_id", "bot",
+	}
+)
+
+// ContentType returns the media type of an export format.
+func ContentType(format string) (string, error) {
+	switch format {
+	case domain.FormatCSV:
+		return "text/csv; charset=utf-8", nil
+	case domain.FormatNDJSON:
+		return "application/x-ndjson", nil
+	default:
+		return "", fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+// Writer encodes records of type T. Output is buffered, so Flush must be
+// called after the last record.
+type Writer[T any] struct {
+	csv    *csv.Writer
+	record func(T) []string
+
+	buf  *bufio.Writer
+	json *json.Encoder
+}
+
+// NewLinkWriter returns a Writer of links in format. A CSV writer starts with
+// the LinkColumns header.
+func NewLinkWriter(w io.Writer, format string) (*Writer[domain.URL], error) {
+	return newWriter(w, format, LinkColumns, linkRecord)
+}
+
+// NewClickWriter returns a Writer of clicks in format. A CSV writer starts
+// with the ClickColumns header.
+func NewClickWriter(w io.Writer, format string) (*Writer[domain.ExportedClick], error) {
+	return newWriter(w, format, ClickColumns, clickRecord)
+}
+
+func newWriter[T any](w io.Writer, format string, header []string, record func(T) []string) (*Writer[T], error) {
+	switch format {
+	case domain.FormatCSV:
+		cw := csv.NewWriter(w)
+		if err := cw.Write(header); err != nil {
+			return nil, err
+		}
+		return &Writer[T]{csv: cw, record: record}, nil
+	case domain.FormatNDJSON:
+		buf := bufio.NewWriter(w)
+		return &Writer[T]{buf: buf, json: json.NewEncoder(buf)}, nil
+	default:
+		return nil, fmt.Errorf("%w %q", ErrUnknownFormat, format)
+	}
+}
+
+// Write encodes one record.
+func (w *Writer[T]) Write(v T) error {
+	if w.csv != nil {
+		return w.csv.Write(w.record(v))
+	}
+	return w.json.Encode(v)
+}
+
+// Flush writes any buffered records to the underlying writer.
+func (w *Writer[T]) Flush() error {
+	if w.csv != nil {
+		w.csv.Flush()
+		return w.csv.Error()
+	}
+	return w.buf.Flush()
+}
+
+func linkRecord(u domain.URL) []string {
+	var expiresAt, maxClicks, redirectType string
+	if u.ExpiresAt != nil {
+		expiresAt = formatTime(*u.ExpiresAt)
+	}
+	if u.MaxClicks != nil {
+		maxClicks = strconv.FormatInt(*u.MaxClicks, 10)
+	}
+	if u.RedirectType != 0 {
+		redirectType = strconv.Itoa(u.RedirectType)
+	}
+	return []string{
+		strconv.FormatInt(u.ID, 10), u.Code, u.Original,
+		strconv.FormatInt(u.Clicks, 10), strconv.FormatInt(u.BotClicks, 10),
+		formatTime(u.CreatedAt), strconv.FormatBool(u.Disabled),
+		expiresAt, maxClicks, u.FallbackURL, redirectType,
+	}
+}
+
+func clickRecord(c domain.ExportedClick) []string {
+	return []string{
+		strconv.FormatInt(c.ID, 10), c.Code, formatTime(c.ClickedAt),
+		c.ReferrerHost, c.AgentClass, c.OS, c.Browser, c.RequestID, strconv.FormatBool(c.Bot),
+	}
+}
+
+// formatTime formats t like encoding/json does, so both formats agree.
+func formatTime(t time.Time) string {
+	return t.Format(time.RFC3339Nano)
+}
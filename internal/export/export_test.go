@@ -0,0 +1,88 @@
+package export
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+func TestLinkWriter_CSV(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewLinkWriter(&buf, domain.FormatCSV)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+
+	maxClicks := int64(100)
+	link := domain.URL{
+		ID: 7, Code: "b", Original: "https://example.com/a,b", Clicks: 42, BotClicks: 3,
+		CreatedAt: time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC),
+	}
+	link.MaxClicks = &maxClicks
+	if err := w.Write(link); err != nil {
+		t.Fatalf("write: %v", err)
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	want := strings.Join(LinkColumns, ",") + "\n" +
+		`7,b,"https://example.com/a,b",42,3,2026-03-01T09:30:00Z,false,,100,,` + "\n"
+	if buf.String() != want {
+		t.Errorf("expected\n%s\ngot\n%s", want, buf.String())
+	}
+}
+
+func TestClickWriter_NDJSON(t *testing.T) {
+	var buf bytes.Buffer
+	w, err := NewClickWriter(&buf, domain.FormatNDJSON)
+	if err != nil {
+		t.Fatalf("new writer: %v", err)
+	}
+
+	for i := int64(1); i <= 2; i++ {
+		click := domain.ExportedClick{Code: "b"}
+		click.ID = i
+		click.Browser = "Firefox"
+		if err := w.Write(click); err != nil {
+			t.Fatalf("write: %v", err)
+		}
+	}
+	if buf.Len() != 0 {
+		t.Error("expected output to be buffered until flushed")
+	}
+	if err := w.Flush(); err != nil {
+		t.Fatalf("flush: %v", err)
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 2 {
+		t.Fatalf("expected 2 lines, got %d: %q", len(lines), buf.String())
+	}
+	var record map[string]any
+	if err := json.Unmarshal([]byte(lines[1]), &record); err != nil {
+		t.Fatalf("decode line: %v", err)
+	}
+	for _, column := range ClickColumns {
+		if _, ok := record[column]; !ok && column != "referrer_host" && column != "request_id" {
+			t.Errorf("expected field %q in %s", column, lines[1])
+		}
+	}
+	if record["code"] != "b" || record["id"] != float64(2) {
+		t.Errorf("unexpected record: %s", lines[1])
+	}
+}
+
+func TestUnknownFormat(t *testing.T) {
+	if _, err := NewLinkWriter(&bytes.Buffer{}, "xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+	if _, err := ContentType("xml"); !errors.Is(err, ErrUnknownFormat) {
+		t.Errorf("expected ErrUnknownFormat, got %v", err)
+	}
+}
@@ -0,0 +1,102 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/devaloi/shrink/internal/middleware"
+	"github.com/devaloi/shrink/internal/stream"
+)
+
+// heartbeatInterval is how often an idle event stream sends a comment, so
+// that proxies and load balancers keep the connection open.
+const heartbeatInterval = 15 * time.Second
+
+// StreamClicks handles GET /api/urls/{code}/events
+func (h *Handler) StreamClicks(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	sub, err := h.svc.SubscribeClicks(r.Context(), middleware.GetAPIKey(r.Context()), code, r.URL.Query().Get("bots") == "true")
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to stream clicks")
+		return
+	}
+	defer sub.Close()
+
+	streamClicks(w, r, sub)
+}
+
+// StreamAllClicks handles GET /api/events
+func (h *Handler) StreamAllClicks(w http.ResponseWriter, r *http.Request) {
+	sub, err := h.svc.SubscribeAllClicks(middleware.GetAPIKey(r.Context()), r.URL.Query().Get("bots") == "true")
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to stream clicks")
+		return
+	}
+	defer sub.Close()
+
+	streamClicks(w, r, sub)
+}
+
+// streamClicks writes clicks from sub as Server-Sent Events until the client
+// disconnects or the subscription is closed. Each click is a "click" event
+// with the click as JSON data; when clicks had to be dropped because the
+// client fell behind, a "dropped" event reports how many.
+func streamClicks(w http.ResponseWriter, r *http.Request, sub *stream.Subscription) {
+	rc := http.NewResponseController(w)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no")
+	if err := rc.Flush(); err != nil {
+		if errors.Is(err, http.ErrNotSupported) {
+			writeError(w, http.StatusInternalServerError, "streaming not supported")
+		}
+		return
+	}
+
+	heartbeat := time.NewTicker(heartbeatInterval)
+	defer heartbeat.Stop()
+
+	var dropped int64
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case click, ok := <-sub.Clicks():
+			if !ok {
+				return
+			}
+			if n := sub.Dropped(); n > dropped {
+				fmt.Fprintf(w, "event: dropped\ndata: {\"dropped\":%d}\n\n", n-dropped)
+				dropped = n
+			}
+			data, err := json.Marshal(click)
+			if err != nil {
+				log.Printf("error encoding click event: %v", err)
+				continue
+			}
+			fmt.Fprintf(w, "event: click\ndata: %s\n\n", data)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": ping\n\n")
+		}
+
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
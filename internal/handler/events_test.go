@@ -0,0 +1,115 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+func TestHandler_StreamClicks(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	resp, err := h.svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /api/urls/{code}/events", func(w http.ResponseWriter, r *http.Request) {
+		h.StreamClicks(w, asAdmin(r))
+	})
+	mux.HandleFunc("GET /{code}", h.Redirect)
+	srv := httptest.NewServer(mux)
+	defer srv.Close()
+
+	events, err := http.Get(srv.URL + "/api/urls/" + resp.Code + "/events")
+	if err != nil {
+		t.Fatalf("open stream: %v", err)
+	}
+	defer events.Body.Close()
+
+	if ct := events.Header.Get("Content-Type"); ct != "text/event-stream" {
+		t.Fatalf("expected text/event-stream, got %q", ct)
+	}
+
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}}
+	req, err := http.NewRequest(http.MethodGet, srv.URL+"/"+resp.Code, nil)
+	if err != nil {
+		t.Fatalf("new request: %v", err)
+	}
+	req.Header.Set("User-Agent", "Mozilla/5.0 (Windows NT 10.0; Win64; x64) Chrome/120.0 Safari/537.36")
+	redirect, err := client.Do(req)
+	if err != nil {
+		t.Fatalf("follow short link: %v", err)
+	}
+	redirect.Body.Close()
+
+	scanner := bufio.NewScanner(events.Body)
+	var event, data string
+	for scanner.Scan() {
+		line := scanner.Text()
+		if line == "" && event != "" {
+			break
+		}
+		if v, ok := strings.CutPrefix(line, "event: "); ok {
+			event = v
+		}
+		if v, ok := strings.CutPrefix(line, "data: "); ok {
+			data = v
+		}
+	}
+	if event != "click" {
+		t.Fatalf("expected a click event, got %q", event)
+	}
+	var click domain.LiveClick
+	if err := json.Unmarshal([]byte(data), &click); err != nil {
+		t.Fatalf("decode click: %v", err)
+	}
+	if click.Code != resp.Code {
+		t.Errorf("expected click for %s, got %s", resp.Code, click.Code)
+	}
+}
+
+func TestHandler_StreamClicks_Errors(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"unknown code", testAdminKey, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/urls/missing/events", nil)
+			req.SetPathValue("code", "missing")
+			if tt.key != nil {
+				req = withKey(req, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.StreamClicks(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+
+	w := httptest.NewRecorder()
+	h.StreamAllClicks(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+	if w.Code != http.StatusUnauthorized {
+		t.Errorf("expected status 401 for the global stream without a key, got %d", w.Code)
+	}
+}
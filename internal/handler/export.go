@@ -0,0 +1,86 @@
+package handler
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/export"
+	"github.com/devaloi/shrink/internal/middleware"
+	"github.com/devaloi/shrink/internal/service"
+)
+
+// ExportLinks handles GET /api/export/links
+func (h *Handler) ExportLinks(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, "links", h.svc.ExportLinks)
+}
+
+// ExportClicks handles GET /api/export/clicks
+func (h *Handler) ExportClicks(w http.ResponseWriter, r *http.Request) {
+	h.export(w, r, "clicks", h.svc.ExportClicks)
+}
+
+type exportFunc func(context.Context, *domain.APIKey, domain.ExportRequest, io.Writer) error
+
+// export streams an export as a file download named after what it contains.
+func (h *Handler) export(w http.ResponseWriter, r *http.Request, name string, run exportFunc) {
+	params := r.URL.Query()
+	req := domain.ExportRequest{Format: params.Get("format")}
+	if req.Format == "" {
+		req.Format = domain.FormatCSV
+	}
+
+	contentType, err := export.ContentType(req.Format)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "format must be csv or ndjson")
+		return
+	}
+	if req.From, err = parseDateParam(params.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)")
+		return
+	}
+	if req.To, err = parseDateParam(params.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)")
+		return
+	}
+
+	w.Header().Set("Content-Type", contentType)
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="%s.%s"`, name, req.Format))
+
+	out := &exportWriter{w: w}
+	err = run(r.Context(), middleware.GetAPIKey(r.Context()), req, out)
+	if err == nil {
+		return
+	}
+	if out.wrote {
+		// The status is already sent; all that can be done is to cut the
+		// download short.
+		log.Printf("error exporting %s: %v", name, err)
+		return
+	}
+
+	w.Header().Del("Content-Disposition")
+	if writeLookupError(w, err) {
+		return
+	}
+	if errors.Is(err, service.ErrInvalidExport) {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeError(w, http.StatusInternalServerError, "failed to export "+name)
+}
+
+// exportWriter records whether any part of an export reached the client.
+type exportWriter struct {
+	w     io.Writer
+	wrote bool
+}
+
+func (e *exportWriter) Write(p []byte) (int, error) {
+	e.wrote = true
+	return e.w.Write(p)
+}
@@ -0,0 +1,83 @@
+package handler
+
+import (
+	"context"
+	"encoding/csv"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+func TestHandler_ExportLinks(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	resp, err := h.svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com/export"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/export/links", nil)
+	w := httptest.NewRecorder()
+	h.ExportLinks(w, asAdmin(req))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/csv; charset=utf-8" {
+		t.Errorf("expected CSV content type, got %q", ct)
+	}
+	if cd := w.Header().Get("Content-Disposition"); cd != `attachment; filename="links.csv"` {
+		t.Errorf("unexpected Content-Disposition %q", cd)
+	}
+
+	records, err := csv.NewReader(w.Body).ReadAll()
+	if err != nil {
+		t.Fatalf("parse csv: %v", err)
+	}
+	found := false
+	for _, record := range records[1:] {
+		if record[1] == resp.Code && record[2] == "https://example.com/export" {
+			found = true
+		}
+	}
+	if !found {
+		t.Errorf("expected %s in export, got %v", resp.Code, records)
+	}
+}
+
+func TestHandler_ExportClicks_Errors(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	tests := []struct {
+		name  string
+		query string
+		key   *domain.APIKey
+		want  int
+	}{
+		{"anonymous", "", nil, http.StatusUnauthorized},
+		{"unknown format", "?format=xml", testAdminKey, http.StatusBadRequest},
+		{"bad date", "?from=March", testAdminKey, http.StatusBadRequest},
+		{"from after to", "?from=2026-03-02&to=2026-03-01", testAdminKey, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/export/clicks"+tt.query, nil)
+			if tt.key != nil {
+				req = withKey(req, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.ExportClicks(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+			if cd := w.Header().Get("Content-Disposition"); cd != "" {
+				t.Errorf("expected no attachment on error, got %q", cd)
+			}
+		})
+	}
+}
@@ -5,9 +5,11 @@ import (
 	"encoding/json"
 	"errors"
 	"net/http"
+	"strconv"
 	"time"
 
 	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/middleware"
 	"github.com/devaloi/shrink/internal/repository"
 	"github.com/devaloi/shrink/internal/service"
 )
@@ -15,6 +17,9 @@ import (
 // maxRequestBodySize limits the size of incoming request bodies (1 MB).
 const maxRequestBodySize = 1 << 20
 
+// maxBatchBodySize limits the size of batch request bodies (16 MB).
+const maxBatchBodySize = 16 << 20
+
 // Handler handles HTTP requests for the URL shortener.
 type Handler struct {
 	svc       *service.URLService
@@ -45,17 +50,24 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	resp, err := h.svc.Shorten(req.URL)
+	if key := middleware.GetAPIKey(r.Context()); key != nil {
+		req.OwnerID = key.ID
+	}
+
+	resp, err := h.svc.Shorten(r.Context(), req)
 	if err != nil {
+		if writeURLError(w, err) {
+			return
+		}
 		switch {
-		case errors.Is(err, service.ErrEmptyURL):
-			writeError(w, http.StatusBadRequest, "url is required")
-		case errors.Is(err, service.ErrURLTooLong):
-			writeError(w, http.StatusBadRequest, "url exceeds maximum length")
-		case errors.Is(err, service.ErrMissingScheme):
-			writeError(w, http.StatusBadRequest, "url must have http or https scheme")
-		case errors.Is(err, service.ErrInvalidURL):
-			writeError(w, http.StatusBadRequest, "invalid url")
+		case errors.Is(err, service.ErrInvalidAlias):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrReservedAlias):
+			writeError(w, http.StatusBadRequest, "alias is reserved")
+		case errors.Is(err, service.ErrAliasTaken):
+			writeError(w, http.StatusConflict, "alias already in use")
+		case errors.Is(err, service.ErrInvalidOption):
+			writeError(w, http.StatusBadRequest, err.Error())
 		default:
 			writeError(w, http.StatusInternalServerError, "failed to create short url")
 		}
@@ -65,6 +77,37 @@ func (h *Handler) CreateShortURL(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusCreated, resp)
 }
 
+// CreateShortURLBatch handles POST /api/shorten/batch
+func (h *Handler) CreateShortURLBatch(w http.ResponseWriter, r *http.Request) {
+	var req domain.BatchRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxBatchBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	if key := middleware.GetAPIKey(r.Context()); key != nil {
+		for i := range req.URLs {
+			req.URLs[i].OwnerID = key.ID
+		}
+	}
+
+	resp, err := h.svc.ShortenBatch(r.Context(), req.URLs)
+	if err != nil {
+		switch {
+		case errors.Is(err, service.ErrEmptyBatch):
+			writeError(w, http.StatusBadRequest, "urls is required")
+		case errors.Is(err, service.ErrBatchTooLarge):
+			writeError(w, http.StatusRequestEntityTooLarge, err.Error())
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to create short urls")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, resp)
+}
+
 // Redirect handles GET /{code}
 func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
 	code := r.PathValue("code")
@@ -73,17 +116,31 @@ func (h *Handler) Redirect(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	originalURL, err := h.svc.Resolve(code)
+	visit := domain.Visit{
+		Method:    r.Method,
+		Referrer:  r.Referer(),
+		UserAgent: r.UserAgent(),
+		IP:        middleware.ClientIP(r),
+		RequestID: middleware.GetRequestID(r.Context()),
+		Purpose:   purpose(r),
+	}
+
+	target, err := h.svc.Resolve(r.Context(), code, visit)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
+		switch {
+		case errors.Is(err, repository.ErrNotFound):
 			writeError(w, http.StatusNotFound, "short url not found")
-			return
+		case errors.Is(err, service.ErrExpired):
+			writeError(w, http.StatusGone, "short url has expired")
+		case errors.Is(err, service.ErrDisabled):
+			writeError(w, http.StatusForbidden, "short url is disabled")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to resolve url")
 		}
-		writeError(w, http.StatusInternalServerError, "failed to resolve url")
 		return
 	}
 
-	http.Redirect(w, r, originalURL, http.StatusMovedPermanently)
+	http.Redirect(w, r, target.Location, target.Status)
 }
 
 // GetStats handles GET /api/urls/{code}
@@ -94,10 +151,9 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	stats, err := h.svc.Stats(code)
+	stats, err := h.svc.Stats(r.Context(), middleware.GetAPIKey(r.Context()), code)
 	if err != nil {
-		if errors.Is(err, repository.ErrNotFound) {
-			writeError(w, http.StatusNotFound, "short url not found")
+		if writeLookupError(w, err) {
 			return
 		}
 		writeError(w, http.StatusInternalServerError, "failed to get stats")
@@ -107,14 +163,346 @@ func (h *Handler) GetStats(w http.ResponseWriter, r *http.Request) {
 	writeJSON(w, http.StatusOK, stats)
 }
 
+// ListURLs handles GET /api/urls
+func (h *Handler) ListURLs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := domain.ListFilter{
+		Host:   q.Get("host"),
+		Query:  q.Get("q"),
+		SortBy: q.Get("sort"),
+	}
+
+	switch q.Get("order") {
+	case "", "desc":
+	case "asc":
+		filter.Ascending = true
+	default:
+		writeError(w, http.StatusBadRequest, "order must be asc or desc")
+		return
+	}
+
+	if limit := q.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		filter.Limit = n
+	}
+
+	var err error
+	if filter.CreatedAfter, err = parseTimeParam(q.Get("created_after")); err != nil {
+		writeError(w, http.StatusBadRequest, "created_after must be an RFC 3339 timestamp")
+		return
+	}
+	if filter.CreatedBefore, err = parseTimeParam(q.Get("created_before")); err != nil {
+		writeError(w, http.StatusBadRequest, "created_before must be an RFC 3339 timestamp")
+		return
+	}
+
+	page, err := h.svc.List(r.Context(), middleware.GetAPIKey(r.Context()), filter, q.Get("cursor"))
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, service.ErrInvalidFilter):
+			writeError(w, http.StatusBadRequest, err.Error())
+		case errors.Is(err, service.ErrInvalidCursor):
+			writeError(w, http.StatusBadRequest, "invalid cursor")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to list urls")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, page)
+}
+
+// GetTimeSeries handles GET /api/urls/{code}/timeseries
+func (h *Handler) GetTimeSeries(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	params := r.URL.Query()
+	q := domain.TimeSeriesQuery{
+		Interval: params.Get("interval"),
+		TZ:       params.Get("tz"),
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be an RFC 3339 timestamp")
+		return
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "to must be an RFC 3339 timestamp")
+		return
+	}
+
+	series, err := h.svc.TimeSeries(r.Context(), middleware.GetAPIKey(r.Context()), code, q)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidTimeSeries) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get time series")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, series)
+}
+
+// GetBreakdown handles GET /api/urls/{code}/breakdown
+func (h *Handler) GetBreakdown(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	params := r.URL.Query()
+	var q domain.BreakdownQuery
+
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		q.Limit = n
+	}
+
+	var err error
+	if q.From, err = parseTimeParam(params.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be an RFC 3339 timestamp")
+		return
+	}
+	if q.To, err = parseTimeParam(params.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "to must be an RFC 3339 timestamp")
+		return
+	}
+
+	breakdown, err := h.svc.Breakdown(r.Context(), middleware.GetAPIKey(r.Context()), code, q)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidBreakdown) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get breakdown")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, breakdown)
+}
+
+// GetVisitors handles GET /api/urls/{code}/visitors
+func (h *Handler) GetVisitors(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	params := r.URL.Query()
+	var q domain.VisitorsQuery
+
+	var err error
+	if q.From, err = parseDateParam(params.Get("from")); err != nil {
+		writeError(w, http.StatusBadRequest, "from must be a date (YYYY-MM-DD)")
+		return
+	}
+	if q.To, err = parseDateParam(params.Get("to")); err != nil {
+		writeError(w, http.StatusBadRequest, "to must be a date (YYYY-MM-DD)")
+		return
+	}
+
+	visitors, err := h.svc.Visitors(r.Context(), middleware.GetAPIKey(r.Context()), code, q)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		if errors.Is(err, service.ErrInvalidVisitors) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to get visitors")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, visitors)
+}
+
+// UpdateURL handles PATCH /api/urls/{code}
+func (h *Handler) UpdateURL(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	var req domain.UpdateRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	stats, err := h.svc.UpdateDestination(r.Context(), middleware.GetAPIKey(r.Context()), code, req.URL)
+	if err != nil {
+		if writeURLError(w, err) || writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update url")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// ListRevisions handles GET /api/urls/{code}/revisions
+func (h *Handler) ListRevisions(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	revisions, err := h.svc.Revisions(r.Context(), middleware.GetAPIKey(r.Context()), code)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list revisions")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, revisions)
+}
+
+// RollbackRevision handles POST /api/urls/{code}/revisions/{id}/rollback
+func (h *Handler) RollbackRevision(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid revision id")
+		return
+	}
+
+	stats, err := h.svc.Rollback(r.Context(), middleware.GetAPIKey(r.Context()), code, id)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		switch {
+		case errors.Is(err, repository.ErrRevisionNotFound):
+			writeError(w, http.StatusNotFound, "revision not found")
+		default:
+			writeError(w, http.StatusInternalServerError, "failed to roll back url")
+		}
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
+// DeleteURL handles DELETE /api/urls/{code}
+func (h *Handler) DeleteURL(w http.ResponseWriter, r *http.Request) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	if err := h.svc.Delete(r.Context(), middleware.GetAPIKey(r.Context()), code); err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete url")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// DisableURL handles POST /api/urls/{code}/disable
+func (h *Handler) DisableURL(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, true)
+}
+
+// EnableURL handles POST /api/urls/{code}/enable
+func (h *Handler) EnableURL(w http.ResponseWriter, r *http.Request) {
+	h.setDisabled(w, r, false)
+}
+
+func (h *Handler) setDisabled(w http.ResponseWriter, r *http.Request, disabled bool) {
+	code := r.PathValue("code")
+	if code == "" {
+		writeError(w, http.StatusBadRequest, "code is required")
+		return
+	}
+
+	stats, err := h.svc.SetDisabled(r.Context(), middleware.GetAPIKey(r.Context()), code, disabled)
+	if err != nil {
+		if writeLookupError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to update url")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, stats)
+}
+
 // GlobalStats handles GET /api/stats
 func (h *Handler) GlobalStats(w http.ResponseWriter, r *http.Request) {
-	stats, err := h.svc.GlobalStats()
+	params := r.URL.Query()
+	req := domain.StatsRequest{TZ: params.Get("tz")}
+
+	if days := params.Get("days"); days != "" {
+		n, err := strconv.Atoi(days)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid days")
+			return
+		}
+		req.Days = n
+	}
+	if limit := params.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil {
+			writeError(w, http.StatusBadRequest, "invalid limit")
+			return
+		}
+		req.Limit = n
+	}
+
+	stats, err := h.svc.GlobalStats(r.Context(), middleware.GetAPIKey(r.Context()), req)
 	if err != nil {
+		if errors.Is(err, service.ErrInvalidStats) {
+			writeError(w, http.StatusBadRequest, err.Error())
+			return
+		}
 		writeError(w, http.StatusInternalServerError, "failed to get global stats")
 		return
 	}
 
+	// Age tells caches and clients how stale a cached snapshot is.
+	age := max(time.Since(stats.GeneratedAt), 0)
+	w.Header().Set("Age", strconv.Itoa(int(age.Seconds())))
 	writeJSON(w, http.StatusOK, stats)
 }
 
@@ -130,3 +518,72 @@ func (h *Handler) HealthCheck(w http.ResponseWriter, r *http.Request) {
 		Uptime: uptime.String(),
 	})
 }
+
+// writeURLError writes a 400 response for destination URL validation errors.
+// It reports whether err was one of them.
+func writeURLError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrEmptyURL):
+		writeError(w, http.StatusBadRequest, "url is required")
+	case errors.Is(err, service.ErrURLTooLong):
+		writeError(w, http.StatusBadRequest, "url exceeds maximum length")
+	case errors.Is(err, service.ErrMissingScheme):
+		writeError(w, http.StatusBadRequest, "url must have http or https scheme")
+	case errors.Is(err, service.ErrInvalidURL):
+		writeError(w, http.StatusBadRequest, "invalid url")
+	default:
+		return false
+	}
+	return true
+}
+
+// writeLookupError writes the response for a link that is missing, or that
+// the request's API key may not manage. It reports whether err was one of them.
+func writeLookupError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrUnauthorized):
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shrink"`)
+		writeError(w, http.StatusUnauthorized, "api key required")
+	case errors.Is(err, repository.ErrNotFound):
+		writeError(w, http.StatusNotFound, "short url not found")
+	default:
+		return false
+	}
+	return true
+}
+
+// purpose returns the header browsers use to mark speculative requests.
+// Chrome sends Sec-Purpose (formerly Purpose), Firefox X-Moz and Safari
+// X-Purpose.
+func purpose(r *http.Request) string {
+	for _, name := range []string{"Sec-Purpose", "Purpose", "X-Purpose", "X-Moz"} {
+		if v := r.Header.Get(name); v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// parseDateParam parses an optional YYYY-MM-DD query parameter as a UTC day.
+func parseDateParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse("2006-01-02", value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
+
+// parseTimeParam parses an optional RFC 3339 query parameter.
+func parseTimeParam(value string) (*time.Time, error) {
+	if value == "" {
+		return nil, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return nil, err
+	}
+	return &t, nil
+}
@@ -6,6 +6,7 @@ import (
 	"encoding/json"
 	"net/http"
 	"net/http/httptest"
+	"strconv"
 	"strings"
 	"testing"
 	"time"
@@ -13,6 +14,7 @@ import (
 	_ "github.com/mattn/go-sqlite3"
 
 	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/middleware"
 	"github.com/devaloi/shrink/internal/repository"
 	"github.com/devaloi/shrink/internal/service"
 )
@@ -42,6 +44,17 @@ func setupTestHandler(t *testing.T) (*Handler, func()) {
 	return h, cleanup
 }
 
+var testAdminKey = &domain.APIKey{ID: 1, Name: "admin", Admin: true}
+
+// withKey returns r authenticated as key, as APIKeyAuth would leave it.
+func withKey(r *http.Request, key *domain.APIKey) *http.Request {
+	return r.WithContext(middleware.WithAPIKey(r.Context(), key))
+}
+
+func asAdmin(r *http.Request) *http.Request {
+	return withKey(r, testAdminKey)
+}
+
 func TestHandler_CreateShortURL(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -131,6 +144,114 @@ func TestHandler_CreateShortURL_MethodNotAllowed(t *testing.T) {
 	}
 }
 
+func TestHandler_CreateShortURL_Alias(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"q3-launch"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.CreateShortURL(w, req)
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("expected status 201, got %d", w.Code)
+	}
+
+	var resp domain.CreateResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.ShortURL != "http://localhost:8080/q3-launch" {
+		t.Errorf("expected short URL http://localhost:8080/q3-launch, got %s", resp.ShortURL)
+	}
+}
+
+func TestHandler_CreateShortURL_AliasConflict(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"promo"}`
+	for i, want := range []int{http.StatusCreated, http.StatusConflict} {
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+		req.Header.Set("Content-Type", "application/json")
+		w := httptest.NewRecorder()
+
+		h.CreateShortURL(w, req)
+
+		if w.Code != want {
+			t.Errorf("request %d: expected status %d, got %d", i+1, want, w.Code)
+		}
+	}
+}
+
+func TestHandler_CreateShortURL_ReservedAlias(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"api"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.CreateShortURL(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
+func TestHandler_CreateShortURLBatch(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"urls":[{"url":"https://example.com/a"},{"url":"not a url"},{"url":"https://example.com/b","alias":"bee"},{"url":"https://example.com/c","alias":"bee"}]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.CreateShortURLBatch(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var resp domain.BatchResponse
+	if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+		t.Fatalf("decode response: %v", err)
+	}
+
+	if resp.Succeeded != 2 || resp.Failed != 2 {
+		t.Errorf("expected 2 succeeded and 2 failed, got %d and %d", resp.Succeeded, resp.Failed)
+	}
+	if resp.Results[3].Error != "alias already in use" {
+		t.Errorf("expected alias conflict for item 3, got %+v", resp.Results[3])
+	}
+	if resp.Results[1].Error == "" {
+		t.Errorf("expected error for invalid item, got %+v", resp.Results[1])
+	}
+	if resp.Results[2].ShortURL != "http://localhost:8080/bee" {
+		t.Errorf("expected short URL http://localhost:8080/bee, got %s", resp.Results[2].ShortURL)
+	}
+}
+
+func TestHandler_CreateShortURLBatch_Empty(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten/batch", strings.NewReader(`{"urls":[]}`))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.CreateShortURLBatch(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
 func TestHandler_Redirect(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -161,6 +282,33 @@ func TestHandler_Redirect(t *testing.T) {
 	}
 }
 
+func TestHandler_Redirect_TemporaryType(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com/campaign","alias":"campaign","redirect_type":302}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	createW := httptest.NewRecorder()
+	h.CreateShortURL(createW, createReq)
+
+	if createW.Code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d", createW.Code)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/campaign", nil)
+	req.SetPathValue("code", "campaign")
+	w := httptest.NewRecorder()
+	h.Redirect(w, req)
+
+	if w.Code != http.StatusFound {
+		t.Errorf("expected status 302, got %d", w.Code)
+	}
+	if location := w.Header().Get("Location"); location != "https://example.com/campaign" {
+		t.Errorf("expected Location https://example.com/campaign, got %s", location)
+	}
+}
+
 func TestHandler_Redirect_NotFound(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -176,6 +324,50 @@ func TestHandler_Redirect_NotFound(t *testing.T) {
 	}
 }
 
+func TestHandler_Redirect_Expired(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"once","max_clicks":1}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	createW := httptest.NewRecorder()
+	h.CreateShortURL(createW, createReq)
+
+	if createW.Code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d", createW.Code)
+	}
+
+	if _, err := h.db.Exec("UPDATE urls SET clicks = 1 WHERE code = 'once'"); err != nil {
+		t.Fatalf("set clicks: %v", err)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/once", nil)
+	req.SetPathValue("code", "once")
+	w := httptest.NewRecorder()
+	h.Redirect(w, req)
+
+	if w.Code != http.StatusGone {
+		t.Errorf("expected status 410, got %d", w.Code)
+	}
+}
+
+func TestHandler_CreateShortURL_InvalidExpiry(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","expires_at":"2000-01-01T00:00:00Z"}`
+	req := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	req.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+
+	h.CreateShortURL(w, req)
+
+	if w.Code != http.StatusBadRequest {
+		t.Errorf("expected status 400, got %d", w.Code)
+	}
+}
+
 func TestHandler_GetStats(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -194,7 +386,7 @@ func TestHandler_GetStats(t *testing.T) {
 	statsReq := httptest.NewRequest(http.MethodGet, "/api/urls/"+createResp.Code, nil)
 	statsReq.SetPathValue("code", createResp.Code)
 	statsW := httptest.NewRecorder()
-	h.GetStats(statsW, statsReq)
+	h.GetStats(statsW, asAdmin(statsReq))
 
 	if statsW.Code != http.StatusOK {
 		t.Errorf("expected status 200, got %d", statsW.Code)
@@ -221,13 +413,328 @@ func TestHandler_GetStats_NotFound(t *testing.T) {
 	req.SetPathValue("code", "nonexistent")
 	w := httptest.NewRecorder()
 
-	h.GetStats(w, req)
+	h.GetStats(w, asAdmin(req))
 
 	if w.Code != http.StatusNotFound {
 		t.Errorf("expected status 404, got %d", w.Code)
 	}
 }
 
+func TestHandler_GetStats_Ownership(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	owner := &domain.APIKey{ID: 2, Name: "alice"}
+	other := &domain.APIKey{ID: 3, Name: "bob"}
+
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com","alias":"mine"}`))
+	h.CreateShortURL(httptest.NewRecorder(), withKey(createReq, owner))
+
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		want int
+	}{
+		{"owner", owner, http.StatusOK},
+		{"admin", testAdminKey, http.StatusOK},
+		{"other key", other, http.StatusNotFound},
+		{"anonymous", nil, http.StatusUnauthorized},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/urls/mine", nil)
+			req.SetPathValue("code", "mine")
+			if tt.key != nil {
+				req = withKey(req, tt.key)
+			}
+			w := httptest.NewRecorder()
+
+			h.GetStats(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_GetTimeSeries(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com","alias":"series"}`))
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/urls/series/timeseries?interval=hour&tz=Asia/Kolkata", nil)
+	req.SetPathValue("code", "series")
+	w := httptest.NewRecorder()
+
+	h.GetTimeSeries(w, asAdmin(req))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var series domain.TimeSeries
+	if err := json.NewDecoder(w.Body).Decode(&series); err != nil {
+		t.Fatalf("decode time series: %v", err)
+	}
+	if series.Interval != "hour" || series.TZ != "Asia/Kolkata" {
+		t.Errorf("unexpected series header: %+v", series)
+	}
+	if n := len(series.Buckets); n < 24 || n > 25 {
+		t.Errorf("expected a day of hourly buckets, got %d", n)
+	}
+	if _, offset := series.Buckets[0].Start.Zone(); offset != 5*3600+1800 {
+		t.Errorf("expected buckets in +05:30, got offset %d", offset)
+	}
+
+	for _, query := range []string{"interval=week", "from=yesterday", "tz=Nowhere/Special"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/series/timeseries?"+query, nil)
+		req.SetPathValue("code", "series")
+		w := httptest.NewRecorder()
+
+		h.GetTimeSeries(w, asAdmin(req))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_GetBreakdown(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com","alias":"channels"}`))
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/urls/channels/breakdown?limit=5", nil)
+	req.SetPathValue("code", "channels")
+	w := httptest.NewRecorder()
+
+	h.GetBreakdown(w, asAdmin(req))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var breakdown domain.Breakdown
+	if err := json.NewDecoder(w.Body).Decode(&breakdown); err != nil {
+		t.Fatalf("decode breakdown: %v", err)
+	}
+	if breakdown.Code != "channels" || breakdown.Referrers == nil || breakdown.Browsers == nil {
+		t.Errorf("unexpected breakdown: %+v", breakdown)
+	}
+
+	for _, query := range []string{"limit=0x", "limit=1000", "to=tomorrow"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/channels/breakdown?"+query, nil)
+		req.SetPathValue("code", "channels")
+		w := httptest.NewRecorder()
+
+		h.GetBreakdown(w, asAdmin(req))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_GetVisitors(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://example.com","alias":"reach"}`))
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	req := httptest.NewRequest(http.MethodGet, "/api/urls/reach/visitors?from=2026-03-01&to=2026-03-07", nil)
+	req.SetPathValue("code", "reach")
+	w := httptest.NewRecorder()
+
+	h.GetVisitors(w, asAdmin(req))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d: %s", w.Code, w.Body.String())
+	}
+
+	var visitors domain.Visitors
+	if err := json.NewDecoder(w.Body).Decode(&visitors); err != nil {
+		t.Fatalf("decode visitors: %v", err)
+	}
+	if len(visitors.Days) != 7 || visitors.Visitors != 0 {
+		t.Errorf("expected 7 empty days, got %+v", visitors)
+	}
+
+	for _, query := range []string{"from=2026-03-01T00:00:00Z", "from=2026-03-07&to=2026-03-01"} {
+		req := httptest.NewRequest(http.MethodGet, "/api/urls/reach/visitors?"+query, nil)
+		req.SetPathValue("code", "reach")
+		w := httptest.NewRecorder()
+
+		h.GetVisitors(w, asAdmin(req))
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_UpdateAndRollback(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://exmaple.com","alias":"typo"}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	patchReq := httptest.NewRequest(http.MethodPatch, "/api/urls/typo", strings.NewReader(`{"url":"https://example.com"}`))
+	patchReq.SetPathValue("code", "typo")
+	patchW := httptest.NewRecorder()
+	h.UpdateURL(patchW, asAdmin(patchReq))
+
+	if patchW.Code != http.StatusOK {
+		t.Fatalf("patch: expected status 200, got %d", patchW.Code)
+	}
+
+	listReq := httptest.NewRequest(http.MethodGet, "/api/urls/typo/revisions", nil)
+	listReq.SetPathValue("code", "typo")
+	listW := httptest.NewRecorder()
+	h.ListRevisions(listW, asAdmin(listReq))
+
+	var history domain.RevisionList
+	if err := json.NewDecoder(listW.Body).Decode(&history); err != nil {
+		t.Fatalf("decode revisions: %v", err)
+	}
+	if len(history.Revisions) != 1 || history.Revisions[0].Original != "https://exmaple.com" {
+		t.Fatalf("unexpected revisions: %+v", history.Revisions)
+	}
+
+	rollbackReq := httptest.NewRequest(http.MethodPost, "/api/urls/typo/revisions/1/rollback", nil)
+	rollbackReq.SetPathValue("code", "typo")
+	rollbackReq.SetPathValue("id", strconv.FormatInt(history.Revisions[0].ID, 10))
+	rollbackW := httptest.NewRecorder()
+	h.RollbackRevision(rollbackW, asAdmin(rollbackReq))
+
+	if rollbackW.Code != http.StatusOK {
+		t.Fatalf("rollback: expected status 200, got %d", rollbackW.Code)
+	}
+
+	var stats domain.StatsResponse
+	if err := json.NewDecoder(rollbackW.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats: %v", err)
+	}
+	if stats.Original != "https://exmaple.com" {
+		t.Errorf("expected original restored to https://exmaple.com, got %s", stats.Original)
+	}
+}
+
+func TestHandler_UpdateURL_Invalid(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"fixed"}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	tests := []struct {
+		name string
+		code string
+		body string
+		want int
+	}{
+		{"invalid url", "fixed", `{"url":"ftp://example.com"}`, http.StatusBadRequest},
+		{"invalid json", "fixed", `{`, http.StatusBadRequest},
+		{"not found", "missing", `{"url":"https://example.com"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPatch, "/api/urls/"+tt.code, strings.NewReader(tt.body))
+			req.SetPathValue("code", tt.code)
+			w := httptest.NewRecorder()
+			h.UpdateURL(w, asAdmin(req))
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestHandler_DeleteURL(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"takedown"}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	for i, want := range []int{http.StatusNoContent, http.StatusNotFound} {
+		req := httptest.NewRequest(http.MethodDelete, "/api/urls/takedown", nil)
+		req.SetPathValue("code", "takedown")
+		w := httptest.NewRecorder()
+		h.DeleteURL(w, asAdmin(req))
+
+		if w.Code != want {
+			t.Errorf("delete %d: expected status %d, got %d", i+1, want, w.Code)
+		}
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/takedown", nil)
+	req.SetPathValue("code", "takedown")
+	w := httptest.NewRecorder()
+	h.Redirect(w, req)
+
+	if w.Code != http.StatusNotFound {
+		t.Errorf("redirect after delete: expected status 404, got %d", w.Code)
+	}
+}
+
+func TestHandler_DisableEnableURL(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	body := `{"url":"https://example.com","alias":"toggle"}`
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(body))
+	createReq.Header.Set("Content-Type", "application/json")
+	h.CreateShortURL(httptest.NewRecorder(), createReq)
+
+	redirect := func() int {
+		req := httptest.NewRequest(http.MethodGet, "/toggle", nil)
+		req.SetPathValue("code", "toggle")
+		w := httptest.NewRecorder()
+		h.Redirect(w, req)
+		return w.Code
+	}
+
+	disableReq := httptest.NewRequest(http.MethodPost, "/api/urls/toggle/disable", nil)
+	disableReq.SetPathValue("code", "toggle")
+	disableW := httptest.NewRecorder()
+	h.DisableURL(disableW, asAdmin(disableReq))
+
+	if disableW.Code != http.StatusOK {
+		t.Fatalf("disable: expected status 200, got %d", disableW.Code)
+	}
+	if code := redirect(); code != http.StatusForbidden {
+		t.Errorf("redirect while disabled: expected status 403, got %d", code)
+	}
+
+	enableReq := httptest.NewRequest(http.MethodPost, "/api/urls/toggle/enable", nil)
+	enableReq.SetPathValue("code", "toggle")
+	enableW := httptest.NewRecorder()
+	h.EnableURL(enableW, asAdmin(enableReq))
+
+	if enableW.Code != http.StatusOK {
+		t.Fatalf("enable: expected status 200, got %d", enableW.Code)
+	}
+	if code := redirect(); code != http.StatusMovedPermanently {
+		t.Errorf("redirect after enable: expected status 301, got %d", code)
+	}
+}
+
 func TestHandler_GlobalStats(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -256,6 +763,103 @@ func TestHandler_GlobalStats(t *testing.T) {
 	if stats.TotalURLs != 3 {
 		t.Errorf("expected 3 total URLs, got %d", stats.TotalURLs)
 	}
+	if stats.TopLinks != nil {
+		t.Errorf("expected no leaderboards without a key, got %+v", stats.TopLinks)
+	}
+
+	req = asAdmin(httptest.NewRequest(http.MethodGet, "/api/stats?days=3&limit=2&tz=Asia/Tokyo", nil))
+	w = httptest.NewRecorder()
+	h.GlobalStats(w, req)
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+	stats = domain.GlobalStats{}
+	if err := json.NewDecoder(w.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode global stats response: %v", err)
+	}
+	if stats.TZ != "Asia/Tokyo" || len(stats.CreatedPerDay) != 3 {
+		t.Fatalf("expected 3 days in Asia/Tokyo, got %d in %s", len(stats.CreatedPerDay), stats.TZ)
+	}
+	if today := stats.CreatedPerDay[2]; today.Count != 3 {
+		t.Errorf("expected 3 URLs created on %s, got %d", today.Day, today.Count)
+	}
+
+	for _, query := range []string{"days=abc", "limit=abc", "days=1000", "tz=Nowhere/Special"} {
+		req = httptest.NewRequest(http.MethodGet, "/api/stats?"+query, nil)
+		w = httptest.NewRecorder()
+		h.GlobalStats(w, req)
+
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("%s: expected status 400, got %d", query, w.Code)
+		}
+	}
+}
+
+func TestHandler_ListURLs(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	for i := 0; i < 3; i++ {
+		body := bytes.NewBufferString(`{"url":"https://example.com/` + string(rune('a'+i)) + `"}`)
+		req := httptest.NewRequest(http.MethodPost, "/api/shorten", body)
+		req.Header.Set("Content-Type", "application/json")
+		h.CreateShortURL(httptest.NewRecorder(), req)
+	}
+
+	req := httptest.NewRequest(http.MethodGet, "/api/urls?limit=2&host=example.com", nil)
+	w := httptest.NewRecorder()
+	h.ListURLs(w, asAdmin(req))
+
+	if w.Code != http.StatusOK {
+		t.Fatalf("expected status 200, got %d", w.Code)
+	}
+
+	var page domain.URLPage
+	if err := json.NewDecoder(w.Body).Decode(&page); err != nil {
+		t.Fatalf("decode page: %v", err)
+	}
+	if len(page.URLs) != 2 || page.NextCursor == "" {
+		t.Fatalf("expected 2 urls and a cursor, got %d urls and cursor %q", len(page.URLs), page.NextCursor)
+	}
+
+	req = httptest.NewRequest(http.MethodGet, "/api/urls?limit=2&host=example.com&cursor="+page.NextCursor, nil)
+	w = httptest.NewRecorder()
+	h.ListURLs(w, asAdmin(req))
+
+	var next domain.URLPage
+	if err := json.NewDecoder(w.Body).Decode(&next); err != nil {
+		t.Fatalf("decode next page: %v", err)
+	}
+	if len(next.URLs) != 1 || next.NextCursor != "" {
+		t.Errorf("expected final page with 1 url, got %d urls and cursor %q", len(next.URLs), next.NextCursor)
+	}
+}
+
+func TestHandler_ListURLs_BadRequest(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	queries := []string{
+		"sort=original",
+		"order=sideways",
+		"limit=ten",
+		"limit=1000",
+		"created_after=yesterday",
+		"cursor=bogus",
+	}
+
+	for _, q := range queries {
+		t.Run(q, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/api/urls?"+q, nil)
+			w := httptest.NewRecorder()
+			h.ListURLs(w, asAdmin(req))
+
+			if w.Code != http.StatusBadRequest {
+				t.Errorf("expected status 400, got %d", w.Code)
+			}
+		})
+	}
 }
 
 func TestHandler_HealthCheck(t *testing.T) {
@@ -314,7 +918,7 @@ func TestHandler_FullFlow(t *testing.T) {
 	statsReq := httptest.NewRequest(http.MethodGet, "/api/urls/"+createResp.Code, nil)
 	statsReq.SetPathValue("code", createResp.Code)
 	statsW := httptest.NewRecorder()
-	h.GetStats(statsW, statsReq)
+	h.GetStats(statsW, asAdmin(statsReq))
 
 	if statsW.Code != http.StatusOK {
 		t.Fatalf("stats: expected status 200, got %d", statsW.Code)
@@ -330,6 +934,46 @@ func TestHandler_FullFlow(t *testing.T) {
 	}
 }
 
+func TestHandler_Redirect_Bot(t *testing.T) {
+	h, cleanup := setupTestHandler(t)
+	defer cleanup()
+
+	createReq := httptest.NewRequest(http.MethodPost, "/api/shorten", strings.NewReader(`{"url":"https://github.com"}`))
+	createReq.Header.Set("Content-Type", "application/json")
+	createW := httptest.NewRecorder()
+	h.CreateShortURL(createW, createReq)
+
+	var createResp domain.CreateResponse
+	if err := json.NewDecoder(createW.Body).Decode(&createResp); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+
+	redirectReq := httptest.NewRequest(http.MethodGet, "/"+createResp.Code, nil)
+	redirectReq.SetPathValue("code", createResp.Code)
+	redirectReq.Header.Set("User-Agent", "Slackbot-LinkExpanding 1.0 (+https://api.slack.com/robots)")
+	redirectW := httptest.NewRecorder()
+	h.Redirect(redirectW, redirectReq)
+
+	if redirectW.Code != http.StatusMovedPermanently {
+		t.Fatalf("expected bots to be redirected with 301, got %d", redirectW.Code)
+	}
+
+	time.Sleep(100 * time.Millisecond)
+
+	statsReq := httptest.NewRequest(http.MethodGet, "/api/urls/"+createResp.Code, nil)
+	statsReq.SetPathValue("code", createResp.Code)
+	statsW := httptest.NewRecorder()
+	h.GetStats(statsW, asAdmin(statsReq))
+
+	var stats domain.StatsResponse
+	if err := json.NewDecoder(statsW.Body).Decode(&stats); err != nil {
+		t.Fatalf("decode stats response: %v", err)
+	}
+	if stats.Clicks != 0 || stats.BotClicks != 1 {
+		t.Errorf("expected 0 clicks and 1 bot click, got %d and %d", stats.Clicks, stats.BotClicks)
+	}
+}
+
 func TestHandler_DuplicateURL(t *testing.T) {
 	h, cleanup := setupTestHandler(t)
 	defer cleanup()
@@ -0,0 +1,113 @@
+package handler
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"strconv"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/middleware"
+	"github.com/devaloi/shrink/internal/service"
+)
+
+// WebhookHandler handles HTTP requests for managing webhooks.
+type WebhookHandler struct {
+	svc *service.WebhookService
+}
+
+// NewWebhookHandler creates a new WebhookHandler with the given service.
+func NewWebhookHandler(svc *service.WebhookService) *WebhookHandler {
+	return &WebhookHandler{svc: svc}
+}
+
+// CreateWebhook handles POST /api/webhooks
+func (h *WebhookHandler) CreateWebhook(w http.ResponseWriter, r *http.Request) {
+	var req domain.WebhookRequest
+	r.Body = http.MaxBytesReader(w, r.Body, maxRequestBodySize)
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid JSON body")
+		return
+	}
+
+	hook, err := h.svc.Create(r.Context(), middleware.GetAPIKey(r.Context()), req)
+	if err != nil {
+		if writeWebhookError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to create webhook")
+		return
+	}
+
+	writeJSON(w, http.StatusCreated, hook)
+}
+
+// ListWebhooks handles GET /api/webhooks
+func (h *WebhookHandler) ListWebhooks(w http.ResponseWriter, r *http.Request) {
+	hooks, err := h.svc.List(r.Context(), middleware.GetAPIKey(r.Context()))
+	if err != nil {
+		if writeWebhookError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list webhooks")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, hooks)
+}
+
+// DeleteWebhook handles DELETE /api/webhooks/{id}
+func (h *WebhookHandler) DeleteWebhook(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	if err := h.svc.Delete(r.Context(), middleware.GetAPIKey(r.Context()), id); err != nil {
+		if writeWebhookError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to delete webhook")
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// ListDeadLetters handles GET /api/webhooks/{id}/dead-letters
+func (h *WebhookHandler) ListDeadLetters(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(r.PathValue("id"), 10, 64)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid webhook id")
+		return
+	}
+
+	letters, err := h.svc.DeadLetters(r.Context(), middleware.GetAPIKey(r.Context()), id)
+	if err != nil {
+		if writeWebhookError(w, err) {
+			return
+		}
+		writeError(w, http.StatusInternalServerError, "failed to list dead letters")
+		return
+	}
+
+	writeJSON(w, http.StatusOK, letters)
+}
+
+// writeWebhookError writes the response for a missing key, a webhook that
+// does not exist or belongs to another key, or an invalid registration. It
+// reports whether err was one of them.
+func writeWebhookError(w http.ResponseWriter, err error) bool {
+	switch {
+	case errors.Is(err, service.ErrUnauthorized):
+		return writeLookupError(w, err)
+	case errors.Is(err, service.ErrWebhookNotFound):
+		writeError(w, http.StatusNotFound, "webhook not found")
+	case errors.Is(err, service.ErrInvalidWebhook):
+		writeError(w, http.StatusBadRequest, err.Error())
+	default:
+		return false
+	}
+	return true
+}
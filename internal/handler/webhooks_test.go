@@ -0,0 +1,125 @@
+package handler
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/service"
+)
+
+func setupWebhookHandler(t *testing.T) (*WebhookHandler, *repository.SQLite) {
+	t.Helper()
+
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() {
+		if err := db.Close(); err != nil {
+			t.Errorf("close db: %v", err)
+		}
+	})
+
+	repo := repository.NewSQLite(db)
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	return NewWebhookHandler(service.NewWebhookService(repo, repo, "http://localhost:8080")), repo
+}
+
+func TestWebhookHandler_Lifecycle(t *testing.T) {
+	h, repo := setupWebhookHandler(t)
+
+	alice, err := repo.CreateAPIKey(context.Background(), "alice", "hash-alice", "shk_alice", false)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	bob := &domain.APIKey{ID: alice.ID + 1, Name: "bob"}
+
+	body := `{"url":"https://crm.example.com/hook","events":["link.clicked"]}`
+	req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(body))
+	w := httptest.NewRecorder()
+	h.CreateWebhook(w, withKey(req, alice))
+
+	if w.Code != http.StatusCreated {
+		t.Fatalf("create: expected status 201, got %d: %s", w.Code, w.Body.String())
+	}
+	var created domain.Webhook
+	if err := json.NewDecoder(w.Body).Decode(&created); err != nil {
+		t.Fatalf("decode create response: %v", err)
+	}
+	if !strings.HasPrefix(created.Secret, service.WebhookSecretPrefix) {
+		t.Errorf("expected the signing secret on creation, got %q", created.Secret)
+	}
+
+	w = httptest.NewRecorder()
+	h.ListWebhooks(w, withKey(httptest.NewRequest(http.MethodGet, "/api/webhooks", nil), alice))
+	var list domain.WebhookList
+	if err := json.NewDecoder(w.Body).Decode(&list); err != nil {
+		t.Fatalf("decode list response: %v", err)
+	}
+	if len(list.Webhooks) != 1 || list.Webhooks[0].Secret != "" {
+		t.Errorf("expected one webhook without its secret, got %+v", list.Webhooks)
+	}
+
+	id := strconv.FormatInt(created.ID, 10)
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		want int
+	}{
+		{"anonymous", nil, http.StatusUnauthorized},
+		{"other key", bob, http.StatusNotFound},
+		{"owner", alice, http.StatusNoContent},
+		{"already deleted", alice, http.StatusNotFound},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodDelete, "/api/webhooks/"+id, nil)
+			req.SetPathValue("id", id)
+			if tt.key != nil {
+				req = withKey(req, tt.key)
+			}
+			w := httptest.NewRecorder()
+			h.DeleteWebhook(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
+
+func TestWebhookHandler_CreateInvalid(t *testing.T) {
+	h, _ := setupWebhookHandler(t)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"bad json", `{`, http.StatusBadRequest},
+		{"bad url", `{"url":"not a url"}`, http.StatusBadRequest},
+		{"unknown event", `{"url":"https://example.com","events":["link.renamed"]}`, http.StatusBadRequest},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodPost, "/api/webhooks", strings.NewReader(tt.body))
+			w := httptest.NewRecorder()
+			h.CreateWebhook(w, asAdmin(req))
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+		})
+	}
+}
@@ -0,0 +1,95 @@
+// Package hll implements a HyperLogLog sketch for estimating the number of
+// distinct items in a stream using a fixed, small amount of memory.
+package hll
+
+import (
+	"errors"
+	"math"
+	"math/bits"
+)
+
+// Precision is the number of hash bits used to pick a register. 2^12
+// registers take 4 KiB and give a standard error of about 1.6%.
+const Precision = 12
+
+// registers is the number of registers in a sketch.
+const registers = 1 << Precision
+
+// version identifies the binary encoding produced by MarshalBinary.
+const version = 1
+
+// ErrInvalidSketch is returned when decoding malformed sketch data.
+var ErrInvalidSketch = errors.New("invalid hll sketch")
+
+// Sketch estimates the cardinality of a set of 64-bit hashes. Items must be
+// hashed uniformly before they are added. The zero value is not usable;
+// create sketches with New.
+type Sketch struct {
+	reg []uint8
+}
+
+// New returns an empty sketch.
+func New() *Sketch {
+	return &Sketch{reg: make([]uint8, registers)}
+}
+
+// Add records a hashed item and reports whether the sketch changed.
+func (s *Sketch) Add(hash uint64) bool {
+	idx := hash >> (64 - Precision)
+	// The guard bit caps rho so an all-zero remainder cannot overflow.
+	w := hash<<Precision | 1<<(Precision-1)
+	rho := uint8(bits.LeadingZeros64(w) + 1)
+	if rho <= s.reg[idx] {
+		return false
+	}
+	s.reg[idx] = rho
+	return true
+}
+
+// Merge folds other into s, so s estimates the union of both sets.
+func (s *Sketch) Merge(other *Sketch) {
+	for i, r := range other.reg {
+		if r > s.reg[i] {
+			s.reg[i] = r
+		}
+	}
+}
+
+// Estimate returns the approximate number of distinct items added.
+func (s *Sketch) Estimate() uint64 {
+	const m = float64(registers)
+	alpha := 0.7213 / (1 + 1.079/m)
+
+	sum := 0.0
+	zeros := 0
+	for _, r := range s.reg {
+		sum += math.Ldexp(1, -int(r))
+		if r == 0 {
+			zeros++
+		}
+	}
+
+	estimate := alpha * m * m / sum
+	// Small cardinalities are counted more accurately from empty registers.
+	if estimate <= 2.5*m && zeros > 0 {
+		estimate = m * math.Log(m/float64(zeros))
+	}
+	return uint64(estimate + 0.5)
+}
+
+// MarshalBinary encodes the sketch as a version byte, the precision and the
+// registers.
+func (s *Sketch) MarshalBinary() ([]byte, error) {
+	data := make([]byte, 0, 2+len(s.reg))
+	data = append(data, version, Precision)
+	return append(data, s.reg...), nil
+}
+
+// UnmarshalBinary decodes a sketch produced by MarshalBinary.
+func (s *Sketch) UnmarshalBinary(data []byte) error {
+	if len(data) != 2+registers || data[0] != version || data[1] != Precision {
+		return ErrInvalidSketch
+	}
+	s.reg = append(make([]uint8, 0, registers), data[2:]...)
+	return nil
+}
@@ -0,0 +1,97 @@
+package hll
+
+import (
+	"encoding/binary"
+	"hash/fnv"
+	"math"
+	"testing"
+)
+
+// hashOf returns a uniformly distributed 64-bit hash of i.
+func hashOf(i int) uint64 {
+	h := fnv.New64a()
+	var buf [8]byte
+	binary.LittleEndian.PutUint64(buf[:], uint64(i))
+	_, _ = h.Write(buf[:])
+	// Finalize with a mixer; FNV alone is weak in the high bits.
+	x := h.Sum64()
+	x ^= x >> 33
+	x *= 0xff51afd7ed558ccd
+	x ^= x >> 33
+	x *= 0xc4ceb9fe1a85ec53
+	x ^= x >> 33
+	return x
+}
+
+func TestSketch_Estimate(t *testing.T) {
+	for _, n := range []int{0, 1, 10, 1000, 100000} {
+		s := New()
+		for i := 0; i < n; i++ {
+			s.Add(hashOf(i))
+			s.Add(hashOf(i)) // duplicates must not count
+		}
+
+		got := float64(s.Estimate())
+		if n == 0 {
+			if got != 0 {
+				t.Errorf("empty sketch: expected 0, got %v", got)
+			}
+			continue
+		}
+		if errRate := math.Abs(got-float64(n)) / float64(n); errRate > 0.05 {
+			t.Errorf("n=%d: estimate %v is off by %.1f%%", n, got, errRate*100)
+		}
+	}
+}
+
+func TestSketch_AddReportsChange(t *testing.T) {
+	s := New()
+	if !s.Add(hashOf(1)) {
+		t.Error("expected first add to change the sketch")
+	}
+	if s.Add(hashOf(1)) {
+		t.Error("expected repeated add to leave the sketch unchanged")
+	}
+}
+
+func TestSketch_Merge(t *testing.T) {
+	a, b := New(), New()
+	for i := 0; i < 6000; i++ {
+		a.Add(hashOf(i))
+	}
+	for i := 4000; i < 10000; i++ {
+		b.Add(hashOf(i))
+	}
+
+	a.Merge(b)
+
+	if got := float64(a.Estimate()); math.Abs(got-10000)/10000 > 0.05 {
+		t.Errorf("expected union estimate near 10000, got %v", got)
+	}
+}
+
+func TestSketch_Binary(t *testing.T) {
+	s := New()
+	for i := 0; i < 500; i++ {
+		s.Add(hashOf(i))
+	}
+
+	data, err := s.MarshalBinary()
+	if err != nil {
+		t.Fatalf("marshal: %v", err)
+	}
+
+	decoded := New()
+	if err := decoded.UnmarshalBinary(data); err != nil {
+		t.Fatalf("unmarshal: %v", err)
+	}
+	if decoded.Estimate() != s.Estimate() {
+		t.Errorf("expected estimate %d after round trip, got %d", s.Estimate(), decoded.Estimate())
+	}
+
+	for _, bad := range [][]byte{nil, data[:100], append([]byte{9}, data[1:]...)} {
+		if err := New().UnmarshalBinary(bad); err != ErrInvalidSketch {
+			t.Errorf("expected ErrInvalidSketch for %d bytes, got %v", len(bad), err)
+		}
+	}
+}
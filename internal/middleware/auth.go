@@ -0,0 +1,90 @@
+package middleware
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+const apiKeyKey contextKey = "apiKey"
+
+// Authenticator resolves an API key secret to the key it identifies.
+// It returns domain.ErrInvalidAPIKey for unknown or revoked keys.
+type Authenticator interface {
+	Authenticate(ctx context.Context, secret string) (*domain.APIKey, error)
+}
+
+// APIKeyAuth authenticates requests that present an API key, either as
+// "Authorization: Bearer <key>" or in the X-API-Key header, and stores the
+// key in the request context. Requests without a key pass through
+// anonymously; handlers decide whether a key is required.
+func APIKeyAuth(auth Authenticator) Middleware {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			secret := apiKeyFromRequest(r)
+			if secret == "" {
+				next.ServeHTTP(w, r)
+				return
+			}
+
+			key, err := auth.Authenticate(r.Context(), secret)
+			if err != nil {
+				status, message := http.StatusUnauthorized, "invalid api key"
+				if !errors.Is(err, domain.ErrInvalidAPIKey) {
+					log.Printf("[%s] error authenticating api key: %v", GetRequestID(r.Context()), err)
+					status, message = http.StatusInternalServerError, "failed to authenticate api key"
+				}
+				writeAuthError(w, status, message)
+				return
+			}
+
+			next.ServeHTTP(w, r.WithContext(WithAPIKey(r.Context(), key)))
+		})
+	}
+}
+
+// WithAPIKey returns a copy of ctx carrying the authenticated API key.
+func WithAPIKey(ctx context.Context, key *domain.APIKey) context.Context {
+	return context.WithValue(ctx, apiKeyKey, key)
+}
+
+// GetAPIKey retrieves the authenticated API key from the context, or nil
+// for anonymous requests.
+func GetAPIKey(ctx context.Context) *domain.APIKey {
+	if key, ok := ctx.Value(apiKeyKey).(*domain.APIKey); ok {
+		return key
+	}
+	return nil
+}
+
+func apiKeyFromRequest(r *http.Request) string {
+	if auth := r.Header.Get("Authorization"); auth != "" {
+		if token, ok := strings.CutPrefix(auth, "Bearer "); ok {
+			return strings.TrimSpace(token)
+		}
+	}
+	return strings.TrimSpace(r.Header.Get("X-API-Key"))
+}
+
+func writeAuthError(w http.ResponseWriter, status int, message string) {
+	w.Header().Set("Content-Type", "application/json")
+	if status == http.StatusUnauthorized {
+		w.Header().Set("WWW-Authenticate", `Bearer realm="shrink"`)
+	}
+	w.WriteHeader(status)
+	resp := struct {
+		Error string `json:"error"`
+		Code  int    `json:"code"`
+	}{
+		Error: message,
+		Code:  status,
+	}
+	if err := json.NewEncoder(w).Encode(resp); err != nil {
+		log.Printf("error encoding auth response: %v", err)
+	}
+}
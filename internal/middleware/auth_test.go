@@ -0,0 +1,68 @@
+package middleware
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+type stubAuthenticator map[string]*domain.APIKey
+
+func (s stubAuthenticator) Authenticate(_ context.Context, secret string) (*domain.APIKey, error) {
+	if secret == "broken" {
+		return nil, errors.New("database is locked")
+	}
+	if key, ok := s[secret]; ok {
+		return key, nil
+	}
+	return nil, domain.ErrInvalidAPIKey
+}
+
+func TestAPIKeyAuth(t *testing.T) {
+	key := &domain.APIKey{ID: 1, Name: "ci"}
+	auth := APIKeyAuth(stubAuthenticator{"shk_valid": key})
+
+	tests := []struct {
+		name    string
+		header  string
+		value   string
+		want    int
+		wantKey *domain.APIKey
+	}{
+		{"anonymous", "", "", http.StatusOK, nil},
+		{"bearer", "Authorization", "Bearer shk_valid", http.StatusOK, key},
+		{"header", "X-API-Key", "shk_valid", http.StatusOK, key},
+		{"unknown key", "X-API-Key", "shk_nope", http.StatusUnauthorized, nil},
+		{"lookup failure", "Authorization", "Bearer broken", http.StatusInternalServerError, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got *domain.APIKey
+			h := auth(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				got = GetAPIKey(r.Context())
+			}))
+
+			req := httptest.NewRequest(http.MethodGet, "/api/urls", nil)
+			if tt.header != "" {
+				req.Header.Set(tt.header, tt.value)
+			}
+			w := httptest.NewRecorder()
+			h.ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("expected status %d, got %d", tt.want, w.Code)
+			}
+			if got != tt.wantKey {
+				t.Errorf("expected key %v in context, got %v", tt.wantKey, got)
+			}
+			if tt.want == http.StatusUnauthorized && w.Header().Get("WWW-Authenticate") == "" {
+				t.Error("expected WWW-Authenticate header on 401")
+			}
+		})
+	}
+}
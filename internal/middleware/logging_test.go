@@ -0,0 +1,25 @@
+package middleware
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestLogging_PreservesFlusher(t *testing.T) {
+	var flushErr error
+	handler := Logging(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, _ = w.Write([]byte("data: hello\n\n"))
+		flushErr = http.NewResponseController(w).Flush()
+	}))
+
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, httptest.NewRequest(http.MethodGet, "/api/events", nil))
+
+	if flushErr != nil {
+		t.Fatalf("expected the wrapped writer to flush, got %v", flushErr)
+	}
+	if !w.Flushed {
+		t.Error("expected the flush to reach the underlying writer")
+	}
+}
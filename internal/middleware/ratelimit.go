@@ -67,7 +67,7 @@ func (rl *RateLimiter) Allow(ip string) bool {
 // Middleware returns an HTTP middleware that applies rate limiting.
 func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		ip := getClientIP(r)
+		ip := ClientIP(r)
 
 		if !rl.Allow(ip) {
 			w.Header().Set("Content-Type", "application/json")
@@ -90,7 +90,9 @@ func (rl *RateLimiter) Middleware(next http.Handler) http.Handler {
 	})
 }
 
-func getClientIP(r *http.Request) string {
+// ClientIP returns the originating client IP, honoring X-Forwarded-For and
+// X-Real-IP before falling back to the connection's remote address.
+func ClientIP(r *http.Request) string {
 	if xff := r.Header.Get("X-Forwarded-For"); xff != "" {
 		parts := strings.Split(xff, ",")
 		if len(parts) > 0 {
@@ -0,0 +1,351 @@
+// Package migrate applies and reverts versioned SQL migrations, recording
+// the versions applied to a database in its schema_migrations table.
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// downMarker separates the up and down statements of a migration file.
+const downMarker = "-- migrate:down"
+
+// timeFormat matches SQLite's CURRENT_TIMESTAMP.
+const timeFormat = "2006-01-02 15:04:05"
+
+// LegacyVersion is the last migration that was built inline, with CREATE
+// ... IF NOT EXISTS and missing columns added on every start, before
+// schema_migrations existed. The last tagged release only created the urls
+// table of 001; builds after it went on to create the schema through 013
+// the same way. A database without schema_migrations may therefore hold any
+// prefix up to here, and adopting a baseline database just applies the rest.
+const LegacyVersion = 13
+
+// Common errors returned by the runner.
+var (
+	// ErrIrreversible is returned when reverting a migration without down
+	// statements.
+	ErrIrreversible = errors.New("migration cannot be reverted")
+
+	// ErrUnknownVersion is returned when the database has a migration
+	// applied that this build does not know, such as after a downgrade.
+	ErrUnknownVersion = errors.New("database has unknown migration applied")
+)
+
+// Migration is one versioned schema change.
+type Migration struct {
+	Version int
+	Name    string
+	Up      string
+	Down    string
+}
+
+// Status is a known migration and when it was applied, if it was.
+type Status struct {
+	Migration
+	AppliedAt *time.Time
+}
+
+// Load reads the migrations in the root of fsys, ordered by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	names, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, fmt.Errorf("list migrations: %w", err)
+	}
+
+	migrations := make([]Migration, 0, len(names))
+	seen := make(map[int]string, len(names))
+	for _, name := range names {
+		version, desc, ok := strings.Cut(strings.TrimSuffix(path.Base(name), ".sql"), "_")
+		v, err := strconv.Atoi(version)
+		if !ok || err != nil || v < 1 {
+			return nil, fmt.Errorf("migration %s: name must be NNN_description.sql", name)
+		}
+		if other, ok := seen[v]; ok {
+			return nil, fmt.Errorf("migration %s: version %d already used by %s", name, v, other)
+		}
+		seen[v] = name
+
+		data, err := fs.ReadFile(fsys, name)
+		if err != nil {
+			return nil, fmt.Errorf("read migration %s: %w", name, err)
+		}
+		up, down, _ := strings.Cut(string(data), downMarker)
+		migrations = append(migrations, Migration{
+			Version: v,
+			Name:    desc,
+			Up:      strings.TrimSpace(up),
+			Down:    strings.TrimSpace(down),
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+	return migrations, nil
+}
+
+// Runner applies migrations to a database.
+type Runner struct {
+	db         *sql.DB
+	migrations []Migration
+}
+
+// New creates a Runner for db with the given migrations, ordered by version.
+func New(db *sql.DB, migrations []Migration) *Runner {
+	return &Runner{db: db, migrations: migrations}
+}
+
+// Status reports every known migration and whether it has been applied.
+func (r *Runner) Status() ([]Status, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+
+	status := make([]Status, len(r.migrations))
+	for i, m := range r.migrations {
+		status[i].Migration = m
+		if at, ok := applied[m.Version]; ok {
+			status[i].AppliedAt = &at
+		}
+	}
+	return status, nil
+}
+
+// Up applies every pending migration in version order, each in its own
+// transaction, and returns the ones it applied. A database created before
+// schema_migrations existed is adopted first.
+func (r *Runner) Up() ([]Migration, error) {
+	if err := r.ensureTable(); err != nil {
+		return nil, err
+	}
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkKnown(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for _, m := range r.migrations {
+		if _, ok := applied[m.Version]; ok {
+			continue
+		}
+		if err := r.apply(m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// Down reverts the n most recently applied migrations, newest first, and
+// returns the ones it reverted. It stops at a migration without down
+// statements.
+func (r *Runner) Down(n int) ([]Migration, error) {
+	applied, err := r.applied()
+	if err != nil {
+		return nil, err
+	}
+	if err := r.checkKnown(applied); err != nil {
+		return nil, err
+	}
+
+	var done []Migration
+	for i := len(r.migrations) - 1; i >= 0 && len(done) < n; i-- {
+		m := r.migrations[i]
+		if _, ok := applied[m.Version]; !ok {
+			continue
+		}
+		if m.Down == "" {
+			return done, fmt.Errorf("revert migration %03d_%s: %w", m.Version, m.Name, ErrIrreversible)
+		}
+		if err := r.revert(m); err != nil {
+			return done, err
+		}
+		done = append(done, m)
+	}
+	return done, nil
+}
+
+// ensureTable creates schema_migrations. If the database already has a
+// schema from before schema_migrations existed, it is adopted in the same
+// transaction.
+func (r *Runner) ensureTable() error {
+	hasTable, err := r.tableExists("schema_migrations")
+	if err != nil {
+		return err
+	}
+	if hasTable {
+		return nil
+	}
+	legacy, err := r.tableExists("urls")
+	if err != nil {
+		return err
+	}
+
+	err = r.inTx(func(tx *sql.Tx) error {
+		_, err := tx.Exec(`CREATE TABLE schema_migrations (
+			version INTEGER PRIMARY KEY,
+			applied_at DATETIME NOT NULL
+		)`)
+		if err != nil {
+			return err
+		}
+		if legacy {
+			return r.adopt(tx)
+		}
+		return nil
+	})
+	if err != nil {
+		return fmt.Errorf("create schema_migrations: %w", err)
+	}
+	return nil
+}
+
+func (r *Runner) tableExists(name string) (bool, error) {
+	var n int
+	err := r.db.QueryRow("SELECT COUNT(*) FROM sqlite_master WHERE type = 'table' AND name = ?", name).Scan(&n)
+	if err != nil {
+		return false, fmt.Errorf("inspect schema: %w", err)
+	}
+	return n > 0, nil
+}
+
+// adopt re-applies the migrations up to LegacyVersion to a legacy database
+// and records them. Tables and indexes are created with IF NOT EXISTS, so
+// only columns that are already there need to be skipped.
+func (r *Runner) adopt(tx *sql.Tx) error {
+	for _, m := range r.migrations {
+		if m.Version > LegacyVersion {
+			break
+		}
+		for _, stmt := range statements(m.Up) {
+			_, err := tx.Exec(stmt)
+			if err != nil && !strings.Contains(err.Error(), "duplicate column name") {
+				return fmt.Errorf("adopt migration %03d_%s: %w", m.Version, m.Name, err)
+			}
+		}
+		if err := record(tx, m.Version); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (r *Runner) apply(m Migration) error {
+	err := r.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Up); err != nil {
+			return err
+		}
+		return record(tx, m.Version)
+	})
+	if err != nil {
+		return fmt.Errorf("apply migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func (r *Runner) revert(m Migration) error {
+	err := r.inTx(func(tx *sql.Tx) error {
+		if _, err := tx.Exec(m.Down); err != nil {
+			return err
+		}
+		_, err := tx.Exec("DELETE FROM schema_migrations WHERE version = ?", m.Version)
+		return err
+	})
+	if err != nil {
+		return fmt.Errorf("revert migration %03d_%s: %w", m.Version, m.Name, err)
+	}
+	return nil
+}
+
+func record(tx *sql.Tx, version int) error {
+	_, err := tx.Exec(
+		"INSERT INTO schema_migrations (version, applied_at) VALUES (?, ?)",
+		version, time.Now().UTC().Format(timeFormat),
+	)
+	return err
+}
+
+func (r *Runner) inTx(fn func(*sql.Tx) error) error {
+	tx, err := r.db.Begin()
+	if err != nil {
+		return err
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	if err := fn(tx); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// applied returns the applied versions and when they were applied. A
+// database without schema_migrations has none.
+func (r *Runner) applied() (map[int]time.Time, error) {
+	ok, err := r.tableExists("schema_migrations")
+	if err != nil || !ok {
+		return map[int]time.Time{}, err
+	}
+
+	rows, err := r.db.Query("SELECT version, applied_at FROM schema_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	applied := make(map[int]time.Time)
+	for rows.Next() {
+		var version int
+		var at time.Time
+		if err := rows.Scan(&version, &at); err != nil {
+			return nil, fmt.Errorf("scan applied migration: %w", err)
+		}
+		applied[version] = at
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list applied migrations: %w", err)
+	}
+	return applied, nil
+}
+
+// checkKnown fails if a version in applied has no migration in this build.
+func (r *Runner) checkKnown(applied map[int]time.Time) error {
+	known := make(map[int]bool, len(r.migrations))
+	for _, m := range r.migrations {
+		known[m.Version] = true
+	}
+	for version := range applied {
+		if !known[version] {
+			return fmt.Errorf("%w: version %d", ErrUnknownVersion, version)
+		}
+	}
+	return nil
+}
+
+// statements splits a migration into its statements, leaving out comment
+// lines. Migrations do not put semicolons inside string literals.
+func statements(script string) []string {
+	var lines []string
+	for _, line := range strings.Split(script, "\n") {
+		if !strings.HasPrefix(strings.TrimSpace(line), "--") {
+			lines = append(lines, line)
+		}
+	}
+
+	var stmts []string
+	for _, stmt := range strings.Split(strings.Join(lines, "\n"), ";") {
+		if stmt = strings.TrimSpace(stmt); stmt != "" {
+			stmts = append(stmts, stmt)
+		}
+	}
+	return stmts
+}
@@ -0,0 +1,224 @@
+package migrate
+
+import (
+	"database/sql"
+	"errors"
+	"reflect"
+	"testing"
+	"testing/fstest"
+
+	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/devaloi/shrink/migrations"
+)
+
+func openTestDB(t *testing.T) *sql.DB {
+	t.Helper()
+	db, err := sql.Open("sqlite3", "file:"+t.Name()+"?mode=memory&cache=shared")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+	return db
+}
+
+// tables returns the names of the tables in db, sorted.
+func tables(t *testing.T, db *sql.DB) []string {
+	t.Helper()
+	rows, err := db.Query("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%' ORDER BY name")
+	if err != nil {
+		t.Fatalf("list tables: %v", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	var names []string
+	for rows.Next() {
+		var name string
+		if err := rows.Scan(&name); err != nil {
+			t.Fatalf("scan table: %v", err)
+		}
+		names = append(names, name)
+	}
+	return names
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"002_add_b.sql":    {Data: []byte("-- 002_add_b.sql\nALTER TABLE a ADD COLUMN b TEXT;\n\n-- migrate:down\nALTER TABLE a DROP COLUMN b;\n")},
+		"001_create_a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);\n")},
+		"README.md":        {Data: []byte("not a migration")},
+	}
+
+	got, err := Load(fsys)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	want := []Migration{
+		{Version: 1, Name: "create_a", Up: "CREATE TABLE a (id INTEGER);"},
+		{Version: 2, Name: "add_b", Up: "-- 002_add_b.sql\nALTER TABLE a ADD COLUMN b TEXT;", Down: "ALTER TABLE a DROP COLUMN b;"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %+v, got %+v", want, got)
+	}
+
+	for name, fsys := range map[string]fstest.MapFS{
+		"bad name":          {"create_a.sql": {Data: []byte("SELECT 1;")}},
+		"duplicate version": {"001_a.sql": {Data: []byte("SELECT 1;")}, "1_b.sql": {Data: []byte("SELECT 1;")}},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestRunner_UpDown(t *testing.T) {
+	db := openTestDB(t)
+	all, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	r := New(db, all)
+
+	applied, err := r.Up()
+	if err != nil {
+		t.Fatalf("up: %v", err)
+	}
+	if len(applied) != len(all) {
+		t.Errorf("expected %d migrations applied, got %d", len(all), len(applied))
+	}
+
+	applied, err = r.Up()
+	if err != nil {
+		t.Fatalf("second up: %v", err)
+	}
+	if len(applied) != 0 {
+		t.Errorf("expected nothing left to apply, got %+v", applied)
+	}
+
+	status, err := r.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	for _, s := range status {
+		if s.AppliedAt == nil {
+			t.Errorf("expected migration %d to be applied", s.Version)
+		}
+	}
+
+	reverted, err := r.Down(1)
+	if err != nil {
+		t.Fatalf("down: %v", err)
+	}
+	if len(reverted) != 1 || reverted[0].Version != all[len(all)-1].Version {
+		t.Errorf("expected the latest migration reverted, got %+v", reverted)
+	}
+	status, err = r.Status()
+	if err != nil {
+		t.Fatalf("status: %v", err)
+	}
+	if last := status[len(status)-1]; last.AppliedAt != nil {
+		t.Errorf("expected migration %d to be pending", last.Version)
+	}
+
+	// Every down migration must undo its up migration.
+	if _, err := r.Down(len(all)); err != nil {
+		t.Fatalf("down all: %v", err)
+	}
+	if got := tables(t, db); !reflect.DeepEqual(got, []string{"schema_migrations"}) {
+		t.Errorf("expected only schema_migrations left, got %v", got)
+	}
+
+	if _, err := r.Up(); err != nil {
+		t.Fatalf("up again: %v", err)
+	}
+}
+
+func TestRunner_AdoptsLegacyDatabase(t *testing.T) {
+	db := openTestDB(t)
+	all, err := Load(migrations.FS)
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+
+	// A release before schema_migrations left the schema part way, with
+	// columns from later migrations already added.
+	_, err = db.Exec(`
+		CREATE TABLE urls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT UNIQUE NOT NULL,
+			original TEXT NOT NULL,
+			clicks INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+			expires_at DATETIME,
+			max_clicks INTEGER,
+			fallback_url TEXT NOT NULL DEFAULT ''
+		);
+	`)
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	if _, err := New(db, all).Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	var n int
+	if err := db.QueryRow("SELECT COUNT(*) FROM schema_migrations").Scan(&n); err != nil {
+		t.Fatalf("count applied: %v", err)
+	}
+	if n != len(all) {
+		t.Errorf("expected %d migrations recorded, got %d", len(all), n)
+	}
+	if _, err := db.Exec("SELECT owner_id, bot_clicks FROM urls"); err != nil {
+		t.Errorf("expected later columns to be added: %v", err)
+	}
+}
+
+func TestRunner_Irreversible(t *testing.T) {
+	db := openTestDB(t)
+	all, err := Load(fstest.MapFS{
+		"001_create_a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);\n\n-- migrate:down\nDROP TABLE a;\n")},
+		"002_create_b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);\n")},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	r := New(db, all)
+	if _, err := r.Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	reverted, err := r.Down(2)
+	if !errors.Is(err, ErrIrreversible) {
+		t.Errorf("expected ErrIrreversible, got %v", err)
+	}
+	if len(reverted) != 0 {
+		t.Errorf("expected nothing reverted, got %+v", reverted)
+	}
+}
+
+func TestRunner_UnknownVersion(t *testing.T) {
+	db := openTestDB(t)
+	all, err := Load(fstest.MapFS{
+		"001_create_a.sql": {Data: []byte("CREATE TABLE a (id INTEGER);")},
+		"002_create_b.sql": {Data: []byte("CREATE TABLE b (id INTEGER);")},
+	})
+	if err != nil {
+		t.Fatalf("load: %v", err)
+	}
+	if _, err := New(db, all).Up(); err != nil {
+		t.Fatalf("up: %v", err)
+	}
+
+	if _, err := New(db, all[:1]).Up(); !errors.Is(err, ErrUnknownVersion) {
+		t.Errorf("expected ErrUnknownVersion from an older build, got %v", err)
+	}
+}
+
+func TestStatements(t *testing.T) {
+	script := "-- header; with a semicolon\nCREATE TABLE a (id INTEGER);\n\n-- note\nCREATE INDEX i ON a(id);\n"
+	want := []string{"CREATE TABLE a (id INTEGER)", "CREATE INDEX i ON a(id)"}
+	if got := statements(script); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %q, got %q", want, got)
+	}
+}
@@ -0,0 +1,236 @@
+// Package recorder queues click events in memory and writes them to the
+// repository in batches from a single background goroutine.
+package recorder
+
+import (
+	"context"
+	"log"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// Recorder defaults.
+const (
+	DefaultQueueSize     = 10000
+	DefaultBatchSize     = 500
+	DefaultFlushInterval = time.Second
+)
+
+// Store persists batches of click events keyed by short code. Batches are
+// written with a context of the recorder's own, so queued clicks are still
+// written while the server shuts down, until Close gives up on them.
+type Store interface {
+	RecordClicks(ctx context.Context, batch map[string][]domain.Click) error
+}
+
+// Option configures a Recorder.
+type Option func(*Recorder)
+
+// WithQueueSize bounds how many clicks may wait in memory. Clicks arriving
+// while the queue is full are dropped.
+func WithQueueSize(n int) Option {
+	return func(r *Recorder) {
+		r.queueSize = n
+	}
+}
+
+// WithBatchSize sets how many clicks are written per transaction.
+func WithBatchSize(n int) Option {
+	return func(r *Recorder) {
+		r.batchSize = n
+	}
+}
+
+// WithFlushInterval sets how long a click may wait before its batch is
+// written, however small the batch.
+func WithFlushInterval(d time.Duration) Option {
+	return func(r *Recorder) {
+		r.flushInterval = d
+	}
+}
+
+// WithFlushHook calls fn with every batch after it has been written. fn runs
+// on the recorder's goroutine, so slow hooks delay later writes.
+func WithFlushHook(fn func(batch map[string][]domain.Click)) Option {
+	return func(r *Recorder) {
+		r.onFlush = fn
+	}
+}
+
+type event struct {
+	code  string
+	click domain.Click
+}
+
+// Recorder buffers clicks and writes them in batched transactions. Record
+// never blocks the caller; Close flushes whatever is still queued.
+type Recorder struct {
+	store         Store
+	queueSize     int
+	batchSize     int
+	flushInterval time.Duration
+	onFlush       func(batch map[string][]domain.Click)
+
+	queue   chan event
+	done    chan struct{}
+	dropped atomic.Int64
+
+	// ctx is canceled by Close to abandon writes once it stops waiting.
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	// reported is the dropped count last logged. Only run touches it.
+	reported int64
+
+	mu     sync.RWMutex
+	closed bool
+}
+
+// New creates a Recorder writing to store and starts its flush loop.
+func New(store Store, opts ...Option) *Recorder {
+	r := &Recorder{
+		store:         store,
+		queueSize:     DefaultQueueSize,
+		batchSize:     DefaultBatchSize,
+		flushInterval: DefaultFlushInterval,
+		done:          make(chan struct{}),
+	}
+	r.ctx, r.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(r)
+	}
+	r.queue = make(chan event, r.queueSize)
+
+	go r.run()
+	return r
+}
+
+// Record queues a click for code. It reports false if the click was dropped
+// because the queue is full or the recorder is closed.
+func (r *Recorder) Record(code string, click domain.Click) bool {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+
+	if r.closed {
+		r.dropped.Add(1)
+		return false
+	}
+
+	select {
+	case r.queue <- event{code: code, click: click}:
+		return true
+	default:
+		r.dropped.Add(1)
+		return false
+	}
+}
+
+// Dropped returns how many clicks have been dropped since the recorder
+// started.
+func (r *Recorder) Dropped() int64 {
+	return r.dropped.Load()
+}
+
+// Close stops accepting clicks and waits until every queued click has been
+// written. If ctx is done first, the clicks still queued are abandoned and
+// Close returns ctx's error once the write in flight, if any, has given up,
+// so the store is no longer in use either way.
+func (r *Recorder) Close(ctx context.Context) error {
+	r.mu.Lock()
+	if !r.closed {
+		r.closed = true
+		close(r.queue)
+	}
+	r.mu.Unlock()
+
+	select {
+	case <-r.done:
+		return nil
+	case <-ctx.Done():
+		r.cancel()
+		<-r.done
+		return ctx.Err()
+	}
+}
+
+// run collects queued clicks into a batch and writes it when the batch is
+// full, when the flush interval passes, and once more when the queue closes.
+func (r *Recorder) run() {
+	defer close(r.done)
+
+	ticker := time.NewTicker(r.flushInterval)
+	defer ticker.Stop()
+
+	b := newBatch()
+	for {
+		select {
+		case e, ok := <-r.queue:
+			if !ok {
+				if err := r.flush(b); err != nil {
+					log.Printf("error recording clicks: %v; %d clicks lost", err, b.size)
+				}
+				return
+			}
+			b.add(e)
+			// After a failed write, wait for the ticker rather than
+			// retrying on every click.
+			if b.size >= r.batchSize && !b.failed {
+				b = r.write(b)
+			}
+		case <-ticker.C:
+			b = r.write(b)
+		}
+	}
+}
+
+// write flushes b and returns the batch to continue with. A failed batch is
+// kept for the next tick unless it has outgrown the queue.
+func (r *Recorder) write(b *batch) *batch {
+	err := r.flush(b)
+	if err == nil {
+		return newBatch()
+	}
+	if b.size >= r.queueSize {
+		log.Printf("error recording clicks: %v; %d clicks lost", err, b.size)
+		return newBatch()
+	}
+	log.Printf("error recording clicks: %v; retrying %d clicks", err, b.size)
+	b.failed = true
+	return b
+}
+
+func (r *Recorder) flush(b *batch) error {
+	if n := r.dropped.Load(); n > r.reported {
+		log.Printf("Warning: click queue full; dropped %d clicks", n-r.reported)
+		r.reported = n
+	}
+	if b.size == 0 {
+		return nil
+	}
+	if err := r.store.RecordClicks(r.ctx, b.clicks); err != nil {
+		return err
+	}
+	if r.onFlush != nil {
+		r.onFlush(b.clicks)
+	}
+	return nil
+}
+
+// batch groups pending clicks by code.
+type batch struct {
+	clicks map[string][]domain.Click
+	size   int
+	failed bool
+}
+
+func newBatch() *batch {
+	return &batch{clicks: make(map[string][]domain.Click)}
+}
+
+func (b *batch) add(e event) {
+	b.clicks[e.code] = append(b.clicks[e.code], e.click)
+	b.size++
+}
@@ -0,0 +1,179 @@
+package recorder
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	batches []map[string][]domain.Click
+	fail    int
+}
+
+func (s *fakeStore) RecordClicks(_ context.Context, batch map[string][]domain.Click) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if s.fail > 0 {
+		s.fail--
+		return errors.New("database is locked")
+	}
+	s.batches = append(s.batches, batch)
+	return nil
+}
+
+func (s *fakeStore) clicks() map[string]int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	counts := make(map[string]int)
+	for _, b := range s.batches {
+		for code, clicks := range b {
+			counts[code] += len(clicks)
+		}
+	}
+	return counts
+}
+
+func (s *fakeStore) batchCount() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.batches)
+}
+
+func TestRecorder_CloseFlushes(t *testing.T) {
+	store := &fakeStore{}
+	r := New(store, WithFlushInterval(time.Hour))
+
+	for i := 0; i < 5; i++ {
+		r.Record("a", domain.Click{})
+	}
+	r.Record("b", domain.Click{})
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	counts := store.clicks()
+	if counts["a"] != 5 || counts["b"] != 1 {
+		t.Errorf("expected 5 and 1 clicks, got %v", counts)
+	}
+	if n := store.batchCount(); n != 1 {
+		t.Errorf("expected one batched write, got %d", n)
+	}
+
+	if r.Record("a", domain.Click{}) {
+		t.Error("expected Record to refuse clicks after Close")
+	}
+}
+
+func TestRecorder_FlushesFullBatches(t *testing.T) {
+	store := &fakeStore{}
+	r := New(store, WithBatchSize(2), WithFlushInterval(time.Hour))
+	defer func() { _ = r.Close(context.Background()) }()
+
+	for i := 0; i < 4; i++ {
+		r.Record("a", domain.Click{})
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for store.batchCount() < 2 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+	if n := store.batchCount(); n != 2 {
+		t.Errorf("expected 2 batches of 2 clicks, got %d batches", n)
+	}
+}
+
+func TestRecorder_RetriesFailedBatch(t *testing.T) {
+	store := &fakeStore{fail: 1}
+	r := New(store, WithFlushInterval(10*time.Millisecond))
+
+	r.Record("a", domain.Click{})
+
+	deadline := time.Now().Add(time.Second)
+	for store.batchCount() == 0 && time.Now().Before(deadline) {
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if counts := store.clicks(); counts["a"] != 1 {
+		t.Errorf("expected the click to be written on retry, got %v", counts)
+	}
+}
+
+func TestRecorder_DropsWhenFull(t *testing.T) {
+	store := &fakeStore{}
+	r := New(store, WithQueueSize(1), WithBatchSize(1), WithFlushInterval(time.Hour))
+
+	// Hold the store so the flush loop blocks on its first write and
+	// cannot drain the queue.
+	store.mu.Lock()
+	accepted := 0
+	for i := 0; i < 100; i++ {
+		if r.Record("a", domain.Click{}) {
+			accepted++
+		}
+	}
+	store.mu.Unlock()
+
+	if err := r.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if r.Dropped() == 0 {
+		t.Error("expected clicks to be dropped once the queue filled")
+	}
+	if got := int64(accepted) + r.Dropped(); got != 100 {
+		t.Errorf("expected accepted and dropped clicks to add up to 100, got %d", got)
+	}
+	if counts := store.clicks(); counts["a"] != accepted {
+		t.Errorf("expected all %d accepted clicks to be written, got %d", accepted, counts["a"])
+	}
+}
+
+// blockingStore holds every write until its context is canceled.
+type blockingStore struct {
+	once     sync.Once
+	started  chan struct{}
+	finished chan struct{}
+}
+
+func (s *blockingStore) RecordClicks(ctx context.Context, _ map[string][]domain.Click) error {
+	s.once.Do(func() { close(s.started) })
+	<-ctx.Done()
+	select {
+	case <-s.finished:
+	default:
+		close(s.finished)
+	}
+	return ctx.Err()
+}
+
+func TestRecorder_CloseAbandonsWriteInFlight(t *testing.T) {
+	store := &blockingStore{started: make(chan struct{}), finished: make(chan struct{})}
+	r := New(store, WithBatchSize(1))
+
+	r.Record("a", domain.Click{})
+	<-store.started
+
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Millisecond)
+	defer cancel()
+	if err := r.Close(ctx); !errors.Is(err, context.DeadlineExceeded) {
+		t.Fatalf("expected the deadline to pass, got %v", err)
+	}
+
+	select {
+	case <-store.finished:
+	default:
+		t.Error("expected Close to wait for the write in flight to give up")
+	}
+}
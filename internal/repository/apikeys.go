@@ -0,0 +1,117 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// apiKeyColumns lists the columns scanned by scanAPIKey, in order.
+const apiKeyColumns = "id, name, prefix, admin, created_at, revoked_at"
+
+// CreateAPIKey stores a new API key by the hash of its secret.
+func (r *SQLite) CreateAPIKey(ctx context.Context, name, keyHash, prefix string, admin bool) (*domain.APIKey, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.exec(ctx,
+		"INSERT INTO api_keys (name, key_hash, prefix, admin) VALUES (?, ?, ?, ?)",
+		name, keyHash, prefix, admin,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create api key: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get last insert id: %w", err)
+	}
+
+	key, err := scanAPIKey(r.q.QueryRowContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys WHERE id = ?", id))
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return key, nil
+}
+
+// GetAPIKeyByHash retrieves an active API key by the hash of its secret.
+func (r *SQLite) GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	key, err := scanAPIKey(r.q.QueryRowContext(ctx,
+		"SELECT "+apiKeyColumns+" FROM api_keys WHERE key_hash = ? AND revoked_at IS NULL",
+		keyHash,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrKeyNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get api key: %w", err)
+	}
+	return key, nil
+}
+
+// ListAPIKeys returns all API keys, oldest first.
+func (r *SQLite) ListAPIKeys(ctx context.Context) ([]domain.APIKey, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx, "SELECT "+apiKeyColumns+" FROM api_keys ORDER BY id")
+	if err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	keys := []domain.APIKey{}
+	for rows.Next() {
+		key, err := scanAPIKey(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan api key: %w", err)
+		}
+		keys = append(keys, *key)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list api keys: %w", err)
+	}
+	return keys, nil
+}
+
+// RevokeAPIKey permanently disables an API key.
+func (r *SQLite) RevokeAPIKey(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.exec(ctx,
+		"UPDATE api_keys SET revoked_at = ? WHERE id = ? AND revoked_at IS NULL",
+		time.Now().UTC().Format(timeFormat), id,
+	)
+	if err != nil {
+		return fmt.Errorf("revoke api key: %w", err)
+	}
+	rows, err := result.RowsAffected()
+	if err != nil {
+		return fmt.Errorf("check rows affected: %w", err)
+	}
+	if rows == 0 {
+		return ErrKeyNotFound
+	}
+	return nil
+}
+
+// scanAPIKey scans a row selected with apiKeyColumns.
+func scanAPIKey(row interface{ Scan(...any) error }) (*domain.APIKey, error) {
+	key := &domain.APIKey{}
+	var revokedAt sql.NullTime
+	err := row.Scan(&key.ID, &key.Name, &key.Prefix, &key.Admin, &key.CreatedAt, &revokedAt)
+	if err != nil {
+		return nil, err
+	}
+	if revokedAt.Valid {
+		key.RevokedAt = &revokedAt.Time
+	}
+	return key, nil
+}
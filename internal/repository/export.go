@@ -0,0 +1,92 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// ExportLinks calls fn for every live URL matching q, oldest first. Rows are
+// read one at a time, so exports of any size use constant memory. Exports
+// run until ctx is done rather than within the query timeout.
+func (r *SQLite) ExportLinks(ctx context.Context, q domain.ExportQuery, fn func(domain.URL) error) error {
+	where, args := exportFilter(q, "created_at", "owner_id")
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE deleted_at IS NULL"+where+" ORDER BY id",
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("export urls: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return fmt.Errorf("scan url: %w", err)
+		}
+		if err := fn(*url); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export urls: %w", err)
+	}
+	return nil
+}
+
+// ExportClicks calls fn for every click of a live URL matching q, in the
+// order they were recorded. Rows are read one at a time.
+func (r *SQLite) ExportClicks(ctx context.Context, q domain.ExportQuery, fn func(domain.ExportedClick) error) error {
+	where, args := exportFilter(q, "c.clicked_at", "u.owner_id")
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT c.id, u.code, c.clicked_at, c.referrer_host, c.agent_class, c.os, c.browser, c.request_id, c.is_bot"+
+			" FROM clicks c JOIN urls u ON u.id = c.url_id"+
+			" WHERE u.deleted_at IS NULL"+where+" ORDER BY c.id",
+		args...,
+	)
+	if err != nil {
+		return fmt.Errorf("export clicks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	for rows.Next() {
+		var c domain.ExportedClick
+		if err := rows.Scan(
+			&c.ID, &c.Code, &c.ClickedAt, &c.ReferrerHost, &c.AgentClass, &c.OS, &c.Browser, &c.RequestID, &c.Bot,
+		); err != nil {
+			return fmt.Errorf("scan click: %w", err)
+		}
+		if err := fn(c); err != nil {
+			return err
+		}
+	}
+	if err := rows.Err(); err != nil {
+		return fmt.Errorf("export clicks: %w", err)
+	}
+	return nil
+}
+
+// exportFilter builds the conditions of q on timeColumn and ownerColumn,
+// each prefixed with AND.
+func exportFilter(q domain.ExportQuery, timeColumn, ownerColumn string) (string, []any) {
+	var where strings.Builder
+	var args []any
+	if q.OwnerID != 0 {
+		where.WriteString(" AND " + ownerColumn + " = ?")
+		args = append(args, q.OwnerID)
+	}
+	if q.From != nil {
+		where.WriteString(" AND " + timeColumn + " >= ?")
+		args = append(args, q.From.UTC().Format(timeFormat))
+	}
+	if q.To != nil {
+		where.WriteString(" AND " + timeColumn + " < ?")
+		args = append(args, q.To.UTC().Format(timeFormat))
+	}
+	return where.String(), args
+}
@@ -2,28 +2,230 @@
 package repository
 
 import (
+	"context"
 	"errors"
+	"time"
 
 	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/hll"
 )
 
-// ErrNotFound is returned when a URL is not found in the repository.
-var ErrNotFound = errors.New("url not found")
+// Common errors returned by repositories.
+var (
+	// ErrNotFound is returned when a URL is not found in the repository.
+	ErrNotFound = errors.New("url not found")
 
-// Repository defines the interface for URL storage operations.
+	// ErrCodeExists is returned when a short code is already in use.
+	ErrCodeExists = errors.New("code already exists")
+
+	// ErrDestinationExists is returned when creating a link without options
+	// for a destination its owner already has one for.
+	ErrDestinationExists = errors.New("destination already shortened")
+
+	// ErrClickBudgetSpent is returned by ClaimClick when a URL has already
+	// been clicked as often as its max_clicks allows.
+	ErrClickBudgetSpent = errors.New("click budget spent")
+
+	// ErrRevisionNotFound is returned when a URL revision does not exist.
+	ErrRevisionNotFound = errors.New("revision not found")
+
+	// ErrKeyNotFound is returned when an API key does not exist or is revoked.
+	ErrKeyNotFound = errors.New("api key not found")
+
+	// ErrWebhookNotFound is returned when a webhook does not exist or was deleted.
+	ErrWebhookNotFound = errors.New("webhook not found")
+)
+
+// ClickBucketSize is the granularity of ClickBuckets. Every UTC offset in
+// use is a multiple of it, so buckets can be regrouped by local hour or day.
+const ClickBucketSize = 15 * time.Minute
+
+// Repository defines the interface for URL storage operations. Every call
+// stops when its context is done.
 type Repository interface {
 	// Create inserts a new URL and returns it with the generated short code.
-	Create(original string) (*domain.URL, error)
+	// Only one link without options is kept per normalized destination and
+	// owner; Create returns ErrDestinationExists for a second one.
+	Create(ctx context.Context, original string, opts domain.LinkOptions) (*domain.URL, error)
+
+	// CreateWithCode inserts a new URL under a caller-chosen short code.
+	// Returns ErrCodeExists if the code is already taken.
+	CreateWithCode(ctx context.Context, code, original string, opts domain.LinkOptions) (*domain.URL, error)
+
+	// GetByCode retrieves a URL by its short code. Deleted URLs are not found.
+	GetByCode(ctx context.Context, code string) (*domain.URL, error)
+
+	// GetByOriginal retrieves the URL without link options that was created
+	// for the normalized original URL and owner (for deduplication). Links
+	// that have since been disabled, deleted or pointed elsewhere are not
+	// found. ownerID zero matches anonymous URLs.
+	GetByOriginal(ctx context.Context, original string, ownerID int64) (*domain.URL, error)
+
+	// List returns up to filter.Limit URLs matching the filter, in its order.
+	List(ctx context.Context, filter domain.ListFilter) ([]domain.URL, error)
+
+	// UpdateOriginal changes a URL's destination and records the previous
+	// destination as a revision attributed to changedBy.
+	UpdateOriginal(ctx context.Context, code, original, changedBy string) (*domain.URL, error)
+
+	// ListRevisions returns the revisions of a URL, newest first.
+	ListRevisions(ctx context.Context, code string) ([]domain.Revision, error)
+
+	// GetRevision retrieves a single revision of a URL.
+	GetRevision(ctx context.Context, code string, id int64) (*domain.Revision, error)
+
+	// Delete tombstones a URL. The code stays reserved and is never reissued.
+	Delete(ctx context.Context, code string) error
+
+	// SetDisabled disables or re-enables redirects for a URL.
+	SetDisabled(ctx context.Context, code string, disabled bool) error
+
+	// MarkExpiryNotified records that a URL's expiry has been announced. It
+	// reports true only for the call that first marks the URL, so that
+	// concurrent requests announce it once.
+	MarkExpiryNotified(ctx context.Context, code string) (bool, error)
+
+	// ExpiredLinks returns up to limit live links that have expired by now,
+	// by date or click budget, and whose expiry has not been announced.
+	ExpiredLinks(ctx context.Context, now time.Time, limit int) ([]domain.URL, error)
+
+	// ClaimClick counts one human click toward a URL's click budget, or
+	// returns ErrClickBudgetSpent if the budget is used up. The check and the
+	// increment are a single statement, so concurrent redirects never exceed
+	// the budget. The click must later be recorded with Counted set.
+	ClaimClick(ctx context.Context, code string) error
+
+	// RecordClick stores a click event for a URL, increments its click count
+	// unless the click was claimed, and adds the visitor to the day's unique
+	// visitor sketch, all in the same transaction.
+	RecordClick(ctx context.Context, code string, click domain.Click) error
+
+	// RecordClicks stores batches of click events keyed by code in a single
+	// transaction, updating each URL's counters and visitor sketches once.
+	// Codes that no longer resolve to a live URL are skipped.
+	RecordClicks(ctx context.Context, batch map[string][]domain.Click) error
+
+	// RollupClicks moves up to limit clicks made before cutoff into daily
+	// per-dimension counts and deletes the raw rows, in one transaction. It
+	// returns how many clicks were moved; fewer than limit means none older
+	// than cutoff are left.
+	RollupClicks(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+
+	// CompactVisitorSketches merges up to limit daily visitor sketches of
+	// days before cutoff into monthly sketches and deletes them, in one
+	// transaction. It returns how many daily sketches were merged; fewer
+	// than limit means none older than cutoff are left.
+	CompactVisitorSketches(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+
+	// ClickBuckets returns the human clicks of a URL in [from, to), counted in
+	// ClickBucketSize buckets aligned to UTC. Buckets without clicks are
+	// omitted. Rolled-up clicks are counted at the start of their UTC day.
+	ClickBuckets(ctx context.Context, code string, from, to time.Time) ([]domain.ClickBucket, error)
+
+	// ClickBreakdown counts the human clicks of a URL by referrer host, device
+	// class, OS and browser, keeping the top q.Limit values of each. Raw and
+	// rolled-up clicks are both counted.
+	ClickBreakdown(ctx context.Context, code string, q domain.BreakdownQuery) (*domain.Breakdown, error)
+
+	// VisitorSketches returns the unique visitor sketches of a URL for the
+	// UTC days from through to, inclusive, keyed by day (YYYY-MM-DD), and
+	// the monthly sketches of compacted days in the months of from through
+	// to, keyed by month (YYYY-MM).
+	VisitorSketches(ctx context.Context, code string, from, to time.Time) (map[string]*hll.Sketch, error)
+
+	// ExportLinks calls fn for every URL matching q, oldest first, without
+	// loading them all into memory. It stops at the first error fn returns
+	// or when ctx is done.
+	ExportLinks(ctx context.Context, q domain.ExportQuery, fn func(domain.URL) error) error
+
+	// ExportClicks calls fn for every raw click matching q in recorded order,
+	// without loading them all into memory. It stops at the first error fn
+	// returns or when ctx is done. Rolled-up clicks are not exported.
+	ExportClicks(ctx context.Context, q domain.ExportQuery, fn func(domain.ExportedClick) error) error
+
+	// StatsTotals returns a snapshot with the number of URLs and their
+	// clicks filled in, for the URLs of ownerID or of every owner when it
+	// is zero. It reads running totals kept by the write paths.
+	StatsTotals(ctx context.Context, ownerID int64) (*domain.StatsSnapshot, error)
+
+	// Leaderboards returns a snapshot with the top links and destination
+	// hosts by human clicks since q.From filled in, for the URLs selected
+	// by q.
+	Leaderboards(ctx context.Context, q domain.StatsQuery) (*domain.StatsSnapshot, error)
+
+	// CreatedBuckets counts the URLs created in the ClickBucketSize
+	// buckets aligned to UTC that start in [from, to). ownerID zero counts
+	// every owner's URLs.
+	CreatedBuckets(ctx context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error)
+
+	// OwnerClickBuckets counts the raw human clicks recorded in the
+	// ClickBucketSize buckets aligned to UTC that start in [from, to), for
+	// the URLs of ownerID or of every owner when it is zero.
+	OwnerClickBuckets(ctx context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error)
+
+	// WithTx runs fn with a Repository bound to a single transaction. The
+	// transaction commits if fn returns nil and rolls back otherwise.
+	WithTx(ctx context.Context, fn func(Repository) error) error
+}
+
+// KeyRepository defines the interface for API key storage operations.
+type KeyRepository interface {
+	// CreateAPIKey stores a new API key by the hash of its secret.
+	CreateAPIKey(ctx context.Context, name, keyHash, prefix string, admin bool) (*domain.APIKey, error)
+
+	// GetAPIKeyByHash retrieves an active API key by the hash of its secret.
+	// Revoked keys are not found.
+	GetAPIKeyByHash(ctx context.Context, keyHash string) (*domain.APIKey, error)
+
+	// ListAPIKeys returns all API keys, including revoked ones.
+	ListAPIKeys(ctx context.Context) ([]domain.APIKey, error)
+
+	// RevokeAPIKey permanently disables an API key.
+	RevokeAPIKey(ctx context.Context, id int64) error
+}
+
+// WebhookRepository defines the interface for webhook registrations and
+// their delivery outbox.
+type WebhookRepository interface {
+	// CreateWebhook registers an endpoint for ownerID. Empty events
+	// subscribes it to every event.
+	CreateWebhook(ctx context.Context, ownerID int64, url string, events []string, secret string) (*domain.Webhook, error)
+
+	// GetWebhook retrieves a webhook that has not been deleted.
+	GetWebhook(ctx context.Context, id int64) (*domain.Webhook, error)
+
+	// ListWebhooks returns the webhooks of ownerID, or of every owner when
+	// ownerID is zero, oldest first.
+	ListWebhooks(ctx context.Context, ownerID int64) ([]domain.Webhook, error)
+
+	// DeleteWebhook removes a webhook and drops its pending deliveries.
+	DeleteWebhook(ctx context.Context, id int64) error
+
+	// SubscribedWebhooks returns the webhooks that receive event for a link
+	// owned by linkOwnerID: those of the owner and those of admin keys.
+	// Webhooks of revoked keys are left out.
+	SubscribedWebhooks(ctx context.Context, linkOwnerID int64, event string) ([]domain.Webhook, error)
+
+	// EnqueueWebhookEvent stores an event and schedules its delivery to each
+	// webhook, all in one transaction. It reports false without enqueueing
+	// anything if an event with the same ID was stored before.
+	EnqueueWebhookEvent(ctx context.Context, event *domain.WebhookEvent, payload []byte, webhookIDs []int64) (bool, error)
+
+	// DueWebhookDeliveries returns up to limit deliveries whose next attempt
+	// is due at now, oldest first.
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error)
 
-	// GetByCode retrieves a URL by its short code.
-	GetByCode(code string) (*domain.URL, error)
+	// MarkWebhookDelivered removes a delivery that succeeded.
+	MarkWebhookDelivered(ctx context.Context, id int64) error
 
-	// GetByOriginal retrieves a URL by its original URL (for deduplication).
-	GetByOriginal(original string) (*domain.URL, error)
+	// RetryWebhookDelivery records a failed attempt and schedules the next.
+	RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error
 
-	// IncrementClicks increases the click count for a URL.
-	IncrementClicks(code string) error
+	// DeadLetterWebhookDelivery moves a delivery that failed for the last
+	// time to the dead-letter table.
+	DeadLetterWebhookDelivery(ctx context.Context, id int64, lastErr string) error
 
-	// GlobalStats returns aggregate statistics for all URLs.
-	GlobalStats() (*domain.GlobalStats, error)
+	// ListDeadLetters returns the abandoned deliveries of a webhook, newest
+	// first.
+	ListDeadLetters(ctx context.Context, webhookID int64) ([]domain.DeadLetter, error)
 }
@@ -0,0 +1,147 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"time"
+
+	"github.com/devaloi/shrink/internal/hll"
+)
+
+// RollupClicks moves up to limit clicks made before cutoff into click_rollups
+// and deletes them from clicks, in one transaction. Rollups keep a count per
+// link, UTC day, dimension and bot flag; the IP hash and request ID of each
+// click are dropped, and the clicks stop counting in owner_stat_buckets. It
+// returns how many clicks were moved.
+func (r *SQLite) RollupClicks(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	batch := "SELECT id FROM clicks WHERE clicked_at < ? ORDER BY clicked_at, id LIMIT ?"
+	args := []any{cutoff.UTC().Format(timeFormat), limit}
+
+	var moved int64
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		_, err := tx.q.ExecContext(ctx,
+			"INSERT INTO click_rollups (url_id, day, referrer_host, agent_class, os, browser, is_bot, clicks)"+
+				" SELECT url_id, date(clicked_at), referrer_host, agent_class, os, browser, is_bot, COUNT(*)"+
+				" FROM clicks WHERE id IN ("+batch+")"+
+				" GROUP BY url_id, date(clicked_at), referrer_host, agent_class, os, browser, is_bot"+
+				" ON CONFLICT (url_id, day, referrer_host, agent_class, os, browser, is_bot)"+
+				" DO UPDATE SET clicks = clicks + excluded.clicks",
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("roll up clicks: %w", err)
+		}
+
+		// owner_stat_buckets counts raw clicks only. Those of deleted links
+		// were taken out when the link was deleted.
+		_, err = tx.q.ExecContext(ctx,
+			"INSERT INTO owner_stat_buckets (bucket, owner_id, created, clicks)"+
+				" SELECT "+statBucket("c.clicked_at")+" AS bucket, COALESCE(u.owner_id, 0) AS owner, 0, -COUNT(*)"+
+				" FROM clicks c JOIN urls u ON u.id = c.url_id"+
+				" WHERE c.id IN ("+batch+") AND c.is_bot = 0 AND u.deleted_at IS NULL"+
+				" GROUP BY bucket, owner"+statBucketUpsert,
+			args...,
+		)
+		if err != nil {
+			return fmt.Errorf("update stat buckets: %w", err)
+		}
+
+		result, err := tx.q.ExecContext(ctx, "DELETE FROM clicks WHERE id IN ("+batch+")", args...)
+		if err != nil {
+			return fmt.Errorf("delete rolled up clicks: %w", err)
+		}
+		moved, err = result.RowsAffected()
+		return err
+	})
+	if err != nil {
+		return 0, err
+	}
+	return moved, nil
+}
+
+// CompactVisitorSketches merges up to limit daily visitor sketches of days
+// before cutoff into one sketch per link and UTC month, keyed by the month
+// (YYYY-MM) in url_uniques, and deletes the daily rows, in one transaction.
+// It returns how many daily sketches were merged.
+func (r *SQLite) CompactVisitorSketches(ctx context.Context, cutoff time.Time, limit int) (int64, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	type monthKey struct {
+		urlID int64
+		month string
+	}
+
+	var merged int64
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		rows, err := tx.q.QueryContext(ctx,
+			"SELECT url_id, day, sketch FROM url_uniques WHERE length(day) = 10 AND day < ?"+
+				" ORDER BY url_id, day LIMIT ?",
+			cutoff.UTC().Format(dayFormat), limit,
+		)
+		if err != nil {
+			return fmt.Errorf("list visitor sketches: %w", err)
+		}
+
+		months := make(map[monthKey]*hll.Sketch)
+		var days []any
+		for rows.Next() {
+			var urlID int64
+			var day string
+			var data []byte
+			if err := rows.Scan(&urlID, &day, &data); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("scan visitor sketch: %w", err)
+			}
+			sketch := hll.New()
+			if err := sketch.UnmarshalBinary(data); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("decode visitor sketch for %s: %w", day, err)
+			}
+
+			key := monthKey{urlID, day[:len(monthFormat)]}
+			if months[key] == nil {
+				months[key] = hll.New()
+			}
+			months[key].Merge(sketch)
+			days = append(days, urlID, day)
+		}
+		if err := rows.Close(); err != nil {
+			return fmt.Errorf("list visitor sketches: %w", err)
+		}
+		if err := rows.Err(); err != nil {
+			return fmt.Errorf("list visitor sketches: %w", err)
+		}
+
+		for key, days := range months {
+			sketch, err := tx.loadSketch(ctx, key.urlID, key.month)
+			if err != nil {
+				return err
+			}
+			sketch.Merge(days)
+			if err := tx.saveSketch(ctx, key.urlID, key.month, sketch); err != nil {
+				return err
+			}
+		}
+
+		stmt, err := tx.q.PrepareContext(ctx, "DELETE FROM url_uniques WHERE url_id = ? AND day = ?")
+		if err != nil {
+			return fmt.Errorf("delete visitor sketches: %w", err)
+		}
+		defer func() { _ = stmt.Close() }()
+		for i := 0; i < len(days); i += 2 {
+			if _, err := stmt.ExecContext(ctx, days[i], days[i+1]); err != nil {
+				return fmt.Errorf("delete visitor sketches: %w", err)
+			}
+		}
+		merged = int64(len(days) / 2)
+		return nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return merged, nil
+}
@@ -1,75 +1,423 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
 	"fmt"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/mattn/go-sqlite3"
+
+	"github.com/devaloi/shrink/internal/codegen"
 	"github.com/devaloi/shrink/internal/domain"
 	"github.com/devaloi/shrink/internal/encoding"
+	"github.com/devaloi/shrink/internal/hll"
+	"github.com/devaloi/shrink/internal/migrate"
+	"github.com/devaloi/shrink/migrations"
 )
 
+// maxCreateAttempts bounds how many row IDs Create will skip when their
+// code has already been claimed by a custom alias or another link.
+const maxCreateAttempts = 10
+
+// timeFormat is the layout used for timestamps written by the repository.
+// It matches SQLite's CURRENT_TIMESTAMP so values compare lexically.
+const timeFormat = "2006-01-02 15:04:05"
+
+// dayFormat is the layout of the UTC day keys of url_uniques and
+// click_rollups.
+const dayFormat = "2006-01-02"
+
+// monthFormat is the layout of the UTC month keys of url_uniques rows that
+// CompactVisitorSketches merged days into.
+const monthFormat = "2006-01"
+
+// rollupStart is the start of a click_rollups row's day in timeFormat, for
+// comparing against click time ranges.
+const rollupStart = "(r.day || ' 00:00:00')"
+
+// urlColumns lists the columns scanned by scanURL, in order.
+const urlColumns = "id, code, original, clicks, bot_clicks, created_at, disabled, expires_at, max_clicks, fallback_url, redirect_type, owner_id, expiry_notified"
+
+// DefaultQueryTimeout bounds how long a repository call may run.
+const DefaultQueryTimeout = 5 * time.Second
+
+// querier is the subset of *sql.DB and *sql.Tx used to run statements.
+type querier interface {
+	ExecContext(ctx context.Context, query string, args ...any) (sql.Result, error)
+	QueryContext(ctx context.Context, query string, args ...any) (*sql.Rows, error)
+	QueryRowContext(ctx context.Context, query string, args ...any) *sql.Row
+	PrepareContext(ctx context.Context, query string) (*sql.Stmt, error)
+}
+
 // SQLite implements the Repository interface using SQLite.
 type SQLite struct {
-	db *sql.DB
+	db      *sql.DB
+	q       querier
+	timeout time.Duration
+	codes   codegen.Generator
+
+	// writeMu serializes writes. SQLite allows one writer at a time, and a
+	// shared-cache database reports a second one as locked at once instead
+	// of waiting for the busy timeout.
+	writeMu *sync.Mutex
+}
+
+// Option configures a SQLite repository.
+type Option func(*SQLite)
+
+// WithQueryTimeout bounds how long each repository call may run, on top of
+// any deadline of the context it is given. Zero leaves calls bounded by
+// their context only.
+func WithQueryTimeout(d time.Duration) Option {
+	return func(r *SQLite) {
+		r.timeout = d
+	}
+}
+
+// WithCodeGenerator sets how Create derives codes for new links. The default
+// is sequential base62 codes.
+func WithCodeGenerator(g codegen.Generator) Option {
+	return func(r *SQLite) {
+		r.codes = g
+	}
 }
 
 // NewSQLite creates a new SQLite repository with the given database connection.
-func NewSQLite(db *sql.DB) *SQLite {
-	return &SQLite{db: db}
+func NewSQLite(db *sql.DB, opts ...Option) *SQLite {
+	r := &SQLite{
+		db:      db,
+		q:       db,
+		timeout: DefaultQueryTimeout,
+		codes:   codegen.NewSequential(encoding.Base62),
+		writeMu: &sync.Mutex{},
+	}
+	for _, opt := range opts {
+		opt(r)
+	}
+	return r
 }
 
-// Migrate runs the database migrations.
+// withTimeout derives the context a repository call runs its statements
+// under.
+func (r *SQLite) withTimeout(ctx context.Context) (context.Context, context.CancelFunc) {
+	if r.timeout <= 0 {
+		return ctx, func() {}
+	}
+	return context.WithTimeout(ctx, r.timeout)
+}
+
+// WithTx runs fn with a repository bound to a single transaction, committing
+// if fn returns nil and rolling back otherwise. Calls made on a repository
+// that is already inside a transaction join it. The transaction is rolled
+// back if ctx is done before it commits.
+func (r *SQLite) WithTx(ctx context.Context, fn func(Repository) error) error {
+	return r.inTx(ctx, func(tx *SQLite) error { return fn(tx) })
+}
+
+// inTx runs fn inside a transaction, reusing the current one if any. The
+// transaction holds the write lock until it ends.
+func (r *SQLite) inTx(ctx context.Context, fn func(*SQLite) error) error {
+	if _, ok := r.q.(*sql.Tx); ok {
+		return fn(r)
+	}
+
+	r.writeMu.Lock()
+	defer r.writeMu.Unlock()
+
+	tx, err := r.db.BeginTx(ctx, nil)
+	if err != nil {
+		return fmt.Errorf("begin transaction: %w", err)
+	}
+	defer func() { _ = tx.Rollback() }()
+
+	bound := *r
+	bound.q = tx
+	if err := fn(&bound); err != nil {
+		return err
+	}
+
+	if err := tx.Commit(); err != nil {
+		return fmt.Errorf("commit transaction: %w", err)
+	}
+	return nil
+}
+
+// Migrate applies the pending migrations in the migrations directory and
+// backfills derived columns of rows written before they existed.
 func (r *SQLite) Migrate() error {
-	schema := `
-		CREATE TABLE IF NOT EXISTS urls (
-			id INTEGER PRIMARY KEY AUTOINCREMENT,
-			code TEXT UNIQUE NOT NULL,
-			original TEXT NOT NULL,
-			clicks INTEGER DEFAULT 0,
-			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
-		);
-		CREATE INDEX IF NOT EXISTS idx_urls_code ON urls(code);
-		CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);
-	`
-	_, err := r.db.Exec(schema)
+	all, err := migrate.Load(migrations.FS)
 	if err != nil {
 		return fmt.Errorf("migrate: %w", err)
 	}
+	if _, err := migrate.New(r.db, all).Up(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+
+	if err := r.backfillHosts(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	if err := r.backfillDedupKeys(); err != nil {
+		return fmt.Errorf("migrate: %w", err)
+	}
+	return nil
+}
+
+// backfillHosts fills in the host column for rows created before it existed.
+func (r *SQLite) backfillHosts() error {
+	rows, err := r.db.Query("SELECT id, original FROM urls WHERE host = ''")
+	if err != nil {
+		return fmt.Errorf("find rows without host: %w", err)
+	}
+
+	hosts := make(map[int64]string)
+	for rows.Next() {
+		var id int64
+		var original string
+		if err := rows.Scan(&id, &original); err != nil {
+			_ = rows.Close()
+			return fmt.Errorf("scan row without host: %w", err)
+		}
+		hosts[id] = hostOf(original)
+	}
+	if err := rows.Close(); err != nil {
+		return fmt.Errorf("find rows without host: %w", err)
+	}
+
+	for id, host := range hosts {
+		if _, err := r.db.Exec("UPDATE urls SET host = ? WHERE id = ?", host, id); err != nil {
+			return fmt.Errorf("backfill host: %w", err)
+		}
+	}
 	return nil
 }
 
+// backfillDedupKeys fills in dedup_key for rows created before it existed.
+// The oldest link without options for each normalized destination and owner
+// gets the key, matching which link Shorten used to reuse. It runs in one
+// transaction so that an interrupted backfill starts over.
+func (r *SQLite) backfillDedupKeys() error {
+	return r.inTx(context.Background(), func(tx *SQLite) error {
+		rows, err := tx.q.QueryContext(context.Background(),
+			"SELECT id, original, owner_id, expires_at IS NULL AND max_clicks IS NULL AND fallback_url = ''"+
+				" AND redirect_type = 0 AND disabled = 0 AND deleted_at IS NULL"+
+				" FROM urls WHERE dedup_key IS NULL ORDER BY id",
+		)
+		if err != nil {
+			return fmt.Errorf("find rows without dedup key: %w", err)
+		}
+
+		type ownedKey struct {
+			ownerID int64
+			key     string
+		}
+		taken := make(map[ownedKey]bool)
+		var ids []int64
+		keys := make(map[int64]string)
+		for rows.Next() {
+			var id int64
+			var original string
+			var ownerID sql.NullInt64
+			var plain bool
+			if err := rows.Scan(&id, &original, &ownerID, &plain); err != nil {
+				_ = rows.Close()
+				return fmt.Errorf("scan row without dedup key: %w", err)
+			}
+
+			ids = append(ids, id)
+			k := ownedKey{ownerID.Int64, destinationKey(original)}
+			if plain && !taken[k] {
+				taken[k] = true
+				keys[id] = k.key
+			}
+		}
+		if err := rows.Close(); err != nil {
+			return fmt.Errorf("find rows without dedup key: %w", err)
+		}
+
+		for _, id := range ids {
+			_, err := tx.q.ExecContext(context.Background(), "UPDATE urls SET dedup_key = ? WHERE id = ?", keys[id], id)
+			if err != nil {
+				return fmt.Errorf("backfill dedup key: %w", err)
+			}
+		}
+		return nil
+	})
+}
+
 // Create inserts a new URL and returns it with the generated short code.
-func (r *SQLite) Create(original string) (*domain.URL, error) {
-	result, err := r.db.Exec(
-		"INSERT INTO urls (code, original) VALUES (?, ?)",
-		"_placeholder_", original,
-	)
+// The row ID is reserved and the code derived from it within one
+// transaction, so the row is never visible without its code. IDs whose
+// code is already taken, by an alias or an earlier random code, are
+// skipped. A link without options becomes the one Shorten reuses for its
+// destination and owner; if there already is one, Create returns
+// ErrDestinationExists.
+func (r *SQLite) Create(ctx context.Context, original string, opts domain.LinkOptions) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var key string
+	if opts.IsZero() {
+		key = destinationKey(original)
+	}
+
+	var created *domain.URL
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		for attempt := 0; attempt < maxCreateAttempts; attempt++ {
+			id, err := tx.nextURLID(ctx)
+			if err != nil {
+				return err
+			}
+
+			code, err := tx.codes.Code(id)
+			if err != nil {
+				return fmt.Errorf("generate code: %w", err)
+			}
+
+			created, err = tx.insertURL(ctx, id, code, original, key, opts)
+			if err == nil {
+				return nil
+			}
+			if isDuplicateDestination(err) {
+				return ErrDestinationExists
+			}
+			if !isUniqueViolation(err) {
+				return fmt.Errorf("create url: %w", err)
+			}
+		}
+		return fmt.Errorf("create url: no free code after %d attempts", maxCreateAttempts)
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create url: %w", err)
+		return nil, err
 	}
+	return created, nil
+}
 
-	id, err := result.LastInsertId()
+// nextURLID reserves the next ID from the urls AUTOINCREMENT sequence.
+// Bumping the sequence is a write, so the transaction holds SQLite's write
+// lock from its first statement and concurrent creates queue up rather than
+// reserve the same ID.
+func (r *SQLite) nextURLID(ctx context.Context) (int64, error) {
+	var id int64
+	err := r.q.QueryRowContext(ctx,
+		"UPDATE sqlite_sequence SET seq = seq + 1 WHERE name = 'urls' RETURNING seq",
+	).Scan(&id)
+	if err == sql.ErrNoRows {
+		// No row has ever been inserted, so there is no sequence yet.
+		err = r.q.QueryRowContext(ctx, "SELECT COALESCE(MAX(id), 0) + 1 FROM urls").Scan(&id)
+	}
 	if err != nil {
-		return nil, fmt.Errorf("get last insert id: %w", err)
+		return 0, fmt.Errorf("reserve url id: %w", err)
+	}
+	return id, nil
+}
+
+// CreateWithCode inserts a new URL under the given short code.
+func (r *SQLite) CreateWithCode(ctx context.Context, code, original string, opts domain.LinkOptions) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	// Aliased links are never reused by Shorten, so they take no dedup key.
+	var created *domain.URL
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		var err error
+		created, err = tx.insertURL(ctx, 0, code, original, "", opts)
+		return err
+	})
+	if err != nil {
+		if isUniqueViolation(err) {
+			return nil, ErrCodeExists
+		}
+		return nil, fmt.Errorf("create url with code: %w", err)
+	}
+	return created, nil
+}
+
+// insertURL inserts a urls row with the given code, dedup key and options,
+// counts it in its owner's stats and returns it. A zero id lets SQLite
+// assign one. It must run in a transaction.
+func (r *SQLite) insertURL(ctx context.Context, id int64, code, original, key string, opts domain.LinkOptions) (*domain.URL, error) {
+	var expiresAt any
+	if opts.ExpiresAt != nil {
+		expiresAt = opts.ExpiresAt.UTC().Format(timeFormat)
+	}
+
+	created, err := scanURL(r.q.QueryRowContext(ctx,
+		"INSERT INTO urls (id, code, original, host, dedup_key, expires_at, max_clicks, fallback_url, redirect_type, owner_id)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?, ?) RETURNING "+urlColumns,
+		nullableID(id), code, original, hostOf(original), key, expiresAt,
+		opts.MaxClicks, opts.FallbackURL, opts.RedirectType, nullableID(opts.OwnerID),
+	))
+	if err != nil {
+		return nil, err
+	}
+	if err := r.addOwnerStats(ctx, created.OwnerID, 1, 0); err != nil {
+		return nil, err
+	}
+	if err := r.addStatBucket(ctx, created.OwnerID, created.CreatedAt, 1, 0); err != nil {
+		return nil, err
+	}
+	return created, nil
+}
+
+// nullableID maps a zero ID to SQL NULL.
+func nullableID(id int64) any {
+	if id == 0 {
+		return nil
 	}
+	return id
+}
 
-	code := encoding.Encode(id)
+// hostOf returns the lowercased host name of a URL, without any port.
+func hostOf(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
 
-	_, err = r.db.Exec("UPDATE urls SET code = ? WHERE id = ?", code, id)
+// destinationKey normalizes a destination URL for deduplication: the scheme
+// and host are lowercased, a default port is dropped and an empty path
+// becomes "/".
+func destinationKey(rawURL string) string {
+	parsed, err := url.Parse(rawURL)
 	if err != nil {
-		return nil, fmt.Errorf("update code: %w", err)
+		return rawURL
 	}
 
-	return r.GetByID(id)
+	parsed.Scheme = strings.ToLower(parsed.Scheme)
+	parsed.Host = strings.ToLower(parsed.Host)
+	if port := parsed.Port(); (parsed.Scheme == "http" && port == "80") || (parsed.Scheme == "https" && port == "443") {
+		parsed.Host = strings.TrimSuffix(parsed.Host, ":"+port)
+	}
+	if parsed.Path == "" && parsed.RawPath == "" && parsed.Opaque == "" {
+		parsed.Path = "/"
+	}
+	return parsed.String()
+}
+
+// isDuplicateDestination reports whether err is a violation of the unique
+// index on dedup keys.
+func isDuplicateDestination(err error) bool {
+	return isUniqueViolation(err) && strings.Contains(err.Error(), "idx_urls_dedup_key")
+}
+
+// isUniqueViolation reports whether err is a SQLite UNIQUE constraint failure.
+func isUniqueViolation(err error) bool {
+	var sqliteErr sqlite3.Error
+	return errors.As(err, &sqliteErr) && sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
 }
 
 // getURL executes a query that returns a single URL row.
-func (r *SQLite) getURL(query string, arg any) (*domain.URL, error) {
-	url := &domain.URL{}
-	err := r.db.QueryRow(query, arg).Scan(
-		&url.ID, &url.Code, &url.Original, &url.Clicks, &url.CreatedAt,
-	)
+func (r *SQLite) getURL(ctx context.Context, query string, args ...any) (*domain.URL, error) {
+	url, err := scanURL(r.q.QueryRowContext(ctx, query, args...))
 	if err == sql.ErrNoRows {
 		return nil, ErrNotFound
 	}
@@ -79,26 +427,726 @@ func (r *SQLite) getURL(query string, arg any) (*domain.URL, error) {
 	return url, nil
 }
 
+// scanURL scans a row selected with urlColumns.
+func scanURL(row interface{ Scan(...any) error }) (*domain.URL, error) {
+	url := &domain.URL{}
+	var expiresAt sql.NullTime
+	var maxClicks, ownerID sql.NullInt64
+	err := row.Scan(
+		&url.ID, &url.Code, &url.Original, &url.Clicks, &url.BotClicks, &url.CreatedAt, &url.Disabled,
+		&expiresAt, &maxClicks, &url.FallbackURL, &url.RedirectType, &ownerID, &url.ExpiryNotified,
+	)
+	if err != nil {
+		return nil, err
+	}
+	url.OwnerID = ownerID.Int64
+	if expiresAt.Valid {
+		url.ExpiresAt = &expiresAt.Time
+	}
+	if maxClicks.Valid {
+		url.MaxClicks = &maxClicks.Int64
+	}
+	return url, nil
+}
+
 // GetByID retrieves a URL by its database ID.
-func (r *SQLite) GetByID(id int64) (*domain.URL, error) {
-	return r.getURL("SELECT id, code, original, clicks, created_at FROM urls WHERE id = ?", id)
+func (r *SQLite) GetByID(ctx context.Context, id int64) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.getURL(ctx, "SELECT "+urlColumns+" FROM urls WHERE id = ? AND deleted_at IS NULL", id)
 }
 
 // GetByCode retrieves a URL by its short code.
-func (r *SQLite) GetByCode(code string) (*domain.URL, error) {
-	return r.getURL("SELECT id, code, original, clicks, created_at FROM urls WHERE code = ?", code)
+func (r *SQLite) GetByCode(ctx context.Context, code string) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.getURL(ctx, "SELECT "+urlColumns+" FROM urls WHERE code = ? AND deleted_at IS NULL", code)
+}
+
+// GetByOriginal retrieves a URL by its original URL and owner if it exists.
+// Links created with options, disabled or deleted are never returned.
+func (r *SQLite) GetByOriginal(ctx context.Context, original string, ownerID int64) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.getURL(ctx,
+		"SELECT "+urlColumns+" FROM urls WHERE COALESCE(owner_id, 0) = ? AND dedup_key = ?",
+		ownerID, destinationKey(original),
+	)
+}
+
+// List returns up to filter.Limit URLs matching the filter. Pages are keyed on
+// the sort column plus id, so results stay stable while rows are added.
+func (r *SQLite) List(ctx context.Context, filter domain.ListFilter) ([]domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	where := []string{"deleted_at IS NULL"}
+	var args []any
+
+	if filter.OwnerID != 0 {
+		where = append(where, "owner_id = ?")
+		args = append(args, filter.OwnerID)
+	}
+	if filter.Host != "" {
+		where = append(where, "host = ?")
+		args = append(args, strings.ToLower(filter.Host))
+	}
+	if filter.Query != "" {
+		pattern := "%" + escapeLike(filter.Query) + "%"
+		where = append(where, `(original LIKE ? ESCAPE '\' OR code LIKE ? ESCAPE '\')`)
+		args = append(args, pattern, pattern)
+	}
+	if filter.CreatedAfter != nil {
+		where = append(where, "created_at >= ?")
+		args = append(args, filter.CreatedAfter.UTC().Format(timeFormat))
+	}
+	if filter.CreatedBefore != nil {
+		where = append(where, "created_at < ?")
+		args = append(args, filter.CreatedBefore.UTC().Format(timeFormat))
+	}
+
+	sortColumn := "created_at"
+	if filter.SortBy == domain.SortClicks {
+		sortColumn = "clicks"
+	}
+	direction, cmp := "DESC", "<"
+	if filter.Ascending {
+		direction, cmp = "ASC", ">"
+	}
+
+	if filter.After != nil {
+		where = append(where, fmt.Sprintf("(%s, id) %s (?, ?)", sortColumn, cmp))
+		if sortColumn == "clicks" {
+			args = append(args, filter.After.Clicks, filter.After.ID)
+		} else {
+			args = append(args, filter.After.CreatedAt.UTC().Format(timeFormat), filter.After.ID)
+		}
+	}
+
+	query := fmt.Sprintf(
+		"SELECT %s FROM urls WHERE %s ORDER BY %s %s, id %s LIMIT ?",
+		urlColumns, strings.Join(where, " AND "), sortColumn, direction, direction,
+	)
+	args = append(args, filter.Limit)
+
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list urls: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	urls := []domain.URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan url: %w", err)
+		}
+		urls = append(urls, *url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list urls: %w", err)
+	}
+	return urls, nil
+}
+
+// escapeLike escapes LIKE wildcards so s matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, "%", `\%`, "_", `\_`).Replace(s)
 }
 
-// GetByOriginal retrieves a URL by its original URL if it exists.
-func (r *SQLite) GetByOriginal(original string) (*domain.URL, error) {
-	return r.getURL("SELECT id, code, original, clicks, created_at FROM urls WHERE original = ?", original)
+// UpdateOriginal changes a URL's destination and records the previous
+// destination in url_revisions within a single transaction. The transaction
+// takes SQLite's write lock before reading the current destination, so
+// concurrent edits queue up and each records the destination it replaced.
+func (r *SQLite) UpdateOriginal(ctx context.Context, code, original, changedBy string) (*domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	var updated *domain.URL
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		// A no-op write, so the read below sees the latest committed edit.
+		_, err := tx.q.ExecContext(ctx,
+			"UPDATE urls SET original = original WHERE code = ? AND deleted_at IS NULL", code,
+		)
+		if err != nil {
+			return fmt.Errorf("lock url: %w", err)
+		}
+
+		current, err := tx.GetByCode(ctx, code)
+		if err != nil {
+			return err
+		}
+		if current.Original == original {
+			updated = current
+			return nil
+		}
+
+		_, err = tx.q.ExecContext(ctx,
+			"INSERT INTO url_revisions (url_id, original, changed_by, changed_at) VALUES (?, ?, ?, ?)",
+			current.ID, current.Original, changedBy, time.Now().UTC().Format(timeFormat),
+		)
+		if err != nil {
+			return fmt.Errorf("record revision: %w", err)
+		}
+
+		_, err = tx.q.ExecContext(ctx,
+			"UPDATE urls SET original = ?, host = ?, dedup_key = '' WHERE id = ?",
+			original, hostOf(original), current.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("update original: %w", err)
+		}
+
+		updated, err = tx.GetByID(ctx, current.ID)
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	return updated, nil
 }
 
-// IncrementClicks increases the click count for a URL by 1.
-func (r *SQLite) IncrementClicks(code string) error {
-	result, err := r.db.Exec("UPDATE urls SET clicks = clicks + 1 WHERE code = ?", code)
+// ListRevisions returns the revisions of a URL, newest first.
+func (r *SQLite) ListRevisions(ctx context.Context, code string) ([]domain.Revision, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	current, err := r.GetByCode(ctx, code)
 	if err != nil {
-		return fmt.Errorf("increment clicks: %w", err)
+		return nil, err
+	}
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT id, original, changed_by, changed_at FROM url_revisions WHERE url_id = ? ORDER BY id DESC",
+		current.ID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	revisions := []domain.Revision{}
+	for rows.Next() {
+		var rev domain.Revision
+		if err := rows.Scan(&rev.ID, &rev.Original, &rev.ChangedBy, &rev.ChangedAt); err != nil {
+			return nil, fmt.Errorf("scan revision: %w", err)
+		}
+		revisions = append(revisions, rev)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list revisions: %w", err)
+	}
+	return revisions, nil
+}
+
+// GetRevision retrieves a single revision of a URL.
+func (r *SQLite) GetRevision(ctx context.Context, code string, id int64) (*domain.Revision, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rev := &domain.Revision{}
+	err := r.q.QueryRowContext(ctx,
+		"SELECT rv.id, rv.original, rv.changed_by, rv.changed_at FROM url_revisions rv"+
+			" JOIN urls u ON u.id = rv.url_id"+
+			" WHERE u.code = ? AND u.deleted_at IS NULL AND rv.id = ?",
+		code, id,
+	).Scan(&rev.ID, &rev.Original, &rev.ChangedBy, &rev.ChangedAt)
+	if err == sql.ErrNoRows {
+		return nil, ErrRevisionNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get revision: %w", err)
+	}
+	return rev, nil
+}
+
+// Delete tombstones a URL. The row is kept so its code is never reissued.
+// The URL, its clicks and its creation stop counting in its owner's stats.
+func (r *SQLite) Delete(ctx context.Context, code string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *SQLite) error {
+		deleted, err := scanURL(tx.q.QueryRowContext(ctx,
+			"UPDATE urls SET deleted_at = ?, dedup_key = '' WHERE code = ? AND deleted_at IS NULL RETURNING "+urlColumns,
+			time.Now().UTC().Format(timeFormat), code,
+		))
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("delete url: %w", err)
+		}
+
+		if err := tx.addOwnerStats(ctx, deleted.OwnerID, -1, -deleted.Clicks); err != nil {
+			return err
+		}
+		if err := tx.addStatBucket(ctx, deleted.OwnerID, deleted.CreatedAt, -1, 0); err != nil {
+			return err
+		}
+		_, err = tx.q.ExecContext(ctx,
+			"INSERT INTO owner_stat_buckets (bucket, owner_id, created, clicks)"+
+				" SELECT "+statBucket("clicked_at")+" AS bucket, ?, 0, -COUNT(*) FROM clicks"+
+				" WHERE url_id = ? AND is_bot = 0 GROUP BY bucket"+statBucketUpsert,
+			deleted.OwnerID, deleted.ID,
+		)
+		if err != nil {
+			return fmt.Errorf("update stat buckets: %w", err)
+		}
+		return nil
+	})
+}
+
+// SetDisabled disables or re-enables redirects for a URL. A disabled link
+// is no longer reused by Shorten, even once it is enabled again.
+func (r *SQLite) SetDisabled(ctx context.Context, code string, disabled bool) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.updateByCode(ctx,
+		"UPDATE urls SET disabled = ?, dedup_key = CASE WHEN ? THEN '' ELSE dedup_key END"+
+			" WHERE code = ? AND deleted_at IS NULL",
+		disabled, disabled, code,
+	)
+}
+
+// MarkExpiryNotified sets a URL's expiry_notified flag, reporting whether
+// this call was the one to set it.
+func (r *SQLite) MarkExpiryNotified(ctx context.Context, code string) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.updateByCode(ctx,
+		"UPDATE urls SET expiry_notified = 1 WHERE code = ? AND deleted_at IS NULL AND expiry_notified = 0",
+		code,
+	)
+	if errors.Is(err, ErrNotFound) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// ExpiredLinks returns up to limit live URLs past their expiry date or click
+// budget at now whose expiry_notified flag is not set, oldest first.
+func (r *SQLite) ExpiredLinks(ctx context.Context, now time.Time, limit int) ([]domain.URL, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT "+urlColumns+" FROM urls"+
+			" WHERE expiry_notified = 0 AND deleted_at IS NULL AND (expires_at IS NOT NULL OR max_clicks IS NOT NULL)"+
+			" AND (expires_at <= ? OR clicks >= max_clicks) ORDER BY id LIMIT ?",
+		now.UTC().Format(timeFormat), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list expired urls: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	urls := []domain.URL{}
+	for rows.Next() {
+		url, err := scanURL(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan url: %w", err)
+		}
+		urls = append(urls, *url)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list expired urls: %w", err)
+	}
+	return urls, nil
+}
+
+// ClaimClick counts a human click toward a URL's click budget in the same
+// statement that checks it.
+func (r *SQLite) ClaimClick(ctx context.Context, code string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		var ownerID int64
+		err := tx.q.QueryRowContext(ctx,
+			"UPDATE urls SET clicks = clicks + 1"+
+				" WHERE code = ? AND deleted_at IS NULL AND (max_clicks IS NULL OR clicks < max_clicks)"+
+				" RETURNING COALESCE(owner_id, 0)",
+			code,
+		).Scan(&ownerID)
+		if err == sql.ErrNoRows {
+			return ErrNotFound
+		}
+		if err != nil {
+			return fmt.Errorf("update url: %w", err)
+		}
+		return tx.addOwnerStats(ctx, ownerID, 0, 1)
+	})
+	if !errors.Is(err, ErrNotFound) {
+		return err
+	}
+	if _, err := r.GetByCode(ctx, code); err != nil {
+		return err
+	}
+	return ErrClickBudgetSpent
+}
+
+// RecordClick stores a click event for a URL, increments its click count
+// unless ClaimClick already did, and adds the visitor to the day's unique
+// visitor sketch. urls.clicks and urls.bot_clicks are running totals of the
+// human and bot rows of the clicks table, kept so that click budgets and
+// sorting by clicks stay cheap. Bots are not counted as visitors.
+func (r *SQLite) RecordClick(ctx context.Context, code string, click domain.Click) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *SQLite) error {
+		return tx.recordClicks(ctx, code, []domain.Click{click})
+	})
+}
+
+// RecordClicks stores batches of click events keyed by code in a single
+// transaction. Codes that no longer resolve to a live URL are skipped.
+func (r *SQLite) RecordClicks(ctx context.Context, batch map[string][]domain.Click) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	codes := make([]string, 0, len(batch))
+	for code := range batch {
+		codes = append(codes, code)
+	}
+	sort.Strings(codes)
+
+	return r.inTx(ctx, func(tx *SQLite) error {
+		for _, code := range codes {
+			err := tx.recordClicks(ctx, code, batch[code])
+			if err != nil && !errors.Is(err, ErrNotFound) {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// recordClicks stores clicks for one URL, bumping its counters and its
+// owner's stats once and writing each day's visitor sketch at most once.
+func (r *SQLite) recordClicks(ctx context.Context, code string, clicks []domain.Click) error {
+	if len(clicks) == 0 {
+		return nil
+	}
+
+	var human, bots int
+	for _, c := range clicks {
+		switch {
+		case c.Bot:
+			bots++
+		case !c.Counted:
+			human++
+		}
+	}
+
+	// Increment first so the transaction takes the write lock up front
+	// instead of upgrading from a read.
+	err := r.updateByCode(ctx,
+		"UPDATE urls SET clicks = clicks + ?, bot_clicks = bot_clicks + ? WHERE code = ? AND deleted_at IS NULL",
+		human, bots, code,
+	)
+	if err != nil {
+		return err
+	}
+
+	var urlID, ownerID int64
+	err = r.q.QueryRowContext(ctx, "SELECT id, COALESCE(owner_id, 0) FROM urls WHERE code = ?", code).Scan(&urlID, &ownerID)
+	if err != nil {
+		return fmt.Errorf("record click: %w", err)
+	}
+	if human > 0 {
+		if err := r.addOwnerStats(ctx, ownerID, 0, int64(human)); err != nil {
+			return err
+		}
+	}
+
+	stmt, err := r.q.PrepareContext(ctx,
+		"INSERT INTO clicks (url_id, clicked_at, referrer_host, agent_class, os, browser, ip_hash, request_id, is_bot)"+
+			" VALUES (?, ?, ?, ?, ?, ?, ?, ?, ?)",
+	)
+	if err != nil {
+		return fmt.Errorf("record click: %w", err)
+	}
+	defer func() { _ = stmt.Close() }()
+
+	visitors := make(map[string][]uint64)
+	buckets := make(map[time.Time]int64)
+	for _, c := range clicks {
+		clickedAt := c.ClickedAt
+		if clickedAt.IsZero() {
+			clickedAt = time.Now()
+		}
+		clickedAt = clickedAt.UTC()
+
+		_, err := stmt.ExecContext(ctx,
+			urlID, clickedAt.Format(timeFormat), c.ReferrerHost, c.AgentClass, c.OS, c.Browser,
+			c.IPHash, c.RequestID, c.Bot,
+		)
+		if err != nil {
+			return fmt.Errorf("record click: %w", err)
+		}
+
+		if !c.Bot {
+			buckets[clickedAt.Truncate(ClickBucketSize)]++
+		}
+		if !c.Bot && c.VisitorHash != 0 {
+			day := clickedAt.Format(dayFormat)
+			visitors[day] = append(visitors[day], c.VisitorHash)
+		}
+	}
+
+	for start, n := range buckets {
+		if err := r.addStatBucket(ctx, ownerID, start, 0, n); err != nil {
+			return err
+		}
+	}
+
+	for day, hashes := range visitors {
+		if err := r.addVisitors(ctx, urlID, day, hashes); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// addVisitors adds visitor hashes to a URL's sketch for day, writing the
+// sketch back only if it changed.
+func (r *SQLite) addVisitors(ctx context.Context, urlID int64, day string, hashes []uint64) error {
+	sketch, err := r.loadSketch(ctx, urlID, day)
+	if err != nil {
+		return err
+	}
+
+	changed := false
+	for _, h := range hashes {
+		if sketch.Add(h) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return r.saveSketch(ctx, urlID, day, sketch)
+}
+
+// loadSketch returns a URL's visitor sketch for a day or month, or an empty
+// sketch if there is none yet.
+func (r *SQLite) loadSketch(ctx context.Context, urlID int64, period string) (*hll.Sketch, error) {
+	sketch := hll.New()
+
+	var data []byte
+	err := r.q.QueryRowContext(ctx,
+		"SELECT sketch FROM url_uniques WHERE url_id = ? AND day = ?", urlID, period,
+	).Scan(&data)
+	switch {
+	case err == sql.ErrNoRows:
+	case err != nil:
+		return nil, fmt.Errorf("load visitor sketch: %w", err)
+	default:
+		if err := sketch.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("decode visitor sketch: %w", err)
+		}
+	}
+	return sketch, nil
+}
+
+// saveSketch writes a URL's visitor sketch for a day or month.
+func (r *SQLite) saveSketch(ctx context.Context, urlID int64, period string, sketch *hll.Sketch) error {
+	data, err := sketch.MarshalBinary()
+	if err != nil {
+		return fmt.Errorf("encode visitor sketch: %w", err)
+	}
+	_, err = r.exec(ctx,
+		"INSERT INTO url_uniques (url_id, day, sketch) VALUES (?, ?, ?)"+
+			" ON CONFLICT (url_id, day) DO UPDATE SET sketch = excluded.sketch",
+		urlID, period, data,
+	)
+	if err != nil {
+		return fmt.Errorf("save visitor sketch: %w", err)
+	}
+	return nil
+}
+
+// VisitorSketches returns the unique visitor sketches of a URL for the UTC
+// days from through to, inclusive, keyed by day, along with the monthly
+// sketches of compacted days in the same months, keyed by month.
+func (r *SQLite) VisitorSketches(ctx context.Context, code string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT s.day, s.sketch FROM url_uniques s JOIN urls u ON u.id = s.url_id"+
+			" WHERE u.code = ? AND u.deleted_at IS NULL AND ("+
+			"(length(s.day) = 10 AND s.day >= ? AND s.day <= ?) OR"+
+			" (length(s.day) = 7 AND s.day >= ? AND s.day <= ?))",
+		code, from.UTC().Format(dayFormat), to.UTC().Format(dayFormat),
+		from.UTC().Format(monthFormat), to.UTC().Format(monthFormat),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list visitor sketches: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	sketches := make(map[string]*hll.Sketch)
+	for rows.Next() {
+		var day string
+		var data []byte
+		if err := rows.Scan(&day, &data); err != nil {
+			return nil, fmt.Errorf("scan visitor sketch: %w", err)
+		}
+		sketch := hll.New()
+		if err := sketch.UnmarshalBinary(data); err != nil {
+			return nil, fmt.Errorf("decode visitor sketch for %s: %w", day, err)
+		}
+		sketches[day] = sketch
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list visitor sketches: %w", err)
+	}
+	return sketches, nil
+}
+
+// ClickBuckets returns the human clicks of a URL in [from, to), counted in
+// ClickBucketSize buckets aligned to UTC. Rolled-up clicks only keep their
+// day, so they are counted in the bucket at the start of their UTC day.
+func (r *SQLite) ClickBuckets(ctx context.Context, code string, from, to time.Time) ([]domain.ClickBucket, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	size := int64(ClickBucketSize / time.Second)
+	start, end := from.UTC().Format(timeFormat), to.UTC().Format(timeFormat)
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT bucket, SUM(n) FROM ("+
+			"SELECT CAST(strftime('%s', c.clicked_at) AS INTEGER) / ? * ? AS bucket, COUNT(*) AS n FROM clicks c"+
+			" JOIN urls u ON u.id = c.url_id"+
+			" WHERE u.code = ? AND u.deleted_at IS NULL AND c.is_bot = 0 AND c.clicked_at >= ? AND c.clicked_at < ?"+
+			" GROUP BY bucket"+
+			" UNION ALL"+
+			" SELECT CAST(strftime('%s', r.day) AS INTEGER), SUM(r.clicks) FROM click_rollups r"+
+			" JOIN urls u ON u.id = r.url_id"+
+			" WHERE u.code = ? AND u.deleted_at IS NULL AND r.is_bot = 0 AND "+rollupStart+" >= ? AND "+rollupStart+" < ?"+
+			" GROUP BY r.day"+
+			") GROUP BY bucket ORDER BY bucket",
+		size, size, code, start, end, code, start, end,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("count clicks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	buckets := []domain.ClickBucket{}
+	for rows.Next() {
+		var start int64
+		var b domain.ClickBucket
+		if err := rows.Scan(&start, &b.Clicks); err != nil {
+			return nil, fmt.Errorf("scan click bucket: %w", err)
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("count clicks: %w", err)
+	}
+	return buckets, nil
+}
+
+// ClickBreakdown counts the human clicks of a URL by referrer host, device
+// class, OS and browser, keeping the top q.Limit values of each. Rolled-up
+// clicks are included by the start of their UTC day.
+func (r *SQLite) ClickBreakdown(ctx context.Context, code string, q domain.BreakdownQuery) (*domain.Breakdown, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	clicksWhere := " FROM clicks c JOIN urls u ON u.id = c.url_id WHERE u.code = ? AND u.deleted_at IS NULL AND c.is_bot = 0"
+	rollupsWhere := " FROM click_rollups r JOIN urls u ON u.id = r.url_id WHERE u.code = ? AND u.deleted_at IS NULL AND r.is_bot = 0"
+	clickArgs, rollupArgs := []any{code}, []any{code}
+	if q.From != nil {
+		clicksWhere += " AND c.clicked_at >= ?"
+		rollupsWhere += " AND " + rollupStart + " >= ?"
+		clickArgs = append(clickArgs, q.From.UTC().Format(timeFormat))
+		rollupArgs = append(rollupArgs, q.From.UTC().Format(timeFormat))
+	}
+	if q.To != nil {
+		clicksWhere += " AND c.clicked_at < ?"
+		rollupsWhere += " AND " + rollupStart + " < ?"
+		clickArgs = append(clickArgs, q.To.UTC().Format(timeFormat))
+		rollupArgs = append(rollupArgs, q.To.UTC().Format(timeFormat))
+	}
+	args := append(clickArgs, rollupArgs...)
+
+	breakdown := &domain.Breakdown{Code: code}
+	if err := r.q.QueryRowContext(ctx,
+		"SELECT (SELECT COUNT(*)"+clicksWhere+") + (SELECT COALESCE(SUM(r.clicks), 0)"+rollupsWhere+")", args...,
+	).Scan(&breakdown.Total); err != nil {
+		return nil, fmt.Errorf("count clicks: %w", err)
+	}
+
+	dimensions := []struct {
+		column string
+		dest   *[]domain.BreakdownEntry
+	}{
+		{"referrer_host", &breakdown.Referrers},
+		{"agent_class", &breakdown.Devices},
+		{"os", &breakdown.OS},
+		{"browser", &breakdown.Browsers},
+	}
+	for _, d := range dimensions {
+		entries, err := r.topValues(ctx,
+			"SELECT value, SUM(n) AS total FROM ("+
+				"SELECT c."+d.column+" AS value, COUNT(*) AS n"+clicksWhere+" GROUP BY c."+d.column+
+				" UNION ALL"+
+				" SELECT r."+d.column+", SUM(r.clicks)"+rollupsWhere+" GROUP BY r."+d.column+
+				") GROUP BY value ORDER BY total DESC, value LIMIT ?",
+			append(args, q.Limit)...,
+		)
+		if err != nil {
+			return nil, fmt.Errorf("break down clicks by %s: %w", d.column, err)
+		}
+		*d.dest = entries
+	}
+	return breakdown, nil
+}
+
+// topValues scans (value, count) rows into breakdown entries.
+func (r *SQLite) topValues(ctx context.Context, query string, args ...any) ([]domain.BreakdownEntry, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	entries := []domain.BreakdownEntry{}
+	for rows.Next() {
+		var e domain.BreakdownEntry
+		if err := rows.Scan(&e.Value, &e.Clicks); err != nil {
+			return nil, err
+		}
+		entries = append(entries, e)
+	}
+	return entries, rows.Err()
+}
+
+// exec runs a write statement, holding the write lock unless it is part of
+// a transaction, which already holds it.
+func (r *SQLite) exec(ctx context.Context, query string, args ...any) (sql.Result, error) {
+	if _, ok := r.q.(*sql.Tx); !ok {
+		r.writeMu.Lock()
+		defer r.writeMu.Unlock()
+	}
+	return r.q.ExecContext(ctx, query, args...)
+}
+
+// updateByCode executes an update and returns ErrNotFound if no row matched.
+func (r *SQLite) updateByCode(ctx context.Context, query string, args ...any) error {
+	result, err := r.exec(ctx, query, args...)
+	if err != nil {
+		return fmt.Errorf("update url: %w", err)
 	}
 	rows, err := result.RowsAffected()
 	if err != nil {
@@ -110,29 +1158,200 @@ func (r *SQLite) IncrementClicks(code string) error {
 	return nil
 }
 
-// GlobalStats returns aggregate statistics for all URLs.
-func (r *SQLite) GlobalStats() (*domain.GlobalStats, error) {
-	stats := &domain.GlobalStats{}
+// statBucketUpsert adds the counts of an insert into owner_stat_buckets to
+// the bucket's existing row.
+const statBucketUpsert = " ON CONFLICT (bucket, owner_id)" +
+	" DO UPDATE SET created = created + excluded.created, clicks = clicks + excluded.clicks"
 
-	err := r.db.QueryRow(
-		"SELECT COUNT(*), COALESCE(SUM(clicks), 0) FROM urls",
-	).Scan(&stats.TotalURLs, &stats.TotalClicks)
+// statBucket returns the SQL for the Unix start of the ClickBucketSize
+// bucket of a timestamp column.
+func statBucket(column string) string {
+	size := strconv.FormatInt(int64(ClickBucketSize/time.Second), 10)
+	return "CAST(strftime('%s', " + column + ") AS INTEGER) / " + size + " * " + size
+}
+
+// addOwnerStats adds to the running totals of ownerID's live URLs and
+// their human clicks. Owner zero holds URLs without an owner.
+func (r *SQLite) addOwnerStats(ctx context.Context, ownerID, urls, clicks int64) error {
+	_, err := r.q.ExecContext(ctx,
+		"INSERT INTO owner_stats (owner_id, urls, clicks) VALUES (?, ?, ?)"+
+			" ON CONFLICT (owner_id) DO UPDATE SET urls = urls + excluded.urls, clicks = clicks + excluded.clicks",
+		ownerID, urls, clicks,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("get global stats: %w", err)
+		return fmt.Errorf("update owner stats: %w", err)
 	}
+	return nil
+}
 
-	today := time.Now().Format("2006-01-02")
-	err = r.db.QueryRow(
-		"SELECT COUNT(*) FROM urls WHERE DATE(created_at) = ?",
-		today,
-	).Scan(&stats.URLsToday)
+// addStatBucket adds to the URLs created and the raw human clicks recorded
+// for ownerID in the ClickBucketSize bucket holding t.
+func (r *SQLite) addStatBucket(ctx context.Context, ownerID int64, t time.Time, created, clicks int64) error {
+	_, err := r.q.ExecContext(ctx,
+		"INSERT INTO owner_stat_buckets (bucket, owner_id, created, clicks) VALUES (?, ?, ?, ?)"+statBucketUpsert,
+		t.Truncate(ClickBucketSize).Unix(), ownerID, created, clicks,
+	)
 	if err != nil {
-		return nil, fmt.Errorf("get urls today: %w", err)
+		return fmt.Errorf("update stat buckets: %w", err)
+	}
+	return nil
+}
+
+// StatsTotals reads the number of URLs of ownerID, or of every owner when
+// it is zero, and their clicks from the running totals in owner_stats.
+func (r *SQLite) StatsTotals(ctx context.Context, ownerID int64) (*domain.StatsSnapshot, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT COALESCE(SUM(urls), 0), COALESCE(SUM(clicks), 0) FROM owner_stats"
+	args := []any{}
+	if ownerID != 0 {
+		query += " WHERE owner_id = ?"
+		args = append(args, ownerID)
 	}
 
+	stats := &domain.StatsSnapshot{}
+	if err := r.q.QueryRowContext(ctx, query, args...).Scan(&stats.TotalURLs, &stats.TotalClicks); err != nil {
+		return nil, fmt.Errorf("get global stats: %w", err)
+	}
 	return stats, nil
 }
 
+// Leaderboards ranks the URLs selected by q and their destination hosts by
+// human clicks since q.From.
+func (r *SQLite) Leaderboards(ctx context.Context, q domain.StatsQuery) (*domain.StatsSnapshot, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	owner, ownerArgs := "", []any{}
+	if q.OwnerID != 0 {
+		owner, ownerArgs = " AND u.owner_id = ?", []any{q.OwnerID}
+	}
+
+	// windowClicks counts the human clicks of each URL since the start of
+	// the window, raw and rolled up.
+	windowClicks := "(SELECT c.url_id, COUNT(*) AS n FROM clicks c" +
+		" WHERE c.is_bot = 0 AND c.clicked_at >= ? GROUP BY c.url_id" +
+		" UNION ALL" +
+		" SELECT r.url_id, SUM(r.clicks) FROM click_rollups r" +
+		" WHERE r.is_bot = 0 AND " + rollupStart + " >= ? GROUP BY r.url_id) w" +
+		" JOIN urls u ON u.id = w.url_id WHERE u.deleted_at IS NULL" + owner
+	from := q.From.UTC().Format(timeFormat)
+	args := append([]any{from, from}, ownerArgs...)
+	args = append(args, q.Limit)
+
+	stats := &domain.StatsSnapshot{}
+	var err error
+	if stats.TopLinks, err = r.topLinks(ctx, windowClicks, args); err != nil {
+		return nil, fmt.Errorf("get top links: %w", err)
+	}
+	if stats.TopDomains, err = r.topDomains(ctx, windowClicks, args); err != nil {
+		return nil, fmt.Errorf("get top domains: %w", err)
+	}
+	return stats, nil
+}
+
+// topLinks ranks the URLs of windowClicks by their clicks.
+func (r *SQLite) topLinks(ctx context.Context, windowClicks string, args []any) ([]domain.LinkClicks, error) {
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT u.code, u.original, SUM(w.n) AS total FROM "+windowClicks+
+			" GROUP BY u.id ORDER BY total DESC, u.id LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	links := []domain.LinkClicks{}
+	for rows.Next() {
+		var l domain.LinkClicks
+		if err := rows.Scan(&l.Code, &l.Original, &l.Clicks); err != nil {
+			return nil, err
+		}
+		links = append(links, l)
+	}
+	return links, rows.Err()
+}
+
+// topDomains ranks the destination hosts of windowClicks by their clicks.
+func (r *SQLite) topDomains(ctx context.Context, windowClicks string, args []any) ([]domain.DomainClicks, error) {
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT u.host, COUNT(DISTINCT u.id), SUM(w.n) AS total FROM "+windowClicks+
+			" GROUP BY u.host ORDER BY total DESC, u.host LIMIT ?",
+		args...,
+	)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	domains := []domain.DomainClicks{}
+	for rows.Next() {
+		var d domain.DomainClicks
+		if err := rows.Scan(&d.Domain, &d.Links, &d.Clicks); err != nil {
+			return nil, err
+		}
+		domains = append(domains, d)
+	}
+	return domains, rows.Err()
+}
+
+// CreatedBuckets counts the URLs created in the ClickBucketSize buckets
+// aligned to UTC that start in [from, to), from owner_stat_buckets. ownerID
+// zero counts every owner's URLs.
+func (r *SQLite) CreatedBuckets(ctx context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error) {
+	buckets, err := r.statBuckets(ctx, "created", ownerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("count created urls: %w", err)
+	}
+	return buckets, nil
+}
+
+// OwnerClickBuckets counts the raw human clicks recorded in the
+// ClickBucketSize buckets aligned to UTC that start in [from, to), from
+// owner_stat_buckets, for the URLs of ownerID or of every owner when it is
+// zero.
+func (r *SQLite) OwnerClickBuckets(ctx context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error) {
+	buckets, err := r.statBuckets(ctx, "clicks", ownerID, from, to)
+	if err != nil {
+		return nil, fmt.Errorf("count clicks: %w", err)
+	}
+	return buckets, nil
+}
+
+// statBuckets sums a column of owner_stat_buckets per bucket starting in
+// [from, to), leaving out empty buckets.
+func (r *SQLite) statBuckets(ctx context.Context, column string, ownerID int64, from, to time.Time) ([]domain.CountBucket, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT bucket, SUM(" + column + ") AS n FROM owner_stat_buckets WHERE bucket >= ? AND bucket < ?"
+	args := []any{from.Unix(), to.Unix()}
+	if ownerID != 0 {
+		query += " AND owner_id = ?"
+		args = append(args, ownerID)
+	}
+
+	rows, err := r.q.QueryContext(ctx, query+" GROUP BY bucket HAVING n > 0 ORDER BY bucket", args...)
+	if err != nil {
+		return nil, err
+	}
+	defer func() { _ = rows.Close() }()
+
+	buckets := []domain.CountBucket{}
+	for rows.Next() {
+		var start int64
+		var b domain.CountBucket
+		if err := rows.Scan(&start, &b.Count); err != nil {
+			return nil, err
+		}
+		b.Start = time.Unix(start, 0).UTC()
+		buckets = append(buckets, b)
+	}
+	return buckets, rows.Err()
+}
+
 // Close closes the database connection.
 func (r *SQLite) Close() error {
 	return r.db.Close()
@@ -1,11 +1,20 @@
 package repository
 
 import (
+	"context"
 	"database/sql"
+	"errors"
+	"fmt"
+	"path/filepath"
+	"sync"
 	"testing"
 	"time"
 
 	_ "github.com/mattn/go-sqlite3"
+
+	"github.com/devaloi/shrink/internal/codegen"
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/encoding"
 )
 
 func setupTestDB(t *testing.T) *SQLite {
@@ -16,154 +25,1638 @@ func setupTestDB(t *testing.T) *SQLite {
 		t.Fatalf("open db: %v", err)
 	}
 
-	repo := NewSQLite(db)
-	if err := repo.Migrate(); err != nil {
-		t.Fatalf("migrate: %v", err)
+	repo := NewSQLite(db)
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+
+	t.Cleanup(func() {
+		if err := repo.Close(); err != nil {
+			t.Errorf("close repo: %v", err)
+		}
+	})
+
+	return repo
+}
+
+func TestSQLite_Migrate_ExistingDatabase(t *testing.T) {
+	db, err := sql.Open("sqlite3", "file::memory:?cache=shared")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	repo := NewSQLite(db)
+	t.Cleanup(func() {
+		if err := repo.Close(); err != nil {
+			t.Errorf("close repo: %v", err)
+		}
+	})
+
+	// Schema and data as written by the original release.
+	_, err = db.Exec(`
+		CREATE TABLE urls (
+			id INTEGER PRIMARY KEY AUTOINCREMENT,
+			code TEXT UNIQUE NOT NULL,
+			original TEXT NOT NULL,
+			clicks INTEGER DEFAULT 0,
+			created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+		);
+		INSERT INTO urls (code, original) VALUES ('b', 'https://Legacy.example.com/page');
+		INSERT INTO urls (code, original, clicks) VALUES ('c', 'https://legacy.example.com/page', 3);
+	`)
+	if err != nil {
+		t.Fatalf("create legacy schema: %v", err)
+	}
+
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("second migrate: %v", err)
+	}
+
+	urls, err := repo.List(context.Background(), domain.ListFilter{Limit: 10, Host: "legacy.example.com"})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(urls) != 2 {
+		t.Errorf("expected legacy rows to be backfilled with their host, got %+v", urls)
+	}
+
+	found, err := repo.GetByOriginal(context.Background(), "https://legacy.example.com/page", 0)
+	if err != nil {
+		t.Fatalf("get by original: %v", err)
+	}
+	if found.Code != "b" {
+		t.Errorf("expected the oldest legacy row to be deduplicated against, got %q", found.Code)
+	}
+
+	stats, err := repo.StatsTotals(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("stats totals: %v", err)
+	}
+	if stats.TotalURLs != 2 || stats.TotalClicks != 3 {
+		t.Errorf("expected stats backfilled with 2 URLs and 3 clicks, got %d with %d", stats.TotalURLs, stats.TotalClicks)
+	}
+}
+
+func TestSQLite_Create(t *testing.T) {
+	repo := setupTestDB(t)
+
+	url, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if url.ID != 1 {
+		t.Errorf("expected ID 1, got %d", url.ID)
+	}
+	if url.Code == "" {
+		t.Errorf("expected valid code, got %q", url.Code)
+	}
+	if url.Original != "https://example.com" {
+		t.Errorf("expected original https://example.com, got %q", url.Original)
+	}
+	if url.Clicks != 0 {
+		t.Errorf("expected 0 clicks, got %d", url.Clicks)
+	}
+	if url.CreatedAt.IsZero() {
+		t.Error("expected non-zero created_at")
+	}
+}
+
+func TestSQLite_CreateWithCode(t *testing.T) {
+	repo := setupTestDB(t)
+
+	url, err := repo.CreateWithCode(context.Background(), "launch", "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create with code: %v", err)
+	}
+
+	if url.Code != "launch" {
+		t.Errorf("expected code launch, got %q", url.Code)
+	}
+
+	if _, err := repo.CreateWithCode(context.Background(), "launch", "https://other.com", domain.LinkOptions{}); err != ErrCodeExists {
+		t.Errorf("expected ErrCodeExists, got %v", err)
+	}
+}
+
+func TestSQLite_Create_SkipsAliasedCode(t *testing.T) {
+	repo := setupTestDB(t)
+
+	// "b" is the code the first generated row (ID 1) would receive.
+	if _, err := repo.CreateWithCode(context.Background(), "b", "https://alias.example.com", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create with code: %v", err)
+	}
+
+	url, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if url.Code == "b" {
+		t.Error("generated code must not reuse an alias")
+	}
+
+	found, err := repo.GetByCode(context.Background(), "b")
+	if err != nil {
+		t.Fatalf("get alias: %v", err)
+	}
+	if found.Original != "https://alias.example.com" {
+		t.Errorf("alias was overwritten: got %q", found.Original)
+	}
+}
+
+// setupFileDB opens a repository on a WAL-mode database file, so that
+// concurrent transactions use separate connections as in production.
+func setupFileDB(t *testing.T) *SQLite {
+	t.Helper()
+	db, err := sql.Open("sqlite3", filepath.Join(t.TempDir(), "shrink.db")+"?_journal_mode=WAL")
+	if err != nil {
+		t.Fatalf("open db: %v", err)
+	}
+	repo := NewSQLite(db)
+	t.Cleanup(func() { _ = repo.Close() })
+	if err := repo.Migrate(); err != nil {
+		t.Fatalf("migrate: %v", err)
+	}
+	return repo
+}
+
+func TestSQLite_Create_Concurrent(t *testing.T) {
+	repo := setupFileDB(t)
+
+	const n = 20
+	var wg sync.WaitGroup
+	codes := make([]string, n)
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			url, err := repo.Create(context.Background(), fmt.Sprintf("https://example.com/%d", i), domain.LinkOptions{})
+			if err == nil {
+				codes[i] = url.Code
+			}
+			errs[i] = err
+		}(i)
+	}
+	wg.Wait()
+
+	seen := make(map[string]bool)
+	for i, code := range codes {
+		if errs[i] != nil {
+			t.Fatalf("create %d: %v", i, errs[i])
+		}
+		if seen[code] {
+			t.Errorf("code %q issued twice", code)
+		}
+		seen[code] = true
+	}
+}
+
+func TestSQLite_Create_DuplicateDestination(t *testing.T) {
+	repo := setupTestDB(t)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, "HTTPS://Example.com:443", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := repo.Create(ctx, "https://example.com/", domain.LinkOptions{}); !errors.Is(err, ErrDestinationExists) {
+		t.Errorf("expected ErrDestinationExists for the same normalized destination, got %v", err)
+	}
+	found, err := repo.GetByOriginal(ctx, "https://EXAMPLE.com", 0)
+	if err != nil {
+		t.Fatalf("get by original: %v", err)
+	}
+	if found.Code != created.Code {
+		t.Errorf("expected code %q, got %q", created.Code, found.Code)
+	}
+
+	maxClicks := int64(5)
+	if _, err := repo.Create(ctx, "https://example.com/", domain.LinkOptions{MaxClicks: &maxClicks}); err != nil {
+		t.Errorf("links with options must not be deduplicated: %v", err)
+	}
+	if _, err := repo.Create(ctx, "https://example.com/", domain.LinkOptions{OwnerID: 7}); err != nil {
+		t.Errorf("links must only be deduplicated within an owner: %v", err)
+	}
+
+	if err := repo.SetDisabled(ctx, created.Code, true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if err := repo.SetDisabled(ctx, created.Code, false); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+	if _, err := repo.GetByOriginal(ctx, "https://example.com/", 0); err != ErrNotFound {
+		t.Errorf("expected a once disabled link not to be reused, got %v", err)
+	}
+	if _, err := repo.Create(ctx, "https://example.com/", domain.LinkOptions{}); err != nil {
+		t.Errorf("expected a new link once the old one was disabled: %v", err)
+	}
+}
+
+func TestDestinationKey(t *testing.T) {
+	tests := []struct {
+		in   string
+		want string
+	}{
+		{"https://example.com/a?b=c", "https://example.com/a?b=c"},
+		{"HTTPS://Example.COM", "https://example.com/"},
+		{"http://example.com:80/a", "http://example.com/a"},
+		{"https://example.com:8443/a", "https://example.com:8443/a"},
+		{"https://example.com/Path", "https://example.com/Path"},
+	}
+	for _, tt := range tests {
+		if got := destinationKey(tt.in); got != tt.want {
+			t.Errorf("destinationKey(%q) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
+
+// listCodes is a codegen.Generator that hands out codes from a list.
+type listCodes []string
+
+func (l *listCodes) Code(int64) (string, error) {
+	code := (*l)[0]
+	*l = (*l)[1:]
+	return code, nil
+}
+
+func TestSQLite_Create_CodeGenerator(t *testing.T) {
+	repo := setupTestDB(t)
+	ctx := context.Background()
+
+	if _, err := repo.CreateWithCode(ctx, "taken", "https://alias.example.com", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create with code: %v", err)
+	}
+
+	WithCodeGenerator(&listCodes{"taken", "fresh"})(repo)
+	url, err := repo.Create(ctx, "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if url.Code != "fresh" {
+		t.Errorf("expected a taken code to be retried, got %q", url.Code)
+	}
+
+	permuted, err := codegen.NewPermuted(encoding.Base62, "secret", 6)
+	if err != nil {
+		t.Fatalf("new permuted: %v", err)
+	}
+	WithCodeGenerator(permuted)(repo)
+	url, err = repo.Create(ctx, "https://example.com/permuted", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if id, err := permuted.ID(url.Code); err != nil || id != url.ID {
+		t.Errorf("expected code %q to map back to ID %d, got %d, %v", url.Code, url.ID, id, err)
+	}
+}
+
+func TestSQLite_Create_WithOptions(t *testing.T) {
+	repo := setupTestDB(t)
+
+	expiresAt := time.Date(2030, 1, 2, 3, 4, 5, 0, time.UTC)
+	maxClicks := int64(100)
+	opts := domain.LinkOptions{
+		ExpiresAt:   &expiresAt,
+		MaxClicks:   &maxClicks,
+		FallbackURL: "https://example.com/ended",
+	}
+
+	created, err := repo.Create(context.Background(), "https://example.com", opts)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	found, err := repo.GetByCode(context.Background(), created.Code)
+	if err != nil {
+		t.Fatalf("get by code: %v", err)
+	}
+
+	if found.ExpiresAt == nil || !found.ExpiresAt.Equal(expiresAt) {
+		t.Errorf("expected expires_at %v, got %v", expiresAt, found.ExpiresAt)
+	}
+	if found.MaxClicks == nil || *found.MaxClicks != maxClicks {
+		t.Errorf("expected max_clicks %d, got %v", maxClicks, found.MaxClicks)
+	}
+	if found.FallbackURL != "https://example.com/ended" {
+		t.Errorf("expected fallback_url https://example.com/ended, got %q", found.FallbackURL)
+	}
+
+	if _, err := repo.GetByOriginal(context.Background(), "https://example.com", 0); err != ErrNotFound {
+		t.Errorf("links with options must not be deduplicated, got %v", err)
+	}
+}
+
+func TestSQLite_WithTx(t *testing.T) {
+	repo := setupTestDB(t)
+
+	err := repo.WithTx(context.Background(), func(tx Repository) error {
+		if _, err := tx.Create(context.Background(), "https://example.com/a", domain.LinkOptions{}); err != nil {
+			return err
+		}
+		if _, err := tx.GetByOriginal(context.Background(), "https://example.com/a", 0); err != nil {
+			t.Errorf("row should be visible inside its transaction: %v", err)
+		}
+		_, err := tx.CreateWithCode(context.Background(), "kept", "https://example.com/b", domain.LinkOptions{})
+		return err
+	})
+	if err != nil {
+		t.Fatalf("commit: %v", err)
+	}
+
+	if _, err := repo.GetByCode(context.Background(), "kept"); err != nil {
+		t.Errorf("expected committed row, got %v", err)
+	}
+
+	rollback := errors.New("rollback")
+	err = repo.WithTx(context.Background(), func(tx Repository) error {
+		if _, err := tx.CreateWithCode(context.Background(), "discarded", "https://example.com/c", domain.LinkOptions{}); err != nil {
+			return err
+		}
+		return rollback
+	})
+	if err != rollback {
+		t.Fatalf("expected rollback error, got %v", err)
+	}
+
+	if _, err := repo.GetByCode(context.Background(), "discarded"); err != ErrNotFound {
+		t.Errorf("expected rolled back row to be absent, got %v", err)
+	}
+}
+
+func TestSQLite_QueryTimeout(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	if _, err := repo.GetByCode(ctx, created.Code); !errors.Is(err, context.Canceled) {
+		t.Errorf("expected context.Canceled, got %v", err)
+	}
+
+	WithQueryTimeout(time.Nanosecond)(repo)
+	if _, err := repo.GetByCode(context.Background(), created.Code); !errors.Is(err, context.DeadlineExceeded) {
+		t.Errorf("expected context.DeadlineExceeded, got %v", err)
+	}
+
+	WithQueryTimeout(0)(repo)
+	if _, err := repo.GetByCode(context.Background(), created.Code); err != nil {
+		t.Errorf("expected no timeout, got %v", err)
+	}
+}
+
+func TestSQLite_GetByCode(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	found, err := repo.GetByCode(context.Background(), created.Code)
+	if err != nil {
+		t.Fatalf("get by code: %v", err)
+	}
+
+	if found.ID != created.ID {
+		t.Errorf("expected ID %d, got %d", created.ID, found.ID)
+	}
+	if found.Original != created.Original {
+		t.Errorf("expected original %q, got %q", created.Original, found.Original)
+	}
+}
+
+func TestSQLite_GetByCode_NotFound(t *testing.T) {
+	repo := setupTestDB(t)
+
+	_, err := repo.GetByCode(context.Background(), "nonexistent")
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSQLite_GetByOriginal(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	found, err := repo.GetByOriginal(context.Background(), "https://example.com", 0)
+	if err != nil {
+		t.Fatalf("get by original: %v", err)
+	}
+
+	if found.Code != created.Code {
+		t.Errorf("expected code %q, got %q", created.Code, found.Code)
+	}
+
+	if _, err := repo.GetByOriginal(context.Background(), "https://example.com", 7); err != ErrNotFound {
+		t.Errorf("links must only be deduplicated within an owner, got %v", err)
+	}
+}
+
+func TestSQLite_APIKeys(t *testing.T) {
+	repo := setupTestDB(t)
+
+	key, err := repo.CreateAPIKey(context.Background(), "ci", "hash", "shk_1234", true)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	if key.Name != "ci" || !key.Admin || key.RevokedAt != nil {
+		t.Errorf("unexpected key: %+v", key)
+	}
+
+	found, err := repo.GetAPIKeyByHash(context.Background(), "hash")
+	if err != nil {
+		t.Fatalf("get api key: %v", err)
+	}
+	if found.ID != key.ID {
+		t.Errorf("expected key %d, got %d", key.ID, found.ID)
+	}
+
+	owned, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{OwnerID: key.ID})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if owned.OwnerID != key.ID {
+		t.Errorf("expected owner %d, got %d", key.ID, owned.OwnerID)
+	}
+
+	if err := repo.RevokeAPIKey(context.Background(), key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := repo.GetAPIKeyByHash(context.Background(), "hash"); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound for revoked key, got %v", err)
+	}
+	if err := repo.RevokeAPIKey(context.Background(), key.ID); err != ErrKeyNotFound {
+		t.Errorf("expected ErrKeyNotFound on second revoke, got %v", err)
+	}
+
+	keys, err := repo.ListAPIKeys(context.Background())
+	if err != nil {
+		t.Fatalf("list api keys: %v", err)
+	}
+	if len(keys) != 1 || keys[0].RevokedAt == nil {
+		t.Errorf("expected one revoked key, got %+v", keys)
+	}
+}
+
+func TestSQLite_RecordClick(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	clickedAt := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		click := domain.Click{
+			ClickedAt:    clickedAt,
+			ReferrerHost: "news.example.org",
+			AgentClass:   "mobile",
+			IPHash:       "abc123",
+			RequestID:    "req-" + string(rune('a'+i)),
+		}
+		if err := repo.RecordClick(context.Background(), created.Code, click); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	found, err := repo.GetByCode(context.Background(), created.Code)
+	if err != nil {
+		t.Fatalf("get by code: %v", err)
+	}
+
+	if found.Clicks != 5 {
+		t.Errorf("expected 5 clicks, got %d", found.Clicks)
+	}
+
+	var events int
+	var referrer, class, stamp string
+	err = repo.db.QueryRow(
+		"SELECT COUNT(*), MAX(referrer_host), MAX(agent_class), MAX(clicked_at) FROM clicks WHERE url_id = ?",
+		created.ID,
+	).Scan(&events, &referrer, &class, &stamp)
+	if err != nil {
+		t.Fatalf("query clicks: %v", err)
+	}
+	if events != 5 || referrer != "news.example.org" || class != "mobile" {
+		t.Errorf("unexpected click events: count=%d referrer=%q class=%q", events, referrer, class)
+	}
+	if stamp != "2026-03-01 09:30:00" {
+		t.Errorf("expected clicked_at 2026-03-01 09:30:00, got %q", stamp)
+	}
+}
+
+func TestSQLite_ClaimClick_Concurrent(t *testing.T) {
+	repo := setupFileDB(t)
+	ctx := context.Background()
+
+	maxClicks := int64(3)
+	created, err := repo.Create(ctx, "https://example.com", domain.LinkOptions{MaxClicks: &maxClicks})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	const n = 20
+	var wg sync.WaitGroup
+	start := make(chan struct{})
+	errs := make([]error, n)
+	for i := 0; i < n; i++ {
+		wg.Add(1)
+		go func(i int) {
+			defer wg.Done()
+			<-start
+			errs[i] = repo.ClaimClick(ctx, created.Code)
+		}(i)
+	}
+	close(start)
+	wg.Wait()
+
+	var claimed int64
+	for i, err := range errs {
+		switch {
+		case err == nil:
+			claimed++
+		case !errors.Is(err, ErrClickBudgetSpent):
+			t.Fatalf("claim %d: %v", i, err)
+		}
+	}
+	if claimed != maxClicks {
+		t.Errorf("expected %d claimed clicks, got %d", maxClicks, claimed)
+	}
+
+	// Recording a claimed click must not count it again.
+	if err := repo.RecordClick(ctx, created.Code, domain.Click{Counted: true}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+	found, err := repo.GetByCode(ctx, created.Code)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if found.Clicks != maxClicks {
+		t.Errorf("expected %d clicks, got %d", maxClicks, found.Clicks)
+	}
+
+	if err := repo.ClaimClick(ctx, "nonexistent"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestSQLite_MarkExpiryNotified(t *testing.T) {
+	repo := setupTestDB(t)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	for i, want := range []bool{true, false} {
+		first, err := repo.MarkExpiryNotified(ctx, created.Code)
+		if err != nil {
+			t.Fatalf("mark %d: %v", i, err)
+		}
+		if first != want {
+			t.Errorf("mark %d: expected %v, got %v", i, want, first)
+		}
+	}
+	found, err := repo.GetByCode(ctx, created.Code)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if !found.ExpiryNotified {
+		t.Error("expected the link to be marked")
+	}
+}
+
+func TestSQLite_ExpiredLinks(t *testing.T) {
+	repo := setupTestDB(t)
+	ctx := context.Background()
+
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	past, future := now.Add(-time.Minute), now.Add(time.Hour)
+	maxClicks := int64(1)
+
+	lapsed, err := repo.Create(ctx, "https://example.com/lapsed", domain.LinkOptions{ExpiresAt: &past})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := repo.Create(ctx, "https://example.com/live", domain.LinkOptions{ExpiresAt: &future}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := repo.Create(ctx, "https://example.com/forever", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	used, err := repo.Create(ctx, "https://example.com/used", domain.LinkOptions{MaxClicks: &maxClicks})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := repo.ClaimClick(ctx, used.Code); err != nil {
+		t.Fatalf("claim: %v", err)
+	}
+	announced, err := repo.Create(ctx, "https://example.com/announced", domain.LinkOptions{ExpiresAt: &past})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := repo.MarkExpiryNotified(ctx, announced.Code); err != nil {
+		t.Fatalf("mark: %v", err)
+	}
+	deleted, err := repo.Create(ctx, "https://example.com/deleted", domain.LinkOptions{ExpiresAt: &past})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if err := repo.Delete(ctx, deleted.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	links, err := repo.ExpiredLinks(ctx, now, 10)
+	if err != nil {
+		t.Fatalf("expired links: %v", err)
+	}
+	if len(links) != 2 || links[0].Code != lapsed.Code || links[1].Code != used.Code {
+		t.Fatalf("expected %s and %s, got %+v", lapsed.Code, used.Code, links)
+	}
+
+	links, err = repo.ExpiredLinks(ctx, now, 1)
+	if err != nil {
+		t.Fatalf("expired links: %v", err)
+	}
+	if len(links) != 1 || links[0].Code != lapsed.Code {
+		t.Errorf("expected the limit to keep the oldest link, got %+v", links)
+	}
+}
+
+func TestSQLite_RecordClick_Bot(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	clickedAt := time.Date(2026, 3, 1, 9, 30, 0, 0, time.UTC)
+	clicks := []domain.Click{
+		{ClickedAt: clickedAt, ReferrerHost: "slack.com", AgentClass: "bot", Bot: true, VisitorHash: 1},
+		{ClickedAt: clickedAt, ReferrerHost: "t.co", AgentClass: "mobile", VisitorHash: 2},
+	}
+	for _, c := range clicks {
+		if err := repo.RecordClick(context.Background(), created.Code, c); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	found, err := repo.GetByCode(context.Background(), created.Code)
+	if err != nil {
+		t.Fatalf("get by code: %v", err)
+	}
+	if found.Clicks != 1 || found.BotClicks != 1 {
+		t.Errorf("expected 1 human and 1 bot click, got %d and %d", found.Clicks, found.BotClicks)
+	}
+
+	breakdown, err := repo.ClickBreakdown(context.Background(), created.Code, domain.BreakdownQuery{Limit: 10})
+	if err != nil {
+		t.Fatalf("click breakdown: %v", err)
+	}
+	if breakdown.Total != 1 || len(breakdown.Referrers) != 1 || breakdown.Referrers[0].Value != "t.co" {
+		t.Errorf("expected bot clicks to be left out of the breakdown, got %+v", breakdown)
+	}
+
+	buckets, err := repo.ClickBuckets(context.Background(), created.Code, clickedAt, clickedAt.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("click buckets: %v", err)
+	}
+	if len(buckets) != 1 || buckets[0].Clicks != 1 {
+		t.Errorf("expected bot clicks to be left out of buckets, got %+v", buckets)
+	}
+
+	sketches, err := repo.VisitorSketches(context.Background(), created.Code, clickedAt, clickedAt)
+	if err != nil {
+		t.Fatalf("visitor sketches: %v", err)
+	}
+	if n := sketches["2026-03-01"].Estimate(); n != 1 {
+		t.Errorf("expected bots not to count as visitors, got %d", n)
+	}
+}
+
+func TestSQLite_RecordClicks(t *testing.T) {
+	repo := setupTestDB(t)
+
+	a, err := repo.Create(context.Background(), "https://example.com/a", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	b, err := repo.Create(context.Background(), "https://example.com/b", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	batch := map[string][]domain.Click{
+		a.Code: {
+			{ClickedAt: day, VisitorHash: 0x9e3779b97f4a7c15},
+			{ClickedAt: day, VisitorHash: 0x3c6ef372fe94f82a},
+			{ClickedAt: day.Add(24 * time.Hour), VisitorHash: 0x9e3779b97f4a7c15},
+			{ClickedAt: day, Bot: true},
+		},
+		b.Code:    {{ClickedAt: day, VisitorHash: 3}},
+		"missing": {{ClickedAt: day}},
+	}
+	if err := repo.RecordClicks(context.Background(), batch); err != nil {
+		t.Fatalf("record clicks: %v", err)
+	}
+
+	for code, want := range map[string][2]int64{a.Code: {3, 1}, b.Code: {1, 0}} {
+		found, err := repo.GetByCode(context.Background(), code)
+		if err != nil {
+			t.Fatalf("get by code: %v", err)
+		}
+		if found.Clicks != want[0] || found.BotClicks != want[1] {
+			t.Errorf("%s: expected %d clicks and %d bot clicks, got %d and %d",
+				code, want[0], want[1], found.Clicks, found.BotClicks)
+		}
+	}
+
+	var rows int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM clicks").Scan(&rows); err != nil {
+		t.Fatalf("count clicks: %v", err)
+	}
+	if rows != 5 {
+		t.Errorf("expected 5 click rows, got %d", rows)
+	}
+
+	sketches, err := repo.VisitorSketches(context.Background(), a.Code, day, day.Add(24*time.Hour))
+	if err != nil {
+		t.Fatalf("visitor sketches: %v", err)
+	}
+	if sketches["2026-03-01"].Estimate() != 2 || sketches["2026-03-02"].Estimate() != 1 {
+		t.Errorf("expected 2 and 1 visitors, got %d and %d",
+			sketches["2026-03-01"].Estimate(), sketches["2026-03-02"].Estimate())
+	}
+}
+
+func TestSQLite_RecordClick_NotFound(t *testing.T) {
+	repo := setupTestDB(t)
+
+	err := repo.RecordClick(context.Background(), "nonexistent", domain.Click{})
+	if err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+
+	var events int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM clicks").Scan(&events); err != nil {
+		t.Fatalf("query clicks: %v", err)
+	}
+	if events != 0 {
+		t.Errorf("expected no click events, got %d", events)
+	}
+}
+
+func TestSQLite_ClickBuckets(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	for _, offset := range []time.Duration{
+		-time.Minute, 0, 14 * time.Minute, 15 * time.Minute, 59 * time.Minute, time.Hour,
+	} {
+		if err := repo.RecordClick(context.Background(), created.Code, domain.Click{ClickedAt: base.Add(offset)}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	buckets, err := repo.ClickBuckets(context.Background(), created.Code, base, base.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("click buckets: %v", err)
+	}
+
+	want := []domain.ClickBucket{
+		{Start: base, Clicks: 2},
+		{Start: base.Add(15 * time.Minute), Clicks: 1},
+		{Start: base.Add(45 * time.Minute), Clicks: 1},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), buckets)
+	}
+	for i := range want {
+		if !buckets[i].Start.Equal(want[i].Start) || buckets[i].Clicks != want[i].Clicks {
+			t.Errorf("bucket %d: expected %+v, got %+v", i, want[i], buckets[i])
+		}
+	}
+}
+
+func TestSQLite_ClickBreakdown(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	base := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	clicks := []domain.Click{
+		{ClickedAt: base, ReferrerHost: "t.co", AgentClass: "mobile", OS: "iOS", Browser: "Safari"},
+		{ClickedAt: base, ReferrerHost: "t.co", AgentClass: "mobile", OS: "Android", Browser: "Chrome"},
+		{ClickedAt: base, ReferrerHost: "news.example.org", AgentClass: "desktop", OS: "Windows", Browser: "Chrome"},
+		{ClickedAt: base.Add(-time.Hour), ReferrerHost: "old.example.org", AgentClass: "desktop", OS: "Linux", Browser: "Firefox"},
+	}
+	for _, c := range clicks {
+		if err := repo.RecordClick(context.Background(), created.Code, c); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	breakdown, err := repo.ClickBreakdown(context.Background(), created.Code, domain.BreakdownQuery{From: &base, Limit: 1})
+	if err != nil {
+		t.Fatalf("click breakdown: %v", err)
+	}
+
+	if breakdown.Total != 3 {
+		t.Errorf("expected 3 clicks in range, got %d", breakdown.Total)
+	}
+	checks := []struct {
+		name    string
+		entries []domain.BreakdownEntry
+		want    domain.BreakdownEntry
+	}{
+		{"referrers", breakdown.Referrers, domain.BreakdownEntry{Value: "t.co", Clicks: 2}},
+		{"devices", breakdown.Devices, domain.BreakdownEntry{Value: "mobile", Clicks: 2}},
+		{"os", breakdown.OS, domain.BreakdownEntry{Value: "Android", Clicks: 1}},
+		{"browsers", breakdown.Browsers, domain.BreakdownEntry{Value: "Chrome", Clicks: 2}},
+	}
+	for _, c := range checks {
+		if len(c.entries) != 1 || c.entries[0] != c.want {
+			t.Errorf("%s: expected [%+v], got %+v", c.name, c.want, c.entries)
+		}
+	}
+}
+
+func TestSQLite_Export(t *testing.T) {
+	repo := setupTestDB(t)
+
+	alice, err := repo.Create(context.Background(), "https://example.com/alice", domain.LinkOptions{OwnerID: 2})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	bob, err := repo.Create(context.Background(), "https://example.com/bob", domain.LinkOptions{OwnerID: 3})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	day := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	for _, c := range []struct {
+		code string
+		at   time.Time
+		bot  bool
+	}{
+		{alice.Code, day.Add(-time.Minute), false},
+		{alice.Code, day.Add(9 * time.Hour), false},
+		{alice.Code, day.Add(10 * time.Hour), true},
+		{bob.Code, day.Add(11 * time.Hour), false},
+	} {
+		if err := repo.RecordClick(context.Background(), c.code, domain.Click{ClickedAt: c.at, Browser: "Firefox", Bot: c.bot}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	next := day.AddDate(0, 0, 1)
+	var clicks []domain.ExportedClick
+	err = repo.ExportClicks(context.Background(), domain.ExportQuery{OwnerID: 2, From: &day, To: &next}, func(c domain.ExportedClick) error {
+		clicks = append(clicks, c)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("export clicks: %v", err)
+	}
+	if len(clicks) != 2 {
+		t.Fatalf("expected alice's 2 clicks on the day, got %d", len(clicks))
+	}
+	if clicks[0].Code != alice.Code || !clicks[0].ClickedAt.Equal(day.Add(9*time.Hour)) || clicks[0].Browser != "Firefox" {
+		t.Errorf("unexpected first click: %+v", clicks[0])
+	}
+	if !clicks[1].Bot {
+		t.Error("expected bot clicks to be exported and flagged")
+	}
+
+	var codes []string
+	err = repo.ExportLinks(context.Background(), domain.ExportQuery{}, func(u domain.URL) error {
+		codes = append(codes, u.Code)
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("export links: %v", err)
+	}
+	if len(codes) != 2 || codes[0] != alice.Code || codes[1] != bob.Code {
+		t.Errorf("expected every link oldest first, got %v", codes)
+	}
+
+	stop := errors.New("stop")
+	calls := 0
+	err = repo.ExportLinks(context.Background(), domain.ExportQuery{}, func(domain.URL) error {
+		calls++
+		return stop
+	})
+	if !errors.Is(err, stop) || calls != 1 {
+		t.Errorf("expected the export to stop at the callback error, got %v after %d calls", err, calls)
+	}
+}
+
+func TestSQLite_RollupClicks(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	old := time.Date(2026, 1, 10, 9, 0, 0, 0, time.UTC)
+	recent := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	clicks := []domain.Click{
+		{ClickedAt: old, ReferrerHost: "t.co", Browser: "Safari", IPHash: "a"},
+		{ClickedAt: old.Add(time.Hour), ReferrerHost: "t.co", Browser: "Safari", IPHash: "b"},
+		{ClickedAt: old.Add(2 * time.Hour), ReferrerHost: "t.co", Browser: "Safari", Bot: true},
+		{ClickedAt: old.AddDate(0, 0, 1), ReferrerHost: "news.example.org", Browser: "Firefox"},
+		{ClickedAt: recent, ReferrerHost: "t.co", Browser: "Chrome"},
+	}
+	for _, c := range clicks {
+		if err := repo.RecordClick(context.Background(), created.Code, c); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	cutoff := time.Date(2026, 2, 1, 0, 0, 0, 0, time.UTC)
+	n, err := repo.RollupClicks(context.Background(), cutoff, 2)
+	if err != nil {
+		t.Fatalf("rollup clicks: %v", err)
+	}
+	if n != 2 {
+		t.Fatalf("expected a batch of 2, got %d", n)
+	}
+	if n, err = repo.RollupClicks(context.Background(), cutoff, 10); err != nil || n != 2 {
+		t.Fatalf("expected the remaining 2 old clicks rolled up, got %d, %v", n, err)
+	}
+
+	var raw, rolled int64
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM clicks").Scan(&raw); err != nil {
+		t.Fatalf("count clicks: %v", err)
+	}
+	if err := repo.db.QueryRow("SELECT SUM(clicks) FROM click_rollups").Scan(&rolled); err != nil {
+		t.Fatalf("count rollups: %v", err)
+	}
+	if raw != 1 || rolled != 4 {
+		t.Errorf("expected 1 raw and 4 rolled up clicks, got %d and %d", raw, rolled)
+	}
+	var safari int64
+	if err := repo.db.QueryRow(
+		"SELECT clicks FROM click_rollups WHERE day = '2026-01-10' AND browser = 'Safari' AND is_bot = 0",
+	).Scan(&safari); err != nil {
+		t.Fatalf("read rollup: %v", err)
+	}
+	if safari != 2 {
+		t.Errorf("expected the two batches merged into one rollup of 2, got %d", safari)
+	}
+
+	from := time.Date(2026, 1, 1, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 4, 1, 0, 0, 0, 0, time.UTC)
+	buckets, err := repo.ClickBuckets(context.Background(), created.Code, from, to)
+	if err != nil {
+		t.Fatalf("click buckets: %v", err)
+	}
+	want := []domain.ClickBucket{
+		{Start: time.Date(2026, 1, 10, 0, 0, 0, 0, time.UTC), Clicks: 2},
+		{Start: time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC), Clicks: 1},
+		{Start: recent, Clicks: 1},
+	}
+	if len(buckets) != len(want) {
+		t.Fatalf("expected %d buckets, got %+v", len(want), buckets)
+	}
+	for i := range want {
+		if !buckets[i].Start.Equal(want[i].Start) || buckets[i].Clicks != want[i].Clicks {
+			t.Errorf("bucket %d: expected %+v, got %+v", i, want[i], buckets[i])
+		}
+	}
+
+	breakdown, err := repo.ClickBreakdown(context.Background(), created.Code, domain.BreakdownQuery{From: &from, Limit: 10})
+	if err != nil {
+		t.Fatalf("click breakdown: %v", err)
+	}
+	if breakdown.Total != 4 {
+		t.Errorf("expected 4 human clicks, got %d", breakdown.Total)
+	}
+	if top := breakdown.Referrers[0]; top.Value != "t.co" || top.Clicks != 3 {
+		t.Errorf("expected t.co with 3 clicks on top, got %+v", top)
+	}
+
+	late := time.Date(2026, 1, 11, 0, 0, 0, 0, time.UTC)
+	breakdown, err = repo.ClickBreakdown(context.Background(), created.Code, domain.BreakdownQuery{From: &late, To: &cutoff, Limit: 10})
+	if err != nil {
+		t.Fatalf("click breakdown: %v", err)
+	}
+	if breakdown.Total != 1 || len(breakdown.Browsers) != 1 || breakdown.Browsers[0].Value != "Firefox" {
+		t.Errorf("expected only the rolled up Firefox click in range, got %+v", breakdown)
+	}
+}
+
+func TestSQLite_VisitorSketches(t *testing.T) {
+	repo := setupTestDB(t)
+
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	day1 := time.Date(2026, 3, 1, 23, 59, 0, 0, time.UTC)
+	day2 := day1.Add(2 * time.Minute)
+	clicks := []domain.Click{
+		{ClickedAt: day1, VisitorHash: 0x1111111111111111},
+		{ClickedAt: day1, VisitorHash: 0x1111111111111111},
+		{ClickedAt: day1, VisitorHash: 0x2222222222222222},
+		{ClickedAt: day2, VisitorHash: 0x2222222222222222},
+		{ClickedAt: day2},
+	}
+	for _, c := range clicks {
+		if err := repo.RecordClick(context.Background(), created.Code, c); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	sketches, err := repo.VisitorSketches(context.Background(), created.Code, day1, day2)
+	if err != nil {
+		t.Fatalf("visitor sketches: %v", err)
+	}
+
+	if len(sketches) != 2 {
+		t.Fatalf("expected sketches for 2 days, got %d", len(sketches))
+	}
+	if n := sketches["2026-03-01"].Estimate(); n != 2 {
+		t.Errorf("expected 2 visitors on 2026-03-01, got %d", n)
+	}
+	if n := sketches["2026-03-02"].Estimate(); n != 1 {
+		t.Errorf("expected 1 visitor on 2026-03-02, got %d", n)
+	}
+
+	sketches, err = repo.VisitorSketches(context.Background(), created.Code, day2, day2)
+	if err != nil {
+		t.Fatalf("visitor sketches: %v", err)
+	}
+	if _, ok := sketches["2026-03-01"]; ok || len(sketches) != 1 {
+		t.Errorf("expected only 2026-03-02, got %v", sketches)
+	}
+}
+
+func TestSQLite_CompactVisitorSketches(t *testing.T) {
+	repo := setupTestDB(t)
+	ctx := context.Background()
+
+	created, err := repo.Create(ctx, "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	days := []time.Time{
+		time.Date(2026, 1, 30, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 1, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 2, 2, 12, 0, 0, 0, time.UTC),
+		time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC),
+	}
+	for i, day := range days {
+		clicks := []domain.Click{
+			{ClickedAt: day, VisitorHash: 0x1111111111111111},
+			{ClickedAt: day, VisitorHash: uint64(i+2) * 0x0101010101010101},
+		}
+		for _, c := range clicks {
+			if err := repo.RecordClick(ctx, created.Code, c); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+	}
+
+	cutoff := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	n, err := repo.CompactVisitorSketches(ctx, cutoff, 2)
+	if err != nil {
+		t.Fatalf("compact: %v", err)
+	}
+	if n != 2 {
+		t.Errorf("expected a batch of 2 sketches, got %d", n)
+	}
+	if n, err = repo.CompactVisitorSketches(ctx, cutoff, 2); err != nil || n != 1 {
+		t.Errorf("expected the last sketch to be compacted, got %d, %v", n, err)
+	}
+	if n, err = repo.CompactVisitorSketches(ctx, cutoff, 2); err != nil || n != 0 {
+		t.Errorf("expected nothing left to compact, got %d, %v", n, err)
+	}
+
+	sketches, err := repo.VisitorSketches(ctx, created.Code, days[1], days[3])
+	if err != nil {
+		t.Fatalf("visitor sketches: %v", err)
+	}
+	if len(sketches) != 2 {
+		t.Fatalf("expected February and 2026-03-01, got %v", sketches)
+	}
+	if n := sketches["2026-02"].Estimate(); n != 3 {
+		t.Errorf("expected 3 visitors in February, got %d", n)
+	}
+	if n := sketches["2026-03-01"].Estimate(); n != 2 {
+		t.Errorf("expected the day after the cutoff to stay daily with 2 visitors, got %d", n)
+	}
+
+	var rows int
+	if err := repo.db.QueryRow("SELECT COUNT(*) FROM url_uniques WHERE url_id = ?", created.ID).Scan(&rows); err != nil {
+		t.Fatalf("count sketches: %v", err)
+	}
+	if rows != 3 {
+		t.Errorf("expected 3 sketches (January, February and 2026-03-01), got %d", rows)
+	}
+}
+
+func TestSQLite_List(t *testing.T) {
+	repo := setupTestDB(t)
+
+	originals := []string{
+		"https://Example.com/a",
+		"https://example.com:8443/b",
+		"https://example.org/report_2026",
+		"https://example.org/report-2026",
+	}
+	for i, u := range originals {
+		created, err := repo.Create(context.Background(), u, domain.LinkOptions{})
+		if err != nil {
+			t.Fatalf("create %q: %v", u, err)
+		}
+		for j := 0; j < i; j++ {
+			if err := repo.RecordClick(context.Background(), created.Code, domain.Click{}); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+	}
+
+	tests := []struct {
+		name   string
+		filter domain.ListFilter
+		want   []int64
+	}{
+		{"newest first", domain.ListFilter{Limit: 10}, []int64{4, 3, 2, 1}},
+		{"oldest first", domain.ListFilter{Limit: 10, Ascending: true}, []int64{1, 2, 3, 4}},
+		{"limit", domain.ListFilter{Limit: 2}, []int64{4, 3}},
+		{"host ignores case and port", domain.ListFilter{Limit: 10, Host: "EXAMPLE.com"}, []int64{2, 1}},
+		{"query escapes wildcards", domain.ListFilter{Limit: 10, Query: "report_"}, []int64{3}},
+		{"by clicks", domain.ListFilter{Limit: 10, SortBy: domain.SortClicks}, []int64{4, 3, 2, 1}},
+		{
+			"after cursor by clicks",
+			domain.ListFilter{Limit: 10, SortBy: domain.SortClicks, After: &domain.ListCursor{ID: 3, Clicks: 2}},
+			[]int64{2, 1},
+		},
+		{
+			"created in future",
+			domain.ListFilter{Limit: 10, CreatedAfter: timePtr(time.Now().Add(time.Hour))},
+			nil,
+		},
 	}
 
-	t.Cleanup(func() {
-		if err := repo.Close(); err != nil {
-			t.Errorf("close repo: %v", err)
-		}
-	})
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			urls, err := repo.List(context.Background(), tt.filter)
+			if err != nil {
+				t.Fatalf("list: %v", err)
+			}
+			if len(urls) != len(tt.want) {
+				t.Fatalf("expected %d urls, got %d", len(tt.want), len(urls))
+			}
+			for i, u := range urls {
+				if u.ID != tt.want[i] {
+					t.Errorf("position %d: expected id %d, got %d", i, tt.want[i], u.ID)
+				}
+			}
+		})
+	}
+}
 
-	return repo
+func timePtr(t time.Time) *time.Time {
+	return &t
 }
 
-func TestSQLite_Create(t *testing.T) {
+func TestSQLite_UpdateOriginal(t *testing.T) {
 	repo := setupTestDB(t)
 
-	url, err := repo.Create("https://example.com")
+	created, err := repo.Create(context.Background(), "https://example.com/v1", domain.LinkOptions{})
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
 
-	if url.ID != 1 {
-		t.Errorf("expected ID 1, got %d", url.ID)
+	if _, err := repo.UpdateOriginal(context.Background(), created.Code, "https://example.com/v2", "alice"); err != nil {
+		t.Fatalf("update v2: %v", err)
 	}
-	if url.Code == "" || url.Code == "_placeholder_" {
-		t.Errorf("expected valid code, got %q", url.Code)
+	updated, err := repo.UpdateOriginal(context.Background(), created.Code, "https://example.com/v3", "bob")
+	if err != nil {
+		t.Fatalf("update v3: %v", err)
 	}
-	if url.Original != "https://example.com" {
-		t.Errorf("expected original https://example.com, got %q", url.Original)
+
+	if updated.Original != "https://example.com/v3" {
+		t.Errorf("expected original https://example.com/v3, got %q", updated.Original)
 	}
-	if url.Clicks != 0 {
-		t.Errorf("expected 0 clicks, got %d", url.Clicks)
+
+	revisions, err := repo.ListRevisions(context.Background(), created.Code)
+	if err != nil {
+		t.Fatalf("list revisions: %v", err)
 	}
-	if url.CreatedAt.IsZero() {
-		t.Error("expected non-zero created_at")
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Original != "https://example.com/v2" || revisions[0].ChangedBy != "bob" {
+		t.Errorf("unexpected newest revision: %+v", revisions[0])
+	}
+	if revisions[1].Original != "https://example.com/v1" || revisions[1].ChangedBy != "alice" {
+		t.Errorf("unexpected oldest revision: %+v", revisions[1])
+	}
+
+	rev, err := repo.GetRevision(context.Background(), created.Code, revisions[1].ID)
+	if err != nil {
+		t.Fatalf("get revision: %v", err)
+	}
+	if rev.Original != "https://example.com/v1" {
+		t.Errorf("expected revision original https://example.com/v1, got %q", rev.Original)
+	}
+
+	if _, err := repo.GetRevision(context.Background(), "nonexistent", revisions[1].ID); err != ErrRevisionNotFound {
+		t.Errorf("expected ErrRevisionNotFound, got %v", err)
+	}
+	if _, err := repo.UpdateOriginal(context.Background(), "nonexistent", "https://example.com", "alice"); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
 	}
 }
 
-func TestSQLite_GetByCode(t *testing.T) {
-	repo := setupTestDB(t)
+func TestSQLite_UpdateOriginal_Concurrent(t *testing.T) {
+	repo := setupFileDB(t)
+	ctx := context.Background()
 
-	created, err := repo.Create("https://example.com")
+	created, err := repo.Create(ctx, "https://example.com/v0", domain.LinkOptions{})
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
 
-	found, err := repo.GetByCode(created.Code)
+	// Start a second edit while the first one's transaction is still open.
+	done := make(chan error, 1)
+	err = repo.WithTx(ctx, func(tx Repository) error {
+		if _, err := tx.UpdateOriginal(ctx, created.Code, "https://example.com/v1", "alice"); err != nil {
+			return err
+		}
+		go func() {
+			_, err := repo.UpdateOriginal(ctx, created.Code, "https://example.com/v2", "bob")
+			done <- err
+		}()
+		time.Sleep(50 * time.Millisecond)
+		return nil
+	})
 	if err != nil {
-		t.Fatalf("get by code: %v", err)
+		t.Fatalf("first update: %v", err)
+	}
+	if err := <-done; err != nil {
+		t.Fatalf("second update: %v", err)
 	}
 
-	if found.ID != created.ID {
-		t.Errorf("expected ID %d, got %d", created.ID, found.ID)
+	revisions, err := repo.ListRevisions(ctx, created.Code)
+	if err != nil {
+		t.Fatalf("list revisions: %v", err)
 	}
-	if found.Original != created.Original {
-		t.Errorf("expected original %q, got %q", created.Original, found.Original)
+	if len(revisions) != 2 {
+		t.Fatalf("expected 2 revisions, got %d", len(revisions))
+	}
+	if revisions[0].Original != "https://example.com/v1" || revisions[1].Original != "https://example.com/v0" {
+		t.Errorf("expected revisions v1 and v0, got %q and %q", revisions[0].Original, revisions[1].Original)
 	}
 }
 
-func TestSQLite_GetByCode_NotFound(t *testing.T) {
+func TestSQLite_Delete(t *testing.T) {
 	repo := setupTestDB(t)
 
-	_, err := repo.GetByCode("nonexistent")
-	if err != ErrNotFound {
-		t.Errorf("expected ErrNotFound, got %v", err)
+	created, err := repo.CreateWithCode(context.Background(), "promo", "https://example.com", domain.LinkOptions{})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if err := repo.Delete(context.Background(), created.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := repo.GetByCode(context.Background(), created.Code); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+	if _, err := repo.GetByOriginal(context.Background(), "https://example.com", 0); err != ErrNotFound {
+		t.Errorf("deleted url must not be deduplicated, got %v", err)
+	}
+	if err := repo.Delete(context.Background(), created.Code); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+
+	if _, err := repo.CreateWithCode(context.Background(), "promo", "https://other.com", domain.LinkOptions{}); err != ErrCodeExists {
+		t.Errorf("tombstoned code must not be reissued, got %v", err)
 	}
 }
 
-func TestSQLite_GetByOriginal(t *testing.T) {
+func TestSQLite_SetDisabled(t *testing.T) {
 	repo := setupTestDB(t)
 
-	created, err := repo.Create("https://example.com")
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
 
-	found, err := repo.GetByOriginal("https://example.com")
+	if err := repo.SetDisabled(context.Background(), created.Code, true); err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+
+	found, err := repo.GetByCode(context.Background(), created.Code)
 	if err != nil {
-		t.Fatalf("get by original: %v", err)
+		t.Fatalf("get by code: %v", err)
+	}
+	if !found.Disabled {
+		t.Error("expected url to be disabled")
 	}
 
-	if found.Code != created.Code {
-		t.Errorf("expected code %q, got %q", created.Code, found.Code)
+	if err := repo.SetDisabled(context.Background(), "nonexistent", true); err != ErrNotFound {
+		t.Errorf("expected ErrNotFound, got %v", err)
 	}
 }
 
-func TestSQLite_IncrementClicks(t *testing.T) {
+func TestSQLite_StatsTotals(t *testing.T) {
 	repo := setupTestDB(t)
 
-	created, err := repo.Create("https://example.com")
+	for i := 0; i < 3; i++ {
+		url, err := repo.Create(context.Background(), "https://example.com/"+string(rune('a'+i)), domain.LinkOptions{OwnerID: int64(i%2 + 1)})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		for j := 0; j <= i; j++ {
+			if err := repo.RecordClick(context.Background(), url.Code, domain.Click{}); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+	}
+
+	stats, err := repo.StatsTotals(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("stats totals: %v", err)
+	}
+	if stats.TotalURLs != 3 {
+		t.Errorf("expected 3 total URLs, got %d", stats.TotalURLs)
+	}
+	if stats.TotalClicks != 6 {
+		t.Errorf("expected 6 total clicks, got %d", stats.TotalClicks)
+	}
+	if stats.TopLinks != nil || stats.TopDomains != nil {
+		t.Errorf("expected no leaderboards, got %+v", stats)
+	}
+
+	stats, err = repo.StatsTotals(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("stats totals: %v", err)
+	}
+	if stats.TotalURLs != 2 || stats.TotalClicks != 4 {
+		t.Errorf("expected 2 URLs with 4 clicks for owner 1, got %d with %d", stats.TotalURLs, stats.TotalClicks)
+	}
+
+	// A claimed click is counted once, and a deleted link takes its clicks
+	// with it.
+	maxClicks := int64(5)
+	budgeted, err := repo.Create(context.Background(), "https://example.com/budget", domain.LinkOptions{OwnerID: 1, MaxClicks: &maxClicks})
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
+	if err := repo.ClaimClick(context.Background(), budgeted.Code); err != nil {
+		t.Fatalf("claim click: %v", err)
+	}
+	if err := repo.RecordClick(context.Background(), budgeted.Code, domain.Click{Counted: true}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+	stats, err = repo.StatsTotals(context.Background(), 1)
+	if err != nil {
+		t.Fatalf("stats totals: %v", err)
+	}
+	if stats.TotalURLs != 3 || stats.TotalClicks != 5 {
+		t.Errorf("expected 3 URLs with 5 clicks for owner 1, got %d with %d", stats.TotalURLs, stats.TotalClicks)
+	}
 
-	for i := 0; i < 5; i++ {
-		if err := repo.IncrementClicks(created.Code); err != nil {
-			t.Fatalf("increment clicks: %v", err)
+	if err := repo.Delete(context.Background(), budgeted.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	stats, err = repo.StatsTotals(context.Background(), 0)
+	if err != nil {
+		t.Fatalf("stats totals: %v", err)
+	}
+	if stats.TotalURLs != 3 || stats.TotalClicks != 6 {
+		t.Errorf("expected the deleted link to stop counting, got %d URLs with %d clicks", stats.TotalURLs, stats.TotalClicks)
+	}
+}
+
+func TestSQLite_OwnerClickBuckets(t *testing.T) {
+	repo := setupTestDB(t)
+
+	now := time.Now().UTC()
+	for i, owner := range []int64{1, 2} {
+		url, err := repo.Create(context.Background(), "https://example.com/"+string(rune('a'+i)), domain.LinkOptions{OwnerID: owner})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		for _, c := range []domain.Click{{}, {}, {Bot: true}, {ClickedAt: now.Add(-3 * time.Hour)}} {
+			if err := repo.RecordClick(context.Background(), url.Code, c); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
 		}
 	}
 
-	found, err := repo.GetByCode(created.Code)
+	buckets, err := repo.OwnerClickBuckets(context.Background(), 0, now.Add(-time.Hour), now.Add(time.Hour))
 	if err != nil {
-		t.Fatalf("get by code: %v", err)
+		t.Fatalf("owner click buckets: %v", err)
+	}
+	var total int64
+	for _, b := range buckets {
+		if !b.Start.Equal(b.Start.Truncate(ClickBucketSize)) {
+			t.Errorf("bucket %s is not aligned", b.Start)
+		}
+		total += b.Count
+	}
+	if total != 4 {
+		t.Errorf("expected 4 human clicks in the last hour, got %d", total)
 	}
 
-	if found.Clicks != 5 {
-		t.Errorf("expected 5 clicks, got %d", found.Clicks)
+	buckets, err = repo.OwnerClickBuckets(context.Background(), 2, now.Add(-4*time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("owner click buckets: %v", err)
+	}
+	total = 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total != 3 {
+		t.Errorf("expected 3 human clicks for owner 2, got %d", total)
+	}
+
+	// Rolled-up clicks and the clicks of deleted links are no longer raw.
+	if _, err := repo.RollupClicks(context.Background(), now.Add(-2*time.Hour), 100); err != nil {
+		t.Fatalf("rollup: %v", err)
+	}
+	urls, err := repo.List(context.Background(), domain.ListFilter{Limit: 10, OwnerID: 1})
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if err := repo.Delete(context.Background(), urls[0].Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	buckets, err = repo.OwnerClickBuckets(context.Background(), 0, now.Add(-4*time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("owner click buckets: %v", err)
+	}
+	total = 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total != 2 {
+		t.Errorf("expected owner 2's 2 raw clicks of the last hour left, got %d", total)
 	}
 }
 
-func TestSQLite_IncrementClicks_NotFound(t *testing.T) {
+func TestSQLite_Leaderboards(t *testing.T) {
 	repo := setupTestDB(t)
 
-	err := repo.IncrementClicks("nonexistent")
-	if err != ErrNotFound {
-		t.Errorf("expected ErrNotFound, got %v", err)
+	now := time.Now().UTC()
+	from := now.Add(-24 * time.Hour)
+	old := now.AddDate(0, 0, -10)
+
+	links := []struct {
+		original string
+		owner    int64
+		recent   int
+		stale    int
+	}{
+		{"https://a.example.com/1", 1, 2, 5},
+		{"https://a.example.com/2", 1, 2, 0},
+		{"https://b.example.com/1", 1, 3, 0},
+		{"https://c.example.com/1", 2, 9, 0},
+	}
+	codes := make([]string, len(links))
+	for i, l := range links {
+		url, err := repo.Create(context.Background(), l.original, domain.LinkOptions{OwnerID: l.owner})
+		if err != nil {
+			t.Fatalf("create: %v", err)
+		}
+		codes[i] = url.Code
+		for j := 0; j < l.recent; j++ {
+			if err := repo.RecordClick(context.Background(), url.Code, domain.Click{}); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+		for j := 0; j < l.stale; j++ {
+			if err := repo.RecordClick(context.Background(), url.Code, domain.Click{ClickedAt: old}); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+	}
+	if err := repo.RecordClick(context.Background(), codes[2], domain.Click{Bot: true}); err != nil {
+		t.Fatalf("record click: %v", err)
+	}
+
+	stats, err := repo.Leaderboards(context.Background(), domain.StatsQuery{OwnerID: 1, From: from, Limit: 2})
+	if err != nil {
+		t.Fatalf("leaderboards: %v", err)
+	}
+
+	if len(stats.TopLinks) != 2 {
+		t.Fatalf("expected 2 top links, got %+v", stats.TopLinks)
+	}
+	if stats.TopLinks[0].Code != codes[2] || stats.TopLinks[0].Clicks != 3 {
+		t.Errorf("expected %s with 3 clicks first, got %+v", codes[2], stats.TopLinks[0])
+	}
+	if stats.TopLinks[1].Code != codes[0] || stats.TopLinks[1].Original != links[0].original {
+		t.Errorf("expected %s second, got %+v", codes[0], stats.TopLinks[1])
+	}
+
+	want := []domain.DomainClicks{
+		{Domain: "a.example.com", Links: 2, Clicks: 4},
+		{Domain: "b.example.com", Links: 1, Clicks: 3},
+	}
+	if len(stats.TopDomains) != len(want) {
+		t.Fatalf("expected %d top domains, got %+v", len(want), stats.TopDomains)
+	}
+	for i, d := range want {
+		if stats.TopDomains[i] != d {
+			t.Errorf("domain %d: expected %+v, got %+v", i, d, stats.TopDomains[i])
+		}
 	}
 }
 
-func TestSQLite_GlobalStats(t *testing.T) {
+func TestSQLite_CreatedBuckets(t *testing.T) {
 	repo := setupTestDB(t)
 
 	for i := 0; i < 3; i++ {
-		url, err := repo.Create("https://example.com/" + string(rune('a'+i)))
-		if err != nil {
+		if _, err := repo.Create(context.Background(), "https://example.com/"+string(rune('a'+i)), domain.LinkOptions{OwnerID: int64(i%2 + 1)}); err != nil {
 			t.Fatalf("create: %v", err)
 		}
-		for j := 0; j <= i; j++ {
-			if err := repo.IncrementClicks(url.Code); err != nil {
-				t.Fatalf("increment clicks: %v", err)
-			}
+	}
+
+	now := time.Now().UTC()
+	buckets, err := repo.CreatedBuckets(context.Background(), 0, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("created buckets: %v", err)
+	}
+	var total int64
+	for _, b := range buckets {
+		if !b.Start.Equal(b.Start.Truncate(ClickBucketSize)) {
+			t.Errorf("bucket %s is not aligned", b.Start)
 		}
+		total += b.Count
+	}
+	if total != 3 {
+		t.Errorf("expected 3 URLs created, got %d", total)
 	}
 
-	stats, err := repo.GlobalStats()
+	buckets, err = repo.CreatedBuckets(context.Background(), 2, now.Add(-time.Hour), now.Add(time.Hour))
 	if err != nil {
-		t.Fatalf("global stats: %v", err)
+		t.Fatalf("created buckets: %v", err)
+	}
+	total = 0
+	for _, b := range buckets {
+		total += b.Count
+	}
+	if total != 1 {
+		t.Errorf("expected 1 URL created by owner 2, got %d", total)
 	}
 
-	if stats.TotalURLs != 3 {
-		t.Errorf("expected 3 total URLs, got %d", stats.TotalURLs)
+	urls, err := repo.List(context.Background(), domain.ListFilter{Limit: 10, OwnerID: 2})
+	if err != nil {
+		t.Fatalf("list: %v", err)
 	}
-	if stats.TotalClicks != 6 {
-		t.Errorf("expected 6 total clicks, got %d", stats.TotalClicks)
+	if err := repo.Delete(context.Background(), urls[0].Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	buckets, err = repo.CreatedBuckets(context.Background(), 2, now.Add(-time.Hour), now.Add(time.Hour))
+	if err != nil {
+		t.Fatalf("created buckets: %v", err)
+	}
+	if len(buckets) != 0 {
+		t.Errorf("expected the deleted URL to stop counting, got %+v", buckets)
+	}
+
+	buckets, err = repo.CreatedBuckets(context.Background(), 0, now.Add(time.Hour), now.Add(2*time.Hour))
+	if err != nil {
+		t.Fatalf("created buckets: %v", err)
 	}
-	if stats.URLsToday != 3 {
-		t.Errorf("expected 3 URLs today, got %d", stats.URLsToday)
+	if len(buckets) != 0 {
+		t.Errorf("expected no buckets later, got %+v", buckets)
 	}
 }
 
@@ -178,7 +1671,7 @@ func TestSQLite_MultipleURLs(t *testing.T) {
 
 	codes := make([]string, len(urls))
 	for i, u := range urls {
-		created, err := repo.Create(u)
+		created, err := repo.Create(context.Background(), u, domain.LinkOptions{})
 		if err != nil {
 			t.Fatalf("create %q: %v", u, err)
 		}
@@ -194,7 +1687,7 @@ func TestSQLite_MultipleURLs(t *testing.T) {
 	}
 
 	for i, code := range codes {
-		found, err := repo.GetByCode(code)
+		found, err := repo.GetByCode(context.Background(), code)
 		if err != nil {
 			t.Errorf("get code %q: %v", code, err)
 			continue
@@ -208,26 +1701,25 @@ func TestSQLite_MultipleURLs(t *testing.T) {
 func TestSQLite_ConcurrentIncrements(t *testing.T) {
 	repo := setupTestDB(t)
 
-	created, err := repo.Create("https://example.com")
+	created, err := repo.Create(context.Background(), "https://example.com", domain.LinkOptions{})
 	if err != nil {
 		t.Fatalf("create: %v", err)
 	}
 
-	done := make(chan bool, 10)
+	errs := make(chan error, 10)
 	for i := 0; i < 10; i++ {
 		go func() {
-			_ = repo.IncrementClicks(created.Code)
-			done <- true
+			errs <- repo.RecordClick(context.Background(), created.Code, domain.Click{})
 		}()
 	}
 
 	for i := 0; i < 10; i++ {
-		<-done
+		if err := <-errs; err != nil {
+			t.Errorf("record click: %v", err)
+		}
 	}
 
-	time.Sleep(100 * time.Millisecond)
-
-	found, err := repo.GetByCode(created.Code)
+	found, err := repo.GetByCode(context.Background(), created.Code)
 	if err != nil {
 		t.Fatalf("get by code: %v", err)
 	}
@@ -236,3 +1728,154 @@ func TestSQLite_ConcurrentIncrements(t *testing.T) {
 		t.Errorf("expected 10 clicks after concurrent increments, got %d", found.Clicks)
 	}
 }
+
+func TestSQLite_Webhooks(t *testing.T) {
+	repo := setupTestDB(t)
+
+	admin, err := repo.CreateAPIKey(context.Background(), "admin", "hash-admin", "shk_admin", true)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	alice, err := repo.CreateAPIKey(context.Background(), "alice", "hash-alice", "shk_alice", false)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	bob, err := repo.CreateAPIKey(context.Background(), "bob", "hash-bob", "shk_bob", false)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+
+	all, err := repo.CreateWebhook(context.Background(), admin.ID, "https://hooks.example.com/admin", nil, "whsec_a")
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	clicksOnly, err := repo.CreateWebhook(context.Background(), alice.ID, "https://crm.example.com/hook", []string{domain.EventLinkClicked}, "whsec_b")
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	if len(clicksOnly.Events) != 1 || clicksOnly.Secret != "whsec_b" {
+		t.Errorf("unexpected webhook: %+v", clicksOnly)
+	}
+	if _, err := repo.CreateWebhook(context.Background(), bob.ID, "https://bob.example.com/hook", nil, "whsec_c"); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	owned, err := repo.ListWebhooks(context.Background(), alice.ID)
+	if err != nil {
+		t.Fatalf("list webhooks: %v", err)
+	}
+	if len(owned) != 1 || owned[0].ID != clicksOnly.ID {
+		t.Errorf("expected only alice's webhook, got %+v", owned)
+	}
+	if everything, _ := repo.ListWebhooks(context.Background(), 0); len(everything) != 3 {
+		t.Errorf("expected 3 webhooks in total, got %d", len(everything))
+	}
+
+	ids := func(hooks []domain.Webhook) []int64 {
+		var out []int64
+		for _, h := range hooks {
+			out = append(out, h.ID)
+		}
+		return out
+	}
+
+	hooks, err := repo.SubscribedWebhooks(context.Background(), alice.ID, domain.EventLinkClicked)
+	if err != nil {
+		t.Fatalf("subscribed webhooks: %v", err)
+	}
+	if got := ids(hooks); len(got) != 2 || got[0] != all.ID || got[1] != clicksOnly.ID {
+		t.Errorf("expected the admin and alice webhooks for alice's clicks, got %v", got)
+	}
+
+	hooks, _ = repo.SubscribedWebhooks(context.Background(), alice.ID, domain.EventLinkDeleted)
+	if got := ids(hooks); len(got) != 1 || got[0] != all.ID {
+		t.Errorf("expected only the admin webhook for alice's deletes, got %v", got)
+	}
+
+	if err := repo.RevokeAPIKey(context.Background(), admin.ID); err != nil {
+		t.Fatalf("revoke api key: %v", err)
+	}
+	hooks, _ = repo.SubscribedWebhooks(context.Background(), 0, domain.EventLinkCreated)
+	if len(hooks) != 0 {
+		t.Errorf("expected no webhooks for anonymous links once the admin key is revoked, got %v", ids(hooks))
+	}
+
+	if err := repo.DeleteWebhook(context.Background(), clicksOnly.ID); err != nil {
+		t.Fatalf("delete webhook: %v", err)
+	}
+	if _, err := repo.GetWebhook(context.Background(), clicksOnly.ID); err != ErrWebhookNotFound {
+		t.Errorf("expected ErrWebhookNotFound after delete, got %v", err)
+	}
+	if err := repo.DeleteWebhook(context.Background(), clicksOnly.ID); err != ErrWebhookNotFound {
+		t.Errorf("expected ErrWebhookNotFound deleting twice, got %v", err)
+	}
+}
+
+func TestSQLite_WebhookDeliveries(t *testing.T) {
+	repo := setupTestDB(t)
+
+	key, err := repo.CreateAPIKey(context.Background(), "alice", "hash-alice", "shk_alice", false)
+	if err != nil {
+		t.Fatalf("create api key: %v", err)
+	}
+	a, err := repo.CreateWebhook(context.Background(), key.ID, "https://a.example.com/hook", nil, "whsec_a")
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+	b, err := repo.CreateWebhook(context.Background(), key.ID, "https://b.example.com/hook", nil, "whsec_b")
+	if err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	event := &domain.WebhookEvent{ID: "evt_expired_1", Type: domain.EventLinkExpired, CreatedAt: time.Now()}
+	enqueued, err := repo.EnqueueWebhookEvent(context.Background(), event, []byte(`{"id":"evt_expired_1"}`), []int64{a.ID, b.ID})
+	if err != nil || !enqueued {
+		t.Fatalf("enqueue webhook event: %v, %v", enqueued, err)
+	}
+	enqueued, err = repo.EnqueueWebhookEvent(context.Background(), event, []byte(`{}`), []int64{a.ID, b.ID})
+	if err != nil || enqueued {
+		t.Fatalf("expected a repeated event ID to be ignored, got %v, %v", enqueued, err)
+	}
+
+	due, err := repo.DueWebhookDeliveries(context.Background(), time.Now(), 10)
+	if err != nil {
+		t.Fatalf("due webhook deliveries: %v", err)
+	}
+	if len(due) != 2 {
+		t.Fatalf("expected 2 due deliveries, got %d", len(due))
+	}
+	if due[0].URL != a.URL || due[0].Secret != "whsec_a" || string(due[0].Payload) != `{"id":"evt_expired_1"}` {
+		t.Errorf("unexpected delivery: %+v", due[0])
+	}
+
+	if err := repo.MarkWebhookDelivered(context.Background(), due[0].ID); err != nil {
+		t.Fatalf("mark delivered: %v", err)
+	}
+	if err := repo.RetryWebhookDelivery(context.Background(), due[1].ID, time.Now().Add(time.Hour), "endpoint returned 500"); err != nil {
+		t.Fatalf("retry delivery: %v", err)
+	}
+	if due, _ := repo.DueWebhookDeliveries(context.Background(), time.Now(), 10); len(due) != 0 {
+		t.Errorf("expected no due deliveries before the retry time, got %d", len(due))
+	}
+
+	later, err := repo.DueWebhookDeliveries(context.Background(), time.Now().Add(2*time.Hour), 10)
+	if err != nil || len(later) != 1 || later[0].Attempts != 1 {
+		t.Fatalf("expected the retried delivery with 1 attempt, got %+v, %v", later, err)
+	}
+
+	if err := repo.DeadLetterWebhookDelivery(context.Background(), later[0].ID, "endpoint returned 500"); err != nil {
+		t.Fatalf("dead-letter delivery: %v", err)
+	}
+	if due, _ := repo.DueWebhookDeliveries(context.Background(), time.Now().Add(2*time.Hour), 10); len(due) != 0 {
+		t.Errorf("expected the dead-lettered delivery to leave the outbox, got %d", len(due))
+	}
+
+	letters, err := repo.ListDeadLetters(context.Background(), b.ID)
+	if err != nil {
+		t.Fatalf("list dead letters: %v", err)
+	}
+	if len(letters) != 1 || letters[0].Attempts != 2 || letters[0].EventType != domain.EventLinkExpired ||
+		letters[0].LastError != "endpoint returned 500" {
+		t.Errorf("unexpected dead letters: %+v", letters)
+	}
+}
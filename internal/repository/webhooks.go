@@ -0,0 +1,304 @@
+package repository
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// webhookColumns lists the columns scanned by scanWebhook, in order.
+const webhookColumns = "w.id, w.owner_id, w.url, w.events, w.secret, w.created_at"
+
+// CreateWebhook registers an endpoint for ownerID. Empty events subscribes it
+// to every event.
+func (r *SQLite) CreateWebhook(ctx context.Context, ownerID int64, url string, events []string, secret string) (*domain.Webhook, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	result, err := r.exec(ctx,
+		"INSERT INTO webhooks (owner_id, url, events, secret) VALUES (?, ?, ?, ?)",
+		ownerID, url, strings.Join(events, ","), secret,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("create webhook: %w", err)
+	}
+
+	id, err := result.LastInsertId()
+	if err != nil {
+		return nil, fmt.Errorf("get last insert id: %w", err)
+	}
+	return r.GetWebhook(ctx, id)
+}
+
+// GetWebhook retrieves a webhook that has not been deleted.
+func (r *SQLite) GetWebhook(ctx context.Context, id int64) (*domain.Webhook, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	hook, err := scanWebhook(r.q.QueryRowContext(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks w WHERE w.id = ? AND w.deleted_at IS NULL", id,
+	))
+	if err == sql.ErrNoRows {
+		return nil, ErrWebhookNotFound
+	}
+	if err != nil {
+		return nil, fmt.Errorf("get webhook: %w", err)
+	}
+	return hook, nil
+}
+
+// ListWebhooks returns the webhooks of ownerID, or of every owner when
+// ownerID is zero, oldest first.
+func (r *SQLite) ListWebhooks(ctx context.Context, ownerID int64) ([]domain.Webhook, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	query := "SELECT " + webhookColumns + " FROM webhooks w WHERE w.deleted_at IS NULL"
+	var args []any
+	if ownerID != 0 {
+		query += " AND w.owner_id = ?"
+		args = append(args, ownerID)
+	}
+	return r.queryWebhooks(ctx, query+" ORDER BY w.id", args...)
+}
+
+// DeleteWebhook removes a webhook and drops its pending deliveries. Past
+// dead letters are kept.
+func (r *SQLite) DeleteWebhook(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *SQLite) error {
+		result, err := tx.q.ExecContext(ctx,
+			"UPDATE webhooks SET deleted_at = ? WHERE id = ? AND deleted_at IS NULL",
+			time.Now().UTC().Format(timeFormat), id,
+		)
+		if err != nil {
+			return fmt.Errorf("delete webhook: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("check rows affected: %w", err)
+		}
+		if rows == 0 {
+			return ErrWebhookNotFound
+		}
+
+		if _, err := tx.q.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE webhook_id = ?", id); err != nil {
+			return fmt.Errorf("drop webhook deliveries: %w", err)
+		}
+		return nil
+	})
+}
+
+// SubscribedWebhooks returns the webhooks that receive event for a link owned
+// by linkOwnerID: those of the owner and those of admin keys. Webhooks of
+// revoked keys are left out.
+func (r *SQLite) SubscribedWebhooks(ctx context.Context, linkOwnerID int64, event string) ([]domain.Webhook, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.queryWebhooks(ctx,
+		"SELECT "+webhookColumns+" FROM webhooks w JOIN api_keys k ON k.id = w.owner_id"+
+			" WHERE w.deleted_at IS NULL AND k.revoked_at IS NULL"+
+			" AND (k.admin = 1 OR w.owner_id = ?)"+
+			" AND (w.events = '' OR instr(',' || w.events || ',', ',' || ? || ',') > 0)"+
+			" ORDER BY w.id",
+		linkOwnerID, event,
+	)
+}
+
+func (r *SQLite) queryWebhooks(ctx context.Context, query string, args ...any) ([]domain.Webhook, error) {
+	rows, err := r.q.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	hooks := []domain.Webhook{}
+	for rows.Next() {
+		hook, err := scanWebhook(rows)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook: %w", err)
+		}
+		hooks = append(hooks, *hook)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list webhooks: %w", err)
+	}
+	return hooks, nil
+}
+
+// EnqueueWebhookEvent stores an event and schedules its delivery to each
+// webhook, all in one transaction. It reports false without enqueueing
+// anything if an event with the same ID was stored before.
+func (r *SQLite) EnqueueWebhookEvent(ctx context.Context, event *domain.WebhookEvent, payload []byte, webhookIDs []int64) (bool, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	enqueued := false
+	err := r.inTx(ctx, func(tx *SQLite) error {
+		result, err := tx.q.ExecContext(ctx,
+			"INSERT OR IGNORE INTO webhook_events (id, type, payload, created_at) VALUES (?, ?, ?, ?)",
+			event.ID, event.Type, payload, event.CreatedAt.UTC().Format(timeFormat),
+		)
+		if err != nil {
+			return fmt.Errorf("store webhook event: %w", err)
+		}
+		rows, err := result.RowsAffected()
+		if err != nil {
+			return fmt.Errorf("check rows affected: %w", err)
+		}
+		if rows == 0 {
+			return nil
+		}
+
+		now := time.Now().UTC().Format(timeFormat)
+		for _, id := range webhookIDs {
+			_, err := tx.q.ExecContext(ctx,
+				"INSERT INTO webhook_deliveries (webhook_id, event_id, next_attempt_at) VALUES (?, ?, ?)",
+				id, event.ID, now,
+			)
+			if err != nil {
+				return fmt.Errorf("enqueue webhook delivery: %w", err)
+			}
+		}
+		enqueued = true
+		return nil
+	})
+	return enqueued, err
+}
+
+// DueWebhookDeliveries returns up to limit deliveries whose next attempt is
+// due at now, oldest first.
+func (r *SQLite) DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT d.id, d.webhook_id, w.url, w.secret, e.id, e.type, e.payload, d.attempts"+
+			" FROM webhook_deliveries d"+
+			" JOIN webhooks w ON w.id = d.webhook_id"+
+			" JOIN webhook_events e ON e.id = d.event_id"+
+			" WHERE d.next_attempt_at <= ? ORDER BY d.next_attempt_at, d.id LIMIT ?",
+		now.UTC().Format(timeFormat), limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list due webhook deliveries: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	deliveries := []domain.WebhookDelivery{}
+	for rows.Next() {
+		var d domain.WebhookDelivery
+		err := rows.Scan(&d.ID, &d.WebhookID, &d.URL, &d.Secret, &d.EventID, &d.EventType, &d.Payload, &d.Attempts)
+		if err != nil {
+			return nil, fmt.Errorf("scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list due webhook deliveries: %w", err)
+	}
+	return deliveries, nil
+}
+
+// MarkWebhookDelivered removes a delivery that succeeded.
+func (r *SQLite) MarkWebhookDelivered(ctx context.Context, id int64) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	if _, err := r.exec(ctx, "DELETE FROM webhook_deliveries WHERE id = ?", id); err != nil {
+		return fmt.Errorf("mark webhook delivered: %w", err)
+	}
+	return nil
+}
+
+// RetryWebhookDelivery records a failed attempt and schedules the next.
+func (r *SQLite) RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	_, err := r.exec(ctx,
+		"UPDATE webhook_deliveries SET attempts = attempts + 1, next_attempt_at = ?, last_error = ? WHERE id = ?",
+		next.UTC().Format(timeFormat), lastErr, id,
+	)
+	if err != nil {
+		return fmt.Errorf("reschedule webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// DeadLetterWebhookDelivery moves a delivery that failed for the last time to
+// the dead-letter table.
+func (r *SQLite) DeadLetterWebhookDelivery(ctx context.Context, id int64, lastErr string) error {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	return r.inTx(ctx, func(tx *SQLite) error {
+		_, err := tx.q.ExecContext(ctx,
+			"INSERT INTO webhook_dead_letters (webhook_id, event_id, attempts, last_error, failed_at)"+
+				" SELECT webhook_id, event_id, attempts + 1, ?, ? FROM webhook_deliveries WHERE id = ?",
+			lastErr, time.Now().UTC().Format(timeFormat), id,
+		)
+		if err != nil {
+			return fmt.Errorf("dead-letter webhook delivery: %w", err)
+		}
+		if _, err := tx.q.ExecContext(ctx, "DELETE FROM webhook_deliveries WHERE id = ?", id); err != nil {
+			return fmt.Errorf("dead-letter webhook delivery: %w", err)
+		}
+		return nil
+	})
+}
+
+// ListDeadLetters returns the abandoned deliveries of a webhook, newest first.
+func (r *SQLite) ListDeadLetters(ctx context.Context, webhookID int64) ([]domain.DeadLetter, error) {
+	ctx, cancel := r.withTimeout(ctx)
+	defer cancel()
+
+	rows, err := r.q.QueryContext(ctx,
+		"SELECT l.id, l.webhook_id, e.id, e.type, e.payload, l.attempts, l.last_error, l.failed_at"+
+			" FROM webhook_dead_letters l JOIN webhook_events e ON e.id = l.event_id"+
+			" WHERE l.webhook_id = ? ORDER BY l.id DESC",
+		webhookID,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("list dead letters: %w", err)
+	}
+	defer func() { _ = rows.Close() }()
+
+	letters := []domain.DeadLetter{}
+	for rows.Next() {
+		var l domain.DeadLetter
+		var payload []byte
+		err := rows.Scan(&l.ID, &l.WebhookID, &l.EventID, &l.EventType, &payload, &l.Attempts, &l.LastError, &l.FailedAt)
+		if err != nil {
+			return nil, fmt.Errorf("scan dead letter: %w", err)
+		}
+		l.Payload = payload
+		letters = append(letters, l)
+	}
+	if err := rows.Err(); err != nil {
+		return nil, fmt.Errorf("list dead letters: %w", err)
+	}
+	return letters, nil
+}
+
+// scanWebhook scans a row selected with webhookColumns.
+func scanWebhook(row interface{ Scan(...any) error }) (*domain.Webhook, error) {
+	hook := &domain.Webhook{}
+	var events string
+	err := row.Scan(&hook.ID, &hook.OwnerID, &hook.URL, &events, &hook.Secret, &hook.CreatedAt)
+	if err != nil {
+		return nil, err
+	}
+	hook.Events = []string{}
+	if events != "" {
+		hook.Events = strings.Split(events, ",")
+	}
+	return hook, nil
+}
@@ -0,0 +1,197 @@
+// Package retention rolls raw click events past the retention period into
+// daily aggregates, and merges their daily visitor sketches into monthly
+// ones, from a background job, so the clicks table stops growing once it
+// holds the retention period's worth of clicks and old visitor sketches take
+// a thirtieth of the space. The same job announces links that expired
+// without anyone requesting them.
+package retention
+
+import (
+	"context"
+	"log"
+	"time"
+)
+
+// Job defaults.
+const (
+	DefaultInterval  = time.Hour
+	DefaultBatchSize = 5000
+)
+
+// sketchBatchSize is how many daily visitor sketches are merged per
+// transaction. Each one is a few KiB, so batches are kept small.
+const sketchBatchSize = 500
+
+// expiryBatchSize is how many expired links are announced per sweep step.
+const expiryBatchSize = 100
+
+// Store rolls up and deletes raw clicks and compacts old visitor sketches.
+type Store interface {
+	RollupClicks(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+	CompactVisitorSketches(ctx context.Context, cutoff time.Time, limit int) (int64, error)
+}
+
+// SweepFunc announces up to limit links that have expired by now and
+// returns how many it looked at.
+type SweepFunc func(ctx context.Context, now time.Time, limit int) (int64, error)
+
+// Option configures a Job.
+type Option func(*Job)
+
+// WithExpirySweep makes every run of the job also call sweep until every
+// link that has expired by then is announced.
+func WithExpirySweep(sweep SweepFunc) Option {
+	return func(j *Job) {
+		j.sweep = sweep
+	}
+}
+
+// WithInterval sets how often the job looks for clicks to roll up.
+func WithInterval(d time.Duration) Option {
+	return func(j *Job) {
+		j.interval = d
+	}
+}
+
+// WithBatchSize sets how many clicks are rolled up per transaction. Smaller
+// batches hold the write lock for less time.
+func WithBatchSize(n int) Option {
+	return func(j *Job) {
+		j.batchSize = n
+	}
+}
+
+// Job rolls up clicks older than its retention period, and announces
+// expired links when it has a sweep, until it is closed.
+type Job struct {
+	store     Store
+	days      int
+	interval  time.Duration
+	batchSize int
+	sweep     SweepFunc
+	now       func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a Job that keeps raw clicks for the current UTC day and the
+// given number of full days before it, rolling up anything older, and starts
+// it. Zero days keeps raw clicks forever. It runs once immediately and then
+// every interval.
+func New(store Store, days int, opts ...Option) *Job {
+	j := &Job{
+		store:     store,
+		days:      days,
+		interval:  DefaultInterval,
+		batchSize: DefaultBatchSize,
+		now:       time.Now,
+		stop:      make(chan struct{}),
+		done:      make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(j)
+	}
+
+	go j.run()
+	return j
+}
+
+// Close stops the job after the batch in flight, if any, and waits for it or
+// until ctx is done. Clicks not yet rolled up are picked up on the next start.
+func (j *Job) Close(ctx context.Context) error {
+	select {
+	case <-j.stop:
+	default:
+		close(j.stop)
+	}
+
+	select {
+	case <-j.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (j *Job) run() {
+	defer close(j.done)
+
+	ticker := time.NewTicker(j.interval)
+	defer ticker.Stop()
+
+	for {
+		j.rollup()
+		j.sweepExpired()
+		select {
+		case <-j.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cutoff returns the start of the oldest UTC day whose clicks are kept raw
+// at now.
+func (j *Job) cutoff(now time.Time) time.Time {
+	y, m, d := now.UTC().Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC).AddDate(0, 0, -j.days)
+}
+
+// rollup rolls up every click before the cutoff and then compacts the
+// visitor sketches of the same days, a batch at a time.
+func (j *Job) rollup() {
+	if j.days == 0 {
+		return
+	}
+	cutoff := j.cutoff(j.now())
+
+	total, ok := j.drain(cutoff, j.batchSize, j.store.RollupClicks, "rolling up clicks")
+	if total > 0 {
+		log.Printf("Rolled up %d clicks from before %s", total, cutoff.Format("2006-01-02"))
+	}
+	if !ok {
+		return
+	}
+
+	total, _ = j.drain(cutoff, sketchBatchSize, j.store.CompactVisitorSketches, "compacting visitor sketches")
+	if total > 0 {
+		log.Printf("Merged %d daily visitor sketches from before %s into months", total, cutoff.Format("2006-01-02"))
+	}
+}
+
+// sweepExpired announces the links that have expired by now, a batch at a
+// time.
+func (j *Job) sweepExpired() {
+	if j.sweep == nil {
+		return
+	}
+	total, _ := j.drain(j.now(), expiryBatchSize, j.sweep, "announcing expired links")
+	if total > 0 {
+		log.Printf("Swept %d expired links", total)
+	}
+}
+
+// drain calls step with batches of limit until it returns fewer, fails or
+// the job is closed. It returns the total step reported and whether it ran
+// to completion.
+func (j *Job) drain(cutoff time.Time, limit int, step func(context.Context, time.Time, int) (int64, error), what string) (int64, bool) {
+	var total int64
+	for {
+		n, err := step(context.Background(), cutoff, limit)
+		if err != nil {
+			log.Printf("error %s: %v", what, err)
+			return total, false
+		}
+		total += n
+		if n < int64(limit) {
+			return total, true
+		}
+
+		select {
+		case <-j.stop:
+			return total, false
+		default:
+		}
+	}
+}
@@ -0,0 +1,171 @@
+package retention
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+)
+
+type fakeStore struct {
+	mu      sync.Mutex
+	pending int64
+	cutoffs []time.Time
+	err     error
+
+	sketches      int64
+	sketchCutoffs []time.Time
+	sketchLimits  []int
+}
+
+func (s *fakeStore) RollupClicks(_ context.Context, cutoff time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.cutoffs = append(s.cutoffs, cutoff)
+	if s.err != nil {
+		return 0, s.err
+	}
+	n := min(s.pending, int64(limit))
+	s.pending -= n
+	return n, nil
+}
+
+func (s *fakeStore) CompactVisitorSketches(_ context.Context, cutoff time.Time, limit int) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	s.sketchCutoffs = append(s.sketchCutoffs, cutoff)
+	s.sketchLimits = append(s.sketchLimits, limit)
+	n := min(s.sketches, int64(limit))
+	s.sketches -= n
+	return n, nil
+}
+
+func (s *fakeStore) calls() int {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return len(s.cutoffs)
+}
+
+func TestJob_RollsUpInBatches(t *testing.T) {
+	store := &fakeStore{pending: 25}
+	j := &Job{
+		store:     store,
+		days:      30,
+		batchSize: 10,
+		now:       func() time.Time { return time.Date(2026, 3, 31, 18, 45, 0, 0, time.UTC) },
+		stop:      make(chan struct{}),
+	}
+
+	j.rollup()
+
+	if store.pending != 0 {
+		t.Errorf("expected every click rolled up, %d left", store.pending)
+	}
+	if len(store.cutoffs) != 3 {
+		t.Errorf("expected 3 batches, got %d", len(store.cutoffs))
+	}
+	want := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !store.cutoffs[0].Equal(want) {
+		t.Errorf("expected cutoff %v, got %v", want, store.cutoffs[0])
+	}
+}
+
+func TestJob_StopsOnError(t *testing.T) {
+	store := &fakeStore{pending: 25, err: errors.New("database is locked")}
+	j := &Job{store: store, days: 30, batchSize: 10, now: time.Now, stop: make(chan struct{})}
+
+	j.rollup()
+
+	if len(store.cutoffs) != 1 {
+		t.Errorf("expected the run to stop after a failed batch, got %d calls", len(store.cutoffs))
+	}
+	if len(store.sketchCutoffs) != 0 {
+		t.Errorf("expected sketches to wait for the next run, got %d calls", len(store.sketchCutoffs))
+	}
+}
+
+func TestJob_CompactsSketches(t *testing.T) {
+	store := &fakeStore{pending: 5, sketches: 2*sketchBatchSize + 1}
+	j := &Job{
+		store:     store,
+		days:      30,
+		batchSize: 10,
+		now:       func() time.Time { return time.Date(2026, 3, 31, 18, 45, 0, 0, time.UTC) },
+		stop:      make(chan struct{}),
+	}
+
+	j.rollup()
+
+	if store.sketches != 0 {
+		t.Errorf("expected every sketch compacted, %d left", store.sketches)
+	}
+	if len(store.sketchCutoffs) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(store.sketchCutoffs))
+	}
+	if !store.sketchCutoffs[0].Equal(store.cutoffs[0]) {
+		t.Errorf("expected sketches to share the click cutoff %v, got %v", store.cutoffs[0], store.sketchCutoffs[0])
+	}
+	if store.sketchLimits[0] != sketchBatchSize {
+		t.Errorf("expected batches of %d sketches, got %d", sketchBatchSize, store.sketchLimits[0])
+	}
+}
+
+func TestJob_RunsOnStartAndClose(t *testing.T) {
+	store := &fakeStore{}
+	j := New(store, 90, WithInterval(time.Hour))
+
+	deadline := time.Now().Add(time.Second)
+	for store.calls() == 0 && time.Now().Before(deadline) {
+		time.Sleep(time.Millisecond)
+	}
+	if store.calls() == 0 {
+		t.Fatal("expected a run on start")
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second)
+	defer cancel()
+	if err := j.Close(ctx); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := j.Close(ctx); err != nil {
+		t.Errorf("expected a second close to be harmless, got %v", err)
+	}
+}
+
+func TestJob_SweepsExpiredLinks(t *testing.T) {
+	store := &fakeStore{pending: 5}
+	now := time.Date(2026, 3, 31, 18, 45, 0, 0, time.UTC)
+	pending := int64(2*expiryBatchSize + 1)
+	var sweeps []time.Time
+	j := &Job{
+		store:     store,
+		batchSize: 10,
+		now:       func() time.Time { return now },
+		stop:      make(chan struct{}),
+		sweep: func(_ context.Context, at time.Time, limit int) (int64, error) {
+			sweeps = append(sweeps, at)
+			n := min(pending, int64(limit))
+			pending -= n
+			return n, nil
+		},
+	}
+
+	j.rollup()
+	j.sweepExpired()
+
+	if len(store.cutoffs) != 0 {
+		t.Errorf("expected zero days to keep raw clicks, got %d rollups", len(store.cutoffs))
+	}
+	if pending != 0 {
+		t.Errorf("expected every expired link swept, %d left", pending)
+	}
+	if len(sweeps) != 3 {
+		t.Fatalf("expected 3 batches, got %d", len(sweeps))
+	}
+	if !sweeps[0].Equal(now) {
+		t.Errorf("expected links expired by %v, got %v", now, sweeps[0])
+	}
+}
@@ -0,0 +1,184 @@
+package service
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"strings"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/stream"
+	"github.com/devaloi/shrink/internal/useragent"
+)
+
+// ipHashBytes is how much of the HMAC digest is kept as an IP hash.
+const ipHashBytes = 16
+
+// Limits on the number of entries per breakdown dimension.
+const (
+	DefaultBreakdownLimit = 10
+	MaxBreakdownLimit     = 100
+)
+
+// Labels reported in breakdowns for clicks without a value.
+const (
+	DirectReferrer = "(direct)"
+	UnknownValue   = "(unknown)"
+)
+
+// ErrInvalidBreakdown is returned for a malformed breakdown query.
+var ErrInvalidBreakdown = errors.New("invalid breakdown query")
+
+// Breakdown returns the top referrer hosts, device classes, operating
+// systems and browsers of a short URL owned by key.
+func (s *URLService) Breakdown(ctx context.Context, key *domain.APIKey, code string, q domain.BreakdownQuery) (*domain.Breakdown, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if q.Limit == 0 {
+		q.Limit = DefaultBreakdownLimit
+	}
+	if q.Limit < 1 || q.Limit > MaxBreakdownLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidBreakdown, MaxBreakdownLimit)
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidBreakdown)
+	}
+
+	breakdown, err := s.repo.ClickBreakdown(ctx, urlRecord.Code, q)
+	if err != nil {
+		return nil, err
+	}
+
+	labelEmpty(breakdown.Referrers, DirectReferrer)
+	labelEmpty(breakdown.Devices, UnknownValue)
+	labelEmpty(breakdown.OS, UnknownValue)
+	labelEmpty(breakdown.Browsers, UnknownValue)
+	return breakdown, nil
+}
+
+// SubscribeClicks streams the live clicks of a short URL owned by key. Bot
+// clicks are left out unless bots is set. The caller must close the
+// subscription.
+func (s *URLService) SubscribeClicks(ctx context.Context, key *domain.APIKey, code string, bots bool) (*stream.Subscription, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+	return s.live.Subscribe(func(c domain.LiveClick) bool {
+		return c.Code == urlRecord.Code && (bots || !c.Bot)
+	}), nil
+}
+
+// SubscribeAllClicks streams the live clicks of every short URL key can
+// manage. Bot clicks are left out unless bots is set. The caller must close
+// the subscription.
+func (s *URLService) SubscribeAllClicks(key *domain.APIKey, bots bool) (*stream.Subscription, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+	return s.live.Subscribe(func(c domain.LiveClick) bool {
+		return key.CanManage(c.OwnerID) && (bots || !c.Bot)
+	}), nil
+}
+
+func liveClick(link *domain.URL, c domain.Click) domain.LiveClick {
+	return domain.LiveClick{
+		Code:         link.Code,
+		ClickedAt:    c.ClickedAt,
+		ReferrerHost: c.ReferrerHost,
+		AgentClass:   c.AgentClass,
+		OS:           c.OS,
+		Browser:      c.Browser,
+		Bot:          c.Bot,
+		OwnerID:      link.OwnerID,
+	}
+}
+
+// labelEmpty replaces the empty value of a dimension with label. Clicks
+// recorded before a dimension existed have no value for it.
+func labelEmpty(entries []domain.BreakdownEntry, label string) {
+	for i := range entries {
+		if entries[i].Value == "" {
+			entries[i].Value = label
+		}
+	}
+}
+
+// newClick reduces a visit to the click event that is stored. Raw IPs and
+// full referrer URLs never leave this function.
+func (s *URLService) newClick(visit domain.Visit) domain.Click {
+	agent := useragent.Parse(visit.UserAgent)
+	return domain.Click{
+		Bot:          isBot(visit, agent),
+		ClickedAt:    s.now().UTC(),
+		ReferrerHost: referrerHost(visit.Referrer),
+		AgentClass:   string(agent.Class),
+		OS:           agent.OS,
+		Browser:      agent.Browser,
+		IPHash:       s.hashIP(visit.IP),
+		RequestID:    visit.RequestID,
+		VisitorHash:  s.visitorHash(visit),
+	}
+}
+
+// hashIP returns a salted, truncated HMAC-SHA256 of ip, or "" if ip is empty.
+func (s *URLService) hashIP(ip string) string {
+	if ip == "" {
+		return ""
+	}
+	mac := hmac.New(sha256.New, s.ipSalt)
+	mac.Write([]byte(ip))
+	return hex.EncodeToString(mac.Sum(nil)[:ipHashBytes])
+}
+
+// isBot reports whether a visit was made by software rather than a person
+// following the link: a known crawler or unfurler User-Agent, a HEAD request
+// checking the link, or a prefetch or preview that may never be shown.
+func isBot(visit domain.Visit, agent useragent.Agent) bool {
+	if agent.Class == useragent.Bot || visit.Method == http.MethodHead {
+		return true
+	}
+	purpose := strings.ToLower(visit.Purpose)
+	return strings.Contains(purpose, "prefetch") || strings.Contains(purpose, "preview")
+}
+
+// visitorHash identifies a visitor for unique counts by a salted hash of
+// their IP and User-Agent, or 0 if the IP is unknown.
+func (s *URLService) visitorHash(visit domain.Visit) uint64 {
+	if visit.IP == "" {
+		return 0
+	}
+	mac := hmac.New(sha256.New, s.ipSalt)
+	mac.Write([]byte(visit.IP))
+	mac.Write([]byte{0})
+	mac.Write([]byte(visit.UserAgent))
+	return binary.BigEndian.Uint64(mac.Sum(nil))
+}
+
+// referrerHost returns the lowercased host of a Referer header value.
+func referrerHost(referrer string) string {
+	if referrer == "" {
+		return ""
+	}
+	parsed, err := url.Parse(referrer)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(parsed.Hostname())
+}
+
+func randomSalt() []byte {
+	salt := make([]byte, 32)
+	_, _ = rand.Read(salt)
+	return salt
+}
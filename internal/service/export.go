@@ -0,0 +1,75 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/export"
+)
+
+// ErrInvalidExport is returned for a malformed export request.
+var ErrInvalidExport = errors.New("invalid export request")
+
+// ExportLinks writes the links key can manage that were created in the
+// requested days to w. Nothing is written if the request is invalid.
+func (s *URLService) ExportLinks(ctx context.Context, key *domain.APIKey, req domain.ExportRequest, w io.Writer) error {
+	q, err := exportQuery(key, req)
+	if err != nil {
+		return err
+	}
+	enc, err := export.NewLinkWriter(w, req.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	if err := s.repo.ExportLinks(ctx, q, enc.Write); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// ExportClicks writes the clicks made in the requested days on links key can
+// manage to w, bots included. Nothing is written if the request is invalid.
+func (s *URLService) ExportClicks(ctx context.Context, key *domain.APIKey, req domain.ExportRequest, w io.Writer) error {
+	q, err := exportQuery(key, req)
+	if err != nil {
+		return err
+	}
+	enc, err := export.NewClickWriter(w, req.Format)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrInvalidExport, err)
+	}
+
+	if err := s.repo.ExportClicks(ctx, q, enc.Write); err != nil {
+		return err
+	}
+	return enc.Flush()
+}
+
+// exportQuery scopes an export request to key and turns its inclusive days
+// into a half-open time range.
+func exportQuery(key *domain.APIKey, req domain.ExportRequest) (domain.ExportQuery, error) {
+	if key == nil {
+		return domain.ExportQuery{}, ErrUnauthorized
+	}
+
+	var q domain.ExportQuery
+	if !key.Admin {
+		q.OwnerID = key.ID
+	}
+	if req.From != nil {
+		from := startOfDay(req.From.UTC())
+		q.From = &from
+	}
+	if req.To != nil {
+		to := startOfDay(req.To.UTC()).AddDate(0, 0, 1)
+		q.To = &to
+	}
+	if q.From != nil && q.To != nil && !q.From.Before(*q.To) {
+		return domain.ExportQuery{}, fmt.Errorf("%w: from must not be after to", ErrInvalidExport)
+	}
+	return q, nil
+}
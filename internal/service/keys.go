@@ -0,0 +1,93 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+)
+
+// KeyPrefix starts every API key so keys are recognizable in logs and
+// secret scanners.
+const KeyPrefix = "shk_"
+
+// keyBytes is the amount of randomness in an API key.
+const keyBytes = 24
+
+// Errors returned by the key service.
+var (
+	ErrInvalidKey   = domain.ErrInvalidAPIKey
+	ErrEmptyKeyName = errors.New("api key name cannot be empty")
+	ErrKeyNotFound  = repository.ErrKeyNotFound
+	ErrUnauthorized = errors.New("api key required")
+)
+
+// KeyService issues and authenticates API keys.
+type KeyService struct {
+	repo repository.KeyRepository
+}
+
+// NewKeyService creates a new key service backed by the given repository.
+func NewKeyService(repo repository.KeyRepository) *KeyService {
+	return &KeyService{repo: repo}
+}
+
+// Create issues a new API key. The returned secret is shown only once; only
+// its hash is stored.
+func (s *KeyService) Create(ctx context.Context, name string, admin bool) (string, *domain.APIKey, error) {
+	name = strings.TrimSpace(name)
+	if name == "" {
+		return "", nil, ErrEmptyKeyName
+	}
+
+	buf := make([]byte, keyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return "", nil, fmt.Errorf("generate api key: %w", err)
+	}
+	secret := KeyPrefix + hex.EncodeToString(buf)
+
+	key, err := s.repo.CreateAPIKey(ctx, name, HashKey(secret), secret[:len(KeyPrefix)+8], admin)
+	if err != nil {
+		return "", nil, err
+	}
+	return secret, key, nil
+}
+
+// Authenticate returns the active API key matching secret.
+func (s *KeyService) Authenticate(ctx context.Context, secret string) (*domain.APIKey, error) {
+	if !strings.HasPrefix(secret, KeyPrefix) {
+		return nil, ErrInvalidKey
+	}
+
+	key, err := s.repo.GetAPIKeyByHash(ctx, HashKey(secret))
+	if errors.Is(err, repository.ErrKeyNotFound) {
+		return nil, ErrInvalidKey
+	}
+	if err != nil {
+		return nil, fmt.Errorf("authenticate api key: %w", err)
+	}
+	return key, nil
+}
+
+// List returns all API keys, including revoked ones.
+func (s *KeyService) List(ctx context.Context) ([]domain.APIKey, error) {
+	return s.repo.ListAPIKeys(ctx)
+}
+
+// Revoke permanently disables an API key.
+func (s *KeyService) Revoke(ctx context.Context, id int64) error {
+	return s.repo.RevokeAPIKey(ctx, id)
+}
+
+// HashKey returns the hex SHA-256 digest under which an API key is stored.
+// Keys carry enough entropy that a fast, unsalted hash is sufficient.
+func HashKey(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,104 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+)
+
+type mockKeyRepo struct {
+	keys   map[string]*domain.APIKey
+	nextID int64
+}
+
+func newMockKeyRepo() *mockKeyRepo {
+	return &mockKeyRepo{keys: make(map[string]*domain.APIKey), nextID: 1}
+}
+
+func (m *mockKeyRepo) CreateAPIKey(_ context.Context, name, keyHash, prefix string, admin bool) (*domain.APIKey, error) {
+	key := &domain.APIKey{ID: m.nextID, Name: name, Prefix: prefix, Admin: admin, CreatedAt: time.Now()}
+	m.nextID++
+	m.keys[keyHash] = key
+	return key, nil
+}
+
+func (m *mockKeyRepo) GetAPIKeyByHash(_ context.Context, keyHash string) (*domain.APIKey, error) {
+	if key, ok := m.keys[keyHash]; ok && key.RevokedAt == nil {
+		return key, nil
+	}
+	return nil, repository.ErrKeyNotFound
+}
+
+func (m *mockKeyRepo) ListAPIKeys(_ context.Context) ([]domain.APIKey, error) {
+	keys := []domain.APIKey{}
+	for _, key := range m.keys {
+		keys = append(keys, *key)
+	}
+	return keys, nil
+}
+
+func (m *mockKeyRepo) RevokeAPIKey(_ context.Context, id int64) error {
+	for _, key := range m.keys {
+		if key.ID == id && key.RevokedAt == nil {
+			now := time.Now()
+			key.RevokedAt = &now
+			return nil
+		}
+	}
+	return repository.ErrKeyNotFound
+}
+
+func TestKeyService_CreateAndAuthenticate(t *testing.T) {
+	repo := newMockKeyRepo()
+	svc := NewKeyService(repo)
+
+	secret, key, err := svc.Create(context.Background(), "  ci  ", false)
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if key.Name != "ci" {
+		t.Errorf("expected trimmed name ci, got %q", key.Name)
+	}
+	if !strings.HasPrefix(secret, KeyPrefix) || !strings.HasPrefix(secret, key.Prefix) {
+		t.Errorf("secret %q does not match prefix %q", secret, key.Prefix)
+	}
+	if _, ok := repo.keys[secret]; ok {
+		t.Error("secret must not be stored in plain text")
+	}
+
+	got, err := svc.Authenticate(context.Background(), secret)
+	if err != nil {
+		t.Fatalf("authenticate: %v", err)
+	}
+	if got.ID != key.ID {
+		t.Errorf("expected key %d, got %d", key.ID, got.ID)
+	}
+
+	if err := svc.Revoke(context.Background(), key.ID); err != nil {
+		t.Fatalf("revoke: %v", err)
+	}
+	if _, err := svc.Authenticate(context.Background(), secret); !errors.Is(err, ErrInvalidKey) {
+		t.Errorf("expected ErrInvalidKey after revoke, got %v", err)
+	}
+	if err := svc.Revoke(context.Background(), key.ID); !errors.Is(err, ErrKeyNotFound) {
+		t.Errorf("expected ErrKeyNotFound on second revoke, got %v", err)
+	}
+}
+
+func TestKeyService_Invalid(t *testing.T) {
+	svc := NewKeyService(newMockKeyRepo())
+
+	if _, _, err := svc.Create(context.Background(), "   ", false); !errors.Is(err, ErrEmptyKeyName) {
+		t.Errorf("expected ErrEmptyKeyName, got %v", err)
+	}
+	for _, secret := range []string{"", "not-a-key", KeyPrefix + "unknown"} {
+		if _, err := svc.Authenticate(context.Background(), secret); !errors.Is(err, ErrInvalidKey) {
+			t.Errorf("Authenticate(%q): expected ErrInvalidKey, got %v", secret, err)
+		}
+	}
+}
@@ -0,0 +1,177 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/statscache"
+)
+
+// Limits on the GlobalStats leaderboard window and size.
+const (
+	DefaultStatsDays  = 7
+	MaxStatsDays      = 90
+	DefaultStatsLimit = 10
+	MaxStatsLimit     = 100
+)
+
+// ErrInvalidStats is returned for a malformed stats query.
+var ErrInvalidStats = errors.New("invalid stats query")
+
+// GlobalStats returns aggregate statistics. Anonymous requests get totals
+// across all URLs; a key gets the totals of the URLs it can manage, plus
+// leaderboards of its most clicked links and destination hosts. Today and
+// the days of the window are calendar days in the requested time zone.
+// With a stats cache the result may be up to a refresh interval old, as its
+// GeneratedAt shows.
+func (s *URLService) GlobalStats(ctx context.Context, key *domain.APIKey, req domain.StatsRequest) (*domain.GlobalStats, error) {
+	if req.Days == 0 {
+		req.Days = DefaultStatsDays
+	}
+	if req.Days < 1 || req.Days > MaxStatsDays {
+		return nil, fmt.Errorf("%w: days must be between 1 and %d", ErrInvalidStats, MaxStatsDays)
+	}
+	if req.Limit == 0 {
+		req.Limit = DefaultStatsLimit
+	}
+	if req.Limit < 1 || req.Limit > MaxStatsLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidStats, MaxStatsLimit)
+	}
+	loc := s.statsLocation
+	if req.TZ != "" {
+		var err error
+		if loc, err = time.LoadLocation(req.TZ); err != nil {
+			return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidStats, req.TZ)
+		}
+	}
+
+	var ownerID int64
+	if key != nil && !key.Admin {
+		ownerID = key.ID
+	}
+
+	now := s.now()
+	today := bucketStart(now, domain.IntervalDay, loc)
+	y, m, d := today.Date()
+	from := time.Date(y, m, d-(req.Days-1), 0, 0, 0, 0, loc)
+
+	// One snapshot per owner serves every window and time zone, so
+	// anonymous requests share a single one whatever they ask for.
+	base, err := s.statsSnapshot(ctx, fmt.Sprintf("owner=%d", ownerID), func(ctx context.Context) (*domain.StatsSnapshot, error) {
+		return s.loadTotals(ctx, ownerID)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats := &domain.GlobalStats{
+		TotalURLs:     base.TotalURLs,
+		TotalClicks:   base.TotalClicks,
+		URLsToday:     countSince(base.Created, today),
+		ClicksToday:   countSince(base.Clicks, today),
+		TZ:            loc.String(),
+		WindowDays:    req.Days,
+		CreatedPerDay: countPerDay(base.Created, from, req.Days, loc),
+		GeneratedAt:   base.GeneratedAt,
+	}
+	if key == nil {
+		return stats, nil
+	}
+
+	// Leaderboards are kept at their largest size per window start, which
+	// every time zone with the same offset shares.
+	q := domain.StatsQuery{OwnerID: ownerID, From: from, Limit: MaxStatsLimit}
+	board, err := s.statsSnapshot(ctx, fmt.Sprintf("owner=%d from=%d", ownerID, from.Unix()), func(ctx context.Context) (*domain.StatsSnapshot, error) {
+		return s.loadLeaderboards(ctx, q)
+	})
+	if err != nil {
+		return nil, err
+	}
+	stats.TopLinks = board.TopLinks[:min(req.Limit, len(board.TopLinks))]
+	stats.TopDomains = board.TopDomains[:min(req.Limit, len(board.TopDomains))]
+	if board.GeneratedAt.Before(stats.GeneratedAt) {
+		stats.GeneratedAt = board.GeneratedAt
+	}
+	return stats, nil
+}
+
+// An owner's snapshot counts the URLs created over the longest window plus
+// a day, and the human clicks of the last two days, so that the window and
+// today can be counted from it in any time zone.
+const (
+	createdSpan = (MaxStatsDays + 1) * 24 * time.Hour
+	clicksSpan  = 2 * 24 * time.Hour
+)
+
+// statsSnapshot returns the snapshot cached under key, loading it on every
+// call when there is no stats cache.
+func (s *URLService) statsSnapshot(ctx context.Context, key string, load statscache.LoadFunc) (*domain.StatsSnapshot, error) {
+	if s.statsCache == nil {
+		return load(ctx)
+	}
+	return s.statsCache.Get(ctx, key, load)
+}
+
+// loadTotals computes the snapshot of the URLs of ownerID, or of every
+// owner when it is zero.
+func (s *URLService) loadTotals(ctx context.Context, ownerID int64) (*domain.StatsSnapshot, error) {
+	now := s.now()
+	end := now.Add(repository.ClickBucketSize)
+
+	snap, err := s.repo.StatsTotals(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	from := now.Add(-createdSpan).Truncate(repository.ClickBucketSize)
+	if snap.Created, err = s.repo.CreatedBuckets(ctx, ownerID, from, end); err != nil {
+		return nil, err
+	}
+	from = now.Add(-clicksSpan).Truncate(repository.ClickBucketSize)
+	if snap.Clicks, err = s.repo.OwnerClickBuckets(ctx, ownerID, from, end); err != nil {
+		return nil, err
+	}
+	snap.GeneratedAt = now.UTC()
+	return snap, nil
+}
+
+// loadLeaderboards computes the snapshot of the leaderboards selected by q.
+func (s *URLService) loadLeaderboards(ctx context.Context, q domain.StatsQuery) (*domain.StatsSnapshot, error) {
+	now := s.now()
+	snap, err := s.repo.Leaderboards(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	snap.GeneratedAt = now.UTC()
+	return snap, nil
+}
+
+// countSince sums the buckets starting at or after t.
+func countSince(buckets []domain.CountBucket, t time.Time) int64 {
+	var n int64
+	for _, b := range buckets {
+		if !b.Start.Before(t) {
+			n += b.Count
+		}
+	}
+	return n
+}
+
+// countPerDay sums buckets into the days calendar days in loc beginning at
+// from.
+func countPerDay(buckets []domain.CountBucket, from time.Time, days int, loc *time.Location) []domain.DailyCount {
+	counts := make([]domain.DailyCount, days)
+	index := make(map[int64]int, days)
+	for i, day := 0, from; i < days; i, day = i+1, nextBucket(day, domain.IntervalDay, loc) {
+		counts[i].Day = day.Format(dayFormat)
+		index[day.Unix()] = i
+	}
+	for _, b := range buckets {
+		if i, ok := index[bucketStart(b.Start, domain.IntervalDay, loc).Unix()]; ok {
+			counts[i].Count += b.Count
+		}
+	}
+	return counts
+}
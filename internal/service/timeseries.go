@@ -0,0 +1,124 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// MaxTimeSeriesBuckets bounds how many buckets one time series may span.
+const MaxTimeSeriesBuckets = 1000
+
+// Default time series windows, ending now, when From is not given.
+const (
+	DefaultHourlyWindow = 24 * time.Hour
+	DefaultDailyWindow  = 30 * 24 * time.Hour
+)
+
+// ErrInvalidTimeSeries is returned for a malformed time series query.
+var ErrInvalidTimeSeries = errors.New("invalid time series query")
+
+// TimeSeries returns the clicks of a short URL owned by key, bucketed by
+// hour or day in the query's time zone. From is rounded down to the start
+// of its bucket; every bucket up to To is returned, including empty ones.
+func (s *URLService) TimeSeries(ctx context.Context, key *domain.APIKey, code string, q domain.TimeSeriesQuery) (*domain.TimeSeries, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	window := DefaultDailyWindow
+	switch q.Interval {
+	case "":
+		q.Interval = domain.IntervalDay
+	case domain.IntervalDay:
+	case domain.IntervalHour:
+		window = DefaultHourlyWindow
+	default:
+		return nil, fmt.Errorf("%w: interval must be %s or %s", ErrInvalidTimeSeries, domain.IntervalHour, domain.IntervalDay)
+	}
+
+	if q.TZ == "" {
+		q.TZ = "UTC"
+	}
+	loc, err := time.LoadLocation(q.TZ)
+	if err != nil {
+		return nil, fmt.Errorf("%w: unknown time zone %q", ErrInvalidTimeSeries, q.TZ)
+	}
+
+	to := s.now()
+	if q.To != nil {
+		to = *q.To
+	}
+	from := to.Add(-window)
+	if q.From != nil {
+		from = *q.From
+	}
+	if !from.Before(to) {
+		return nil, fmt.Errorf("%w: from must be before to", ErrInvalidTimeSeries)
+	}
+
+	var starts []time.Time
+	index := make(map[int64]int)
+	for start := bucketStart(from, q.Interval, loc); start.Before(to); start = nextBucket(start, q.Interval, loc) {
+		if len(starts) == MaxTimeSeriesBuckets {
+			return nil, fmt.Errorf("%w: range spans more than %d buckets", ErrInvalidTimeSeries, MaxTimeSeriesBuckets)
+		}
+		index[start.Unix()] = len(starts)
+		starts = append(starts, start)
+	}
+
+	counts, err := s.repo.ClickBuckets(ctx, urlRecord.Code, starts[0], to)
+	if err != nil {
+		return nil, err
+	}
+
+	series := &domain.TimeSeries{
+		Code:     urlRecord.Code,
+		Interval: q.Interval,
+		TZ:       loc.String(),
+		From:     starts[0],
+		To:       to.In(loc),
+		Buckets:  make([]domain.ClickBucket, len(starts)),
+	}
+	for i, start := range starts {
+		series.Buckets[i].Start = start
+	}
+	for _, c := range counts {
+		i, ok := index[bucketStart(c.Start, q.Interval, loc).Unix()]
+		if !ok {
+			continue
+		}
+		series.Buckets[i].Clicks += c.Clicks
+		series.Total += c.Clicks
+	}
+	return series, nil
+}
+
+// bucketStart returns the start of the local hour or day containing t.
+// Hours are found by stepping back in absolute time, so the repeated hour
+// at the end of daylight saving time yields two distinct buckets.
+func bucketStart(t time.Time, interval string, loc *time.Location) time.Time {
+	local := t.In(loc)
+	if interval == domain.IntervalHour {
+		offset := time.Duration(local.Minute())*time.Minute +
+			time.Duration(local.Second())*time.Second +
+			time.Duration(local.Nanosecond())
+		return local.Add(-offset)
+	}
+	y, m, d := local.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, loc)
+}
+
+// nextBucket returns the start of the bucket after the one starting at start.
+// Days follow the calendar, so they may be 23 or 25 hours long.
+func nextBucket(start time.Time, interval string, loc *time.Location) time.Time {
+	if interval == domain.IntervalHour {
+		return start.Add(time.Hour)
+	}
+	y, m, d := start.Date()
+	return time.Date(y, m, d+1, 0, 0, 0, 0, loc)
+}
@@ -0,0 +1,115 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+func TestURLService_TimeSeries(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	// Berlin leaves daylight saving time at 01:00 UTC on 2026-10-25.
+	for _, ts := range []string{
+		"2026-10-24T21:59:00Z", // 23:59 CEST on the 24th
+		"2026-10-24T22:00:00Z", // 00:00 CEST on the 25th
+		"2026-10-25T00:30:00Z", // 02:30 CEST
+		"2026-10-25T01:30:00Z", // 02:30 CET, the repeated hour
+		"2026-10-25T22:59:00Z", // 23:59 CET on the 25th
+		"2026-10-25T23:00:00Z", // 00:00 CET on the 26th
+	} {
+		at, _ := time.Parse(time.RFC3339, ts)
+		if err := repo.RecordClick(context.Background(), resp.Code, domain.Click{ClickedAt: at}); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	from := time.Date(2026, 10, 24, 12, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 10, 26, 23, 0, 0, 0, time.UTC) // local midnight
+
+	series, err := svc.TimeSeries(context.Background(), adminKey, resp.Code, domain.TimeSeriesQuery{From: &from, To: &to, TZ: "Europe/Berlin"})
+	if err != nil {
+		t.Fatalf("time series: %v", err)
+	}
+	if series.Interval != domain.IntervalDay || series.Total != 6 {
+		t.Errorf("expected 6 clicks by day, got %d by %s", series.Total, series.Interval)
+	}
+
+	wantDays := []int64{1, 4, 1}
+	if len(series.Buckets) != len(wantDays) {
+		t.Fatalf("expected %d daily buckets, got %+v", len(wantDays), series.Buckets)
+	}
+	for i, want := range wantDays {
+		b := series.Buckets[i]
+		if b.Clicks != want {
+			t.Errorf("day %s: expected %d clicks, got %d", b.Start, want, b.Clicks)
+		}
+		if b.Start.Hour() != 0 || b.Start.Day() != 24+i {
+			t.Errorf("bucket %d: expected local midnight of the %dth, got %s", i, 24+i, b.Start)
+		}
+	}
+
+	from = time.Date(2026, 10, 24, 23, 0, 0, 0, time.UTC)
+	to = time.Date(2026, 10, 25, 2, 0, 0, 0, time.UTC)
+	series, err = svc.TimeSeries(context.Background(), adminKey, resp.Code, domain.TimeSeriesQuery{
+		Interval: domain.IntervalHour, From: &from, To: &to, TZ: "Europe/Berlin",
+	})
+	if err != nil {
+		t.Fatalf("hourly time series: %v", err)
+	}
+	wantHours := []int64{0, 1, 1}
+	if len(series.Buckets) != len(wantHours) {
+		t.Fatalf("expected %d hourly buckets across the repeated hour, got %+v", len(wantHours), series.Buckets)
+	}
+	for i, want := range wantHours {
+		if series.Buckets[i].Clicks != want {
+			t.Errorf("hour %s: expected %d clicks, got %d", series.Buckets[i].Start, want, series.Buckets[i].Clicks)
+		}
+	}
+}
+
+func TestURLService_TimeSeries_Invalid(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	now := time.Now()
+	past := now.Add(-time.Hour)
+	longAgo := now.AddDate(-5, 0, 0)
+
+	tests := []struct {
+		name string
+		q    domain.TimeSeriesQuery
+	}{
+		{"bad interval", domain.TimeSeriesQuery{Interval: "week"}},
+		{"bad time zone", domain.TimeSeriesQuery{TZ: "Mars/Olympus"}},
+		{"inverted range", domain.TimeSeriesQuery{From: &now, To: &past}},
+		{"too many buckets", domain.TimeSeriesQuery{Interval: domain.IntervalHour, From: &longAgo}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.TimeSeries(context.Background(), adminKey, resp.Code, tt.q)
+			if !errors.Is(err, ErrInvalidTimeSeries) {
+				t.Errorf("expected ErrInvalidTimeSeries, got %v", err)
+			}
+		})
+	}
+
+	if _, err := svc.TimeSeries(context.Background(), bobKey, resp.Code, domain.TimeSeriesQuery{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another key, got %v", err)
+	}
+}
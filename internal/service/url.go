@@ -2,113 +2,712 @@
 package service
 
 import (
+	"context"
+	"encoding/base64"
 	"errors"
 	"fmt"
 	"log"
+	"net/http"
 	"net/url"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/encoding"
 	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/statscache"
+	"github.com/devaloi/shrink/internal/stream"
 )
 
 // MaxURLLength is the maximum allowed length for a URL.
 const MaxURLLength = 2048
 
+// Alias length limits for custom short codes.
+const (
+	MinAliasLength = 3
+	MaxAliasLength = 64
+)
+
+// DefaultMaxBatchSize is the default limit on items per ShortenBatch call.
+const DefaultMaxBatchSize = 1000
+
+// Page size limits for listing URLs.
+const (
+	DefaultListLimit = 20
+	MaxListLimit     = 100
+)
+
+// redirectStatuses are the HTTP statuses a link may redirect with.
+var redirectStatuses = map[int]bool{
+	http.StatusMovedPermanently:  true,
+	http.StatusFound:             true,
+	http.StatusTemporaryRedirect: true,
+	http.StatusPermanentRedirect: true,
+}
+
+// reservedAliases are path segments that must never be handed out as aliases
+// because they collide with API routes or are commonly probed paths.
+var reservedAliases = map[string]bool{
+	"api":    true,
+	"admin":  true,
+	"assets": true,
+	"docs":   true,
+	"health": true,
+	"login":  true,
+	"logout": true,
+	"static": true,
+	"stats":  true,
+	"www":    true,
+}
+
 // Common errors returned by the service.
 var (
 	ErrInvalidURL    = errors.New("invalid URL")
 	ErrEmptyURL      = errors.New("URL cannot be empty")
 	ErrMissingScheme = errors.New("URL must have http or https scheme")
 	ErrURLTooLong    = errors.New("URL exceeds maximum length")
+	ErrInvalidAlias  = errors.New("invalid alias")
+	ErrReservedAlias = errors.New("alias is reserved")
+	ErrAliasTaken    = errors.New("alias already in use")
+	ErrInvalidOption = errors.New("invalid link option")
+	ErrExpired       = errors.New("short url has expired")
+	ErrDisabled      = errors.New("short url is disabled")
 	ErrNotFound      = repository.ErrNotFound
+
+	ErrRevisionNotFound = repository.ErrRevisionNotFound
+	ErrInvalidFilter    = errors.New("invalid list filter")
+	ErrInvalidCursor    = errors.New("invalid cursor")
+	ErrEmptyBatch       = errors.New("batch contains no urls")
+	ErrBatchTooLarge    = errors.New("batch exceeds maximum size")
 )
 
 // URLService handles URL shortening business logic.
 type URLService struct {
-	repo    repository.Repository
-	baseURL string
+	repo            repository.Repository
+	baseURL         string
+	now             func() time.Time
+	maxBatchSize    int
+	defaultRedirect int
+	ipSalt          []byte
+	clicks          ClickRecorder
+	notifier        LinkNotifier
+	live            *stream.Broker
+	statsLocation   *time.Location
+	statsCache      *statscache.Cache
+	codec           *encoding.Codec
+}
+
+// ClickRecorder receives the click events of resolved redirects.
+// recorder.Recorder queues them for batched writes.
+type ClickRecorder interface {
+	Record(code string, click domain.Click) bool
+}
+
+// syncRecorder writes each click to the repository before the redirect is
+// returned. It is the default when no ClickRecorder is configured. Clicks
+// are recorded even if the client goes away before the redirect is sent.
+type syncRecorder struct {
+	repo repository.Repository
+}
+
+func (r syncRecorder) Record(code string, click domain.Click) bool {
+	if err := r.repo.RecordClick(context.Background(), code, click); err != nil {
+		log.Printf("error recording click for %s: %v", code, err)
+		return false
+	}
+	return true
+}
+
+// Option configures optional URLService behavior.
+type Option func(*URLService)
+
+// WithMaxBatchSize limits how many items ShortenBatch accepts.
+func WithMaxBatchSize(n int) Option {
+	return func(s *URLService) {
+		s.maxBatchSize = n
+	}
+}
+
+// WithDefaultRedirect sets the redirect status for links that do not choose
+// their own redirect type.
+func WithDefaultRedirect(status int) Option {
+	return func(s *URLService) {
+		s.defaultRedirect = status
+	}
+}
+
+// WithIPSalt sets the secret mixed into client IP hashes. Hashes are only
+// comparable between services that share a salt; without this option a
+// random salt is generated per process.
+func WithIPSalt(salt string) Option {
+	return func(s *URLService) {
+		s.ipSalt = []byte(salt)
+	}
+}
+
+// WithClickRecorder hands click events to rec instead of writing each one
+// synchronously while the redirect waits.
+func WithClickRecorder(rec ClickRecorder) Option {
+	return func(s *URLService) {
+		s.clicks = rec
+	}
+}
+
+// WithNotifier reports link lifecycle events to n.
+func WithNotifier(n LinkNotifier) Option {
+	return func(s *URLService) {
+		s.notifier = n
+	}
+}
+
+// WithClickStream publishes live clicks to b instead of a private broker,
+// so that the caller can close it on shutdown.
+func WithClickStream(b *stream.Broker) Option {
+	return func(s *URLService) {
+		s.live = b
+	}
+}
+
+// WithStatsLocation sets the time zone whose calendar days GlobalStats
+// reports in, unless a request names its own.
+func WithStatsLocation(loc *time.Location) Option {
+	return func(s *URLService) {
+		s.statsLocation = loc
+	}
+}
+
+// WithStatsCache serves GlobalStats from snapshots in c, refreshed in the
+// background, instead of querying the repository on every call.
+func WithStatsCache(c *statscache.Cache) Option {
+	return func(s *URLService) {
+		s.statsCache = c
+	}
+}
+
+// WithCodec sets the codec generated codes are written with, so that codes
+// are looked up however the codec allows them to be typed and codes with a
+// wrong check character are rejected without a repository lookup. The
+// default is encoding.Base62.
+func WithCodec(c *encoding.Codec) Option {
+	return func(s *URLService) {
+		s.codec = c
+	}
 }
 
 // NewURLService creates a new URL service with the given repository and base URL.
-func NewURLService(repo repository.Repository, baseURL string) *URLService {
-	return &URLService{
-		repo:    repo,
-		baseURL: strings.TrimSuffix(baseURL, "/"),
+func NewURLService(repo repository.Repository, baseURL string, opts ...Option) *URLService {
+	s := &URLService{
+		repo:            repo,
+		baseURL:         strings.TrimSuffix(baseURL, "/"),
+		now:             time.Now,
+		maxBatchSize:    DefaultMaxBatchSize,
+		defaultRedirect: http.StatusMovedPermanently,
+		ipSalt:          randomSalt(),
+		clicks:          syncRecorder{repo: repo},
+		notifier:        nopNotifier{},
+		live:            stream.NewBroker(),
+		statsLocation:   time.UTC,
+		codec:           encoding.Base62,
+	}
+	for _, opt := range opts {
+		opt(s)
 	}
+	return s
 }
 
-// Shorten creates a new short URL for the given original URL.
-// If the URL already exists, it returns the existing short URL.
-func (s *URLService) Shorten(originalURL string) (*domain.CreateResponse, error) {
-	if err := s.validateURL(originalURL); err != nil {
+// Shorten creates a new short URL for the requested original URL.
+// When an alias is given it becomes the short code; otherwise a code is
+// generated and an existing short URL for the same original is reused.
+func (s *URLService) Shorten(ctx context.Context, req domain.CreateRequest) (*domain.CreateResponse, error) {
+	resp, link, err := s.shorten(ctx, s.repo, req)
+	if err != nil {
 		return nil, err
 	}
+	if link != nil {
+		s.notifier.LinkCreated(link)
+	}
+	return resp, nil
+}
 
-	existing, err := s.repo.GetByOriginal(originalURL)
-	if err == nil {
-		return &domain.CreateResponse{
-			ShortURL: fmt.Sprintf("%s/%s", s.baseURL, existing.Code),
-			Code:     existing.Code,
-		}, nil
+// ShortenBatch shortens every item inside one repository transaction.
+// Invalid items are reported in their result without affecting the others;
+// a storage failure aborts and rolls back the whole batch.
+func (s *URLService) ShortenBatch(ctx context.Context, items []domain.CreateRequest) (*domain.BatchResponse, error) {
+	if len(items) == 0 {
+		return nil, ErrEmptyBatch
 	}
-	if !errors.Is(err, repository.ErrNotFound) {
-		return nil, fmt.Errorf("check existing url: %w", err)
+	if len(items) > s.maxBatchSize {
+		return nil, fmt.Errorf("%w: %d items (max %d)", ErrBatchTooLarge, len(items), s.maxBatchSize)
 	}
 
-	created, err := s.repo.Create(originalURL)
+	var resp *domain.BatchResponse
+	var links []*domain.URL
+	err := s.repo.WithTx(ctx, func(repo repository.Repository) error {
+		resp = &domain.BatchResponse{Results: make([]domain.BatchResult, len(items))}
+		for i, item := range items {
+			result := domain.BatchResult{Index: i}
+
+			created, link, err := s.shorten(ctx, repo, item)
+			switch {
+			case err == nil:
+				result.ShortURL = created.ShortURL
+				result.Code = created.Code
+				resp.Succeeded++
+				if link != nil {
+					links = append(links, link)
+				}
+			case isRequestError(err):
+				result.Error = err.Error()
+				resp.Failed++
+			default:
+				return fmt.Errorf("item %d: %w", i, err)
+			}
+
+			resp.Results[i] = result
+		}
+		return nil
+	})
 	if err != nil {
-		return nil, fmt.Errorf("create short url: %w", err)
+		return nil, err
 	}
 
-	return &domain.CreateResponse{
-		ShortURL: fmt.Sprintf("%s/%s", s.baseURL, created.Code),
-		Code:     created.Code,
-	}, nil
+	for _, link := range links {
+		s.notifier.LinkCreated(link)
+	}
+	return resp, nil
 }
 
-// Resolve looks up the original URL for a short code and increments the click count.
-func (s *URLService) Resolve(code string) (string, error) {
-	if code == "" {
-		return "", ErrNotFound
+// isRequestError reports whether err is caused by the caller's input rather
+// than by the service or its storage.
+func isRequestError(err error) bool {
+	for _, target := range []error{
+		ErrEmptyURL, ErrURLTooLong, ErrMissingScheme, ErrInvalidURL,
+		ErrInvalidAlias, ErrReservedAlias, ErrAliasTaken, ErrInvalidOption,
+	} {
+		if errors.Is(err, target) {
+			return true
+		}
+	}
+	return false
+}
+
+// shorten creates or finds the short URL for req. The returned link is set
+// only when a new link was created.
+func (s *URLService) shorten(ctx context.Context, repo repository.Repository, req domain.CreateRequest) (*domain.CreateResponse, *domain.URL, error) {
+	if err := s.validateURL(req.URL); err != nil {
+		return nil, nil, err
+	}
+	if err := s.validateOptions(req.LinkOptions); err != nil {
+		return nil, nil, err
+	}
+
+	if req.Alias != "" {
+		if err := validateAlias(req.Alias); err != nil {
+			return nil, nil, err
+		}
+
+		code, err := s.aliasCode(req.Alias)
+		if err != nil {
+			return nil, nil, err
+		}
+
+		created, err := repo.CreateWithCode(ctx, code, req.URL, req.LinkOptions)
+		if errors.Is(err, repository.ErrCodeExists) {
+			return nil, nil, ErrAliasTaken
+		}
+		if err != nil {
+			return nil, nil, fmt.Errorf("create aliased url: %w", err)
+		}
+		return s.createResponse(created.Code), created, nil
+	}
+
+	if req.LinkOptions.IsZero() {
+		existing, err := repo.GetByOriginal(ctx, req.URL, req.OwnerID)
+		if err == nil {
+			return s.createResponse(existing.Code), nil, nil
+		}
+		if !errors.Is(err, repository.ErrNotFound) {
+			return nil, nil, fmt.Errorf("check existing url: %w", err)
+		}
 	}
 
-	urlRecord, err := s.repo.GetByCode(code)
+	created, err := repo.Create(ctx, req.URL, req.LinkOptions)
+	if errors.Is(err, repository.ErrDestinationExists) {
+		// Shortened concurrently since the lookup above.
+		existing, err := repo.GetByOriginal(ctx, req.URL, req.OwnerID)
+		if err != nil {
+			return nil, nil, fmt.Errorf("get existing url: %w", err)
+		}
+		return s.createResponse(existing.Code), nil, nil
+	}
 	if err != nil {
-		return "", err
+		return nil, nil, fmt.Errorf("create short url: %w", err)
 	}
 
-	go func() {
-		if err := s.repo.IncrementClicks(code); err != nil {
-			log.Printf("error incrementing clicks for %s: %v", code, err)
+	return s.createResponse(created.Code), created, nil
+}
+
+func (s *URLService) createResponse(code string) *domain.CreateResponse {
+	return &domain.CreateResponse{
+		ShortURL: fmt.Sprintf("%s/%s", s.baseURL, code),
+		Code:     code,
+	}
+}
+
+// Resolve looks up where a short code should redirect and records a click
+// from visit. Bots are redirected like anyone else but recorded as bot
+// clicks, which do not count toward click budgets. Human clicks on links
+// with a budget are counted before redirecting, so that the budget holds
+// however many clicks are still queued for writing. Links redirect with the
+// status chosen by redirectStatus. Expired links resolve to their fallback
+// URL with a temporary redirect, or return ErrExpired when no fallback is
+// set.
+func (s *URLService) Resolve(ctx context.Context, code string, visit domain.Visit) (*domain.Redirect, error) {
+	urlRecord, err := s.findURL(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if urlRecord.Disabled {
+		return nil, ErrDisabled
+	}
+
+	if urlRecord.Expired(s.now()) {
+		return s.expired(ctx, urlRecord)
+	}
+
+	click := s.newClick(visit)
+	if urlRecord.MaxClicks != nil && !click.Bot {
+		err := s.repo.ClaimClick(ctx, urlRecord.Code)
+		if errors.Is(err, repository.ErrClickBudgetSpent) {
+			return s.expired(ctx, urlRecord)
+		}
+		if err != nil {
+			return nil, err
 		}
-	}()
+		click.Counted = true
+	}
+	s.clicks.Record(urlRecord.Code, click)
+	s.live.Publish(liveClick(urlRecord, click))
 
-	return urlRecord.Original, nil
+	return &domain.Redirect{Location: urlRecord.Original, Status: s.redirectStatus(urlRecord)}, nil
+}
+
+// expired returns the fallback of an expired link. The first request to
+// notice the expiry, or SweepExpired, marks the link and reports it to the
+// notifier; later requests skip both.
+func (s *URLService) expired(ctx context.Context, urlRecord *domain.URL) (*domain.Redirect, error) {
+	if !urlRecord.ExpiryNotified {
+		first, err := s.repo.MarkExpiryNotified(ctx, urlRecord.Code)
+		if err != nil {
+			log.Printf("error marking %s as expired: %v", urlRecord.Code, err)
+		}
+		if first {
+			s.notifier.LinkExpired(urlRecord)
+		}
+	}
+
+	if urlRecord.FallbackURL == "" {
+		return nil, ErrExpired
+	}
+	return &domain.Redirect{Location: urlRecord.FallbackURL, Status: http.StatusFound}, nil
+}
+
+// SweepExpired reports up to limit links that have expired by now without a
+// request noticing, by date or click budget, to the notifier, marking each
+// so it is reported once. It returns how many links it looked at, so that a
+// caller can sweep in batches until fewer than limit are left.
+func (s *URLService) SweepExpired(ctx context.Context, now time.Time, limit int) (int64, error) {
+	links, err := s.repo.ExpiredLinks(ctx, now, limit)
+	if err != nil {
+		return 0, err
+	}
+	for i := range links {
+		first, err := s.repo.MarkExpiryNotified(ctx, links[i].Code)
+		if err != nil {
+			return int64(i), err
+		}
+		if first {
+			s.notifier.LinkExpired(&links[i])
+		}
+	}
+	return int64(len(links)), nil
+}
+
+// redirectStatus returns the status a live link redirects with: its own
+// redirect type, or the service default when unset. Browsers cache permanent
+// redirects and would keep following them after the link expires, so links
+// with an expiry date or click budget get the temporary counterpart of a
+// permanent default.
+func (s *URLService) redirectStatus(u *domain.URL) int {
+	status := u.RedirectType
+	if status == 0 {
+		status = s.defaultRedirect
+	}
+	if u.ExpiresAt == nil && u.MaxClicks == nil {
+		return status
+	}
+
+	switch status {
+	case http.StatusMovedPermanently:
+		return http.StatusFound
+	case http.StatusPermanentRedirect:
+		return http.StatusTemporaryRedirect
+	default:
+		return status
+	}
+}
+
+// Stats returns statistics for a short URL owned by key.
+func (s *URLService) Stats(ctx context.Context, key *domain.APIKey, code string) (*domain.StatsResponse, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	return statsResponse(urlRecord), nil
+}
+
+// ownedURL looks up code on behalf of key. Links owned by another key are
+// reported as ErrNotFound so that codes cannot be probed for existence.
+func (s *URLService) ownedURL(ctx context.Context, key *domain.APIKey, code string) (*domain.URL, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+	urlRecord, err := s.findURL(ctx, code)
+	if err != nil {
+		return nil, err
+	}
+	if !key.CanManage(urlRecord.OwnerID) {
+		return nil, ErrNotFound
+	}
+	return urlRecord, nil
 }
 
-// Stats returns statistics for a shortened URL.
-func (s *URLService) Stats(code string) (*domain.StatsResponse, error) {
+// findURL returns the link code was typed for. A code made only of codec
+// characters is looked up in canonical form, so that a case-insensitive
+// codec finds it however it was typed, and reported as ErrNotFound without
+// a lookup if its check character is wrong. If the canonical form is not
+// found, the code is looked up as given, which finds links stored before
+// the codec changed. Anything else can only be an alias and is used as is.
+func (s *URLService) findURL(ctx context.Context, code string) (*domain.URL, error) {
 	if code == "" {
 		return nil, ErrNotFound
 	}
 
-	urlRecord, err := s.repo.GetByCode(code)
+	canonical, err := s.codec.Canonical(code)
+	switch {
+	case errors.Is(err, encoding.ErrCheckChar):
+		return nil, ErrNotFound
+	case err != nil:
+		return s.repo.GetByCode(ctx, code)
+	}
+
+	urlRecord, err := s.repo.GetByCode(ctx, canonical)
+	if errors.Is(err, repository.ErrNotFound) && canonical != code {
+		return s.repo.GetByCode(ctx, code)
+	}
+	return urlRecord, err
+}
+
+// aliasCode returns the code an alias is stored under. An alias made only of
+// codec characters is looked up like a generated code, so it is stored in
+// canonical form, where it collides with the generated code it could pass
+// for, and, when the codec has check characters, must end with a valid one.
+func (s *URLService) aliasCode(alias string) (string, error) {
+	code, err := s.codec.Canonical(alias)
+	switch {
+	case err == nil:
+		return code, nil
+	case errors.Is(err, encoding.ErrCheckChar):
+		want, _ := s.codec.AppendCheckChar(alias)
+		return "", fmt.Errorf("%w: must end with a check character, as in %q", ErrInvalidAlias, want)
+	default:
+		return alias, nil
+	}
+}
+
+func statsResponse(urlRecord *domain.URL) *domain.StatsResponse {
+	return &domain.StatsResponse{
+		Code:        urlRecord.Code,
+		Original:    urlRecord.Original,
+		Clicks:      urlRecord.Clicks,
+		BotClicks:   urlRecord.BotClicks,
+		CreatedAt:   urlRecord.CreatedAt,
+		Disabled:    urlRecord.Disabled,
+		LinkOptions: urlRecord.LinkOptions,
+	}
+}
+
+// List returns a page of URLs matching the filter. cursor is the NextCursor
+// of the previous page, or empty for the first page. Non-admin keys only see
+// their own links.
+func (s *URLService) List(ctx context.Context, key *domain.APIKey, filter domain.ListFilter, cursor string) (*domain.URLPage, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+	filter.OwnerID = 0
+	if !key.Admin {
+		filter.OwnerID = key.ID
+	}
+
+	switch filter.SortBy {
+	case "":
+		filter.SortBy = domain.SortCreatedAt
+	case domain.SortCreatedAt, domain.SortClicks:
+	default:
+		return nil, fmt.Errorf("%w: sort must be %s or %s", ErrInvalidFilter, domain.SortCreatedAt, domain.SortClicks)
+	}
+
+	if filter.Limit == 0 {
+		filter.Limit = DefaultListLimit
+	}
+	if filter.Limit < 1 || filter.Limit > MaxListLimit {
+		return nil, fmt.Errorf("%w: limit must be between 1 and %d", ErrInvalidFilter, MaxListLimit)
+	}
+
+	if cursor != "" {
+		after, err := decodeCursor(cursor, filter.SortBy)
+		if err != nil {
+			return nil, err
+		}
+		filter.After = after
+	}
+
+	// Fetch one extra row to learn whether another page follows.
+	limit := filter.Limit
+	filter.Limit++
+	urls, err := s.repo.List(ctx, filter)
 	if err != nil {
 		return nil, err
 	}
 
-	return &domain.StatsResponse{
-		Code:      urlRecord.Code,
-		Original:  urlRecord.Original,
-		Clicks:    urlRecord.Clicks,
-		CreatedAt: urlRecord.CreatedAt,
-	}, nil
+	page := &domain.URLPage{URLs: urls}
+	if len(urls) > limit {
+		page.URLs = urls[:limit]
+		page.NextCursor = encodeCursor(page.URLs[limit-1], filter.SortBy)
+	}
+	return page, nil
+}
+
+// encodeCursor builds an opaque cursor positioned at u for the given sort.
+func encodeCursor(u domain.URL, sortBy string) string {
+	value := u.CreatedAt.UTC().Format(time.RFC3339Nano)
+	if sortBy == domain.SortClicks {
+		value = strconv.FormatInt(u.Clicks, 10)
+	}
+	raw := fmt.Sprintf("%s|%s|%d", sortBy, value, u.ID)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// decodeCursor parses a cursor produced by encodeCursor for the same sort.
+func decodeCursor(cursor, sortBy string) (*domain.ListCursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	parts := strings.Split(string(raw), "|")
+	if len(parts) != 3 || parts[0] != sortBy {
+		return nil, ErrInvalidCursor
+	}
+
+	after := &domain.ListCursor{}
+	if after.ID, err = strconv.ParseInt(parts[2], 10, 64); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if sortBy == domain.SortClicks {
+		after.Clicks, err = strconv.ParseInt(parts[1], 10, 64)
+	} else {
+		after.CreatedAt, err = time.Parse(time.RFC3339Nano, parts[1])
+	}
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+	return after, nil
+}
+
+// UpdateDestination points an existing short URL at a new original URL.
+// The previous destination is kept as a revision attributed to key.
+func (s *URLService) UpdateDestination(ctx context.Context, key *domain.APIKey, code, originalURL string) (*domain.StatsResponse, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+	if err := s.validateURL(originalURL); err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateOriginal(ctx, urlRecord.Code, originalURL, key.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return statsResponse(updated), nil
+}
+
+// Revisions returns the destination history of a short URL, newest first.
+func (s *URLService) Revisions(ctx context.Context, key *domain.APIKey, code string) (*domain.RevisionList, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	revisions, err := s.repo.ListRevisions(ctx, urlRecord.Code)
+	if err != nil {
+		return nil, err
+	}
+
+	return &domain.RevisionList{Code: urlRecord.Code, Revisions: revisions}, nil
 }
 
-// GlobalStats returns aggregate statistics for all URLs.
-func (s *URLService) GlobalStats() (*domain.GlobalStats, error) {
-	return s.repo.GlobalStats()
+// Rollback restores the destination recorded in a revision. The destination
+// being replaced is itself recorded as a new revision.
+func (s *URLService) Rollback(ctx context.Context, key *domain.APIKey, code string, revisionID int64) (*domain.StatsResponse, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	rev, err := s.repo.GetRevision(ctx, urlRecord.Code, revisionID)
+	if err != nil {
+		return nil, err
+	}
+
+	updated, err := s.repo.UpdateOriginal(ctx, urlRecord.Code, rev.Original, key.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return statsResponse(updated), nil
+}
+
+// Delete removes a short URL. Its code is tombstoned and never reissued.
+func (s *URLService) Delete(ctx context.Context, key *domain.APIKey, code string) error {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return err
+	}
+	if err := s.repo.Delete(ctx, urlRecord.Code); err != nil {
+		return err
+	}
+	s.notifier.LinkDeleted(urlRecord)
+	return nil
+}
+
+// SetDisabled disables or re-enables a short URL and returns its statistics.
+func (s *URLService) SetDisabled(ctx context.Context, key *domain.APIKey, code string, disabled bool) (*domain.StatsResponse, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := s.repo.SetDisabled(ctx, urlRecord.Code, disabled); err != nil {
+		return nil, err
+	}
+
+	return s.Stats(ctx, key, urlRecord.Code)
 }
 
 func (s *URLService) validateURL(rawURL string) error {
@@ -136,3 +735,60 @@ func (s *URLService) validateURL(rawURL string) error {
 
 	return nil
 }
+
+func (s *URLService) validateOptions(opts domain.LinkOptions) error {
+	if opts.ExpiresAt != nil && !opts.ExpiresAt.After(s.now()) {
+		return fmt.Errorf("%w: expires_at must be in the future", ErrInvalidOption)
+	}
+
+	if opts.MaxClicks != nil && *opts.MaxClicks < 1 {
+		return fmt.Errorf("%w: max_clicks must be at least 1", ErrInvalidOption)
+	}
+
+	if opts.FallbackURL != "" {
+		if err := s.validateURL(opts.FallbackURL); err != nil {
+			return fmt.Errorf("%w: fallback_url: %v", ErrInvalidOption, err)
+		}
+	}
+
+	if opts.RedirectType != 0 && !redirectStatuses[opts.RedirectType] {
+		return fmt.Errorf("%w: redirect_type must be 301, 302, 307 or 308", ErrInvalidOption)
+	}
+
+	if permanentRedirect(opts.RedirectType) && (opts.ExpiresAt != nil || opts.MaxClicks != nil) {
+		return fmt.Errorf("%w: redirect_type must be 302 or 307 for links that expire", ErrInvalidOption)
+	}
+
+	return nil
+}
+
+// permanentRedirect reports whether browsers may cache a redirect with status
+// indefinitely.
+func permanentRedirect(status int) bool {
+	return status == http.StatusMovedPermanently || status == http.StatusPermanentRedirect
+}
+
+func validateAlias(alias string) error {
+	if len(alias) < MinAliasLength || len(alias) > MaxAliasLength {
+		return fmt.Errorf("%w: must be %d-%d characters", ErrInvalidAlias, MinAliasLength, MaxAliasLength)
+	}
+
+	for _, c := range alias {
+		if !isAliasChar(c) {
+			return fmt.Errorf("%w: only letters, digits, '-' and '_' are allowed", ErrInvalidAlias)
+		}
+	}
+
+	if reservedAliases[strings.ToLower(alias)] {
+		return ErrReservedAlias
+	}
+
+	return nil
+}
+
+func isAliasChar(c rune) bool {
+	return (c >= 'a' && c <= 'z') ||
+		(c >= 'A' && c <= 'Z') ||
+		(c >= '0' && c <= '9') ||
+		c == '-' || c == '_'
+}
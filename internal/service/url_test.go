@@ -1,86 +1,471 @@
 package service
 
 import (
+	"context"
 	"errors"
+	"net/http"
+	"sort"
 	"strings"
 	"testing"
 	"time"
 
 	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/encoding"
+	"github.com/devaloi/shrink/internal/hll"
 	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/statscache"
 )
 
+var (
+	adminKey = &domain.APIKey{ID: 1, Name: "admin", Admin: true}
+	aliceKey = &domain.APIKey{ID: 2, Name: "alice"}
+	bobKey   = &domain.APIKey{ID: 3, Name: "bob"}
+)
+
+// originalKey indexes deduplicated links the way GetByOriginal looks them up.
+type originalKey struct {
+	original string
+	ownerID  int64
+}
+
 type mockRepo struct {
-	urls      map[string]*domain.URL
+	urls      map[originalKey]*domain.URL
 	byCode    map[string]*domain.URL
+	deleted   map[string]bool
+	revisions map[string][]domain.Revision
+	clicks    map[string][]domain.Click
+	sketches  map[string]map[string]*hll.Sketch
 	nextID    int64
 	createErr error
+
+	// exported is the query of the last export.
+	exported domain.ExportQuery
+
+	// statsQuery is the query of the last Leaderboards call, and
+	// totalsLoads counts the StatsTotals calls.
+	statsQuery  domain.StatsQuery
+	totalsLoads int
 }
 
 func newMockRepo() *mockRepo {
 	return &mockRepo{
-		urls:   make(map[string]*domain.URL),
-		byCode: make(map[string]*domain.URL),
-		nextID: 1,
+		urls:      make(map[originalKey]*domain.URL),
+		byCode:    make(map[string]*domain.URL),
+		deleted:   make(map[string]bool),
+		revisions: make(map[string][]domain.Revision),
+		clicks:    make(map[string][]domain.Click),
+		sketches:  make(map[string]map[string]*hll.Sketch),
+		nextID:    1,
 	}
 }
 
-func (m *mockRepo) Create(original string) (*domain.URL, error) {
+func (m *mockRepo) Create(_ context.Context, original string, opts domain.LinkOptions) (*domain.URL, error) {
 	if m.createErr != nil {
 		return nil, m.createErr
 	}
 	url := &domain.URL{
-		ID:        m.nextID,
-		Code:      "test" + string(rune('a'+m.nextID-1)),
-		Original:  original,
-		Clicks:    0,
-		CreatedAt: time.Now(),
+		ID:          m.nextID,
+		Code:        "test" + string(rune('a'+m.nextID-1)),
+		Original:    original,
+		Clicks:      0,
+		CreatedAt:   time.Now(),
+		LinkOptions: opts,
+	}
+	if opts.IsZero() {
+		key := originalKey{original, opts.OwnerID}
+		if _, ok := m.urls[key]; ok {
+			return nil, repository.ErrDestinationExists
+		}
+		m.urls[key] = url
 	}
 	m.nextID++
-	m.urls[original] = url
 	m.byCode[url.Code] = url
 	return url, nil
 }
 
-func (m *mockRepo) GetByCode(code string) (*domain.URL, error) {
-	if url, ok := m.byCode[code]; ok {
+func (m *mockRepo) CreateWithCode(_ context.Context, code, original string, opts domain.LinkOptions) (*domain.URL, error) {
+	if m.createErr != nil {
+		return nil, m.createErr
+	}
+	if _, ok := m.byCode[code]; ok {
+		return nil, repository.ErrCodeExists
+	}
+	url := &domain.URL{
+		ID:          m.nextID,
+		Code:        code,
+		Original:    original,
+		CreatedAt:   time.Now(),
+		LinkOptions: opts,
+	}
+	m.nextID++
+	m.byCode[url.Code] = url
+	return url, nil
+}
+
+func (m *mockRepo) GetByCode(_ context.Context, code string) (*domain.URL, error) {
+	if url, ok := m.byCode[code]; ok && !m.deleted[code] {
 		return url, nil
 	}
 	return nil, repository.ErrNotFound
 }
 
-func (m *mockRepo) GetByOriginal(original string) (*domain.URL, error) {
-	if url, ok := m.urls[original]; ok {
+func (m *mockRepo) List(_ context.Context, filter domain.ListFilter) ([]domain.URL, error) {
+	var urls []domain.URL
+	for code, url := range m.byCode {
+		if m.deleted[code] || (filter.OwnerID != 0 && url.OwnerID != filter.OwnerID) {
+			continue
+		}
+		urls = append(urls, *url)
+	}
+
+	// Only id order is modeled; it matches created_at order here.
+	sort.Slice(urls, func(i, j int) bool {
+		if filter.Ascending {
+			return urls[i].ID < urls[j].ID
+		}
+		return urls[i].ID > urls[j].ID
+	})
+
+	result := []domain.URL{}
+	for _, url := range urls {
+		if filter.After != nil {
+			if filter.Ascending && url.ID <= filter.After.ID {
+				continue
+			}
+			if !filter.Ascending && url.ID >= filter.After.ID {
+				continue
+			}
+		}
+		if len(result) == filter.Limit {
+			break
+		}
+		result = append(result, url)
+	}
+	return result, nil
+}
+
+func (m *mockRepo) UpdateOriginal(_ context.Context, code, original, changedBy string) (*domain.URL, error) {
+	url, err := m.GetByCode(context.Background(), code)
+	if err != nil {
+		return nil, err
+	}
+	if url.Original == original {
+		return url, nil
+	}
+	rev := domain.Revision{
+		ID:        int64(len(m.revisions[code]) + 1),
+		Original:  url.Original,
+		ChangedBy: changedBy,
+		ChangedAt: time.Now(),
+	}
+	m.revisions[code] = append([]domain.Revision{rev}, m.revisions[code]...)
+	url.Original = original
+	return url, nil
+}
+
+func (m *mockRepo) ListRevisions(_ context.Context, code string) ([]domain.Revision, error) {
+	if _, err := m.GetByCode(context.Background(), code); err != nil {
+		return nil, err
+	}
+	return m.revisions[code], nil
+}
+
+func (m *mockRepo) GetRevision(_ context.Context, code string, id int64) (*domain.Revision, error) {
+	for _, rev := range m.revisions[code] {
+		if rev.ID == id {
+			return &rev, nil
+		}
+	}
+	return nil, repository.ErrRevisionNotFound
+}
+
+func (m *mockRepo) Delete(_ context.Context, code string) error {
+	url, err := m.GetByCode(context.Background(), code)
+	if err != nil {
+		return err
+	}
+	m.deleted[code] = true
+	if key := (originalKey{url.Original, url.OwnerID}); m.urls[key] == url {
+		delete(m.urls, key)
+	}
+	return nil
+}
+
+func (m *mockRepo) SetDisabled(_ context.Context, code string, disabled bool) error {
+	url, err := m.GetByCode(context.Background(), code)
+	if err != nil {
+		return err
+	}
+	url.Disabled = disabled
+	return nil
+}
+
+func (m *mockRepo) GetByOriginal(_ context.Context, original string, ownerID int64) (*domain.URL, error) {
+	if url, ok := m.urls[originalKey{original, ownerID}]; ok {
 		return url, nil
 	}
 	return nil, repository.ErrNotFound
 }
 
-func (m *mockRepo) IncrementClicks(code string) error {
+func (m *mockRepo) MarkExpiryNotified(_ context.Context, code string) (bool, error) {
+	url, ok := m.byCode[code]
+	if !ok || url.ExpiryNotified {
+		return false, nil
+	}
+	url.ExpiryNotified = true
+	return true, nil
+}
+
+func (m *mockRepo) ExpiredLinks(_ context.Context, now time.Time, limit int) ([]domain.URL, error) {
+	links := []domain.URL{}
+	for code, url := range m.byCode {
+		if url.ExpiryNotified || m.deleted[code] || !url.Expired(now) {
+			continue
+		}
+		links = append(links, *url)
+	}
+	sort.Slice(links, func(i, j int) bool { return links[i].ID < links[j].ID })
+	return links[:min(limit, len(links))], nil
+}
+
+func (m *mockRepo) ClaimClick(_ context.Context, code string) error {
+	url, ok := m.byCode[code]
+	if !ok {
+		return repository.ErrNotFound
+	}
+	if url.MaxClicks != nil && url.Clicks >= *url.MaxClicks {
+		return repository.ErrClickBudgetSpent
+	}
+	url.Clicks++
+	return nil
+}
+
+func (m *mockRepo) RecordClick(_ context.Context, code string, click domain.Click) error {
 	if url, ok := m.byCode[code]; ok {
-		url.Clicks++
+		if click.Bot {
+			url.BotClicks++
+			return nil
+		}
+		if !click.Counted {
+			url.Clicks++
+		}
+		m.clicks[code] = append(m.clicks[code], click)
+		if click.VisitorHash != 0 {
+			day := click.ClickedAt.UTC().Format(dayFormat)
+			if m.sketches[code] == nil {
+				m.sketches[code] = make(map[string]*hll.Sketch)
+			}
+			if m.sketches[code][day] == nil {
+				m.sketches[code][day] = hll.New()
+			}
+			m.sketches[code][day].Add(click.VisitorHash)
+		}
 		return nil
 	}
 	return repository.ErrNotFound
 }
 
-func (m *mockRepo) GlobalStats() (*domain.GlobalStats, error) {
-	var totalClicks int64
-	for _, url := range m.urls {
-		totalClicks += url.Clicks
+func (m *mockRepo) RecordClicks(_ context.Context, batch map[string][]domain.Click) error {
+	for code, clicks := range batch {
+		for _, click := range clicks {
+			if err := m.RecordClick(context.Background(), code, click); err != nil && err != repository.ErrNotFound {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ClickBuckets(_ context.Context, code string, from, to time.Time) ([]domain.ClickBucket, error) {
+	counts := make(map[time.Time]int64)
+	for _, c := range m.clicks[code] {
+		if !c.ClickedAt.Before(from) && c.ClickedAt.Before(to) {
+			counts[c.ClickedAt.UTC().Truncate(repository.ClickBucketSize)]++
+		}
+	}
+
+	buckets := []domain.ClickBucket{}
+	for start, n := range counts {
+		buckets = append(buckets, domain.ClickBucket{Start: start, Clicks: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
+
+func (m *mockRepo) ClickBreakdown(_ context.Context, code string, q domain.BreakdownQuery) (*domain.Breakdown, error) {
+	breakdown := &domain.Breakdown{Code: code, Total: int64(len(m.clicks[code]))}
+	top := func(value func(domain.Click) string) []domain.BreakdownEntry {
+		counts := make(map[string]int64)
+		for _, c := range m.clicks[code] {
+			counts[value(c)]++
+		}
+		entries := []domain.BreakdownEntry{}
+		for v, n := range counts {
+			entries = append(entries, domain.BreakdownEntry{Value: v, Clicks: n})
+		}
+		sort.Slice(entries, func(i, j int) bool {
+			if entries[i].Clicks != entries[j].Clicks {
+				return entries[i].Clicks > entries[j].Clicks
+			}
+			return entries[i].Value < entries[j].Value
+		})
+		if len(entries) > q.Limit {
+			entries = entries[:q.Limit]
+		}
+		return entries
+	}
+	breakdown.Referrers = top(func(c domain.Click) string { return c.ReferrerHost })
+	breakdown.Devices = top(func(c domain.Click) string { return c.AgentClass })
+	breakdown.OS = top(func(c domain.Click) string { return c.OS })
+	breakdown.Browsers = top(func(c domain.Click) string { return c.Browser })
+	return breakdown, nil
+}
+
+func (m *mockRepo) VisitorSketches(_ context.Context, code string, from, to time.Time) (map[string]*hll.Sketch, error) {
+	sketches := make(map[string]*hll.Sketch)
+	for day, sketch := range m.sketches[code] {
+		layout := dayFormat
+		if len(day) == len(monthFormat) {
+			layout = monthFormat
+		}
+		if day >= from.Format(layout) && day <= to.Format(layout) {
+			sketches[day] = sketch
+		}
+	}
+	return sketches, nil
+}
+
+func (m *mockRepo) CompactVisitorSketches(_ context.Context, cutoff time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRepo) RollupClicks(_ context.Context, cutoff time.Time, limit int) (int64, error) {
+	return 0, nil
+}
+
+func (m *mockRepo) ExportLinks(_ context.Context, q domain.ExportQuery, fn func(domain.URL) error) error {
+	m.exported = q
+	var urls []domain.URL
+	for code, url := range m.byCode {
+		if !m.deleted[code] && (q.OwnerID == 0 || url.OwnerID == q.OwnerID) {
+			urls = append(urls, *url)
+		}
+	}
+	sort.Slice(urls, func(i, j int) bool { return urls[i].ID < urls[j].ID })
+	for _, url := range urls {
+		if err := fn(url); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) ExportClicks(_ context.Context, q domain.ExportQuery, fn func(domain.ExportedClick) error) error {
+	m.exported = q
+	var codes []string
+	for code := range m.clicks {
+		if url, ok := m.byCode[code]; ok && !m.deleted[code] && (q.OwnerID == 0 || url.OwnerID == q.OwnerID) {
+			codes = append(codes, code)
+		}
+	}
+	sort.Strings(codes)
+	for _, code := range codes {
+		for _, c := range m.clicks[code] {
+			if err := fn(domain.ExportedClick{Code: code, Click: c}); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+func (m *mockRepo) StatsTotals(_ context.Context, ownerID int64) (*domain.StatsSnapshot, error) {
+	m.totalsLoads++
+	stats := &domain.StatsSnapshot{}
+	for _, url := range m.byCode {
+		if ownerID != 0 && url.OwnerID != ownerID {
+			continue
+		}
+		stats.TotalURLs++
+		stats.TotalClicks += url.Clicks
+	}
+	return stats, nil
+}
+
+func (m *mockRepo) Leaderboards(_ context.Context, q domain.StatsQuery) (*domain.StatsSnapshot, error) {
+	m.statsQuery = q
+	stats := &domain.StatsSnapshot{TopLinks: []domain.LinkClicks{}}
+	for code, url := range m.byCode {
+		if q.OwnerID != 0 && url.OwnerID != q.OwnerID {
+			continue
+		}
+		l := domain.LinkClicks{Code: code, Original: url.Original}
+		for _, c := range m.clicks[code] {
+			if !c.Bot && !c.ClickedAt.Before(q.From) {
+				l.Clicks++
+			}
+		}
+		if l.Clicks > 0 {
+			stats.TopLinks = append(stats.TopLinks, l)
+		}
+	}
+	sort.Slice(stats.TopLinks, func(i, j int) bool {
+		a, b := stats.TopLinks[i], stats.TopLinks[j]
+		return a.Clicks > b.Clicks || a.Clicks == b.Clicks && a.Code < b.Code
+	})
+	stats.TopLinks = stats.TopLinks[:min(q.Limit, len(stats.TopLinks))]
+	return stats, nil
+}
+
+func (m *mockRepo) CreatedBuckets(_ context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error) {
+	counts := make(map[time.Time]int64)
+	for _, url := range m.byCode {
+		if ownerID != 0 && url.OwnerID != ownerID {
+			continue
+		}
+		if !url.CreatedAt.Before(from) && url.CreatedAt.Before(to) {
+			counts[url.CreatedAt.UTC().Truncate(repository.ClickBucketSize)]++
+		}
+	}
+
+	buckets := []domain.CountBucket{}
+	for start, n := range counts {
+		buckets = append(buckets, domain.CountBucket{Start: start, Count: n})
+	}
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
+
+func (m *mockRepo) OwnerClickBuckets(_ context.Context, ownerID int64, from, to time.Time) ([]domain.CountBucket, error) {
+	counts := make(map[time.Time]int64)
+	for code, url := range m.byCode {
+		if ownerID != 0 && url.OwnerID != ownerID {
+			continue
+		}
+		for _, c := range m.clicks[code] {
+			if !c.Bot && !c.ClickedAt.Before(from) && c.ClickedAt.Before(to) {
+				counts[c.ClickedAt.UTC().Truncate(repository.ClickBucketSize)]++
+			}
+		}
+	}
+
+	buckets := []domain.CountBucket{}
+	for start, n := range counts {
+		buckets = append(buckets, domain.CountBucket{Start: start, Count: n})
 	}
-	return &domain.GlobalStats{
-		TotalURLs:   int64(len(m.urls)),
-		TotalClicks: totalClicks,
-		URLsToday:   int64(len(m.urls)),
-	}, nil
+	sort.Slice(buckets, func(i, j int) bool { return buckets[i].Start.Before(buckets[j].Start) })
+	return buckets, nil
+}
+
+func (m *mockRepo) WithTx(_ context.Context, fn func(repository.Repository) error) error {
+	return fn(m)
 }
 
 func TestURLService_Shorten(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	resp, err := svc.Shorten("https://example.com")
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("shorten: %v", err)
 	}
@@ -100,12 +485,12 @@ func TestURLService_Shorten_Duplicate(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	resp1, err := svc.Shorten("https://example.com")
+	resp1, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("first shorten: %v", err)
 	}
 
-	resp2, err := svc.Shorten("https://example.com")
+	resp2, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("second shorten: %v", err)
 	}
@@ -115,6 +500,41 @@ func TestURLService_Shorten_Duplicate(t *testing.T) {
 	}
 }
 
+// racingRepo misses its first GetByOriginal, as when another request
+// shortens the same URL between the lookup and the insert.
+type racingRepo struct {
+	*mockRepo
+	missed bool
+}
+
+func (r *racingRepo) GetByOriginal(ctx context.Context, original string, ownerID int64) (*domain.URL, error) {
+	if !r.missed {
+		r.missed = true
+		return nil, repository.ErrNotFound
+	}
+	return r.mockRepo.GetByOriginal(ctx, original, ownerID)
+}
+
+func TestURLService_Shorten_DuplicateRace(t *testing.T) {
+	mock := newMockRepo()
+	first, err := NewURLService(mock, "http://localhost:8080").Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("first shorten: %v", err)
+	}
+
+	svc := NewURLService(&racingRepo{mockRepo: mock}, "http://localhost:8080")
+	second, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("second shorten: %v", err)
+	}
+	if second.Code != first.Code {
+		t.Errorf("expected the concurrently created code %s, got %s", first.Code, second.Code)
+	}
+	if len(mock.byCode) != 1 {
+		t.Errorf("expected one link, got %d", len(mock.byCode))
+	}
+}
+
 func TestURLService_Shorten_InvalidURL(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
@@ -133,7 +553,7 @@ func TestURLService_Shorten_InvalidURL(t *testing.T) {
 
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			_, err := svc.Shorten(tt.url)
+			_, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: tt.url})
 			if err == nil {
 				t.Error("expected error, got nil")
 				return
@@ -149,18 +569,21 @@ func TestURLService_Resolve(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	resp, err := svc.Shorten("https://example.com")
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("shorten: %v", err)
 	}
 
-	original, err := svc.Resolve(resp.Code)
+	target, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{})
 	if err != nil {
 		t.Fatalf("resolve: %v", err)
 	}
 
-	if original != "https://example.com" {
-		t.Errorf("expected https://example.com, got %s", original)
+	if target.Location != "https://example.com" {
+		t.Errorf("expected https://example.com, got %s", target.Location)
+	}
+	if target.Status != http.StatusMovedPermanently {
+		t.Errorf("expected status 301, got %d", target.Status)
 	}
 }
 
@@ -168,7 +591,7 @@ func TestURLService_Resolve_NotFound(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	_, err := svc.Resolve("nonexistent")
+	_, err := svc.Resolve(context.Background(), "nonexistent", domain.Visit{})
 	if !errors.Is(err, repository.ErrNotFound) {
 		t.Errorf("expected ErrNotFound, got %v", err)
 	}
@@ -178,7 +601,7 @@ func TestURLService_Resolve_Empty(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	_, err := svc.Resolve("")
+	_, err := svc.Resolve(context.Background(), "", domain.Visit{})
 	if !errors.Is(err, repository.ErrNotFound) {
 		t.Errorf("expected ErrNotFound for empty code, got %v", err)
 	}
@@ -188,12 +611,12 @@ func TestURLService_Stats(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	resp, err := svc.Shorten("https://example.com")
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("shorten: %v", err)
 	}
 
-	stats, err := svc.Stats(resp.Code)
+	stats, err := svc.Stats(context.Background(), adminKey, resp.Code)
 	if err != nil {
 		t.Fatalf("stats: %v", err)
 	}
@@ -213,7 +636,7 @@ func TestURLService_Stats_NotFound(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	_, err := svc.Stats("nonexistent")
+	_, err := svc.Stats(context.Background(), adminKey, "nonexistent")
 	if !errors.Is(err, repository.ErrNotFound) {
 		t.Errorf("expected ErrNotFound, got %v", err)
 	}
@@ -223,10 +646,10 @@ func TestURLService_GlobalStats(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080")
 
-	_, _ = svc.Shorten("https://example1.com")
-	_, _ = svc.Shorten("https://example2.com")
+	_, _ = svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example1.com"})
+	_, _ = svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example2.com"})
 
-	stats, err := svc.GlobalStats()
+	stats, err := svc.GlobalStats(context.Background(), nil, domain.StatsRequest{})
 	if err != nil {
 		t.Fatalf("global stats: %v", err)
 	}
@@ -234,13 +657,100 @@ func TestURLService_GlobalStats(t *testing.T) {
 	if stats.TotalURLs != 2 {
 		t.Errorf("expected 2 total URLs, got %d", stats.TotalURLs)
 	}
+	if stats.TZ != "UTC" || stats.WindowDays != DefaultStatsDays {
+		t.Errorf("expected %d days in UTC, got %d in %s", DefaultStatsDays, stats.WindowDays, stats.TZ)
+	}
+	if repo.statsQuery != (domain.StatsQuery{}) || stats.TopLinks != nil {
+		t.Errorf("expected no leaderboards without a key, got %+v", repo.statsQuery)
+	}
+}
+
+func TestURLService_GlobalStatsTimeZone(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	// 23:30 UTC on the 15th is already the 16th in Tokyo.
+	now := time.Date(2026, 10, 15, 23, 30, 0, 0, time.UTC)
+	svc.now = func() time.Time { return now }
+
+	var codes []string
+	for _, at := range []time.Time{
+		now.Add(-time.Hour),      // 07:30 on the 16th in Tokyo
+		now.Add(-10 * time.Hour), // 22:30 on the 15th in Tokyo
+		now.Add(-49 * time.Hour), // 07:30 on the 14th in Tokyo
+	} {
+		url, _ := repo.Create(context.Background(), "https://example.com/"+at.Format("20060102150405"), domain.LinkOptions{OwnerID: aliceKey.ID})
+		url.CreatedAt = at
+		codes = append(codes, url.Code)
+	}
+	other, _ := repo.Create(context.Background(), "https://example.com/bob", domain.LinkOptions{OwnerID: bobKey.ID})
+	other.CreatedAt = now
+
+	for _, c := range []struct {
+		code string
+		at   time.Time
+	}{
+		{codes[1], now.Add(-time.Hour)},
+		{codes[1], now.Add(-10 * time.Hour)},
+		{codes[0], now.Add(-time.Hour)},
+		{other.Code, now.Add(-time.Hour)},
+	} {
+		_ = repo.RecordClick(context.Background(), c.code, domain.Click{ClickedAt: c.at})
+	}
+
+	stats, err := svc.GlobalStats(context.Background(), aliceKey, domain.StatsRequest{Days: 3, Limit: 1, TZ: "Asia/Tokyo"})
+	if err != nil {
+		t.Fatalf("global stats: %v", err)
+	}
+
+	q := repo.statsQuery
+	if q.OwnerID != aliceKey.ID || q.Limit != MaxStatsLimit {
+		t.Errorf("expected alice's full leaderboards, got owner %d limit %d", q.OwnerID, q.Limit)
+	}
+	if want := time.Date(2026, 10, 13, 15, 0, 0, 0, time.UTC); !q.From.Equal(want) {
+		t.Errorf("expected window to start at %s, got %s", want, q.From.UTC())
+	}
+	if len(stats.TopLinks) != 1 || stats.TopLinks[0].Code != codes[1] {
+		t.Errorf("expected only %s in the top links, got %+v", codes[1], stats.TopLinks)
+	}
+
+	if stats.TotalURLs != 3 || stats.URLsToday != 1 {
+		t.Errorf("expected 3 URLs, 1 today, got %d, %d today", stats.TotalURLs, stats.URLsToday)
+	}
+	if stats.ClicksToday != 2 {
+		t.Errorf("expected 2 clicks today, got %d", stats.ClicksToday)
+	}
+	want := []domain.DailyCount{{Day: "2026-10-14", Count: 1}, {Day: "2026-10-15", Count: 1}, {Day: "2026-10-16", Count: 1}}
+	if len(stats.CreatedPerDay) != len(want) {
+		t.Fatalf("expected %d days, got %+v", len(want), stats.CreatedPerDay)
+	}
+	for i, d := range want {
+		if stats.CreatedPerDay[i] != d {
+			t.Errorf("day %d: expected %+v, got %+v", i, d, stats.CreatedPerDay[i])
+		}
+	}
+}
+
+func TestURLService_GlobalStatsInvalid(t *testing.T) {
+	svc := NewURLService(newMockRepo(), "http://localhost:8080")
+
+	for _, req := range []domain.StatsRequest{
+		{Days: -1},
+		{Days: MaxStatsDays + 1},
+		{Limit: MaxStatsLimit + 1},
+		{TZ: "Mars/Olympus_Mons"},
+	} {
+		if _, err := svc.GlobalStats(context.Background(), adminKey, req); !errors.Is(err, ErrInvalidStats) {
+			t.Errorf("%+v: expected ErrInvalidStats, got %v", req, err)
+		}
+	}
 }
 
 func TestURLService_BaseURLTrailingSlash(t *testing.T) {
 	repo := newMockRepo()
 	svc := NewURLService(repo, "http://localhost:8080/")
 
-	resp, err := svc.Shorten("https://example.com")
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
 	if err != nil {
 		t.Fatalf("shorten: %v", err)
 	}
@@ -267,10 +777,1130 @@ func TestURLService_ValidURLs(t *testing.T) {
 
 	for _, u := range validURLs {
 		t.Run(u, func(t *testing.T) {
-			_, err := svc.Shorten(u)
+			_, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: u})
 			if err != nil {
 				t.Errorf("expected valid URL %s to succeed, got error: %v", u, err)
 			}
 		})
 	}
 }
+
+func TestURLService_Shorten_Alias(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com", Alias: "q3-launch"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if resp.Code != "q3-launch" {
+		t.Errorf("expected code q3-launch, got %s", resp.Code)
+	}
+	if resp.ShortURL != "http://localhost:8080/q3-launch" {
+		t.Errorf("expected short URL http://localhost:8080/q3-launch, got %s", resp.ShortURL)
+	}
+
+	target, err := svc.Resolve(context.Background(), "q3-launch", domain.Visit{})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if target.Location != "https://example.com" {
+		t.Errorf("expected https://example.com, got %s", target.Location)
+	}
+}
+
+func TestURLService_Shorten_AliasTaken(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	if _, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com", Alias: "promo"}); err != nil {
+		t.Fatalf("first shorten: %v", err)
+	}
+
+	_, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://other.com", Alias: "promo"})
+	if !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("expected ErrAliasTaken, got %v", err)
+	}
+}
+
+func TestURLService_Shorten_InvalidAlias(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	tests := []struct {
+		name    string
+		alias   string
+		wantErr error
+	}{
+		{"too short", "ab", ErrInvalidAlias},
+		{"too long", strings.Repeat("a", MaxAliasLength+1), ErrInvalidAlias},
+		{"slash", "a/b/c", ErrInvalidAlias},
+		{"dot", "file.txt", ErrInvalidAlias},
+		{"unicode", "café", ErrInvalidAlias},
+		{"reserved", "api", ErrReservedAlias},
+		{"reserved mixed case", "Admin", ErrReservedAlias},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com", Alias: tt.alias})
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+// lookupRepo reports every code looked up.
+type lookupRepo struct {
+	*mockRepo
+	lookups []string
+}
+
+func (r *lookupRepo) GetByCode(ctx context.Context, code string) (*domain.URL, error) {
+	r.lookups = append(r.lookups, code)
+	return r.mockRepo.GetByCode(ctx, code)
+}
+
+func TestURLService_Codec(t *testing.T) {
+	codec := encoding.Crockford.WithCheckChar()
+	repo := &lookupRepo{mockRepo: newMockRepo()}
+	svc := NewURLService(repo, "http://localhost:8080", WithCodec(codec))
+	ctx := context.Background()
+
+	code, err := codec.AppendCheckChar("7K3M")
+	if err != nil {
+		t.Fatalf("append check char: %v", err)
+	}
+	if _, err := repo.CreateWithCode(ctx, code, "https://example.com", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := svc.Resolve(ctx, strings.ToLower(code), domain.Visit{}); err != nil {
+		t.Errorf("expected the code to resolve in lower case: %v", err)
+	}
+
+	repo.lookups = nil
+	typo := code[:1] + "X" + code[2:]
+	if _, err := svc.Resolve(ctx, typo, domain.Visit{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for typo %q, got %v", typo, err)
+	}
+	if len(repo.lookups) != 0 {
+		t.Errorf("expected a mistyped code to be rejected without a lookup, got %v", repo.lookups)
+	}
+
+	if _, err := svc.Shorten(ctx, domain.CreateRequest{URL: "https://example.com/b", Alias: strings.ToLower(code)}); !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("expected an alias spelling a generated code to be taken, got %v", err)
+	}
+	if _, err := svc.Shorten(ctx, domain.CreateRequest{URL: "https://example.com/b", Alias: "7K3MX"}); !errors.Is(err, ErrInvalidAlias) {
+		t.Errorf("expected an alias with a wrong check character to be rejected, got %v", err)
+	}
+	alias, err := codec.AppendCheckChar("9QZ")
+	if err != nil {
+		t.Fatalf("append check char: %v", err)
+	}
+	resp, err := svc.Shorten(ctx, domain.CreateRequest{URL: "https://example.com/b", Alias: strings.ToLower(alias)})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if resp.Code != alias {
+		t.Errorf("expected the alias stored as %q, got %q", alias, resp.Code)
+	}
+
+	resp, err = svc.Shorten(ctx, domain.CreateRequest{URL: "https://example.com/c", Alias: "spring-sale"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if resp.Code != "spring-sale" {
+		t.Errorf("expected an alias outside the alphabet to be kept as is, got %q", resp.Code)
+	}
+	if _, err := svc.Resolve(ctx, "spring-sale", domain.Visit{}); err != nil {
+		t.Errorf("expected the alias to resolve: %v", err)
+	}
+}
+
+func TestURLService_CodecLegacyCodes(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080", WithCodec(encoding.Crockford))
+	ctx := context.Background()
+
+	// Stored by the base62 codec before the alphabet was changed.
+	if _, err := repo.CreateWithCode(ctx, "b7x", "https://example.com/old", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if _, err := svc.Resolve(ctx, "b7x", domain.Visit{}); err != nil {
+		t.Errorf("expected a code stored before the alphabet changed to resolve: %v", err)
+	}
+}
+
+func TestURLService_CodecManagement(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080", WithCodec(encoding.Crockford))
+	ctx := context.Background()
+
+	const code, typed = "7K3MA", "7k3ma"
+	if _, err := repo.CreateWithCode(ctx, code, "https://example.com/v1", domain.LinkOptions{}); err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	if _, err := svc.UpdateDestination(ctx, adminKey, typed, "https://example.com/v2"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	history, err := svc.Revisions(ctx, adminKey, typed)
+	if err != nil {
+		t.Fatalf("revisions: %v", err)
+	}
+	if history.Code != code || len(history.Revisions) != 1 {
+		t.Fatalf("expected one revision of %s, got %+v", code, history)
+	}
+	stats, err := svc.Rollback(ctx, adminKey, typed, history.Revisions[0].ID)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if stats.Original != "https://example.com/v1" {
+		t.Errorf("expected original https://example.com/v1, got %s", stats.Original)
+	}
+
+	sub, err := svc.SubscribeClicks(ctx, adminKey, typed, false)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Close()
+	if _, err := svc.Resolve(ctx, typed, domain.Visit{}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if n := len(sub.Clicks()); n != 1 {
+		t.Errorf("expected the live click, got %d", n)
+	}
+
+	series, err := svc.TimeSeries(ctx, adminKey, typed, domain.TimeSeriesQuery{})
+	if err != nil {
+		t.Fatalf("time series: %v", err)
+	}
+	if series.Code != code {
+		t.Errorf("expected the time series of %s, got %s", code, series.Code)
+	}
+	visitors, err := svc.Visitors(ctx, adminKey, typed, domain.VisitorsQuery{})
+	if err != nil {
+		t.Fatalf("visitors: %v", err)
+	}
+	if visitors.Code != code {
+		t.Errorf("expected the visitors of %s, got %s", code, visitors.Code)
+	}
+	if _, err := svc.Breakdown(ctx, adminKey, typed, domain.BreakdownQuery{}); err != nil {
+		t.Fatalf("breakdown: %v", err)
+	}
+
+	stats, err = svc.SetDisabled(ctx, adminKey, typed, true)
+	if err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if !stats.Disabled {
+		t.Error("expected the link to be disabled")
+	}
+	if err := svc.Delete(ctx, adminKey, typed); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+	if !repo.deleted[code] {
+		t.Errorf("expected %s to be deleted", code)
+	}
+}
+
+func TestURLService_Resolve_ExpiredByDate(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	expiresAt := time.Now().Add(time.Hour)
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com",
+		LinkOptions: domain.LinkOptions{ExpiresAt: &expiresAt},
+	})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+		t.Fatalf("resolve before expiry: %v", err)
+	}
+
+	svc.now = func() time.Time { return expiresAt.Add(time.Second) }
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired, got %v", err)
+	}
+}
+
+func TestURLService_Resolve_ClickBudgetFallback(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	maxClicks := int64(2)
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL: "https://example.com",
+		LinkOptions: domain.LinkOptions{
+			MaxClicks:   &maxClicks,
+			FallbackURL: "https://example.com/ended",
+		},
+	})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	repo.byCode[resp.Code].Clicks = 2
+
+	target, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{})
+	if err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if target.Location != "https://example.com/ended" {
+		t.Errorf("expected fallback https://example.com/ended, got %s", target.Location)
+	}
+	if target.Status != http.StatusFound {
+		t.Errorf("expected status 302 for fallback, got %d", target.Status)
+	}
+}
+
+func TestURLService_Shorten_InvalidOptions(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	past := time.Now().Add(-time.Hour)
+	zero := int64(0)
+
+	tests := []struct {
+		name string
+		opts domain.LinkOptions
+	}{
+		{"expiry in past", domain.LinkOptions{ExpiresAt: &past}},
+		{"zero max clicks", domain.LinkOptions{MaxClicks: &zero}},
+		{"invalid fallback", domain.LinkOptions{FallbackURL: "ftp://example.com"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com", LinkOptions: tt.opts})
+			if !errors.Is(err, ErrInvalidOption) {
+				t.Errorf("expected ErrInvalidOption, got %v", err)
+			}
+		})
+	}
+}
+
+func TestURLService_Shorten_OptionsSkipDedup(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	plain, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten plain: %v", err)
+	}
+
+	maxClicks := int64(10)
+	limited, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com",
+		LinkOptions: domain.LinkOptions{MaxClicks: &maxClicks},
+	})
+	if err != nil {
+		t.Fatalf("shorten limited: %v", err)
+	}
+
+	if plain.Code == limited.Code {
+		t.Error("link with options should not reuse an existing code")
+	}
+}
+
+func TestURLService_Delete(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com", Alias: "gone"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if err := svc.Delete(context.Background(), adminKey, resp.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound after delete, got %v", err)
+	}
+
+	_, err = svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://other.com", Alias: "gone"})
+	if !errors.Is(err, ErrAliasTaken) {
+		t.Errorf("deleted alias must not be reissued, got %v", err)
+	}
+
+	if err := svc.Delete(context.Background(), adminKey, resp.Code); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound on second delete, got %v", err)
+	}
+}
+
+func TestURLService_SetDisabled(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	stats, err := svc.SetDisabled(context.Background(), adminKey, resp.Code, true)
+	if err != nil {
+		t.Fatalf("disable: %v", err)
+	}
+	if !stats.Disabled {
+		t.Error("expected stats to report disabled")
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); !errors.Is(err, ErrDisabled) {
+		t.Errorf("expected ErrDisabled, got %v", err)
+	}
+
+	if _, err := svc.SetDisabled(context.Background(), adminKey, resp.Code, false); err != nil {
+		t.Fatalf("enable: %v", err)
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+		t.Errorf("expected enabled link to resolve, got %v", err)
+	}
+}
+
+func TestURLService_UpdateDestination(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	req := domain.CreateRequest{URL: "https://exmaple.com"}
+	req.OwnerID = aliceKey.ID
+	resp, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	stats, err := svc.UpdateDestination(context.Background(), aliceKey, resp.Code, "https://example.com")
+	if err != nil {
+		t.Fatalf("update: %v", err)
+	}
+	if stats.Original != "https://example.com" {
+		t.Errorf("expected original https://example.com, got %s", stats.Original)
+	}
+
+	history, err := svc.Revisions(context.Background(), aliceKey, resp.Code)
+	if err != nil {
+		t.Fatalf("revisions: %v", err)
+	}
+	if len(history.Revisions) != 1 {
+		t.Fatalf("expected 1 revision, got %d", len(history.Revisions))
+	}
+	if history.Revisions[0].Original != "https://exmaple.com" || history.Revisions[0].ChangedBy != "alice" {
+		t.Errorf("unexpected revision: %+v", history.Revisions[0])
+	}
+
+	if _, err := svc.UpdateDestination(context.Background(), aliceKey, resp.Code, "ftp://example.com"); !errors.Is(err, ErrMissingScheme) {
+		t.Errorf("expected ErrMissingScheme, got %v", err)
+	}
+	if _, err := svc.UpdateDestination(context.Background(), aliceKey, "nonexistent", "https://example.com"); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound, got %v", err)
+	}
+}
+
+func TestURLService_Rollback(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com/v1"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := svc.UpdateDestination(context.Background(), adminKey, resp.Code, "https://example.com/v2"); err != nil {
+		t.Fatalf("update: %v", err)
+	}
+
+	history, err := svc.Revisions(context.Background(), adminKey, resp.Code)
+	if err != nil {
+		t.Fatalf("revisions: %v", err)
+	}
+
+	stats, err := svc.Rollback(context.Background(), adminKey, resp.Code, history.Revisions[0].ID)
+	if err != nil {
+		t.Fatalf("rollback: %v", err)
+	}
+	if stats.Original != "https://example.com/v1" {
+		t.Errorf("expected original https://example.com/v1, got %s", stats.Original)
+	}
+
+	if _, err := svc.Rollback(context.Background(), adminKey, resp.Code, 99); !errors.Is(err, ErrRevisionNotFound) {
+		t.Errorf("expected ErrRevisionNotFound, got %v", err)
+	}
+}
+
+func TestURLService_List_Pagination(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	for i := 0; i < 5; i++ {
+		if _, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com/" + string(rune('a'+i))}); err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+	}
+
+	var seen []int64
+	cursor := ""
+	for pages := 0; ; pages++ {
+		if pages > 5 {
+			t.Fatal("pagination did not terminate")
+		}
+
+		page, err := svc.List(context.Background(), adminKey, domain.ListFilter{Limit: 2}, cursor)
+		if err != nil {
+			t.Fatalf("list: %v", err)
+		}
+		for _, u := range page.URLs {
+			seen = append(seen, u.ID)
+		}
+		if page.NextCursor == "" {
+			break
+		}
+		cursor = page.NextCursor
+	}
+
+	want := []int64{5, 4, 3, 2, 1}
+	if len(seen) != len(want) {
+		t.Fatalf("expected %d urls, got %v", len(want), seen)
+	}
+	for i := range want {
+		if seen[i] != want[i] {
+			t.Errorf("position %d: expected id %d, got %d", i, want[i], seen[i])
+		}
+	}
+}
+
+func TestURLService_List_Invalid(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	tests := []struct {
+		name    string
+		filter  domain.ListFilter
+		cursor  string
+		wantErr error
+	}{
+		{"bad sort", domain.ListFilter{SortBy: "original"}, "", ErrInvalidFilter},
+		{"limit too large", domain.ListFilter{Limit: MaxListLimit + 1}, "", ErrInvalidFilter},
+		{"negative limit", domain.ListFilter{Limit: -1}, "", ErrInvalidFilter},
+		{"garbage cursor", domain.ListFilter{}, "!!!", ErrInvalidCursor},
+		{
+			"cursor from other sort",
+			domain.ListFilter{SortBy: domain.SortCreatedAt},
+			encodeCursor(domain.URL{ID: 1, Clicks: 3}, domain.SortClicks),
+			ErrInvalidCursor,
+		},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := svc.List(context.Background(), adminKey, tt.filter, tt.cursor)
+			if !errors.Is(err, tt.wantErr) {
+				t.Errorf("expected error %v, got %v", tt.wantErr, err)
+			}
+		})
+	}
+}
+
+func TestURLService_ShortenBatch(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.ShortenBatch(context.Background(), []domain.CreateRequest{
+		{URL: "https://example.com/a"},
+		{URL: "ftp://example.com"},
+		{URL: "https://example.com/b", Alias: "bee"},
+		{URL: "https://example.com/c", Alias: "bee"},
+		{URL: "https://example.com/a"},
+	})
+	if err != nil {
+		t.Fatalf("shorten batch: %v", err)
+	}
+
+	if resp.Succeeded != 3 || resp.Failed != 2 {
+		t.Errorf("expected 3 succeeded and 2 failed, got %d and %d", resp.Succeeded, resp.Failed)
+	}
+	if len(resp.Results) != 5 {
+		t.Fatalf("expected 5 results, got %d", len(resp.Results))
+	}
+
+	for i, r := range resp.Results {
+		if r.Index != i {
+			t.Errorf("result %d: expected index %d, got %d", i, i, r.Index)
+		}
+	}
+	if resp.Results[1].Error == "" || resp.Results[1].Code != "" {
+		t.Errorf("expected validation error for item 1, got %+v", resp.Results[1])
+	}
+	if resp.Results[2].Code != "bee" {
+		t.Errorf("expected alias bee for item 2, got %+v", resp.Results[2])
+	}
+	if resp.Results[3].Error == "" {
+		t.Errorf("expected alias conflict for item 3, got %+v", resp.Results[3])
+	}
+	if resp.Results[4].Code != resp.Results[0].Code {
+		t.Errorf("duplicate URL in batch should reuse code %s, got %s", resp.Results[0].Code, resp.Results[4].Code)
+	}
+}
+
+func TestURLService_ShortenBatch_Limits(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080", WithMaxBatchSize(2))
+
+	if _, err := svc.ShortenBatch(context.Background(), nil); !errors.Is(err, ErrEmptyBatch) {
+		t.Errorf("expected ErrEmptyBatch, got %v", err)
+	}
+
+	items := []domain.CreateRequest{
+		{URL: "https://example.com/a"},
+		{URL: "https://example.com/b"},
+		{URL: "https://example.com/c"},
+	}
+	if _, err := svc.ShortenBatch(context.Background(), items); !errors.Is(err, ErrBatchTooLarge) {
+		t.Errorf("expected ErrBatchTooLarge, got %v", err)
+	}
+}
+
+func TestURLService_ShortenBatch_StorageError(t *testing.T) {
+	repo := newMockRepo()
+	repo.createErr = errors.New("disk full")
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	_, err := svc.ShortenBatch(context.Background(), []domain.CreateRequest{{URL: "https://example.com"}})
+	if err == nil || isRequestError(err) {
+		t.Errorf("expected storage error to abort the batch, got %v", err)
+	}
+}
+
+func TestURLService_Resolve_RedirectType(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080", WithDefaultRedirect(http.StatusFound))
+
+	plain, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com/plain"})
+	if err != nil {
+		t.Fatalf("shorten plain: %v", err)
+	}
+	permanent, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com/permanent",
+		LinkOptions: domain.LinkOptions{RedirectType: http.StatusPermanentRedirect},
+	})
+	if err != nil {
+		t.Fatalf("shorten permanent: %v", err)
+	}
+
+	tests := []struct {
+		code string
+		want int
+	}{
+		{plain.Code, http.StatusFound},
+		{permanent.Code, http.StatusPermanentRedirect},
+	}
+
+	for _, tt := range tests {
+		target, err := svc.Resolve(context.Background(), tt.code, domain.Visit{})
+		if err != nil {
+			t.Fatalf("resolve %s: %v", tt.code, err)
+		}
+		if target.Status != tt.want {
+			t.Errorf("resolve %s: expected status %d, got %d", tt.code, tt.want, target.Status)
+		}
+	}
+
+	_, err = svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com/bad",
+		LinkOptions: domain.LinkOptions{RedirectType: http.StatusOK},
+	})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption for redirect_type 200, got %v", err)
+	}
+}
+
+func TestURLService_Resolve_ExpiringRedirect(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	maxClicks := int64(10)
+	expiresAt := time.Now().Add(time.Hour)
+	budgeted, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com/budgeted",
+		LinkOptions: domain.LinkOptions{MaxClicks: &maxClicks},
+	})
+	if err != nil {
+		t.Fatalf("shorten budgeted: %v", err)
+	}
+	expiring, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com/expiring",
+		LinkOptions: domain.LinkOptions{ExpiresAt: &expiresAt, RedirectType: http.StatusTemporaryRedirect},
+	})
+	if err != nil {
+		t.Fatalf("shorten expiring: %v", err)
+	}
+
+	tests := []struct {
+		code string
+		want int
+	}{
+		{budgeted.Code, http.StatusFound},
+		{expiring.Code, http.StatusTemporaryRedirect},
+	}
+
+	for _, tt := range tests {
+		target, err := svc.Resolve(context.Background(), tt.code, domain.Visit{})
+		if err != nil {
+			t.Fatalf("resolve %s: %v", tt.code, err)
+		}
+		if target.Status != tt.want {
+			t.Errorf("resolve %s: expected status %d, got %d", tt.code, tt.want, target.Status)
+		}
+	}
+
+	_, err = svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com/permanent",
+		LinkOptions: domain.LinkOptions{ExpiresAt: &expiresAt, RedirectType: http.StatusMovedPermanently},
+	})
+	if !errors.Is(err, ErrInvalidOption) {
+		t.Errorf("expected ErrInvalidOption for a permanent redirect that expires, got %v", err)
+	}
+}
+
+func TestURLService_Ownership(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	req := domain.CreateRequest{URL: "https://example.com"}
+	req.OwnerID = aliceKey.ID
+	alice, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	req.OwnerID = bobKey.ID
+	bob, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if bob.Code == alice.Code {
+		t.Error("expected deduplication to be scoped to the owner")
+	}
+
+	if _, err := svc.Stats(context.Background(), aliceKey, alice.Code); err != nil {
+		t.Errorf("owner stats: %v", err)
+	}
+	if _, err := svc.Stats(context.Background(), adminKey, alice.Code); err != nil {
+		t.Errorf("admin stats: %v", err)
+	}
+	if _, err := svc.Stats(context.Background(), bobKey, alice.Code); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another owner, got %v", err)
+	}
+	if _, err := svc.Stats(context.Background(), nil, alice.Code); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized without a key, got %v", err)
+	}
+	if err := svc.Delete(context.Background(), bobKey, alice.Code); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound deleting another owner's link, got %v", err)
+	}
+
+	anon, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com/anon"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if _, err := svc.SetDisabled(context.Background(), aliceKey, anon.Code, true); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected anonymous links to be admin-only, got %v", err)
+	}
+
+	page, err := svc.List(context.Background(), aliceKey, domain.ListFilter{}, "")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.URLs) != 1 || page.URLs[0].Code != alice.Code {
+		t.Errorf("expected only alice's link, got %+v", page.URLs)
+	}
+
+	page, err = svc.List(context.Background(), adminKey, domain.ListFilter{}, "")
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(page.URLs) != 3 {
+		t.Errorf("expected admin to list 3 links, got %d", len(page.URLs))
+	}
+}
+
+func TestURLService_NewClick(t *testing.T) {
+	now := time.Date(2026, 3, 1, 9, 30, 0, 0, time.FixedZone("CET", 3600))
+	svc := NewURLService(newMockRepo(), "http://localhost:8080", WithIPSalt("pepper"))
+	svc.now = func() time.Time { return now }
+
+	click := svc.newClick(domain.Visit{
+		Referrer:  "https://News.Example.org:8443/item?id=1",
+		UserAgent: "Mozilla/5.0 (iPhone; CPU iPhone OS 17_5 like Mac OS X) Mobile/15E148",
+		IP:        "203.0.113.7",
+		RequestID: "req-1",
+	})
+
+	if !click.ClickedAt.Equal(now) || click.ClickedAt.Location() != time.UTC {
+		t.Errorf("expected clicked_at %v in UTC, got %v", now, click.ClickedAt)
+	}
+	if click.ReferrerHost != "news.example.org" {
+		t.Errorf("expected referrer host news.example.org, got %q", click.ReferrerHost)
+	}
+	if click.AgentClass != "mobile" || click.OS != "iOS" {
+		t.Errorf("expected a mobile iOS agent, got %q on %q", click.AgentClass, click.OS)
+	}
+	if click.RequestID != "req-1" {
+		t.Errorf("expected request id req-1, got %q", click.RequestID)
+	}
+	if click.IPHash == "" || strings.Contains(click.IPHash, "203.0.113.7") {
+		t.Errorf("expected an opaque ip hash, got %q", click.IPHash)
+	}
+
+	other := NewURLService(newMockRepo(), "http://localhost:8080", WithIPSalt("pepper"))
+	if other.hashIP("203.0.113.7") != click.IPHash {
+		t.Error("expected the same salt to give the same ip hash")
+	}
+	salted := NewURLService(newMockRepo(), "http://localhost:8080", WithIPSalt("salt"))
+	if salted.hashIP("203.0.113.7") == click.IPHash {
+		t.Error("expected a different salt to give a different ip hash")
+	}
+	if svc.hashIP("") != "" {
+		t.Error("expected no hash for an empty ip")
+	}
+}
+
+func TestURLService_Breakdown(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	for _, c := range []domain.Click{
+		{ReferrerHost: "t.co", AgentClass: "mobile", OS: "iOS", Browser: "Safari"},
+		{ReferrerHost: "t.co", AgentClass: "mobile", OS: "Android", Browser: "Chrome"},
+		{ReferrerHost: "", AgentClass: "desktop", OS: "Windows", Browser: "Chrome"},
+		{ReferrerHost: "news.ycombinator.com"},
+	} {
+		if err := repo.RecordClick(context.Background(), resp.Code, c); err != nil {
+			t.Fatalf("record click: %v", err)
+		}
+	}
+
+	breakdown, err := svc.Breakdown(context.Background(), adminKey, resp.Code, domain.BreakdownQuery{Limit: 2})
+	if err != nil {
+		t.Fatalf("breakdown: %v", err)
+	}
+
+	if breakdown.Total != 4 {
+		t.Errorf("expected 4 clicks, got %d", breakdown.Total)
+	}
+	wantReferrers := []domain.BreakdownEntry{{Value: "t.co", Clicks: 2}, {Value: DirectReferrer, Clicks: 1}}
+	if len(breakdown.Referrers) != 2 || breakdown.Referrers[0] != wantReferrers[0] || breakdown.Referrers[1] != wantReferrers[1] {
+		t.Errorf("expected referrers %+v, got %+v", wantReferrers, breakdown.Referrers)
+	}
+	if breakdown.Browsers[0] != (domain.BreakdownEntry{Value: "Chrome", Clicks: 2}) {
+		t.Errorf("expected Chrome to lead browsers, got %+v", breakdown.Browsers)
+	}
+	if breakdown.OS[0] != (domain.BreakdownEntry{Value: UnknownValue, Clicks: 1}) {
+		t.Errorf("expected clicks without an OS to be labeled, got %+v", breakdown.OS)
+	}
+
+	if _, err := svc.Breakdown(context.Background(), adminKey, resp.Code, domain.BreakdownQuery{Limit: MaxBreakdownLimit + 1}); !errors.Is(err, ErrInvalidBreakdown) {
+		t.Errorf("expected ErrInvalidBreakdown, got %v", err)
+	}
+	if _, err := svc.Breakdown(context.Background(), bobKey, resp.Code, domain.BreakdownQuery{}); !errors.Is(err, ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another key, got %v", err)
+	}
+}
+
+func TestURLService_NewClick_Bots(t *testing.T) {
+	svc := NewURLService(newMockRepo(), "http://localhost:8080")
+	browser := "Mozilla/5.0 (Macintosh; Intel Mac OS X 14_5) AppleWebKit/605.1.15 (KHTML, like Gecko) Version/17.5 Safari/605.1.15"
+
+	tests := []struct {
+		name  string
+		visit domain.Visit
+		want  bool
+	}{
+		{"browser", domain.Visit{Method: http.MethodGet, UserAgent: browser}, false},
+		{"unfurler", domain.Visit{Method: http.MethodGet, UserAgent: "Twitterbot/1.0"}, true},
+		{"head request", domain.Visit{Method: http.MethodHead, UserAgent: browser}, true},
+		{"prefetch", domain.Visit{Method: http.MethodGet, UserAgent: browser, Purpose: "prefetch;prerender"}, true},
+		{"preview", domain.Visit{Method: http.MethodGet, UserAgent: browser, Purpose: "preview"}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := svc.newClick(tt.visit).Bot; got != tt.want {
+				t.Errorf("expected bot=%v, got %v", tt.want, got)
+			}
+		})
+	}
+}
+
+func TestURLService_Resolve_BotsKeepClickBudget(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	maxClicks := int64(1)
+	req := domain.CreateRequest{URL: "https://example.com"}
+	req.MaxClicks = &maxClicks
+	resp, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	bot := domain.Visit{Method: http.MethodGet, UserAgent: "Slackbot-LinkExpanding 1.0"}
+	for i := 0; i < 3; i++ {
+		if _, err := svc.Resolve(context.Background(), resp.Code, bot); err != nil {
+			t.Fatalf("resolve as bot: %v", err)
+		}
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+		t.Errorf("expected bot clicks not to use up the budget, got %v", err)
+	}
+
+	stats, err := svc.Stats(context.Background(), adminKey, resp.Code)
+	if err != nil {
+		t.Fatalf("stats: %v", err)
+	}
+	if stats.BotClicks != 3 {
+		t.Errorf("expected 3 bot clicks, got %d", stats.BotClicks)
+	}
+}
+
+type fakeRecorder struct {
+	codes []string
+}
+
+func (r *fakeRecorder) Record(code string, click domain.Click) bool {
+	r.codes = append(r.codes, code)
+	return true
+}
+
+func TestURLService_Resolve_UsesClickRecorder(t *testing.T) {
+	repo := newMockRepo()
+	rec := &fakeRecorder{}
+	svc := NewURLService(repo, "http://localhost:8080", WithClickRecorder(rec))
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	if len(rec.codes) != 1 || rec.codes[0] != resp.Code {
+		t.Errorf("expected one click queued for %s, got %v", resp.Code, rec.codes)
+	}
+	if repo.byCode[resp.Code].Clicks != 0 {
+		t.Error("expected the recorder, not the service, to write the click")
+	}
+}
+
+func TestURLService_Resolve_ClickBudgetWithQueuedClicks(t *testing.T) {
+	repo := newMockRepo()
+	rec := &fakeRecorder{}
+	svc := NewURLService(repo, "http://localhost:8080", WithClickRecorder(rec))
+
+	maxClicks := int64(2)
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{
+		URL:         "https://example.com",
+		LinkOptions: domain.LinkOptions{MaxClicks: &maxClicks},
+	})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	// The recorder never writes, as if every click were still queued.
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+			t.Fatalf("resolve %d: %v", i, err)
+		}
+	}
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired once the budget is spent, got %v", err)
+	}
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{UserAgent: "Googlebot/2.1"}); !errors.Is(err, ErrExpired) {
+		t.Errorf("expected ErrExpired for bots too, got %v", err)
+	}
+	if len(rec.codes) != 2 {
+		t.Errorf("expected 2 clicks queued, got %d", len(rec.codes))
+	}
+}
+
+func TestURLService_SubscribeClicks(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	req := domain.CreateRequest{URL: "https://example.com"}
+	req.OwnerID = aliceKey.ID
+	resp, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if _, err := svc.SubscribeClicks(context.Background(), nil, resp.Code, false); !errors.Is(err, ErrUnauthorized) {
+		t.Errorf("expected ErrUnauthorized without a key, got %v", err)
+	}
+	if _, err := svc.SubscribeClicks(context.Background(), bobKey, resp.Code, false); !errors.Is(err, repository.ErrNotFound) {
+		t.Errorf("expected ErrNotFound for another owner, got %v", err)
+	}
+
+	sub, err := svc.SubscribeClicks(context.Background(), aliceKey, resp.Code, false)
+	if err != nil {
+		t.Fatalf("subscribe: %v", err)
+	}
+	defer sub.Close()
+	all, err := svc.SubscribeAllClicks(bobKey, true)
+	if err != nil {
+		t.Fatalf("subscribe all: %v", err)
+	}
+	defer all.Close()
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{UserAgent: "Googlebot/2.1"}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{Referrer: "https://news.example.org/item"}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+
+	select {
+	case c := <-sub.Clicks():
+		if c.Bot || c.Code != resp.Code || c.ReferrerHost != "news.example.org" {
+			t.Errorf("unexpected live click: %+v", c)
+		}
+	default:
+		t.Fatal("expected a live click")
+	}
+	if n := len(sub.Clicks()); n != 0 {
+		t.Errorf("expected the bot click to be left out, got %d more", n)
+	}
+	if n := len(all.Clicks()); n != 0 {
+		t.Errorf("expected bob to see none of alice's clicks, got %d", n)
+	}
+}
+
+func TestURLService_Export(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	for _, owner := range []int64{aliceKey.ID, bobKey.ID} {
+		req := domain.CreateRequest{URL: "https://example.com"}
+		req.OwnerID = owner
+		resp, err := svc.Shorten(context.Background(), req)
+		if err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+		repo.clicks[resp.Code] = []domain.Click{{ID: owner}}
+	}
+
+	day := time.Date(2026, 3, 1, 15, 0, 0, 0, time.UTC)
+	var out strings.Builder
+	err := svc.ExportClicks(context.Background(), aliceKey, domain.ExportRequest{Format: domain.FormatNDJSON, From: &day, To: &day}, &out)
+	if err != nil {
+		t.Fatalf("export clicks: %v", err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 1 {
+		t.Errorf("expected only alice's click, got %d lines", n)
+	}
+	q := repo.exported
+	if q.OwnerID != aliceKey.ID {
+		t.Errorf("expected the export scoped to alice, got owner %d", q.OwnerID)
+	}
+	start := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	if !q.From.Equal(start) || !q.To.Equal(start.AddDate(0, 0, 1)) {
+		t.Errorf("expected the whole day of %s, got [%v, %v)", start.Format("2006-01-02"), q.From, q.To)
+	}
+
+	out.Reset()
+	if err := svc.ExportLinks(context.Background(), adminKey, domain.ExportRequest{Format: domain.FormatCSV}, &out); err != nil {
+		t.Fatalf("export links: %v", err)
+	}
+	if n := strings.Count(out.String(), "\n"); n != 3 {
+		t.Errorf("expected a header and every link for admin, got %d lines", n)
+	}
+
+	later := day.AddDate(0, 0, 1)
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		req  domain.ExportRequest
+		want error
+	}{
+		{"anonymous", nil, domain.ExportRequest{Format: domain.FormatCSV}, ErrUnauthorized},
+		{"unknown format", aliceKey, domain.ExportRequest{Format: "xml"}, ErrInvalidExport},
+		{"from after to", aliceKey, domain.ExportRequest{Format: domain.FormatCSV, From: &later, To: &day}, ErrInvalidExport},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var out strings.Builder
+			if err := svc.ExportLinks(context.Background(), tt.key, tt.req, &out); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+			if out.Len() != 0 {
+				t.Errorf("expected nothing written, got %q", out.String())
+			}
+		})
+	}
+}
+
+func TestURLService_GlobalStatsCached(t *testing.T) {
+	repo := newMockRepo()
+	cache := statscache.New(statscache.WithInterval(time.Hour))
+	defer func() { _ = cache.Close(context.Background()) }()
+	svc := NewURLService(repo, "http://localhost:8080", WithStatsCache(cache))
+
+	_, _ = svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example1.com"})
+	first, err := svc.GlobalStats(context.Background(), nil, domain.StatsRequest{})
+	if err != nil {
+		t.Fatalf("global stats: %v", err)
+	}
+	if first.GeneratedAt.IsZero() {
+		t.Error("expected GeneratedAt to be set")
+	}
+
+	_, _ = svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example2.com"})
+	stats, err := svc.GlobalStats(context.Background(), nil, domain.StatsRequest{})
+	if err != nil {
+		t.Fatalf("global stats: %v", err)
+	}
+	if stats.TotalURLs != 1 || !stats.GeneratedAt.Equal(first.GeneratedAt) {
+		t.Errorf("expected the cached snapshot, got %d URLs at %s", stats.TotalURLs, stats.GeneratedAt)
+	}
+
+	for _, req := range []domain.StatsRequest{{Days: 30}, {TZ: "Asia/Tokyo"}, {Days: 2, TZ: "America/New_York"}} {
+		stats, err = svc.GlobalStats(context.Background(), nil, req)
+		if err != nil {
+			t.Fatalf("global stats: %v", err)
+		}
+		if stats.TotalURLs != 1 {
+			t.Errorf("%+v: expected the cached snapshot, got %d URLs", req, stats.TotalURLs)
+		}
+	}
+	stats, err = svc.GlobalStats(context.Background(), adminKey, domain.StatsRequest{Limit: 3})
+	if err != nil {
+		t.Fatalf("global stats: %v", err)
+	}
+	if stats.TotalURLs != 1 {
+		t.Errorf("expected an admin key to share the snapshot of all URLs, got %d URLs", stats.TotalURLs)
+	}
+	if repo.totalsLoads != 1 {
+		t.Errorf("expected one snapshot of all URLs, loaded %d", repo.totalsLoads)
+	}
+
+	stats, err = svc.GlobalStats(context.Background(), aliceKey, domain.StatsRequest{})
+	if err != nil {
+		t.Fatalf("global stats: %v", err)
+	}
+	if stats.TotalURLs != 0 || repo.totalsLoads != 2 {
+		t.Errorf("expected a separate snapshot for an owner, got %d URLs after %d loads", stats.TotalURLs, repo.totalsLoads)
+	}
+}
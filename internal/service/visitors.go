@@ -0,0 +1,98 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/hll"
+)
+
+// DefaultVisitorDays is how many days a Visitors report covers by default.
+const DefaultVisitorDays = 30
+
+// MaxVisitorDays bounds how many days one Visitors report may span.
+const MaxVisitorDays = 366
+
+// Layouts of the UTC days and months in visitor reports.
+const (
+	dayFormat   = "2006-01-02"
+	monthFormat = "2006-01"
+)
+
+// ErrInvalidVisitors is returned for a malformed visitors query.
+var ErrInvalidVisitors = errors.New("invalid visitors query")
+
+// Visitors estimates the unique visitors of a short URL owned by key on each
+// UTC day from q.From through q.To, and across the whole range. Days whose
+// sketches were merged into months are reported per month.
+func (s *URLService) Visitors(ctx context.Context, key *domain.APIKey, code string, q domain.VisitorsQuery) (*domain.Visitors, error) {
+	urlRecord, err := s.ownedURL(ctx, key, code)
+	if err != nil {
+		return nil, err
+	}
+
+	to := s.now().UTC()
+	if q.To != nil {
+		to = q.To.UTC()
+	}
+	from := to.AddDate(0, 0, -(DefaultVisitorDays - 1))
+	if q.From != nil {
+		from = q.From.UTC()
+	}
+	from = startOfDay(from)
+	to = startOfDay(to)
+
+	if to.Before(from) {
+		return nil, fmt.Errorf("%w: from must not be after to", ErrInvalidVisitors)
+	}
+	if to.Sub(from) >= MaxVisitorDays*24*time.Hour {
+		return nil, fmt.Errorf("%w: range spans more than %d days", ErrInvalidVisitors, MaxVisitorDays)
+	}
+
+	sketches, err := s.repo.VisitorSketches(ctx, urlRecord.Code, from, to)
+	if err != nil {
+		return nil, err
+	}
+
+	report := &domain.Visitors{
+		Code: urlRecord.Code,
+		From: from.Format(dayFormat),
+		To:   to.Format(dayFormat),
+		Days: []domain.DailyVisitors{},
+	}
+	union := hll.New()
+	for _, sketch := range sketches {
+		union.Merge(sketch)
+	}
+	report.Visitors = union.Estimate()
+
+	for day := from; !day.After(to); day = day.AddDate(0, 0, 1) {
+		daily := domain.DailyVisitors{Day: day.Format(dayFormat)}
+		if sketch, ok := sketches[daily.Day]; ok {
+			daily.Visitors = sketch.Estimate()
+		}
+		report.Days = append(report.Days, daily)
+	}
+	for month := startOfMonth(from); !month.After(to); month = month.AddDate(0, 1, 0) {
+		if sketch, ok := sketches[month.Format(monthFormat)]; ok {
+			report.Months = append(report.Months, domain.MonthlyVisitors{
+				Month:    month.Format(monthFormat),
+				Visitors: sketch.Estimate(),
+			})
+		}
+	}
+	return report, nil
+}
+
+func startOfDay(t time.Time) time.Time {
+	y, m, d := t.Date()
+	return time.Date(y, m, d, 0, 0, 0, 0, time.UTC)
+}
+
+func startOfMonth(t time.Time) time.Time {
+	y, m, _ := t.Date()
+	return time.Date(y, m, 1, 0, 0, 0, 0, time.UTC)
+}
@@ -0,0 +1,125 @@
+package service
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/hll"
+)
+
+func TestURLService_Visitors(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080", WithIPSalt("pepper"))
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	// 50 visitors on the 1st, the same 50 plus 50 new ones on the 3rd, each
+	// clicking three times.
+	day1 := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	day3 := day1.AddDate(0, 0, 2)
+	for i := 0; i < 100; i++ {
+		visit := domain.Visit{IP: fmt.Sprintf("198.51.100.%d", i), UserAgent: "Mozilla/5.0"}
+		for j := 0; j < 3; j++ {
+			if i < 50 {
+				svc.now = func() time.Time { return day1 }
+				if err := repo.RecordClick(context.Background(), resp.Code, svc.newClick(visit)); err != nil {
+					t.Fatalf("record click: %v", err)
+				}
+			}
+			svc.now = func() time.Time { return day3 }
+			if err := repo.RecordClick(context.Background(), resp.Code, svc.newClick(visit)); err != nil {
+				t.Fatalf("record click: %v", err)
+			}
+		}
+	}
+
+	from := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	report, err := svc.Visitors(context.Background(), adminKey, resp.Code, domain.VisitorsQuery{From: &from})
+	if err != nil {
+		t.Fatalf("visitors: %v", err)
+	}
+
+	if report.From != "2026-03-01" || report.To != "2026-03-03" {
+		t.Errorf("expected 2026-03-01..2026-03-03, got %s..%s", report.From, report.To)
+	}
+	want := []uint64{50, 0, 100}
+	if len(report.Days) != len(want) {
+		t.Fatalf("expected %d days, got %+v", len(want), report.Days)
+	}
+	for i, w := range want {
+		if report.Days[i].Visitors != w {
+			t.Errorf("%s: expected %d visitors, got %d", report.Days[i].Day, w, report.Days[i].Visitors)
+		}
+	}
+	if report.Visitors != 100 {
+		t.Errorf("expected 100 visitors across the range, got %d", report.Visitors)
+	}
+}
+
+func TestURLService_Visitors_Months(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	// February was compacted into one sketch of 30 visitors; 10 visitors on
+	// 2026-03-01, half of them seen in February, are still kept daily.
+	february, march := hll.New(), hll.New()
+	for i := uint64(0); i < 30; i++ {
+		february.Add((i + 1) * 0x9E3779B97F4A7C15)
+	}
+	for i := uint64(25); i < 35; i++ {
+		march.Add((i + 1) * 0x9E3779B97F4A7C15)
+	}
+	repo.sketches[resp.Code] = map[string]*hll.Sketch{"2026-02": february, "2026-03-01": march}
+
+	from := time.Date(2026, 2, 20, 0, 0, 0, 0, time.UTC)
+	to := time.Date(2026, 3, 1, 0, 0, 0, 0, time.UTC)
+	report, err := svc.Visitors(context.Background(), adminKey, resp.Code, domain.VisitorsQuery{From: &from, To: &to})
+	if err != nil {
+		t.Fatalf("visitors: %v", err)
+	}
+
+	if len(report.Months) != 1 || report.Months[0].Month != "2026-02" || report.Months[0].Visitors != 30 {
+		t.Errorf("expected 30 visitors in 2026-02, got %+v", report.Months)
+	}
+	if last := report.Days[len(report.Days)-1]; last.Day != "2026-03-01" || last.Visitors != 10 {
+		t.Errorf("expected 10 visitors on 2026-03-01, got %+v", last)
+	}
+	if report.Visitors != 35 {
+		t.Errorf("expected 35 visitors across the range, got %d", report.Visitors)
+	}
+}
+
+func TestURLService_Visitors_Invalid(t *testing.T) {
+	repo := newMockRepo()
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	resp, err := svc.Shorten(context.Background(), domain.CreateRequest{URL: "https://example.com"})
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	now := time.Now()
+	yesterday := now.AddDate(0, 0, -1)
+	longAgo := now.AddDate(-2, 0, 0)
+
+	for name, q := range map[string]domain.VisitorsQuery{
+		"inverted range": {From: &now, To: &yesterday},
+		"too many days":  {From: &longAgo},
+	} {
+		if _, err := svc.Visitors(context.Background(), adminKey, resp.Code, q); !errors.Is(err, ErrInvalidVisitors) {
+			t.Errorf("%s: expected ErrInvalidVisitors, got %v", name, err)
+		}
+	}
+}
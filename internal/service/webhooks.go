@@ -0,0 +1,276 @@
+package service
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"log"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+	"github.com/devaloi/shrink/internal/webhook"
+)
+
+// WebhookSecretPrefix starts every webhook signing secret.
+const WebhookSecretPrefix = "whsec_"
+
+// Errors returned by the webhook service.
+var (
+	ErrInvalidWebhook  = errors.New("invalid webhook")
+	ErrWebhookNotFound = repository.ErrWebhookNotFound
+)
+
+// LinkNotifier is told about link lifecycle events.
+type LinkNotifier interface {
+	LinkCreated(link *domain.URL)
+	LinkExpired(link *domain.URL)
+	LinkDeleted(link *domain.URL)
+}
+
+// nopNotifier is the LinkNotifier used when none is configured.
+type nopNotifier struct{}
+
+func (nopNotifier) LinkCreated(*domain.URL) {}
+func (nopNotifier) LinkExpired(*domain.URL) {}
+func (nopNotifier) LinkDeleted(*domain.URL) {}
+
+// WebhookService registers webhooks and turns link events into deliveries
+// in the webhook outbox. Delivery itself is done by webhook.Worker.
+type WebhookService struct {
+	repo    repository.WebhookRepository
+	links   repository.Repository
+	baseURL string
+	now     func() time.Time
+}
+
+// NewWebhookService creates a webhook service. links is used to look up the
+// links that clicks were recorded for.
+func NewWebhookService(repo repository.WebhookRepository, links repository.Repository, baseURL string) *WebhookService {
+	return &WebhookService{
+		repo:    repo,
+		links:   links,
+		baseURL: strings.TrimSuffix(baseURL, "/"),
+		now:     time.Now,
+	}
+}
+
+// Create registers a webhook for key. Endpoints on localhost or non-public
+// IP addresses are refused. The returned signing secret is shown only once.
+func (s *WebhookService) Create(ctx context.Context, key *domain.APIKey, req domain.WebhookRequest) (*domain.Webhook, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+
+	parsed, err := url.Parse(req.URL)
+	if err != nil || (parsed.Scheme != "http" && parsed.Scheme != "https") || parsed.Host == "" {
+		return nil, fmt.Errorf("%w: url must be an absolute http or https url", ErrInvalidWebhook)
+	}
+	if len(req.URL) > MaxURLLength {
+		return nil, fmt.Errorf("%w: url exceeds maximum length", ErrInvalidWebhook)
+	}
+	if err := webhook.CheckHost(parsed.Hostname()); err != nil {
+		return nil, fmt.Errorf("%w: url must point to a public host", ErrInvalidWebhook)
+	}
+
+	events := []string{}
+	seen := make(map[string]bool)
+	for _, e := range req.Events {
+		if !isLinkEvent(e) {
+			return nil, fmt.Errorf("%w: unknown event %q", ErrInvalidWebhook, e)
+		}
+		if !seen[e] {
+			seen[e] = true
+			events = append(events, e)
+		}
+	}
+
+	buf := make([]byte, keyBytes)
+	if _, err := rand.Read(buf); err != nil {
+		return nil, fmt.Errorf("generate webhook secret: %w", err)
+	}
+	secret := WebhookSecretPrefix + hex.EncodeToString(buf)
+
+	return s.repo.CreateWebhook(ctx, key.ID, req.URL, events, secret)
+}
+
+// List returns the webhooks of key, or every webhook for admin keys. Secrets
+// are not included.
+func (s *WebhookService) List(ctx context.Context, key *domain.APIKey) (*domain.WebhookList, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+
+	var ownerID int64
+	if !key.Admin {
+		ownerID = key.ID
+	}
+	hooks, err := s.repo.ListWebhooks(ctx, ownerID)
+	if err != nil {
+		return nil, err
+	}
+	for i := range hooks {
+		hooks[i].Secret = ""
+	}
+	return &domain.WebhookList{Webhooks: hooks}, nil
+}
+
+// Delete removes a webhook owned by key. Pending deliveries are dropped.
+func (s *WebhookService) Delete(ctx context.Context, key *domain.APIKey, id int64) error {
+	if _, err := s.ownedWebhook(ctx, key, id); err != nil {
+		return err
+	}
+	return s.repo.DeleteWebhook(ctx, id)
+}
+
+// DeadLetters returns the deliveries to a webhook owned by key that were
+// abandoned after too many failed attempts.
+func (s *WebhookService) DeadLetters(ctx context.Context, key *domain.APIKey, id int64) (*domain.DeadLetterList, error) {
+	if _, err := s.ownedWebhook(ctx, key, id); err != nil {
+		return nil, err
+	}
+
+	letters, err := s.repo.ListDeadLetters(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &domain.DeadLetterList{WebhookID: id, DeadLetters: letters}, nil
+}
+
+// ownedWebhook looks up a webhook on behalf of key. Webhooks of other keys
+// are reported as ErrWebhookNotFound.
+func (s *WebhookService) ownedWebhook(ctx context.Context, key *domain.APIKey, id int64) (*domain.Webhook, error) {
+	if key == nil {
+		return nil, ErrUnauthorized
+	}
+	hook, err := s.repo.GetWebhook(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if !key.CanManage(hook.OwnerID) {
+		return nil, ErrWebhookNotFound
+	}
+	return hook, nil
+}
+
+// LinkCreated enqueues a link.created event.
+func (s *WebhookService) LinkCreated(link *domain.URL) {
+	s.notify(newEventID(), domain.EventLinkCreated, link, s.linkData(link))
+}
+
+// LinkDeleted enqueues a link.deleted event.
+func (s *WebhookService) LinkDeleted(link *domain.URL) {
+	s.notify(newEventID(), domain.EventLinkDeleted, link, s.linkData(link))
+}
+
+// LinkExpired enqueues a link.expired event. Expiry is noticed when an
+// expired link is requested or by the periodic expiry sweep, and URLService
+// reports it once per link. The event ID is derived from the link all the
+// same, so a repeat is never delivered twice.
+func (s *WebhookService) LinkExpired(link *domain.URL) {
+	data := s.linkData(link)
+	data.Reason = "max_clicks"
+	if link.ExpiresAt != nil && !s.now().Before(*link.ExpiresAt) {
+		data.Reason = "expires_at"
+	}
+	s.notify(fmt.Sprintf("evt_expired_%d", link.ID), domain.EventLinkExpired, link, data)
+}
+
+// ClicksRecorded enqueues one link.clicked event per link in a batch of
+// recorded clicks. Batches made up only of bot clicks are not reported.
+func (s *WebhookService) ClicksRecorded(batch map[string][]domain.Click) {
+	ctx := context.Background()
+	for code, clicks := range batch {
+		data := domain.LinkEventData{}
+		for _, c := range clicks {
+			if c.Bot {
+				data.BotClicks++
+				continue
+			}
+			data.Clicks++
+			at := c.ClickedAt
+			if data.FirstClickAt == nil || at.Before(*data.FirstClickAt) {
+				data.FirstClickAt = &at
+			}
+			if data.LastClickAt == nil || at.After(*data.LastClickAt) {
+				data.LastClickAt = &at
+			}
+		}
+		if data.Clicks == 0 {
+			continue
+		}
+
+		link, err := s.links.GetByCode(ctx, code)
+		if errors.Is(err, repository.ErrNotFound) {
+			continue
+		}
+		if err != nil {
+			log.Printf("error loading %s for webhooks: %v", code, err)
+			continue
+		}
+
+		linkData := s.linkData(link)
+		data.Code, data.ShortURL, data.OriginalURL = linkData.Code, linkData.ShortURL, linkData.OriginalURL
+		s.notify(newEventID(), domain.EventLinkClicked, link, data)
+	}
+}
+
+// notify stores an event for every webhook subscribed to it. Failures are
+// logged rather than returned, so that webhooks never fail the request
+// that triggered them. The change has already been made by then, so the
+// event is stored even if that request has been canceled.
+func (s *WebhookService) notify(id, event string, link *domain.URL, data domain.LinkEventData) {
+	ctx := context.Background()
+	hooks, err := s.repo.SubscribedWebhooks(ctx, link.OwnerID, event)
+	if err != nil {
+		log.Printf("error finding webhooks for %s: %v", event, err)
+		return
+	}
+	if len(hooks) == 0 {
+		return
+	}
+
+	evt := &domain.WebhookEvent{ID: id, Type: event, CreatedAt: s.now().UTC(), Data: data}
+	payload, err := json.Marshal(evt)
+	if err != nil {
+		log.Printf("error encoding %s event: %v", event, err)
+		return
+	}
+
+	ids := make([]int64, len(hooks))
+	for i, h := range hooks {
+		ids[i] = h.ID
+	}
+	if _, err := s.repo.EnqueueWebhookEvent(ctx, evt, payload, ids); err != nil {
+		log.Printf("error enqueueing %s event for %s: %v", event, link.Code, err)
+	}
+}
+
+func (s *WebhookService) linkData(link *domain.URL) domain.LinkEventData {
+	return domain.LinkEventData{
+		Code:        link.Code,
+		ShortURL:    s.baseURL + "/" + link.Code,
+		OriginalURL: link.Original,
+	}
+}
+
+func isLinkEvent(event string) bool {
+	for _, e := range domain.LinkEvents {
+		if e == event {
+			return true
+		}
+	}
+	return false
+}
+
+// newEventID returns a random webhook event ID.
+func newEventID() string {
+	buf := make([]byte, 12)
+	_, _ = rand.Read(buf)
+	return "evt_" + hex.EncodeToString(buf)
+}
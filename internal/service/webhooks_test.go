@@ -0,0 +1,361 @@
+package service
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+	"github.com/devaloi/shrink/internal/repository"
+)
+
+type mockWebhookRepo struct {
+	hooks  map[int64]*domain.Webhook
+	events map[string]bool
+	sent   []domain.WebhookEvent
+	nextID int64
+
+	// lookups counts SubscribedWebhooks calls by event.
+	lookups map[string]int
+}
+
+func newMockWebhookRepo() *mockWebhookRepo {
+	return &mockWebhookRepo{
+		hooks:   make(map[int64]*domain.Webhook),
+		events:  make(map[string]bool),
+		lookups: make(map[string]int),
+	}
+}
+
+func (m *mockWebhookRepo) CreateWebhook(_ context.Context, ownerID int64, url string, events []string, secret string) (*domain.Webhook, error) {
+	m.nextID++
+	hook := &domain.Webhook{ID: m.nextID, OwnerID: ownerID, URL: url, Events: events, Secret: secret}
+	m.hooks[hook.ID] = hook
+	copied := *hook
+	return &copied, nil
+}
+
+func (m *mockWebhookRepo) GetWebhook(_ context.Context, id int64) (*domain.Webhook, error) {
+	hook, ok := m.hooks[id]
+	if !ok {
+		return nil, repository.ErrWebhookNotFound
+	}
+	copied := *hook
+	return &copied, nil
+}
+
+func (m *mockWebhookRepo) ListWebhooks(_ context.Context, ownerID int64) ([]domain.Webhook, error) {
+	hooks := []domain.Webhook{}
+	for id := int64(1); id <= m.nextID; id++ {
+		if hook, ok := m.hooks[id]; ok && (ownerID == 0 || hook.OwnerID == ownerID) {
+			hooks = append(hooks, *hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *mockWebhookRepo) DeleteWebhook(_ context.Context, id int64) error {
+	if _, ok := m.hooks[id]; !ok {
+		return repository.ErrWebhookNotFound
+	}
+	delete(m.hooks, id)
+	return nil
+}
+
+// SubscribedWebhooks treats key 1 as the only admin, like adminKey.
+func (m *mockWebhookRepo) SubscribedWebhooks(_ context.Context, linkOwnerID int64, event string) ([]domain.Webhook, error) {
+	m.lookups[event]++
+	var hooks []domain.Webhook
+	for id := int64(1); id <= m.nextID; id++ {
+		hook, ok := m.hooks[id]
+		if ok && (hook.OwnerID == adminKey.ID || hook.OwnerID == linkOwnerID) && hook.Subscribed(event) {
+			hooks = append(hooks, *hook)
+		}
+	}
+	return hooks, nil
+}
+
+func (m *mockWebhookRepo) EnqueueWebhookEvent(_ context.Context, event *domain.WebhookEvent, payload []byte, webhookIDs []int64) (bool, error) {
+	if m.events[event.ID] {
+		return false, nil
+	}
+	m.events[event.ID] = true
+
+	var decoded domain.WebhookEvent
+	if err := json.Unmarshal(payload, &decoded); err != nil {
+		return false, err
+	}
+	m.sent = append(m.sent, decoded)
+	return true, nil
+}
+
+func (m *mockWebhookRepo) DueWebhookDeliveries(_ context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	return nil, nil
+}
+
+func (m *mockWebhookRepo) MarkWebhookDelivered(_ context.Context, id int64) error { return nil }
+
+func (m *mockWebhookRepo) RetryWebhookDelivery(_ context.Context, id int64, next time.Time, lastErr string) error {
+	return nil
+}
+
+func (m *mockWebhookRepo) DeadLetterWebhookDelivery(_ context.Context, id int64, lastErr string) error {
+	return nil
+}
+
+func (m *mockWebhookRepo) ListDeadLetters(_ context.Context, webhookID int64) ([]domain.DeadLetter, error) {
+	return []domain.DeadLetter{}, nil
+}
+
+func (m *mockWebhookRepo) types() []string {
+	var types []string
+	for _, e := range m.sent {
+		types = append(types, e.Type)
+	}
+	return types
+}
+
+func TestWebhookService_Create(t *testing.T) {
+	svc := NewWebhookService(newMockWebhookRepo(), newMockRepo(), "http://localhost:8080")
+
+	hook, err := svc.Create(context.Background(), aliceKey, domain.WebhookRequest{
+		URL:    "https://crm.example.com/hook",
+		Events: []string{domain.EventLinkClicked, domain.EventLinkClicked},
+	})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+	if hook.OwnerID != aliceKey.ID || !strings.HasPrefix(hook.Secret, WebhookSecretPrefix) {
+		t.Errorf("unexpected webhook: %+v", hook)
+	}
+	if len(hook.Events) != 1 {
+		t.Errorf("expected duplicate events to collapse, got %v", hook.Events)
+	}
+
+	tests := []struct {
+		name string
+		key  *domain.APIKey
+		req  domain.WebhookRequest
+		want error
+	}{
+		{"anonymous", nil, domain.WebhookRequest{URL: "https://example.com"}, ErrUnauthorized},
+		{"relative url", aliceKey, domain.WebhookRequest{URL: "/hook"}, ErrInvalidWebhook},
+		{"ftp url", aliceKey, domain.WebhookRequest{URL: "ftp://example.com/hook"}, ErrInvalidWebhook},
+		{"loopback url", aliceKey, domain.WebhookRequest{URL: "http://127.0.0.1:8080/hook"}, ErrInvalidWebhook},
+		{"localhost url", aliceKey, domain.WebhookRequest{URL: "http://localhost/hook"}, ErrInvalidWebhook},
+		{"private url", aliceKey, domain.WebhookRequest{URL: "https://10.0.0.5/hook"}, ErrInvalidWebhook},
+		{"metadata url", aliceKey, domain.WebhookRequest{URL: "http://169.254.169.254/latest/meta-data"}, ErrInvalidWebhook},
+		{"mapped loopback url", aliceKey, domain.WebhookRequest{URL: "http://[::ffff:127.0.0.1]/hook"}, ErrInvalidWebhook},
+		{"unknown event", aliceKey, domain.WebhookRequest{URL: "https://example.com", Events: []string{"link.renamed"}}, ErrInvalidWebhook},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := svc.Create(context.Background(), tt.key, tt.req); !errors.Is(err, tt.want) {
+				t.Errorf("expected %v, got %v", tt.want, err)
+			}
+		})
+	}
+}
+
+func TestWebhookService_Ownership(t *testing.T) {
+	svc := NewWebhookService(newMockWebhookRepo(), newMockRepo(), "http://localhost:8080")
+
+	hook, err := svc.Create(context.Background(), aliceKey, domain.WebhookRequest{URL: "https://crm.example.com/hook"})
+	if err != nil {
+		t.Fatalf("create: %v", err)
+	}
+
+	list, err := svc.List(context.Background(), aliceKey)
+	if err != nil {
+		t.Fatalf("list: %v", err)
+	}
+	if len(list.Webhooks) != 1 || list.Webhooks[0].Secret != "" {
+		t.Errorf("expected one webhook without its secret, got %+v", list.Webhooks)
+	}
+	if list, _ := svc.List(context.Background(), bobKey); len(list.Webhooks) != 0 {
+		t.Errorf("expected bob to see no webhooks, got %d", len(list.Webhooks))
+	}
+
+	if err := svc.Delete(context.Background(), bobKey, hook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound for another key, got %v", err)
+	}
+	if _, err := svc.DeadLetters(context.Background(), bobKey, hook.ID); !errors.Is(err, ErrWebhookNotFound) {
+		t.Errorf("expected ErrWebhookNotFound for another key, got %v", err)
+	}
+	if err := svc.Delete(context.Background(), adminKey, hook.ID); err != nil {
+		t.Errorf("expected admin to delete any webhook, got %v", err)
+	}
+}
+
+func TestWebhookService_LinkEvents(t *testing.T) {
+	repo := newMockRepo()
+	hooks := newMockWebhookRepo()
+	webhooks := NewWebhookService(hooks, repo, "http://localhost:8080")
+	svc := NewURLService(repo, "http://localhost:8080", WithNotifier(webhooks))
+
+	if _, err := webhooks.Create(context.Background(), aliceKey, domain.WebhookRequest{URL: "https://crm.example.com/hook"}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	maxClicks := int64(1)
+	req := domain.CreateRequest{URL: "https://example.com"}
+	req.OwnerID = aliceKey.ID
+	req.MaxClicks = &maxClicks
+	resp, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); err != nil {
+		t.Fatalf("resolve: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := svc.Resolve(context.Background(), resp.Code, domain.Visit{}); !errors.Is(err, ErrExpired) {
+			t.Fatalf("expected ErrExpired, got %v", err)
+		}
+	}
+
+	if err := svc.Delete(context.Background(), aliceKey, resp.Code); err != nil {
+		t.Fatalf("delete: %v", err)
+	}
+
+	got := hooks.types()
+	want := []string{domain.EventLinkCreated, domain.EventLinkExpired, domain.EventLinkDeleted}
+	if strings.Join(got, ",") != strings.Join(want, ",") {
+		t.Fatalf("expected events %v, got %v", want, got)
+	}
+
+	created := hooks.sent[0].Data
+	if created.Code != resp.Code || created.ShortURL != resp.ShortURL || created.OriginalURL != "https://example.com" {
+		t.Errorf("unexpected link.created data: %+v", created)
+	}
+	if reason := hooks.sent[1].Data.Reason; reason != "max_clicks" {
+		t.Errorf("expected expiry reason max_clicks, got %q", reason)
+	}
+	if n := hooks.lookups[domain.EventLinkExpired]; n != 1 {
+		t.Errorf("expected expiry to be reported once, got %d webhook lookups", n)
+	}
+
+	// Links of other owners are not reported to alice's webhook.
+	other := domain.CreateRequest{URL: "https://example.org"}
+	other.OwnerID = bobKey.ID
+	if _, err := svc.Shorten(context.Background(), other); err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	if len(hooks.sent) != 3 {
+		t.Errorf("expected no event for bob's link, got %v", hooks.types())
+	}
+}
+
+func TestURLService_SweepExpired(t *testing.T) {
+	repo := newMockRepo()
+	hooks := newMockWebhookRepo()
+	webhooks := NewWebhookService(hooks, repo, "http://localhost:8080")
+	svc := NewURLService(repo, "http://localhost:8080", WithNotifier(webhooks))
+
+	if _, err := webhooks.Create(context.Background(), aliceKey, domain.WebhookRequest{URL: "https://crm.example.com/hook"}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	now := time.Now()
+	expiresAt := now.Add(time.Hour)
+	var codes []string
+	for i := 0; i < 3; i++ {
+		req := domain.CreateRequest{URL: fmt.Sprintf("https://example.com/%d", i)}
+		req.OwnerID = aliceKey.ID
+		req.ExpiresAt = &expiresAt
+		resp, err := svc.Shorten(context.Background(), req)
+		if err != nil {
+			t.Fatalf("shorten: %v", err)
+		}
+		codes = append(codes, resp.Code)
+	}
+	hooks.sent = nil
+
+	if n, err := svc.SweepExpired(context.Background(), now, 10); err != nil || n != 0 {
+		t.Fatalf("expected nothing to sweep before expiry, got %d, %v", n, err)
+	}
+
+	later := expiresAt.Add(time.Minute)
+	webhooks.now = func() time.Time { return later }
+	svc.now = func() time.Time { return later }
+	if n, err := svc.SweepExpired(context.Background(), later, 2); err != nil || n != 2 {
+		t.Fatalf("expected a full batch of 2, got %d, %v", n, err)
+	}
+	if n, err := svc.SweepExpired(context.Background(), later, 2); err != nil || n != 1 {
+		t.Fatalf("expected the last link, got %d, %v", n, err)
+	}
+	if n, err := svc.SweepExpired(context.Background(), later, 2); err != nil || n != 0 {
+		t.Fatalf("expected every link announced, got %d, %v", n, err)
+	}
+
+	if len(hooks.sent) != len(codes) {
+		t.Fatalf("expected %d link.expired events, got %v", len(codes), hooks.types())
+	}
+	for i, e := range hooks.sent {
+		if e.Type != domain.EventLinkExpired || e.Data.Code != codes[i] || e.Data.Reason != "expires_at" {
+			t.Errorf("event %d: unexpected %s %+v", i, e.Type, e.Data)
+		}
+	}
+
+	// A request for an announced link does not announce it again.
+	if _, err := svc.Resolve(context.Background(), codes[0], domain.Visit{}); !errors.Is(err, ErrExpired) {
+		t.Fatalf("expected ErrExpired, got %v", err)
+	}
+	if len(hooks.sent) != len(codes) {
+		t.Errorf("expected no further events, got %v", hooks.types())
+	}
+}
+
+func TestWebhookService_ClicksRecorded(t *testing.T) {
+	repo := newMockRepo()
+	hooks := newMockWebhookRepo()
+	webhooks := NewWebhookService(hooks, repo, "http://localhost:8080")
+	svc := NewURLService(repo, "http://localhost:8080")
+
+	if _, err := webhooks.Create(context.Background(), aliceKey, domain.WebhookRequest{
+		URL: "https://crm.example.com/hook", Events: []string{domain.EventLinkClicked},
+	}); err != nil {
+		t.Fatalf("create webhook: %v", err)
+	}
+
+	req := domain.CreateRequest{URL: "https://example.com"}
+	req.OwnerID = aliceKey.ID
+	resp, err := svc.Shorten(context.Background(), req)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+	botsOnly := domain.CreateRequest{URL: "https://example.com/bots"}
+	botsOnly.OwnerID = aliceKey.ID
+	bots, err := svc.Shorten(context.Background(), botsOnly)
+	if err != nil {
+		t.Fatalf("shorten: %v", err)
+	}
+
+	first := time.Date(2026, 3, 1, 9, 0, 0, 0, time.UTC)
+	webhooks.ClicksRecorded(map[string][]domain.Click{
+		resp.Code: {
+			{ClickedAt: first.Add(2 * time.Second)},
+			{ClickedAt: first},
+			{ClickedAt: first.Add(time.Second), Bot: true},
+		},
+		bots.Code: {{ClickedAt: first, Bot: true}},
+		"missing": {{ClickedAt: first}},
+	})
+
+	if len(hooks.sent) != 1 {
+		t.Fatalf("expected one link.clicked event, got %v", hooks.types())
+	}
+	data := hooks.sent[0].Data
+	if data.Code != resp.Code || data.Clicks != 2 || data.BotClicks != 1 {
+		t.Errorf("unexpected link.clicked data: %+v", data)
+	}
+	if !data.FirstClickAt.Equal(first) || !data.LastClickAt.Equal(first.Add(2*time.Second)) {
+		t.Errorf("expected clicks between %v and %v, got %v and %v",
+			first, first.Add(2*time.Second), data.FirstClickAt, data.LastClickAt)
+	}
+}
@@ -0,0 +1,186 @@
+// Package statscache keeps snapshots of global stats in memory and refreshes
+// them from a background goroutine, so /api/stats is answered without
+// querying the database on every request.
+package statscache
+
+import (
+	"context"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// Cache defaults.
+const (
+	DefaultInterval   = time.Minute
+	DefaultMaxEntries = 1000
+)
+
+// idleRefreshes is how many refreshes a snapshot survives without being
+// read before it is dropped.
+const idleRefreshes = 10
+
+// LoadFunc computes a fresh snapshot.
+type LoadFunc func(ctx context.Context) (*domain.StatsSnapshot, error)
+
+// Option configures a Cache.
+type Option func(*Cache)
+
+// WithInterval sets how often snapshots are recomputed.
+func WithInterval(d time.Duration) Option {
+	return func(c *Cache) {
+		c.interval = d
+	}
+}
+
+// WithMaxEntries bounds how many snapshots are kept. Queries beyond it are
+// loaded on every request until idle snapshots are dropped.
+func WithMaxEntries(n int) Option {
+	return func(c *Cache) {
+		c.maxEntries = n
+	}
+}
+
+type entry struct {
+	stats    *domain.StatsSnapshot
+	load     LoadFunc
+	lastRead time.Time
+}
+
+// Cache holds one snapshot per key. A snapshot is loaded on first use and
+// recomputed every interval for as long as it is read.
+type Cache struct {
+	interval   time.Duration
+	maxEntries int
+	now        func() time.Time
+
+	mu      sync.Mutex
+	entries map[string]*entry
+
+	// ctx is canceled by Close to abandon a refresh in flight.
+	ctx    context.Context
+	cancel context.CancelFunc
+	stop   chan struct{}
+	done   chan struct{}
+}
+
+// New creates a Cache and starts its refresh loop.
+func New(opts ...Option) *Cache {
+	c := &Cache{
+		interval:   DefaultInterval,
+		maxEntries: DefaultMaxEntries,
+		now:        time.Now,
+		entries:    make(map[string]*entry),
+		stop:       make(chan struct{}),
+		done:       make(chan struct{}),
+	}
+	c.ctx, c.cancel = context.WithCancel(context.Background())
+	for _, opt := range opts {
+		opt(c)
+	}
+
+	go c.run()
+	return c
+}
+
+// Get returns the snapshot stored under key, calling load with ctx to
+// compute it if there is none yet. Later refreshes call load with a context
+// of the cache's own. The returned snapshot is shared and must not be
+// modified.
+func (c *Cache) Get(ctx context.Context, key string, load LoadFunc) (*domain.StatsSnapshot, error) {
+	c.mu.Lock()
+	if e, ok := c.entries[key]; ok {
+		e.lastRead = c.now()
+		stats := e.stats
+		c.mu.Unlock()
+		return stats, nil
+	}
+	c.mu.Unlock()
+
+	stats, err := load(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if e, ok := c.entries[key]; ok {
+		// Loaded concurrently; keep the first so readers agree.
+		e.lastRead = c.now()
+		return e.stats, nil
+	}
+	if len(c.entries) < c.maxEntries {
+		c.entries[key] = &entry{stats: stats, load: load, lastRead: c.now()}
+	}
+	return stats, nil
+}
+
+// Close stops the refresh loop, abandoning the snapshot being recomputed,
+// if any, and waits for it or until ctx is done.
+func (c *Cache) Close(ctx context.Context) error {
+	select {
+	case <-c.stop:
+	default:
+		close(c.stop)
+		c.cancel()
+	}
+
+	select {
+	case <-c.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (c *Cache) run() {
+	defer close(c.done)
+
+	ticker := time.NewTicker(c.interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-c.stop:
+			return
+		case <-ticker.C:
+			c.refresh()
+		}
+	}
+}
+
+// refresh drops idle snapshots and recomputes the rest. A snapshot that
+// fails to load keeps its previous value, which its GeneratedAt shows.
+func (c *Cache) refresh() {
+	idleSince := c.now().Add(-idleRefreshes * c.interval)
+
+	c.mu.Lock()
+	due := make(map[string]*entry, len(c.entries))
+	for key, e := range c.entries {
+		if e.lastRead.Before(idleSince) {
+			delete(c.entries, key)
+			continue
+		}
+		due[key] = e
+	}
+	c.mu.Unlock()
+
+	for key, e := range due {
+		select {
+		case <-c.stop:
+			return
+		default:
+		}
+
+		stats, err := e.load(c.ctx)
+		if err != nil {
+			log.Printf("error refreshing stats %s: %v", key, err)
+			continue
+		}
+		c.mu.Lock()
+		e.stats = stats
+		c.mu.Unlock()
+	}
+}
@@ -0,0 +1,178 @@
+package statscache
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// counter is a LoadFunc source that reports how often it was called.
+type counter struct {
+	mu    sync.Mutex
+	calls int64
+	err   error
+}
+
+func (c *counter) load(context.Context) (*domain.StatsSnapshot, error) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	c.calls++
+	if c.err != nil {
+		return nil, c.err
+	}
+	return &domain.StatsSnapshot{TotalURLs: c.calls}, nil
+}
+
+func (c *counter) count() int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.calls
+}
+
+// newTestCache returns a Cache whose refresh loop is not running, so tests
+// drive refresh directly.
+func newTestCache(now *time.Time) *Cache {
+	return &Cache{
+		interval:   time.Minute,
+		maxEntries: DefaultMaxEntries,
+		now:        func() time.Time { return *now },
+		entries:    make(map[string]*entry),
+		ctx:        context.Background(),
+		stop:       make(chan struct{}),
+	}
+}
+
+func TestCache_ServesSnapshot(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(&now)
+	src := &counter{}
+
+	for i := 0; i < 3; i++ {
+		stats, err := c.Get(context.Background(), "all", src.load)
+		if err != nil {
+			t.Fatalf("get: %v", err)
+		}
+		if stats.TotalURLs != 1 {
+			t.Errorf("expected the first snapshot, got %d", stats.TotalURLs)
+		}
+	}
+	if n := src.count(); n != 1 {
+		t.Errorf("expected 1 load, got %d", n)
+	}
+
+	c.refresh()
+
+	stats, err := c.Get(context.Background(), "all", src.load)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stats.TotalURLs != 2 {
+		t.Errorf("expected the refreshed snapshot, got %d", stats.TotalURLs)
+	}
+}
+
+func TestCache_KeepsSnapshotOnError(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(&now)
+	src := &counter{}
+
+	if _, err := c.Get(context.Background(), "all", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	src.err = errors.New("database is locked")
+	c.refresh()
+
+	stats, err := c.Get(context.Background(), "all", src.load)
+	if err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if stats.TotalURLs != 1 {
+		t.Errorf("expected the previous snapshot, got %d", stats.TotalURLs)
+	}
+
+	if _, err := c.Get(context.Background(), "other", src.load); err == nil {
+		t.Error("expected a failed first load to return its error")
+	}
+	if _, ok := c.entries["other"]; ok {
+		t.Error("expected a failed load not to be cached")
+	}
+}
+
+func TestCache_DropsIdleSnapshots(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(&now)
+	src := &counter{}
+
+	if _, err := c.Get(context.Background(), "idle", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	if _, err := c.Get(context.Background(), "busy", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	now = now.Add(idleRefreshes * c.interval)
+	if _, err := c.Get(context.Background(), "busy", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	now = now.Add(time.Second)
+	c.refresh()
+
+	if _, ok := c.entries["idle"]; ok {
+		t.Error("expected the idle snapshot to be dropped")
+	}
+	if _, ok := c.entries["busy"]; !ok {
+		t.Error("expected the busy snapshot to be kept")
+	}
+	if n := src.count(); n != 3 {
+		t.Errorf("expected only the busy snapshot refreshed, got %d loads", n)
+	}
+}
+
+func TestCache_MaxEntries(t *testing.T) {
+	now := time.Date(2026, 3, 1, 12, 0, 0, 0, time.UTC)
+	c := newTestCache(&now)
+	c.maxEntries = 1
+	src := &counter{}
+
+	if _, err := c.Get(context.Background(), "first", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+	for i := 0; i < 2; i++ {
+		if _, err := c.Get(context.Background(), "second", src.load); err != nil {
+			t.Fatalf("get: %v", err)
+		}
+	}
+	if n := src.count(); n != 3 {
+		t.Errorf("expected uncached queries to load every time, got %d loads", n)
+	}
+}
+
+func TestCache_RefreshesInBackground(t *testing.T) {
+	c := New(WithInterval(10 * time.Millisecond))
+	src := &counter{}
+
+	if _, err := c.Get(context.Background(), "all", src.load); err != nil {
+		t.Fatalf("get: %v", err)
+	}
+
+	deadline := time.Now().Add(time.Second)
+	for src.count() < 3 {
+		if time.Now().After(deadline) {
+			t.Fatalf("expected background refreshes, got %d loads", src.count())
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if err := c.Close(context.Background()); err != nil {
+		t.Fatalf("second close: %v", err)
+	}
+}
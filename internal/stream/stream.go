@@ -0,0 +1,104 @@
+// Package stream fans live clicks out to subscribers such as Server-Sent
+// Events connections.
+package stream
+
+import (
+	"sync"
+	"sync/atomic"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// DefaultBuffer is how many clicks a subscription holds before further
+// clicks are dropped for it.
+const DefaultBuffer = 64
+
+// Broker delivers published clicks to every subscription whose filter
+// accepts them. Publishing never blocks: a subscriber that falls behind
+// misses clicks rather than slowing down redirects.
+type Broker struct {
+	mu     sync.RWMutex
+	subs   map[*Subscription]struct{}
+	closed bool
+}
+
+// NewBroker creates an empty broker.
+func NewBroker() *Broker {
+	return &Broker{subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the clicks accepted by its filter until it is
+// closed.
+type Subscription struct {
+	broker  *Broker
+	filter  func(domain.LiveClick) bool
+	ch      chan domain.LiveClick
+	once    sync.Once
+	dropped atomic.Int64
+}
+
+// Subscribe registers a subscription for the clicks filter accepts. If the
+// broker is closed, the subscription's channel is already closed.
+func (b *Broker) Subscribe(filter func(domain.LiveClick) bool) *Subscription {
+	sub := &Subscription{broker: b, filter: filter, ch: make(chan domain.LiveClick, DefaultBuffer)}
+
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if b.closed {
+		sub.once.Do(func() { close(sub.ch) })
+		return sub
+	}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// Publish offers click to every subscription.
+func (b *Broker) Publish(click domain.LiveClick) {
+	b.mu.RLock()
+	defer b.mu.RUnlock()
+
+	for sub := range b.subs {
+		if !sub.filter(click) {
+			continue
+		}
+		select {
+		case sub.ch <- click:
+		default:
+			sub.dropped.Add(1)
+		}
+	}
+}
+
+// Close ends every subscription and refuses new ones, so that streaming
+// handlers return when the server shuts down.
+func (b *Broker) Close() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.closed = true
+	for sub := range b.subs {
+		delete(b.subs, sub)
+		sub.once.Do(func() { close(sub.ch) })
+	}
+}
+
+// Clicks returns the channel clicks are delivered on. It is closed when the
+// subscription or the broker is closed.
+func (s *Subscription) Clicks() <-chan domain.LiveClick {
+	return s.ch
+}
+
+// Dropped returns how many clicks were dropped because the subscriber was
+// not keeping up.
+func (s *Subscription) Dropped() int64 {
+	return s.dropped.Load()
+}
+
+// Close unregisters the subscription.
+func (s *Subscription) Close() {
+	s.broker.mu.Lock()
+	defer s.broker.mu.Unlock()
+
+	delete(s.broker.subs, s)
+	s.once.Do(func() { close(s.ch) })
+}
@@ -0,0 +1,64 @@
+package stream
+
+import (
+	"testing"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+func TestBroker_PublishFilters(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(func(c domain.LiveClick) bool { return c.Code == "abc" })
+	defer sub.Close()
+
+	b.Publish(domain.LiveClick{Code: "xyz"})
+	b.Publish(domain.LiveClick{Code: "abc"})
+
+	select {
+	case c := <-sub.Clicks():
+		if c.Code != "abc" {
+			t.Errorf("expected click for abc, got %s", c.Code)
+		}
+	default:
+		t.Fatal("expected a click")
+	}
+	select {
+	case c := <-sub.Clicks():
+		t.Errorf("expected no further clicks, got %+v", c)
+	default:
+	}
+}
+
+func TestBroker_DropsForSlowSubscriber(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(func(domain.LiveClick) bool { return true })
+	defer sub.Close()
+
+	for i := 0; i < DefaultBuffer+3; i++ {
+		b.Publish(domain.LiveClick{Code: "abc"})
+	}
+
+	if got := sub.Dropped(); got != 3 {
+		t.Errorf("expected 3 dropped clicks, got %d", got)
+	}
+	if got := len(sub.Clicks()); got != DefaultBuffer {
+		t.Errorf("expected %d buffered clicks, got %d", DefaultBuffer, got)
+	}
+}
+
+func TestBroker_Close(t *testing.T) {
+	b := NewBroker()
+	sub := b.Subscribe(func(domain.LiveClick) bool { return true })
+
+	b.Close()
+	if _, ok := <-sub.Clicks(); ok {
+		t.Error("expected the subscription to be closed with the broker")
+	}
+	sub.Close() // closing again is harmless
+
+	late := b.Subscribe(func(domain.LiveClick) bool { return true })
+	if _, ok := <-late.Clicks(); ok {
+		t.Error("expected a subscription to a closed broker to be closed")
+	}
+	b.Publish(domain.LiveClick{Code: "abc"})
+}
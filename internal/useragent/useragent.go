@@ -0,0 +1,115 @@
+// Package useragent classifies HTTP User-Agent strings for click analytics.
+package useragent
+
+import "strings"
+
+// Class is a coarse category of the client that sent a request.
+type Class string
+
+// Client classes reported by Classify.
+const (
+	Desktop Class = "desktop"
+	Mobile  Class = "mobile"
+	Tablet  Class = "tablet"
+	Bot     Class = "bot"
+	Unknown Class = "unknown"
+)
+
+// Other is reported for operating systems and browsers that are not recognized.
+const Other = "Other"
+
+// Agent is what Parse could tell about a client.
+type Agent struct {
+	Class   Class
+	OS      string
+	Browser string
+}
+
+// botTokens are lowercase substrings that identify automated clients:
+// crawlers, HTTP libraries and the link unfurlers of chat and social apps,
+// most of which fetch a link as soon as it is posted.
+var botTokens = []string{
+	"bot", "crawler", "spider", "slurp", "curl", "wget", "python-requests", "go-http-client",
+	"facebookexternalhit", "slack-imgproxy", "whatsapp", "skypeuripreview", "preview",
+	"embedly", "iframely", "vkshare", "headlesschrome", "lighthouse",
+}
+
+// rule maps a lowercase User-Agent token to a family name. Rules are tried
+// in order, so more specific tokens must come first: Android agents also
+// mention Linux, iOS agents mention Mac OS X and most browsers claim to be
+// Safari.
+type rule struct {
+	token, name string
+}
+
+var osRules = []rule{
+	{"windows", "Windows"},
+	{"iphone", "iOS"},
+	{"ipad", "iOS"},
+	{"android", "Android"},
+	{"cros", "ChromeOS"},
+	{"mac os x", "macOS"},
+	{"linux", "Linux"},
+}
+
+var browserRules = []rule{
+	{"edg/", "Edge"},
+	{"edgios/", "Edge"},
+	{"opr/", "Opera"},
+	{"samsungbrowser/", "Samsung Internet"},
+	{"firefox/", "Firefox"},
+	{"fxios/", "Firefox"},
+	{"crios/", "Chrome"},
+	{"chrome/", "Chrome"},
+	{"safari/", "Safari"},
+}
+
+// Parse returns the class, operating system and browser family of the client
+// identified by ua. Matching is a best-effort substring check; unrecognized
+// values are reported as Unknown or Other.
+func Parse(ua string) Agent {
+	lower := strings.ToLower(ua)
+	return Agent{
+		Class:   classify(lower),
+		OS:      match(lower, osRules),
+		Browser: match(lower, browserRules),
+	}
+}
+
+// Classify returns the class of the client identified by ua.
+func Classify(ua string) Class {
+	return classify(strings.ToLower(ua))
+}
+
+func classify(ua string) Class {
+	if ua == "" {
+		return Unknown
+	}
+
+	for _, token := range botTokens {
+		if strings.Contains(ua, token) {
+			return Bot
+		}
+	}
+
+	switch {
+	case strings.Contains(ua, "ipad") || strings.Contains(ua, "tablet") ||
+		(strings.Contains(ua, "android") && !strings.Contains(ua, "mobile")):
+		return Tablet
+	case strings.Contains(ua, "mobi") || strings.Contains(ua, "iphone"):
+		return Mobile
+	case strings.Contains(ua, "windows") || strings.Contains(ua, "macintosh") ||
+		strings.Contains(ua, "x11") || strings.Contains(ua, "cros"):
+		return Desktop
+	}
+	return Unknown
+}
+
+func match(ua string, rules []rule) string {
+	for _, r := range rules {
+		if strings.Contains(ua, r.token) {
+			return r.name
+		}
+	}
+	return Other
+}
@@ -0,0 +1,93 @@
+package webhook
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/netip"
+	"strings"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateTarget is returned for webhook endpoints on loopback, private,
+// link-local or otherwise non-public addresses, which must not be reachable
+// through webhooks.
+var ErrPrivateTarget = errors.New("webhook target is not a public address")
+
+// dialTimeout bounds how long connecting to an endpoint may take.
+const dialTimeout = 5 * time.Second
+
+// nonPublic lists the special-purpose IPv4 ranges that net/netip still
+// considers global unicast.
+var nonPublic = []netip.Prefix{
+	netip.MustParsePrefix("0.0.0.0/8"),
+	netip.MustParsePrefix("100.64.0.0/10"),
+	netip.MustParsePrefix("192.0.0.0/24"),
+	netip.MustParsePrefix("198.18.0.0/15"),
+	netip.MustParsePrefix("240.0.0.0/4"),
+}
+
+// IsPublicAddr reports whether ip is a public unicast address.
+func IsPublicAddr(ip netip.Addr) bool {
+	ip = ip.Unmap()
+	if !ip.IsGlobalUnicast() || ip.IsPrivate() {
+		return false
+	}
+	for _, p := range nonPublic {
+		if p.Contains(ip) {
+			return false
+		}
+	}
+	return true
+}
+
+// CheckHost returns ErrPrivateTarget if host, the host name or IP address of
+// an endpoint, is known not to be public without resolving it. Names that
+// resolve to private addresses are refused when the worker connects.
+func CheckHost(host string) error {
+	host = strings.TrimSuffix(strings.ToLower(host), ".")
+	if host == "localhost" || strings.HasSuffix(host, ".localhost") {
+		return ErrPrivateTarget
+	}
+	if ip, err := netip.ParseAddr(host); err == nil && !IsPublicAddr(ip) {
+		return ErrPrivateTarget
+	}
+	return nil
+}
+
+// publicOnly is a net.Dialer Control hook that refuses connections to
+// non-public addresses. It runs after name resolution, so it also covers
+// names that resolve, or are rebound, to private addresses.
+func publicOnly(_, address string, _ syscall.RawConn) error {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return err
+	}
+	ip, err := netip.ParseAddr(host)
+	if err != nil || !IsPublicAddr(ip) {
+		return fmt.Errorf("%w: %s", ErrPrivateTarget, host)
+	}
+	return nil
+}
+
+// newClient returns the client deliveries are sent with. control checks
+// each address before connecting; redirects are not followed, so a
+// redirecting endpoint fails like any other non-2xx response. Proxies are
+// not used, since they would hide the address being connected to.
+func newClient(control func(network, address string, c syscall.RawConn) error) *http.Client {
+	dialer := &net.Dialer{Timeout: dialTimeout, Control: control}
+	return &http.Client{
+		Timeout: DefaultTimeout,
+		Transport: &http.Transport{
+			DialContext:         dialer.DialContext,
+			TLSHandshakeTimeout: dialTimeout,
+			MaxIdleConns:        10,
+			IdleConnTimeout:     90 * time.Second,
+		},
+		CheckRedirect: func(*http.Request, []*http.Request) error {
+			return http.ErrUseLastResponse
+		},
+	}
+}
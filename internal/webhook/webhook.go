@@ -0,0 +1,263 @@
+// Package webhook signs link events and delivers them to registered
+// endpoints from a background worker, retrying failures with exponential
+// backoff.
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"log"
+	"math/rand/v2"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+// Delivery request headers.
+const (
+	HeaderEvent     = "X-Shrink-Event"
+	HeaderDelivery  = "X-Shrink-Delivery"
+	HeaderSignature = "X-Shrink-Signature"
+)
+
+// Worker defaults.
+const (
+	DefaultPollInterval   = 5 * time.Second
+	DefaultMaxAttempts    = 8
+	DefaultInitialBackoff = 30 * time.Second
+	DefaultMaxBackoff     = 6 * time.Hour
+	DefaultTimeout        = 10 * time.Second
+
+	// batchSize bounds how many deliveries one poll sends.
+	batchSize = 50
+
+	// maxErrorLength bounds how much of a failure is kept for dead letters.
+	maxErrorLength = 500
+)
+
+// Store is the delivery outbox the worker drains. The worker calls it with
+// a background context, so that the outcome of a delivery already sent is
+// recorded during shutdown too.
+type Store interface {
+	DueWebhookDeliveries(ctx context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error)
+	MarkWebhookDelivered(ctx context.Context, id int64) error
+	RetryWebhookDelivery(ctx context.Context, id int64, next time.Time, lastErr string) error
+	DeadLetterWebhookDelivery(ctx context.Context, id int64, lastErr string) error
+}
+
+// Sign returns the X-Shrink-Signature header value for body sent at t:
+// the Unix timestamp and the hex HMAC-SHA256 of "timestamp.body" under
+// secret. Receivers should recompute the HMAC and reject stale timestamps.
+func Sign(secret string, t time.Time, body []byte) string {
+	ts := strconv.FormatInt(t.Unix(), 10)
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte(ts))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return "t=" + ts + ",v1=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Option configures a Worker.
+type Option func(*Worker)
+
+// WithPollInterval sets how often the worker looks for due deliveries.
+func WithPollInterval(d time.Duration) Option {
+	return func(w *Worker) {
+		w.pollInterval = d
+	}
+}
+
+// WithMaxAttempts sets how many times a delivery is tried before it is
+// dead-lettered.
+func WithMaxAttempts(n int) Option {
+	return func(w *Worker) {
+		w.maxAttempts = n
+	}
+}
+
+// WithBackoff sets the delay before the first retry and the cap the delay
+// doubles up to.
+func WithBackoff(initial, max time.Duration) Option {
+	return func(w *Worker) {
+		w.initialBackoff = initial
+		w.maxBackoff = max
+	}
+}
+
+// WithHTTPClient sets the client used to send deliveries. The default client
+// only connects to public addresses and does not follow redirects; a
+// replacement should do the same.
+func WithHTTPClient(c *http.Client) Option {
+	return func(w *Worker) {
+		w.client = c
+	}
+}
+
+// Worker sends due deliveries from a Store until it is closed.
+type Worker struct {
+	store          Store
+	client         *http.Client
+	pollInterval   time.Duration
+	maxAttempts    int
+	initialBackoff time.Duration
+	maxBackoff     time.Duration
+	now            func() time.Time
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+// New creates a Worker draining store and starts its poll loop.
+func New(store Store, opts ...Option) *Worker {
+	w := &Worker{
+		store:          store,
+		client:         newClient(publicOnly),
+		pollInterval:   DefaultPollInterval,
+		maxAttempts:    DefaultMaxAttempts,
+		initialBackoff: DefaultInitialBackoff,
+		maxBackoff:     DefaultMaxBackoff,
+		now:            time.Now,
+		stop:           make(chan struct{}),
+		done:           make(chan struct{}),
+	}
+	for _, opt := range opts {
+		opt(w)
+	}
+
+	go w.run()
+	return w
+}
+
+// Close stops the worker after the delivery in flight, if any, and waits for
+// it or until ctx is done. Undelivered events stay in the outbox for the next
+// start.
+func (w *Worker) Close(ctx context.Context) error {
+	select {
+	case <-w.stop:
+	default:
+		close(w.stop)
+	}
+
+	select {
+	case <-w.done:
+		return nil
+	case <-ctx.Done():
+		return ctx.Err()
+	}
+}
+
+func (w *Worker) run() {
+	defer close(w.done)
+
+	ticker := time.NewTicker(w.pollInterval)
+	defer ticker.Stop()
+
+	for {
+		w.poll()
+		select {
+		case <-w.stop:
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// poll sends every due delivery, a batch at a time.
+func (w *Worker) poll() {
+	for {
+		deliveries, err := w.store.DueWebhookDeliveries(context.Background(), w.now(), batchSize)
+		if err != nil {
+			log.Printf("error loading webhook deliveries: %v", err)
+			return
+		}
+
+		for _, d := range deliveries {
+			select {
+			case <-w.stop:
+				return
+			default:
+			}
+			w.deliver(d)
+		}
+
+		if len(deliveries) < batchSize {
+			return
+		}
+	}
+}
+
+// deliver sends one delivery and records the outcome.
+func (w *Worker) deliver(d domain.WebhookDelivery) {
+	err := w.send(d)
+	if err == nil {
+		if err := w.store.MarkWebhookDelivered(context.Background(), d.ID); err != nil {
+			log.Printf("error marking webhook delivery %d: %v", d.ID, err)
+		}
+		return
+	}
+
+	msg := err.Error()
+	if len(msg) > maxErrorLength {
+		msg = msg[:maxErrorLength]
+	}
+
+	attempts := d.Attempts + 1
+	if attempts >= w.maxAttempts {
+		log.Printf("webhook delivery %d to %s failed %d times, giving up: %v", d.ID, d.URL, attempts, err)
+		if err := w.store.DeadLetterWebhookDelivery(context.Background(), d.ID, msg); err != nil {
+			log.Printf("error dead-lettering webhook delivery %d: %v", d.ID, err)
+		}
+		return
+	}
+
+	if err := w.store.RetryWebhookDelivery(context.Background(), d.ID, w.now().Add(w.backoff(attempts)), msg); err != nil {
+		log.Printf("error rescheduling webhook delivery %d: %v", d.ID, err)
+	}
+}
+
+// send POSTs the event payload, signed with the webhook's secret. Any
+// response other than 2xx is a failure.
+func (w *Worker) send(d domain.WebhookDelivery) error {
+	req, err := http.NewRequest(http.MethodPost, d.URL, bytes.NewReader(d.Payload))
+	if err != nil {
+		return fmt.Errorf("build request: %w", err)
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "shrink-webhooks/1")
+	req.Header.Set(HeaderEvent, d.EventType)
+	req.Header.Set(HeaderDelivery, d.EventID)
+	req.Header.Set(HeaderSignature, Sign(d.Secret, w.now(), d.Payload))
+
+	resp, err := w.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer func() { _ = resp.Body.Close() }()
+	_, _ = io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return nil
+}
+
+// backoff returns the delay before retry number attempt: the initial backoff
+// doubled per earlier failure, capped, with up to 20% jitter so endpoints
+// recovering from an outage are not hit in lockstep.
+func (w *Worker) backoff(attempt int) time.Duration {
+	d := w.initialBackoff
+	for i := 1; i < attempt && d < w.maxBackoff; i++ {
+		d *= 2
+	}
+	if d > w.maxBackoff {
+		d = w.maxBackoff
+	}
+	return d + time.Duration(rand.Int64N(int64(d)/5+1))
+}
@@ -0,0 +1,251 @@
+package webhook
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/devaloi/shrink/internal/domain"
+)
+
+type fakeStore struct {
+	mu         sync.Mutex
+	pending    map[int64]*domain.WebhookDelivery
+	next       map[int64]time.Time
+	delivered  []int64
+	deadLetter map[int64]string
+}
+
+func newFakeStore(deliveries ...domain.WebhookDelivery) *fakeStore {
+	s := &fakeStore{
+		pending:    make(map[int64]*domain.WebhookDelivery),
+		next:       make(map[int64]time.Time),
+		deadLetter: make(map[int64]string),
+	}
+	for i := range deliveries {
+		d := deliveries[i]
+		s.pending[d.ID] = &d
+	}
+	return s
+}
+
+func (s *fakeStore) DueWebhookDeliveries(_ context.Context, now time.Time, limit int) ([]domain.WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var due []domain.WebhookDelivery
+	for id, d := range s.pending {
+		if !s.next[id].After(now) && len(due) < limit {
+			due = append(due, *d)
+		}
+	}
+	return due, nil
+}
+
+func (s *fakeStore) MarkWebhookDelivered(_ context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	s.delivered = append(s.delivered, id)
+	return nil
+}
+
+func (s *fakeStore) RetryWebhookDelivery(_ context.Context, id int64, next time.Time, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.pending[id].Attempts++
+	s.next[id] = next
+	return nil
+}
+
+func (s *fakeStore) DeadLetterWebhookDelivery(_ context.Context, id int64, lastErr string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.pending, id)
+	s.deadLetter[id] = lastErr
+	return nil
+}
+
+func TestSign(t *testing.T) {
+	body := []byte(`{"type":"link.created"}`)
+	at := time.Unix(1767225600, 0)
+
+	got := Sign("whsec_test", at, body)
+
+	mac := hmac.New(sha256.New, []byte("whsec_test"))
+	mac.Write([]byte("1767225600." + string(body)))
+	want := "t=1767225600,v1=" + hex.EncodeToString(mac.Sum(nil))
+	if got != want {
+		t.Errorf("Sign() = %q, want %q", got, want)
+	}
+}
+
+func TestWorker_Delivers(t *testing.T) {
+	type received struct {
+		event, delivery, signature, body string
+	}
+	got := make(chan received, 1)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		got <- received{r.Header.Get(HeaderEvent), r.Header.Get(HeaderDelivery), r.Header.Get(HeaderSignature), string(body)}
+	}))
+	defer srv.Close()
+
+	store := newFakeStore(domain.WebhookDelivery{
+		ID: 1, URL: srv.URL, Secret: "whsec_test", EventID: "evt_1",
+		EventType: domain.EventLinkCreated, Payload: []byte(`{"id":"evt_1"}`),
+	})
+	w := New(store, WithPollInterval(time.Hour), WithHTTPClient(newClient(nil)))
+	defer func() { _ = w.Close(context.Background()) }()
+
+	select {
+	case r := <-got:
+		if r.event != domain.EventLinkCreated || r.delivery != "evt_1" || r.body != `{"id":"evt_1"}` {
+			t.Errorf("unexpected delivery: %+v", r)
+		}
+		ts, err := strconv.ParseInt(strings.TrimPrefix(strings.Split(r.signature, ",")[0], "t="), 10, 64)
+		if err != nil {
+			t.Fatalf("parse signature timestamp: %v", err)
+		}
+		if r.signature != Sign("whsec_test", time.Unix(ts, 0), []byte(r.body)) {
+			t.Errorf("signature %q does not verify", r.signature)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("expected the delivery to be sent")
+	}
+
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+	if len(store.delivered) != 1 {
+		t.Errorf("expected the delivery to be marked delivered, got %v", store.delivered)
+	}
+}
+
+func TestWorker_RetriesThenDeadLetters(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer srv.Close()
+
+	store := newFakeStore(domain.WebhookDelivery{ID: 1, URL: srv.URL, EventID: "evt_1", Payload: []byte(`{}`)})
+	w := New(store,
+		WithPollInterval(5*time.Millisecond),
+		WithHTTPClient(newClient(nil)),
+		WithMaxAttempts(3),
+		WithBackoff(time.Millisecond, time.Millisecond),
+	)
+
+	deadline := time.Now().Add(2 * time.Second)
+	for time.Now().Before(deadline) {
+		store.mu.Lock()
+		done := len(store.deadLetter) > 0
+		store.mu.Unlock()
+		if done {
+			break
+		}
+		time.Sleep(5 * time.Millisecond)
+	}
+	if err := w.Close(context.Background()); err != nil {
+		t.Fatalf("close: %v", err)
+	}
+
+	if msg, ok := store.deadLetter[1]; !ok || !strings.Contains(msg, "503") {
+		t.Fatalf("expected the delivery to be dead-lettered with the 503, got %q", msg)
+	}
+	if len(store.delivered) != 0 {
+		t.Error("expected no successful delivery")
+	}
+}
+
+func TestWorker_RefusesPrivateTargets(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected no request to reach a loopback endpoint")
+	}))
+	defer srv.Close()
+
+	w := &Worker{client: newClient(publicOnly), now: time.Now}
+	err := w.send(domain.WebhookDelivery{URL: srv.URL, Payload: []byte(`{}`)})
+	if !errors.Is(err, ErrPrivateTarget) {
+		t.Errorf("expected ErrPrivateTarget, got %v", err)
+	}
+}
+
+func TestWorker_RefusesRedirects(t *testing.T) {
+	target := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Error("expected the redirect not to be followed")
+	}))
+	defer target.Close()
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.Redirect(w, r, target.URL, http.StatusTemporaryRedirect)
+	}))
+	defer srv.Close()
+
+	w := &Worker{client: newClient(nil), now: time.Now}
+	err := w.send(domain.WebhookDelivery{URL: srv.URL, Payload: []byte(`{}`)})
+	if err == nil || !strings.Contains(err.Error(), "307") {
+		t.Errorf("expected the redirect to fail the delivery, got %v", err)
+	}
+}
+
+func TestCheckHost(t *testing.T) {
+	tests := []struct {
+		host   string
+		public bool
+	}{
+		{"crm.example.com", true},
+		{"93.184.216.34", true},
+		{"2606:2800:220:1:248:1893:25c8:1946", true},
+		{"localhost", false},
+		{"api.localhost", false},
+		{"127.0.0.1", false},
+		{"10.1.2.3", false},
+		{"172.16.0.1", false},
+		{"192.168.1.1", false},
+		{"169.254.169.254", false},
+		{"100.64.0.1", false},
+		{"0.0.0.0", false},
+		{"::1", false},
+		{"fe80::1", false},
+		{"fd00::1", false},
+		{"::ffff:10.0.0.1", false},
+	}
+	for _, tt := range tests {
+		err := CheckHost(tt.host)
+		if (err == nil) != tt.public {
+			t.Errorf("CheckHost(%q) = %v, want public %v", tt.host, err, tt.public)
+		}
+	}
+}
+
+func TestWorker_Backoff(t *testing.T) {
+	w := &Worker{initialBackoff: time.Minute, maxBackoff: 10 * time.Minute}
+
+	tests := []struct {
+		attempt int
+		want    time.Duration
+	}{
+		{1, time.Minute},
+		{2, 2 * time.Minute},
+		{3, 4 * time.Minute},
+		{4, 8 * time.Minute},
+		{5, 10 * time.Minute},
+		{20, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		got := w.backoff(tt.attempt)
+		if got < tt.want || got > tt.want+tt.want/5 {
+			t.Errorf("backoff(%d) = %v, want %v plus up to 20%% jitter", tt.attempt, got, tt.want)
+		}
+	}
+}
@@ -9,3 +9,8 @@ CREATE TABLE IF NOT EXISTS urls (
 
 CREATE INDEX IF NOT EXISTS idx_urls_code ON urls(code);
 CREATE INDEX IF NOT EXISTS idx_urls_created_at ON urls(created_at);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_urls_created_at;
+DROP INDEX IF EXISTS idx_urls_code;
+DROP TABLE urls;
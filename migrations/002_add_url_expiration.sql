@@ -0,0 +1,9 @@
+-- 002_add_url_expiration.sql
+ALTER TABLE urls ADD COLUMN expires_at DATETIME;
+ALTER TABLE urls ADD COLUMN max_clicks INTEGER;
+ALTER TABLE urls ADD COLUMN fallback_url TEXT NOT NULL DEFAULT '';
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN fallback_url;
+ALTER TABLE urls DROP COLUMN max_clicks;
+ALTER TABLE urls DROP COLUMN expires_at;
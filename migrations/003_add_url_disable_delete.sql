@@ -0,0 +1,7 @@
+-- 003_add_url_disable_delete.sql
+ALTER TABLE urls ADD COLUMN disabled INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN deleted_at DATETIME;
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN deleted_at;
+ALTER TABLE urls DROP COLUMN disabled;
@@ -0,0 +1,14 @@
+-- 004_create_url_revisions.sql
+CREATE TABLE IF NOT EXISTS url_revisions (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    original TEXT NOT NULL,
+    changed_by TEXT NOT NULL DEFAULT '',
+    changed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_url_revisions_url_id ON url_revisions(url_id);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_url_revisions_url_id;
+DROP TABLE url_revisions;
@@ -0,0 +1,11 @@
+-- 005_add_url_host.sql
+-- host is backfilled from original by the application on startup.
+ALTER TABLE urls ADD COLUMN host TEXT NOT NULL DEFAULT '';
+
+CREATE INDEX IF NOT EXISTS idx_urls_host ON urls(host);
+CREATE INDEX IF NOT EXISTS idx_urls_clicks ON urls(clicks, id);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_urls_clicks;
+DROP INDEX IF EXISTS idx_urls_host;
+ALTER TABLE urls DROP COLUMN host;
@@ -0,0 +1,6 @@
+-- 006_add_url_redirect_type.sql
+-- 0 means the server default redirect status.
+ALTER TABLE urls ADD COLUMN redirect_type INTEGER NOT NULL DEFAULT 0;
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN redirect_type;
@@ -0,0 +1,20 @@
+-- 007_create_api_keys.sql
+CREATE TABLE IF NOT EXISTS api_keys (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    name TEXT NOT NULL,
+    key_hash TEXT UNIQUE NOT NULL,
+    prefix TEXT NOT NULL,
+    admin INTEGER NOT NULL DEFAULT 0,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    revoked_at DATETIME
+);
+
+-- NULL owner_id marks links created anonymously.
+ALTER TABLE urls ADD COLUMN owner_id INTEGER REFERENCES api_keys(id);
+
+CREATE INDEX IF NOT EXISTS idx_urls_owner_id ON urls(owner_id);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_urls_owner_id;
+ALTER TABLE urls DROP COLUMN owner_id;
+DROP TABLE api_keys;
@@ -0,0 +1,17 @@
+-- 008_create_clicks.sql
+-- One row per redirect. urls.clicks is kept as a running total of these rows.
+CREATE TABLE IF NOT EXISTS clicks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    clicked_at DATETIME NOT NULL,
+    referrer_host TEXT NOT NULL DEFAULT '',
+    agent_class TEXT NOT NULL DEFAULT '',
+    ip_hash TEXT NOT NULL DEFAULT '',
+    request_id TEXT NOT NULL DEFAULT ''
+);
+
+CREATE INDEX IF NOT EXISTS idx_clicks_url_id_clicked_at ON clicks(url_id, clicked_at);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_clicks_url_id_clicked_at;
+DROP TABLE clicks;
@@ -0,0 +1,8 @@
+-- 009_add_click_agent.sql
+-- Operating system and browser family parsed from the User-Agent header.
+ALTER TABLE clicks ADD COLUMN os TEXT NOT NULL DEFAULT '';
+ALTER TABLE clicks ADD COLUMN browser TEXT NOT NULL DEFAULT '';
+
+-- migrate:down
+ALTER TABLE clicks DROP COLUMN browser;
+ALTER TABLE clicks DROP COLUMN os;
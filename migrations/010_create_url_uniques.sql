@@ -0,0 +1,11 @@
+-- 010_create_url_uniques.sql
+-- One HyperLogLog sketch of visitor hashes per link and UTC day.
+CREATE TABLE IF NOT EXISTS url_uniques (
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    day TEXT NOT NULL,
+    sketch BLOB NOT NULL,
+    PRIMARY KEY (url_id, day)
+);
+
+-- migrate:down
+DROP TABLE url_uniques;
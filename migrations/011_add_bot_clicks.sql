@@ -0,0 +1,9 @@
+-- 011_add_bot_clicks.sql
+-- Clicks from crawlers, link unfurlers and prefetches are kept apart from
+-- human clicks so they do not inflate counts or use up click budgets.
+ALTER TABLE clicks ADD COLUMN is_bot INTEGER NOT NULL DEFAULT 0;
+ALTER TABLE urls ADD COLUMN bot_clicks INTEGER NOT NULL DEFAULT 0;
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN bot_clicks;
+ALTER TABLE clicks DROP COLUMN is_bot;
@@ -0,0 +1,54 @@
+-- 012_create_webhooks.sql
+-- Webhook endpoints registered by API keys, and the outbox their link
+-- events are delivered from. Delivered rows are removed; deliveries that
+-- keep failing move to webhook_dead_letters.
+CREATE TABLE IF NOT EXISTS webhooks (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    owner_id INTEGER NOT NULL REFERENCES api_keys(id),
+    url TEXT NOT NULL,
+    events TEXT NOT NULL DEFAULT '',
+    secret TEXT NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP,
+    deleted_at DATETIME
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhooks_owner_id ON webhooks(owner_id);
+
+CREATE TABLE IF NOT EXISTS webhook_events (
+    id TEXT PRIMARY KEY,
+    type TEXT NOT NULL,
+    payload BLOB NOT NULL,
+    created_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS webhook_deliveries (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+    event_id TEXT NOT NULL REFERENCES webhook_events(id),
+    attempts INTEGER NOT NULL DEFAULT 0,
+    next_attempt_at DATETIME NOT NULL,
+    last_error TEXT NOT NULL DEFAULT '',
+    UNIQUE (webhook_id, event_id)
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_next_attempt_at ON webhook_deliveries(next_attempt_at);
+
+CREATE TABLE IF NOT EXISTS webhook_dead_letters (
+    id INTEGER PRIMARY KEY AUTOINCREMENT,
+    webhook_id INTEGER NOT NULL REFERENCES webhooks(id),
+    event_id TEXT NOT NULL REFERENCES webhook_events(id),
+    attempts INTEGER NOT NULL,
+    last_error TEXT NOT NULL,
+    failed_at DATETIME DEFAULT CURRENT_TIMESTAMP
+);
+
+CREATE INDEX IF NOT EXISTS idx_webhook_dead_letters_webhook_id ON webhook_dead_letters(webhook_id);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_webhook_dead_letters_webhook_id;
+DROP TABLE webhook_dead_letters;
+DROP INDEX IF EXISTS idx_webhook_deliveries_next_attempt_at;
+DROP TABLE webhook_deliveries;
+DROP TABLE webhook_events;
+DROP INDEX IF EXISTS idx_webhooks_owner_id;
+DROP TABLE webhooks;
@@ -0,0 +1,20 @@
+-- 013_create_click_rollups.sql
+-- Daily click counts per link and dimension. The retention job moves raw
+-- clicks older than CLICK_RETENTION_DAYS here and deletes them from clicks.
+CREATE TABLE IF NOT EXISTS click_rollups (
+    url_id INTEGER NOT NULL REFERENCES urls(id),
+    day TEXT NOT NULL,
+    referrer_host TEXT NOT NULL,
+    agent_class TEXT NOT NULL,
+    os TEXT NOT NULL,
+    browser TEXT NOT NULL,
+    is_bot INTEGER NOT NULL,
+    clicks INTEGER NOT NULL,
+    PRIMARY KEY (url_id, day, referrer_host, agent_class, os, browser, is_bot)
+);
+
+CREATE INDEX IF NOT EXISTS idx_clicks_clicked_at ON clicks(clicked_at);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_clicks_clicked_at;
+DROP TABLE click_rollups;
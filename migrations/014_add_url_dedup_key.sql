@@ -0,0 +1,11 @@
+-- 014_add_url_dedup_key.sql
+-- dedup_key is the normalized destination of the link Shorten reuses for
+-- an owner, and '' for every other link. NULL marks rows from before this
+-- migration, which the server fills in on start.
+ALTER TABLE urls ADD COLUMN dedup_key TEXT;
+
+CREATE UNIQUE INDEX IF NOT EXISTS idx_urls_dedup_key ON urls(COALESCE(owner_id, 0), dedup_key) WHERE dedup_key <> '';
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_urls_dedup_key;
+ALTER TABLE urls DROP COLUMN dedup_key;
@@ -0,0 +1,7 @@
+-- 015_add_url_expiry_notified.sql
+-- expiry_notified is set once the link.expired event of a link has been
+-- raised, so later requests for the expired link skip the webhook lookup.
+ALTER TABLE urls ADD COLUMN expiry_notified INTEGER NOT NULL DEFAULT 0;
+
+-- migrate:down
+ALTER TABLE urls DROP COLUMN expiry_notified;
@@ -0,0 +1,8 @@
+-- 016_index_urls_expiry_pending.sql
+-- The expiry sweep looks for live links with an expiry date or a click
+-- budget whose expiry has not been announced yet.
+CREATE INDEX IF NOT EXISTS idx_urls_expiry_pending ON urls(expires_at)
+    WHERE expiry_notified = 0 AND deleted_at IS NULL AND (expires_at IS NOT NULL OR max_clicks IS NOT NULL);
+
+-- migrate:down
+DROP INDEX IF EXISTS idx_urls_expiry_pending;
@@ -0,0 +1,40 @@
+-- 017_create_owner_stats.sql
+-- Running totals behind /api/stats, kept by the repository in the same
+-- transactions that create and delete links and record clicks, so stats
+-- never scan urls or clicks. owner_id 0 holds links without an owner.
+-- owner_stats counts the live links of each owner and their human clicks;
+-- owner_stat_buckets counts the links created and the raw human clicks
+-- recorded per owner in 15-minute buckets, keyed by their Unix start.
+CREATE TABLE IF NOT EXISTS owner_stats (
+    owner_id INTEGER PRIMARY KEY,
+    urls INTEGER NOT NULL DEFAULT 0,
+    clicks INTEGER NOT NULL DEFAULT 0
+);
+
+CREATE TABLE IF NOT EXISTS owner_stat_buckets (
+    bucket INTEGER NOT NULL,
+    owner_id INTEGER NOT NULL,
+    created INTEGER NOT NULL DEFAULT 0,
+    clicks INTEGER NOT NULL DEFAULT 0,
+    PRIMARY KEY (bucket, owner_id)
+) WITHOUT ROWID;
+
+INSERT INTO owner_stats (owner_id, urls, clicks)
+    SELECT COALESCE(owner_id, 0), COUNT(*), SUM(clicks) FROM urls
+    WHERE deleted_at IS NULL GROUP BY 1;
+
+INSERT INTO owner_stat_buckets (bucket, owner_id, created, clicks)
+    SELECT bucket, owner_id, SUM(created), SUM(clicks) FROM (
+        SELECT CAST(strftime('%s', created_at) AS INTEGER) / 900 * 900 AS bucket,
+            COALESCE(owner_id, 0) AS owner_id, 1 AS created, 0 AS clicks
+        FROM urls WHERE deleted_at IS NULL
+        UNION ALL
+        SELECT CAST(strftime('%s', c.clicked_at) AS INTEGER) / 900 * 900,
+            COALESCE(u.owner_id, 0), 0, 1
+        FROM clicks c JOIN urls u ON u.id = c.url_id
+        WHERE u.deleted_at IS NULL AND c.is_bot = 0
+    ) GROUP BY bucket, owner_id;
+
+-- migrate:down
+DROP TABLE owner_stat_buckets;
+DROP TABLE owner_stats;
@@ -0,0 +1,13 @@
+// Package migrations embeds the versioned SQL schema migrations.
+//
+// Each file is named NNN_description.sql. The statements before a
+// "-- migrate:down" line apply the migration; the statements after it
+// revert it.
+package migrations
+
+import "embed"
+
+// FS holds every migration file.
+//
+//go:embed *.sql
+var FS embed.FS